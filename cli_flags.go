@@ -6,7 +6,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/peterbourgon/ff/v3"
@@ -25,7 +28,16 @@ const (
 	defaultProbabilisticInterval  = 1 * time.Minute
 	defaultArgSendErrorFrames     = false
 	defaultOffCPUThreshold        = 0
+	defaultContentionThreshold    = 0
+	defaultRunQueueThreshold      = 0
 	defaultEnvVarsValue           = ""
+	defaultOTLPProtocol           = "grpc"
+	defaultDemangle               = "full"
+	defaultSpoolMaxAge            = 24 * time.Hour
+	defaultSpoolMaxSize           = 256
+	defaultSymbolizeNativeCache   = 64
+	defaultRecordDuration         = 30 * time.Second
+	defaultRecordOutput           = "profile.pb.gz"
 
 	// This is the X in 2^(n + x) where n is the default hardcoded map size value
 	defaultArgMapScaleFactor = 0
@@ -55,7 +67,21 @@ var (
 		tracer.ProbabilisticThresholdMax-1, tracer.ProbabilisticThresholdMax-1)
 	probabilisticIntervalHelp = "Time interval for which probabilistic profiling will be " +
 		"enabled or disabled."
-	pprofHelp             = "Listening address (e.g. localhost:6060) to serve pprof information."
+	otlpHeadersHelp = "Comma separated list of key=value pairs that are added as headers " +
+		"to OTLP/HTTP requests."
+	otlpProtocolHelp = "Protocol used to send profiles to the collection agent. " +
+		"Valid values are grpc, http/protobuf and http/json."
+	pprofHelp          = "Listening address (e.g. localhost:6060) to serve pprof information."
+	pprofOutputDirHelp = "Write profiles as gzip compressed pprof files to this directory. " +
+		"Profiles are only sent to a collection agent if collection-agent is set as well."
+	pprofOutputMaxFilesHelp = "Maximum number of pprof files to keep in pprof-output-dir. " +
+		"The oldest files are removed first. 0 disables the limit."
+	pprofOutputMaxSizeHelp = "Maximum total size (in MiB) of the pprof files to keep in " +
+		"pprof-output-dir. The oldest files are removed first, but the newest file is " +
+		"always kept. 0 disables the limit."
+	minSamplesPerSecondHelp = "Enable adaptive sampling: lower the frequency (in Hz) of " +
+		"stack trace sampling down to this value while the agent can not keep up with the " +
+		"traces, and restore it when the load drops. 0 disables adaptive sampling."
 	samplesPerSecondHelp  = "Set the frequency (in Hz) of stack trace sampling."
 	reporterIntervalHelp  = "Set the reporter's interval in seconds."
 	monitorIntervalHelp   = "Set the monitor interval in seconds."
@@ -63,30 +89,199 @@ var (
 		"If zero, monotonic-realtime clock sync will be performed once, " +
 		"on agent startup, but not periodically."
 	sendErrorFramesHelp = "Send error frames (devfiler only, breaks Kibana)"
+	spoolDirHelp        = "Directory to store reports in until they are sent to the collection " +
+		"agent. Stored reports are replayed in order once the collection agent is reachable. " +
+		"Spooling is disabled if empty."
+	spoolMaxAgeHelp     = "Maximum age of the reports stored in spool-dir."
+	spoolMaxSizeHelp    = "Maximum total size (in MiB) of the reports stored in spool-dir."
 	offCPUThresholdHelp = fmt.Sprintf("The probability for an off-cpu event being recorded. "+
 		"Valid values are in the range [0..1]. 0 disables off-cpu profiling. "+
 		"Default is %d.",
 		defaultOffCPUThreshold)
+	offCPUWakeupsHelp = "Collect the stacks of the threads that wake up the tasks of recorded " +
+		"off-cpu events. The off-cpu samples are linked to the waker by its PID, TID and " +
+		"stack hash. Wakeups from interrupts are not attributed. A kretprobe on " +
+		"try_to_wake_up runs on every wakeup of every task, which adds overhead to " +
+		"wakeup heavy workloads. Requires off-cpu-threshold."
+	contentionThresholdHelp = fmt.Sprintf("The probability for a wait for a contended "+
+		"lock being recorded. Waits in futex syscalls and in the slow path of "+
+		"pthread_mutex_lock are recorded with the address of the lock. "+
+		"Valid values are in the range [0..1]. 0 disables lock contention profiling. "+
+		"Default is %d.",
+		defaultContentionThreshold)
+	runQueueThresholdHelp = fmt.Sprintf("The probability for a thread becoming runnable "+
+		"being recorded with the time it waited for a CPU. "+
+		"Valid values are in the range [0..1]. 0 disables run queue latency profiling. "+
+		"Default is %d.",
+		defaultRunQueueThreshold)
 	envVarsHelp = "Comma separated list of environment variables that will be reported with the" +
 		"captured profiling samples."
+	foldedGroupByHelp = "Comma separated list of fields to group folded stacks by. " +
+		"Valid fields are origin, container, pid and comm. Stacks of origins other than " +
+		"on-CPU sampling always start with the origin, as their values have other units."
+	foldedOutputHelp = "Append stacks in the folded (collapsed) format to this file, " +
+		"or to stdout if set to -. Stacks are only sent to a collection agent if " +
+		"collection-agent is set as well."
+	symbolizeNativeHelp = "Resolve function names of native frames from the ELF symbol " +
+		"tables of the executables on the host. The tables are loaded in the background, " +
+		"so the first frames of an executable stay unsymbolized."
+	symbolizeNativeCacheHelp = "Maximum memory (in MiB) used to cache the ELF symbol tables " +
+		"for symbolize-native."
+	symbolizeNativeDWARFHelp = "Also resolve source lines and inlined functions of native " +
+		"frames from DWARF debug information, if it fits into symbolize-native-cache-size. " +
+		"Split DWARF (.dwo and .dwp files) is not supported."
+	demangleHelp = "Demangling of C++ and Rust function names: none, simple (without " +
+		"parameters and template arguments) or full."
+	pidHelp      = "Only profile the process with this PID. 0 profiles all processes."
+	childrenHelp = "Also profile the child processes (including the ones started later) " +
+		"of the process selected with pid."
+	cgroupAllowHelp = "Comma separated list of cgroup path globs (e.g. /kubepods.slice/*). " +
+		"If set, only processes in matching cgroups or allowed containers are profiled."
+	cgroupDenyHelp = "Comma separated list of cgroup path globs (e.g. /system.slice/*). " +
+		"Processes in matching cgroups are not profiled."
+	containerAllowHelp = "Comma separated list of container IDs or ID prefixes. If set, " +
+		"only processes in matching containers or allowed cgroups are profiled."
+	containerDenyHelp = "Comma separated list of container IDs or ID prefixes. Processes " +
+		"in matching containers are not profiled."
+	perfEventsHelp = "Comma separated list of perf events whose samples are profiled in " +
+		"addition to the CPU clock: page-faults, context-switches, cache-misses and " +
+		"branch-misses. Append :period=N to sample every N-th event or :freq=N to sample " +
+		"N times per second, e.g. page-faults:period=100."
+	allocSampleIntervalHelp = "Enables allocation profiling of malloc, calloc, realloc and " +
+		"free. On average one allocation is sampled per this number of allocated bytes, " +
+		"e.g. 524288. 0 disables allocation profiling. Every call of these functions " +
+		"traps into the kernel, and malloc, calloc and realloc trap twice, in all " +
+		"processes that use the allocator libraries unless pid is set without children. " +
+		"This adds a few microseconds per call and can slow down allocation heavy " +
+		"processes considerably."
+	allocInUseHelp = "Also report the sampled allocations that were not freed yet " +
+		"(inuse_objects and inuse_space). Requires alloc-sample-interval."
+	allocLibrariesHelp = "Comma separated list of absolute paths of the allocator libraries " +
+		"(glibc, musl, jemalloc or tcmalloc) whose allocations are profiled. Defaults to " +
+		"the libraries found in well-known locations of the host, which only covers " +
+		"containers that use the same files. Libraries of a container can be given as " +
+		"/proc/PID/root/PATH for any process PID of the container."
+	budgetCPUHelp = "Maximum CPU usage of the agent in percent of one CPU. When exceeded, " +
+		"the agent lowers the sampling frequency, then disables the interpreter unwinders " +
+		"and finally pauses profiling until it is within budget. 0 disables the limit."
+	budgetMemoryHelp = "Maximum resident memory (in MiB) of the agent, enforced like " +
+		"budget-cpu. Freed memory is returned to the operating system while the agent " +
+		"is close to the limit, but memory held by caches and eBPF buffers is not, so " +
+		"an agent that exceeds the limit with them stays degraded. 0 disables the limit."
+	controlAddrHelp = "Serve the control API on this loopback address (e.g. localhost:6061) " +
+		"or Unix socket path, to start and stop profiling, change the sampling frequency, " +
+		"switch off-cpu profiling and tracers, and take one-shot profiles at runtime. " +
+		"Only the user of the agent can connect to the Unix socket. A loopback address " +
+		"requires -control-token-file."
+	controlTokenFileHelp = "File holding the token that clients of the control API send " +
+		"in the header Authorization: Bearer TOKEN. Required if -control-addr is a " +
+		"loopback address."
+	configHelp = "Configuration file. Files ending in .yaml, .yml or .json hold the " +
+		"structured configuration that -print-config shows, other files one flag and its " +
+		"value per line, e.g. reporter-interval 10s. Flags on the command line and " +
+		"environment variables take precedence. Changes to the settings that can change " +
+		"at runtime are applied without a restart, as on SIGHUP."
+	printConfigHelp = "Print the effective configuration, merged from flags, environment " +
+		"variables and the configuration file, in the YAML format of the configuration " +
+		"file and exit."
+	doctorJSONHelp     = "Print the report of the host checks in JSON format."
+	doctorVerboseHelp  = "Log the details of the host checks."
+	recordDurationHelp = "Duration of the recording."
+	recordOutputHelp   = "File to write the pprof profile of on-CPU samples to. The " +
+		"profiles of other trace origins are written next to it, e.g. profile-offcpu.pb.gz."
+	uprobesHelp = "Comma separated list of functions whose calls are profiled, given as " +
+		"binary:symbol with the absolute path of an executable or shared library and a " +
+		"dynamic symbol. Append :N to collect at most N traces per second (default 100, " +
+		"0 for no limit), e.g. /usr/lib/libc.so.6:malloc:50. Calls that exceed the limit " +
+		"are added to the next collected trace of any process, so the calls per stack are " +
+		"an estimate while their total is accurate. Requires Linux 5.15 or newer."
 )
 
 // Package-scope variable, so that conditionally compiled other components can refer
 // to the same flagset.
 
+// parseArgs parses the command line arguments of the agent.
 func parseArgs() (*controller.Config, error) {
 	var args controller.Config
 
 	fs := flag.NewFlagSet("ebpf-profiler", flag.ExitOnError)
+	registerFlags(fs, &args)
+	args.Fs = fs
+
+	return &args, parseFlagSet(fs, os.Args[1:])
+}
+
+// reparseArgs parses the command line arguments of the agent again, together with the
+// current environment and configuration file. Unlike parseArgs, it returns all errors
+// instead of exiting.
+func reparseArgs() (*controller.Config, error) {
+	var args controller.Config
+
+	fs := flag.NewFlagSet("ebpf-profiler", flag.ContinueOnError)
+	registerFlags(fs, &args)
+	fs.SetOutput(io.Discard)
+	args.Fs = fs
+
+	return &args, parseFlagSet(fs, os.Args[1:])
+}
+
+// parseRecordArgs parses the arguments of the record subcommand, which accepts the
+// arguments of the agent in addition to its own.
+func parseRecordArgs(arguments []string) (*controller.Config, *recordArgs, error) {
+	var args controller.Config
+	var rec recordArgs
+
+	fs := flag.NewFlagSet("ebpf-profiler record", flag.ExitOnError)
+	registerFlags(fs, &args)
+	fs.DurationVar(&rec.duration, "duration", defaultRecordDuration, recordDurationHelp)
+	fs.StringVar(&rec.output, "o", defaultRecordOutput, recordOutputHelp)
+	args.Fs = fs
+
+	return &args, &rec, parseFlagSet(fs, arguments)
+}
+
+// parseDoctorArgs parses the arguments of the doctor subcommand.
+func parseDoctorArgs(arguments []string) (*doctorArgs, error) {
+	var args doctorArgs
+
+	fs := flag.NewFlagSet("ebpf-profiler doctor", flag.ExitOnError)
+	fs.BoolVar(&args.json, "json", false, doctorJSONHelp)
+	fs.BoolVar(&args.verbose, "v", false, doctorVerboseHelp)
 
+	return &args, fs.Parse(arguments)
+}
+
+// registerFlags defines the command line arguments of the agent in fs.
+func registerFlags(fs *flag.FlagSet, args *controller.Config) {
 	// Please keep the parameters ordered alphabetically in the source-code.
+	fs.BoolVar(&args.AllocInUse, "alloc-in-use", false, allocInUseHelp)
+	fs.StringVar(&args.AllocLibraries, "alloc-libraries", "", allocLibrariesHelp)
+	fs.UintVar(&args.AllocSampleInterval, "alloc-sample-interval", 0,
+		allocSampleIntervalHelp)
+
 	fs.UintVar(&args.BpfVerifierLogLevel, "bpf-log-level", 0, bpfVerifierLogLevelHelp)
 
+	fs.Float64Var(&args.BudgetCPU, "budget-cpu", 0, budgetCPUHelp)
+	fs.UintVar(&args.BudgetMemory, "budget-memory", 0, budgetMemoryHelp)
+
+	fs.StringVar(&args.CgroupAllow, "cgroup-allow", "", cgroupAllowHelp)
+	fs.StringVar(&args.CgroupDeny, "cgroup-deny", "", cgroupDenyHelp)
+	fs.BoolVar(&args.TargetChildren, "children", false, childrenHelp)
 	fs.StringVar(&args.CollAgentAddr, "collection-agent", "", collAgentAddrHelp)
+	fs.StringVar(&args.ConfigFile, "config", "", configHelp)
+	fs.StringVar(&args.ContainerAllow, "container-allow", "", containerAllowHelp)
+	fs.StringVar(&args.ContainerDeny, "container-deny", "", containerDenyHelp)
+	fs.StringVar(&args.ControlAddr, "control-addr", "", controlAddrHelp)
+	fs.StringVar(&args.ControlTokenFile, "control-token-file", "", controlTokenFileHelp)
 	fs.BoolVar(&args.Copyright, "copyright", false, copyrightHelp)
 
+	fs.StringVar(&args.Demangle, "demangle", defaultDemangle, demangleHelp)
+
 	fs.BoolVar(&args.DisableTLS, "disable-tls", false, disableTLSHelp)
 
+	fs.StringVar(&args.FoldedGroupBy, "folded-group-by", "", foldedGroupByHelp)
+	fs.StringVar(&args.FoldedOutput, "folded-output", "", foldedOutputHelp)
+
 	fs.UintVar(&args.MapScaleFactor, "map-scale-factor",
 		defaultArgMapScaleFactor, mapScaleFactorHelp)
 
@@ -99,7 +294,21 @@ func parseArgs() (*controller.Config, error) {
 	fs.BoolVar(&args.NoKernelVersionCheck, "no-kernel-version-check", false,
 		noKernelVersionCheckHelp)
 
+	fs.StringVar(&args.OTLPHeaders, "otlp-headers", "", otlpHeadersHelp)
+	fs.StringVar(&args.OTLPProtocol, "otlp-protocol", defaultOTLPProtocol, otlpProtocolHelp)
+
+	fs.StringVar(&args.PerfEvents, "perf-events", "", perfEventsHelp)
+
+	fs.UintVar(&args.TargetPID, "pid", 0, pidHelp)
+
 	fs.StringVar(&args.PprofAddr, "pprof", "", pprofHelp)
+	fs.StringVar(&args.PprofOutputDir, "pprof-output-dir", "", pprofOutputDirHelp)
+	fs.UintVar(&args.PprofOutputMaxFiles, "pprof-output-max-files", 0,
+		pprofOutputMaxFilesHelp)
+	fs.UintVar(&args.PprofOutputMaxSize, "pprof-output-max-size", 0,
+		pprofOutputMaxSizeHelp)
+
+	fs.BoolVar(&args.PrintConfig, "print-config", false, printConfigHelp)
 
 	fs.DurationVar(&args.ProbabilisticInterval, "probabilistic-interval",
 		defaultProbabilisticInterval, probabilisticIntervalHelp)
@@ -111,34 +320,73 @@ func parseArgs() (*controller.Config, error) {
 
 	fs.IntVar(&args.SamplesPerSecond, "samples-per-second", defaultArgSamplesPerSecond,
 		samplesPerSecondHelp)
+	fs.IntVar(&args.MinSamplesPerSecond, "min-samples-per-second", 0,
+		minSamplesPerSecondHelp)
 
 	fs.BoolVar(&args.SendErrorFrames, "send-error-frames", defaultArgSendErrorFrames,
 		sendErrorFramesHelp)
 
+	fs.StringVar(&args.SpoolDir, "spool-dir", "", spoolDirHelp)
+	fs.DurationVar(&args.SpoolMaxAge, "spool-max-age", defaultSpoolMaxAge, spoolMaxAgeHelp)
+	fs.UintVar(&args.SpoolMaxSize, "spool-max-size", defaultSpoolMaxSize, spoolMaxSizeHelp)
+
+	fs.BoolVar(&args.SymbolizeNative, "symbolize-native", false, symbolizeNativeHelp)
+	fs.UintVar(&args.SymbolizeNativeCache, "symbolize-native-cache-size",
+		defaultSymbolizeNativeCache, symbolizeNativeCacheHelp)
+	fs.BoolVar(&args.SymbolizeNativeDWARF, "symbolize-native-dwarf", false,
+		symbolizeNativeDWARFHelp)
+
 	fs.StringVar(&args.Tracers, "t", "all", "Shorthand for -tracers.")
 	fs.StringVar(&args.Tracers, "tracers", "all", tracersHelp)
 
+	fs.StringVar(&args.Uprobes, "uprobes", "", uprobesHelp)
+
 	fs.BoolVar(&args.VerboseMode, "v", false, "Shorthand for -verbose.")
 	fs.BoolVar(&args.VerboseMode, "verbose", false, verboseModeHelp)
 	fs.BoolVar(&args.Version, "version", false, versionHelp)
 
 	fs.Float64Var(&args.OffCPUThreshold, "off-cpu-threshold",
 		defaultOffCPUThreshold, offCPUThresholdHelp)
+	fs.BoolVar(&args.OffCPUWakeups, "off-cpu-wakeups", false, offCPUWakeupsHelp)
+
+	fs.Float64Var(&args.ContentionThreshold, "contention-threshold",
+		defaultContentionThreshold, contentionThresholdHelp)
+
+	fs.Float64Var(&args.RunQueueThreshold, "run-queue-threshold",
+		defaultRunQueueThreshold, runQueueThresholdHelp)
 
 	fs.StringVar(&args.IncludeEnvVars, "env-vars", defaultEnvVarsValue, envVarsHelp)
 
 	fs.Usage = func() {
 		fs.PrintDefaults()
 	}
+}
 
-	args.Fs = fs
+// configFileParser returns the parser of the configuration file of fs. Files ending in
+// .yaml, .yml or .json are structured configuration files, other files hold one flag
+// and its value per line.
+func configFileParser(fs *flag.FlagSet) ff.ConfigFileParser {
+	return func(r io.Reader, set func(name, value string) error) error {
+		// ff opens the file that the config flag names.
+		file := fs.Lookup("config").Value.String()
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+			return controller.ParseConfigFile(file, r, fs, set)
+		}
+		return ff.PlainParser(r, set)
+	}
+}
 
-	return &args, ff.Parse(fs, os.Args[1:],
+// parseFlagSet parses arguments, environment variables and the configuration file
+// into fs.
+func parseFlagSet(fs *flag.FlagSet, arguments []string) error {
+	return ff.Parse(fs, arguments,
 		ff.WithEnvVarPrefix("OTEL_PROFILING_AGENT"),
 		ff.WithConfigFileFlag("config"),
-		ff.WithConfigFileParser(ff.PlainParser),
+		ff.WithConfigFileParser(configFileParser(fs)),
 		// This will ignore configuration file (only) options that the current HA
-		// does not recognize.
+		// does not recognize. It does not apply to structured configuration files,
+		// which are strictly validated.
 		ff.WithIgnoreUndefined(true),
 		ff.WithAllowMissingConfigFile(true),
 	)
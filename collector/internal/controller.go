@@ -39,6 +39,8 @@ func NewController(cfg *controller.Config,
 		// Next step: Calculate FramesCacheElements from numCores and samplingRate.
 		FramesCacheElements: 131072,
 		SamplesPerSecond:    cfg.SamplesPerSecond,
+		AllocSampleInterval: uint32(cfg.AllocSampleInterval),
+		AllocInUse:          cfg.AllocInUse,
 	}, nextConsumer)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,117 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/internal/controller"
+	"go.opentelemetry.io/ebpf-profiler/tracer"
+)
+
+// doctorArgs holds the arguments of the doctor subcommand.
+type doctorArgs struct {
+	json    bool
+	verbose bool
+}
+
+// doctorReport is the JSON report of the doctor subcommand.
+type doctorReport struct {
+	Checks []tracer.CheckResult `json:"checks"`
+	// Passed is true if no check failed.
+	Passed bool `json:"passed"`
+}
+
+// doctorWithExitCode runs the doctor subcommand, which checks whether the host supports
+// the agent and prints a report with hints how to fix the failed checks.
+func doctorWithExitCode(arguments []string) exitCode {
+	args, err := parseDoctorArgs(arguments)
+	if err != nil {
+		log.Errorf("Failure to parse arguments: %v", err)
+		return exitParseError
+	}
+
+	// The checks log what the agent logs at startup, which the report replaces.
+	if args.verbose {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	report := newDoctorReport(append([]tracer.CheckResult{checkKernelVersion()},
+		tracer.CheckHost()...))
+
+	if args.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			return failure("Failed to print report: %v", err)
+		}
+	} else {
+		printDoctorReport(os.Stdout, &report)
+	}
+
+	if !report.Passed {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// newDoctorReport returns the report of checks, which passes if no check failed.
+func newDoctorReport(checks []tracer.CheckResult) doctorReport {
+	report := doctorReport{Checks: checks, Passed: true}
+	for _, check := range checks {
+		if check.Status == tracer.CheckFailed {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// checkKernelVersion checks the kernel version as the agent does at startup.
+func checkKernelVersion() tracer.CheckResult {
+	result := tracer.CheckResult{Name: "Kernel version"}
+	major, minor, patch, err := tracer.GetCurrentKernelVersion()
+	if err == nil {
+		result.Detail = fmt.Sprintf("%d.%d.%d", major, minor, patch)
+		err = controller.CheckKernelVersion(false)
+	}
+	if err != nil {
+		result.Status = tracer.CheckFailed
+		result.Detail = err.Error()
+		result.Hint = "Update the kernel of the host."
+	}
+	return result
+}
+
+// printDoctorReport writes the report in human readable form to w.
+func printDoctorReport(w io.Writer, report *doctorReport) {
+	counts := make(map[tracer.CheckStatus]int)
+	for _, check := range report.Checks {
+		counts[check.Status]++
+		fmt.Fprintf(w, "[%s] %s", strings.ToUpper(check.Status.String()), check.Name)
+		if check.Detail != "" {
+			fmt.Fprintf(w, ": %s", check.Detail)
+		}
+		fmt.Fprintln(w)
+		if check.Hint != "" {
+			fmt.Fprintf(w, "       Hint: %s\n", check.Hint)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed, %d skipped\n",
+		counts[tracer.CheckPassed], counts[tracer.CheckWarning],
+		counts[tracer.CheckFailed], counts[tracer.CheckSkipped])
+	if report.Passed {
+		fmt.Fprintln(w, "The host supports the agent.")
+	} else {
+		fmt.Fprintln(w, "The agent does not start on this host, see the hints above.")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/tracer"
+)
+
+var doctorChecks = []tracer.CheckResult{
+	{Name: "eBPF syscall", Status: tracer.CheckPassed, Detail: "available"},
+	{Name: "Kernel BTF", Status: tracer.CheckWarning, Detail: "not available",
+		Hint: "Use a kernel with BTF."},
+	{Name: "eBPF maps", Status: tracer.CheckFailed, Detail: "permission denied",
+		Hint: "Run as root."},
+	{Name: "System configuration", Status: tracer.CheckSkipped},
+}
+
+func TestNewDoctorReport(t *testing.T) {
+	tests := map[string]struct {
+		checks []tracer.CheckResult
+		passed bool
+	}{
+		"no checks": {passed: true},
+		"warnings and skipped": {
+			checks: []tracer.CheckResult{doctorChecks[0], doctorChecks[1], doctorChecks[3]},
+			passed: true,
+		},
+		"failed": {
+			checks: doctorChecks,
+			passed: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := newDoctorReport(tc.checks)
+			assert.Equal(t, tc.checks, report.Checks)
+			assert.Equal(t, tc.passed, report.Passed)
+		})
+	}
+}
+
+func TestPrintDoctorReport(t *testing.T) {
+	var buf bytes.Buffer
+	report := newDoctorReport(doctorChecks)
+	printDoctorReport(&buf, &report)
+	assert.Equal(t, `[PASS] eBPF syscall: available
+[WARN] Kernel BTF: not available
+       Hint: Use a kernel with BTF.
+[FAIL] eBPF maps: permission denied
+       Hint: Run as root.
+[SKIP] System configuration
+
+1 passed, 1 warnings, 1 failed, 1 skipped
+The agent does not start on this host, see the hints above.
+`, buf.String())
+
+	buf.Reset()
+	report = newDoctorReport(doctorChecks[:1])
+	printDoctorReport(&buf, &report)
+	assert.Equal(t, `[PASS] eBPF syscall: available
+
+1 passed, 0 warnings, 0 failed, 0 skipped
+The host supports the agent.
+`, buf.String())
+}
+
+func TestDoctorReportJSON(t *testing.T) {
+	data, err := json.Marshal(newDoctorReport(doctorChecks))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"checks": [
+			{"name": "eBPF syscall", "status": "pass", "detail": "available"},
+			{"name": "Kernel BTF", "status": "warn", "detail": "not available",
+				"hint": "Use a kernel with BTF."},
+			{"name": "eBPF maps", "status": "fail", "detail": "permission denied",
+				"hint": "Run as root."},
+			{"name": "System configuration", "status": "skip"}
+		],
+		"passed": false
+	}`, string(data))
+}
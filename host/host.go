@@ -51,13 +51,20 @@ type Trace struct {
 	ProcessName      string
 	ExecutablePath   string
 	ContainerID      string
+	CgroupPath       string
 	Frames           []Frame
 	Hash             TraceHash
 	KTime            times.KTime
 	PID              libpf.PID
 	TID              libpf.PID
 	Origin           libpf.Origin
-	OffTime          int64 // Time a task was off-cpu in nanoseconds.
+	OffTime          int64       // Time a task was off-cpu in nanoseconds.
+	Addr             uint64      // Address of a tracked allocation or a contended lock.
+	TaskState        string      // State of a task that was off-cpu.
+	WaitChannel      string      // Kernel function a blocked task that was off-cpu waited in.
+	WakerPID         libpf.PID   // Process of the thread that woke up a task that was off-cpu.
+	WakerTID         libpf.PID   // Thread that woke up a task that was off-cpu.
+	WakerKTime       times.KTime // Time of the wakeup of a task that was off-cpu.
 	APMTraceID       libpf.APMTraceID
 	APMTransactionID libpf.APMTransactionID
 	CPU              int
@@ -0,0 +1,321 @@
+package controller // import "go.opentelemetry.io/ebpf-profiler/internal/controller"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/periodiccaller"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// Degradation levels of the budget. Every level includes the degradations of the
+// levels below it.
+const (
+	// budgetLevelNone does not degrade the agent.
+	budgetLevelNone = iota
+	// budgetLevelHalfSampling halves the sampling frequency.
+	budgetLevelHalfSampling
+	// budgetLevelQuarterSampling quarters the sampling frequency.
+	budgetLevelQuarterSampling
+	// budgetLevelNoInterpreters disables the interpreter unwinders.
+	budgetLevelNoInterpreters
+	// budgetLevelPaused pauses profiling.
+	budgetLevelPaused
+)
+
+const (
+	// budgetRecoveryIntervals is the number of consecutive intervals within the
+	// recovery margin of the budget after which a degradation is reverted.
+	budgetRecoveryIntervals = 3
+	// budgetRecoveryMargin is the fraction of the budget that the usage must stay below
+	// to revert a degradation. It avoids flapping between two levels.
+	budgetRecoveryMargin = 0.8
+)
+
+// budgetActuator is the part of the tracer that the budget degrades.
+type budgetActuator interface {
+	SetSamplingLimit(limit int)
+	SetSamplingFrequency(frequency int) error
+	SetIncludedTracers(tracers tracertypes.IncludedTracers) error
+	PauseProfiling(pause bool)
+}
+
+// budgetUsage is the resource usage of the agent.
+type budgetUsage struct {
+	// cpuTime is the CPU time that the agent used since it started.
+	cpuTime time.Duration
+	// memory is the resident memory of the agent in bytes.
+	memory uint64
+}
+
+// budget enforces limits on the CPU usage and the resident memory of the agent. When
+// the agent exceeds its budget, it is degraded one level per interval: first the
+// sampling frequency is lowered, then the interpreter unwinders are disabled and
+// finally profiling is paused. The degradations are reverted one by one once the
+// agent stays well within its budget. The degradations lower the memory that the
+// agent allocates, so the budget returns the freed memory to the operating system
+// while the agent is close to its memory limit. Memory that the agent keeps, such
+// as filled caches and eBPF buffers, is not freed and can keep it degraded.
+type budget struct {
+	// maxCPU is the CPU usage limit in percent of one CPU, zero if unlimited.
+	maxCPU float64
+	// maxMemory is the resident memory limit in bytes, zero if unlimited.
+	maxMemory uint64
+
+	samplesPerSecond int
+	includeTracers   tracertypes.IncludedTracers
+	actuator         budgetActuator
+
+	// readUsage returns the current resource usage of the agent.
+	readUsage func() (budgetUsage, error)
+
+	// mu protects samplesPerSecond, includeTracers and level, which Reload and the
+	// control API read and change.
+	mu            sync.Mutex
+	level         int
+	calmIntervals int
+	lastUsage     budgetUsage
+	lastCheck     time.Time
+}
+
+// newBudget returns a budget that degrades actuator when the agent exceeds maxCPU
+// percent of one CPU or maxMemory bytes of resident memory.
+func newBudget(maxCPU float64, maxMemory uint64, samplesPerSecond int,
+	includeTracers tracertypes.IncludedTracers, actuator budgetActuator) *budget {
+	return &budget{
+		maxCPU:           maxCPU,
+		maxMemory:        maxMemory,
+		samplesPerSecond: samplesPerSecond,
+		includeTracers:   includeTracers,
+		actuator:         actuator,
+		readUsage:        readAgentUsage,
+	}
+}
+
+// start periodically checks the budget until ctx is done.
+func (b *budget) start(ctx context.Context, interval time.Duration) {
+	periodiccaller.Start(ctx, interval, func() {
+		usage, err := b.readUsage()
+		if err != nil {
+			log.Errorf("Failed to read the resource usage of the agent: %v", err)
+			return
+		}
+		b.check(usage, time.Now())
+		if b.maxMemory > 0 &&
+			float64(usage.memory) > float64(b.maxMemory)*budgetRecoveryMargin {
+			// The Go runtime returns freed memory to the operating system only
+			// gradually, so the resident memory would not drop below the budget.
+			debug.FreeOSMemory()
+		}
+	})
+}
+
+// check compares usage at now to the budget and adjusts the degradation level.
+func (b *budget) check(usage budgetUsage, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var cpuPercent float64
+	if !b.lastCheck.IsZero() {
+		if elapsed := now.Sub(b.lastCheck); elapsed > 0 {
+			cpuPercent = 100 * float64(usage.cpuTime-b.lastUsage.cpuTime) / float64(elapsed)
+		}
+	}
+	b.lastUsage = usage
+	b.lastCheck = now
+
+	metrics.AddSlice([]metrics.Metric{
+		{ID: metrics.IDBudgetCPUUsage, Value: metrics.MetricValue(cpuPercent)},
+		{ID: metrics.IDBudgetMemoryUsage, Value: metrics.MetricValue(usage.memory)},
+	})
+
+	switch {
+	case b.exceeds(cpuPercent, usage.memory, 1):
+		b.calmIntervals = 0
+		if b.level < budgetLevelPaused {
+			b.level++
+			log.Warnf("Agent exceeds its budget (CPU: %.1f%%, memory: %d MiB)",
+				cpuPercent, usage.memory/MiB)
+			b.apply(true)
+		}
+	case b.exceeds(cpuPercent, usage.memory, budgetRecoveryMargin):
+		b.calmIntervals = 0
+	default:
+		b.calmIntervals++
+		if b.level > budgetLevelNone && b.calmIntervals >= budgetRecoveryIntervals {
+			b.calmIntervals = 0
+			b.level--
+			b.apply(false)
+		}
+	}
+	metrics.Add(metrics.IDBudgetLevel, metrics.MetricValue(b.level))
+}
+
+// exceeds returns whether cpuPercent or memory exceed the given fraction of the budget.
+func (b *budget) exceeds(cpuPercent float64, memory uint64, fraction float64) bool {
+	return (b.maxCPU > 0 && cpuPercent > b.maxCPU*fraction) ||
+		(b.maxMemory > 0 && float64(memory) > float64(b.maxMemory)*fraction)
+}
+
+// apply degrades the agent according to its level. degrade tells whether the level
+// was raised or lowered.
+func (b *budget) apply(degrade bool) {
+	switch b.level {
+	case budgetLevelNone, budgetLevelHalfSampling, budgetLevelQuarterSampling:
+		limit := b.samplingLimit()
+		b.actuator.SetSamplingLimit(limit)
+		if degrade {
+			log.Warnf("Lowered sampling frequency to %d Hz to stay within budget", limit)
+			metrics.Add(metrics.IDBudgetSamplingReduced, 1)
+			return
+		}
+		if limit == 0 {
+			limit = b.samplesPerSecond
+		}
+		log.Infof("Raised sampling frequency to %d Hz as agent is within budget", limit)
+	case budgetLevelNoInterpreters:
+		if degrade {
+			tracers := withoutInterpreters(b.includeTracers)
+			if err := b.actuator.SetIncludedTracers(tracers); err != nil {
+				log.Errorf("Failed to disable interpreter unwinders: %v", err)
+			}
+			log.Warnf("Disabled interpreter unwinders to stay within budget")
+			metrics.Add(metrics.IDBudgetTracersDisabled, 1)
+			return
+		}
+		b.actuator.PauseProfiling(false)
+		log.Infof("Resumed profiling as agent is within budget")
+	case budgetLevelPaused:
+		b.actuator.PauseProfiling(true)
+		log.Warnf("Paused profiling to stay within budget")
+		metrics.Add(metrics.IDBudgetProfilingPaused, 1)
+		return
+	}
+
+	if !degrade {
+		metrics.Add(metrics.IDBudgetRecovered, 1)
+		if b.level == budgetLevelQuarterSampling {
+			if err := b.actuator.SetIncludedTracers(b.includeTracers); err != nil {
+				log.Errorf("Failed to enable interpreter unwinders: %v", err)
+			}
+			log.Infof("Enabled interpreter unwinders as agent is within budget")
+		}
+	}
+}
+
+// samplingLimit returns the limit of the sampling frequency at the current level, 0
+// if the sampling frequency is not limited.
+func (b *budget) samplingLimit() int {
+	if b.level == budgetLevelNone {
+		return 0
+	}
+	return max(b.samplesPerSecond>>min(b.level, budgetLevelQuarterSampling), 1)
+}
+
+// setSamplingFrequency changes the sampling frequency to frequency Hz, which the
+// budget lowers according to its level.
+func (b *budget) setSamplingFrequency(frequency int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.actuator.SetSamplingFrequency(frequency); err != nil {
+		return err
+	}
+	b.samplesPerSecond = frequency
+	if limit := b.samplingLimit(); limit != 0 {
+		log.Infof("Sampling frequency stays limited to %d Hz to stay within budget", limit)
+		b.actuator.SetSamplingLimit(limit)
+	}
+	return nil
+}
+
+// setIncludedTracers replaces the tracers that are switched on while the agent is
+// within budget. While the budget disables the interpreter unwinders, it switches on
+// only the other tracers and the interpreter unwinders follow on recovery.
+func (b *budget) setIncludedTracers(tracers tracertypes.IncludedTracers) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.includeTracers = tracers
+	if b.level >= budgetLevelNoInterpreters {
+		log.Infof("Interpreter unwinders stay disabled to stay within budget")
+		tracers = withoutInterpreters(tracers)
+	}
+	return b.actuator.SetIncludedTracers(tracers)
+}
+
+// activeTracers returns the tracers of tracers that the budget switches on.
+func (b *budget) activeTracers(tracers tracertypes.IncludedTracers) tracertypes.IncludedTracers {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.level >= budgetLevelNoInterpreters {
+		return withoutInterpreters(tracers)
+	}
+	return tracers
+}
+
+// budgetControlTracer passes the changes of the control API to settings that the
+// budget degrades through the budget, so that it keeps them when it recovers.
+type budgetControlTracer struct {
+	controlTracer
+	budget *budget
+}
+
+func (t *budgetControlTracer) SetSamplingFrequency(frequency int) error {
+	return t.budget.setSamplingFrequency(frequency)
+}
+
+func (t *budgetControlTracer) SetIncludedTracers(tracers tracertypes.IncludedTracers) error {
+	return t.budget.setIncludedTracers(tracers)
+}
+
+// withoutInterpreters returns tracers without the interpreter unwinders.
+func withoutInterpreters(tracers tracertypes.IncludedTracers) tracertypes.IncludedTracers {
+	tracers.Disable(tracertypes.PerlTracer)
+	tracers.Disable(tracertypes.PHPTracer)
+	tracers.Disable(tracertypes.PythonTracer)
+	tracers.Disable(tracertypes.HotspotTracer)
+	tracers.Disable(tracertypes.RubyTracer)
+	tracers.Disable(tracertypes.V8Tracer)
+	tracers.Disable(tracertypes.DotnetTracer)
+	return tracers
+}
+
+// readAgentUsage returns the CPU time and the resident memory of the agent.
+func readAgentUsage() (budgetUsage, error) {
+	var rusage unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &rusage); err != nil {
+		return budgetUsage{}, fmt.Errorf("failed to get resource usage: %v", err)
+	}
+	cpuTime := time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+
+	// The second field of statm is the number of resident pages.
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return budgetUsage{}, err
+	}
+	fields := bytes.Fields(statm)
+	if len(fields) < 2 {
+		return budgetUsage{}, fmt.Errorf("unexpected format of statm: %q", statm)
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return budgetUsage{}, fmt.Errorf("failed to parse statm: %v", err)
+	}
+
+	return budgetUsage{
+		cpuTime: cpuTime,
+		memory:  pages * uint64(os.Getpagesize()),
+	}, nil
+}
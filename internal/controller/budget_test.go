@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+type fakeActuator struct {
+	limit     int
+	frequency int
+	tracers   tracertypes.IncludedTracers
+	paused    bool
+}
+
+func (f *fakeActuator) SetSamplingLimit(limit int) { f.limit = limit }
+
+func (f *fakeActuator) SetSamplingFrequency(frequency int) error {
+	f.frequency = frequency
+	return nil
+}
+
+func (f *fakeActuator) SetIncludedTracers(tracers tracertypes.IncludedTracers) error {
+	f.tracers = tracers
+	return nil
+}
+
+func (f *fakeActuator) PauseProfiling(pause bool) { f.paused = pause }
+
+func TestBudgetCheck(t *testing.T) {
+	includeTracers, err := tracertypes.Parse("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noInterpreters := withoutInterpreters(includeTracers)
+	assert.True(t, noInterpreters.Has(tracertypes.GoTracer))
+	assert.False(t, noInterpreters.Has(tracertypes.PythonTracer))
+
+	actuator := &fakeActuator{tracers: includeTracers}
+	b := newBudget(10, 100*MiB, 20, includeTracers, actuator)
+
+	type step struct {
+		cpuPercent  float64
+		memory      uint64
+		wantLevel   int
+		wantLimit   int
+		wantTracers tracertypes.IncludedTracers
+		wantPaused  bool
+	}
+	var cpuTime time.Duration
+	now := time.Unix(0, 0)
+	for i, s := range []step{
+		{wantTracers: includeTracers},
+		{cpuPercent: 20, wantLevel: 1, wantLimit: 10, wantTracers: includeTracers},
+		{memory: 200 * MiB, wantLevel: 2, wantLimit: 5, wantTracers: includeTracers},
+		{cpuPercent: 11, wantLevel: 3, wantLimit: 5, wantTracers: noInterpreters},
+		{cpuPercent: 50, wantLevel: 4, wantLimit: 5, wantTracers: noInterpreters,
+			wantPaused: true},
+		{cpuPercent: 50, wantLevel: 4, wantLimit: 5, wantTracers: noInterpreters,
+			wantPaused: true},
+		{wantLevel: 4, wantLimit: 5, wantTracers: noInterpreters, wantPaused: true},
+		{wantLevel: 4, wantLimit: 5, wantTracers: noInterpreters, wantPaused: true},
+		{wantLevel: 3, wantLimit: 5, wantTracers: noInterpreters},
+		// Usage within the recovery margin resets the recovery.
+		{cpuPercent: 9, wantLevel: 3, wantLimit: 5, wantTracers: noInterpreters},
+		{wantLevel: 3, wantLimit: 5, wantTracers: noInterpreters},
+		{wantLevel: 3, wantLimit: 5, wantTracers: noInterpreters},
+		{wantLevel: 2, wantLimit: 5, wantTracers: includeTracers},
+		{wantLevel: 2, wantLimit: 5, wantTracers: includeTracers},
+		{wantLevel: 2, wantLimit: 5, wantTracers: includeTracers},
+		{wantLevel: 1, wantLimit: 10, wantTracers: includeTracers},
+		{wantLevel: 1, wantLimit: 10, wantTracers: includeTracers},
+		{wantLevel: 1, wantLimit: 10, wantTracers: includeTracers},
+		{wantLevel: 0, wantLimit: 0, wantTracers: includeTracers},
+	} {
+		cpuTime += time.Duration(s.cpuPercent * float64(time.Second) / 100)
+		now = now.Add(time.Second)
+		b.check(budgetUsage{cpuTime: cpuTime, memory: s.memory}, now)
+
+		assert.Equal(t, s.wantLevel, b.level, "step %d", i)
+		assert.Equal(t, s.wantLimit, actuator.limit, "step %d", i)
+		assert.Equal(t, s.wantTracers, actuator.tracers, "step %d", i)
+		assert.Equal(t, s.wantPaused, actuator.paused, "step %d", i)
+	}
+}
+
+func TestBudgetSetIncludedTracers(t *testing.T) {
+	includeTracers, err := tracertypes.Parse("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := tracertypes.Parse("perl,python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actuator := &fakeActuator{tracers: includeTracers}
+	b := newBudget(10, 0, 20, includeTracers, actuator)
+
+	assert.NoError(t, b.setIncludedTracers(reloaded))
+	assert.Equal(t, reloaded, actuator.tracers)
+	assert.Equal(t, reloaded, b.activeTracers(reloaded))
+
+	// While the interpreter unwinders are disabled, they stay disabled and the reloaded
+	// tracers are switched on when the agent recovers.
+	b.level = budgetLevelNoInterpreters
+	assert.NoError(t, b.setIncludedTracers(includeTracers))
+	assert.Equal(t, withoutInterpreters(includeTracers), actuator.tracers)
+	assert.Equal(t, withoutInterpreters(includeTracers), b.activeTracers(includeTracers))
+	assert.NoError(t, b.setIncludedTracers(reloaded))
+	assert.Equal(t, withoutInterpreters(reloaded), actuator.tracers)
+
+	b.level--
+	b.apply(false)
+	assert.Equal(t, reloaded, actuator.tracers)
+}
+
+func TestBudgetControlTracer(t *testing.T) {
+	includeTracers, err := tracertypes.Parse("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	perl, err := tracertypes.Parse("perl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actuator := &fakeActuator{tracers: includeTracers}
+	b := newBudget(10, 0, 20, includeTracers, actuator)
+	ctrl := &budgetControlTracer{budget: b}
+
+	b.level = budgetLevelQuarterSampling
+	b.apply(true)
+	assert.Equal(t, 5, actuator.limit)
+	assert.NoError(t, ctrl.SetSamplingFrequency(40))
+	assert.Equal(t, 40, actuator.frequency)
+	assert.Equal(t, 10, actuator.limit)
+
+	b.level = budgetLevelNoInterpreters
+	b.apply(true)
+	assert.NoError(t, ctrl.SetIncludedTracers(perl))
+	assert.Equal(t, withoutInterpreters(perl), actuator.tracers)
+
+	// Recovery keeps the changes of the control API.
+	b.level--
+	b.apply(false)
+	assert.Equal(t, perl, actuator.tracers)
+	b.level--
+	b.apply(false)
+	assert.Equal(t, 20, actuator.limit)
+	b.level--
+	b.apply(false)
+	assert.Equal(t, 0, actuator.limit)
+}
+
+func TestReadAgentUsage(t *testing.T) {
+	usage, err := readAgentUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotZero(t, usage.memory)
+}
@@ -4,34 +4,74 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math"
+	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	pm "go.opentelemetry.io/ebpf-profiler/processmanager"
 	"go.opentelemetry.io/ebpf-profiler/reporter"
 	"go.opentelemetry.io/ebpf-profiler/tracer"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
 )
 
 type Config struct {
+	AllocInUse             bool
+	AllocLibraries         string
+	AllocSampleInterval    uint
 	BpfVerifierLogLevel    uint
+	BudgetCPU              float64
+	BudgetMemory           uint
+	CgroupAllow            string
+	CgroupDeny             string
 	CollAgentAddr          string
+	ConfigFile             string
+	ContainerAllow         string
+	ContainerDeny          string
+	ContentionThreshold    float64
+	ControlAddr            string
+	ControlTokenFile       string
 	Copyright              bool
+	Demangle               string
 	DisableTLS             bool
+	FoldedGroupBy          string
+	FoldedOutput           string
 	MapScaleFactor         uint
+	MinSamplesPerSecond    int
 	MonitorInterval        time.Duration
 	ClockSyncInterval      time.Duration
 	NoKernelVersionCheck   bool
+	OTLPHeaders            string
+	OTLPProtocol           string
 	PprofAddr              string
+	PprofOutputDir         string
+	PprofOutputMaxFiles    uint
+	PprofOutputMaxSize     uint
+	PrintConfig            bool
 	ProbabilisticInterval  time.Duration
 	ProbabilisticThreshold uint
 	ReporterInterval       time.Duration
+	RunQueueThreshold      float64
 	SamplesPerSecond       int
 	SendErrorFrames        bool
+	SpoolDir               string
+	SpoolMaxAge            time.Duration
+	SpoolMaxSize           uint
+	SymbolizeNative        bool
+	SymbolizeNativeCache   uint
+	SymbolizeNativeDWARF   bool
+	TargetChildren         bool
+	TargetPID              uint
 	Tracers                string
+	Uprobes                string
 	VerboseMode            bool
 	Version                bool
 	OffCPUThreshold        float64
+	OffCPUWakeups          bool
+	PerfEvents             string
 
 	Reporter reporter.Reporter
 
@@ -60,6 +100,26 @@ func (cfg *Config) Validate() error {
 	if cfg.SamplesPerSecond < 1 {
 		return fmt.Errorf("invalid sampling frequency: %d", cfg.SamplesPerSecond)
 	}
+	if cfg.MinSamplesPerSecond < 0 || cfg.MinSamplesPerSecond > cfg.SamplesPerSecond {
+		return fmt.Errorf("invalid minimum sampling frequency: %d. The value should be "+
+			"in the range [0..%d]. 0 disables adaptive sampling",
+			cfg.MinSamplesPerSecond, cfg.SamplesPerSecond)
+	}
+
+	if cfg.BudgetCPU < 0 {
+		return fmt.Errorf("invalid argument for budget-cpu: %f. The value should be "+
+			"positive, 0 disables the CPU budget", cfg.BudgetCPU)
+	}
+
+	if cfg.ControlAddr != "" {
+		if err := validateControlAddr(cfg.ControlAddr); err != nil {
+			return fmt.Errorf("invalid argument for control-addr: %v", err)
+		}
+		if !isUnixSocket(cfg.ControlAddr) && cfg.ControlTokenFile == "" {
+			return errors.New("serving the control API on a TCP address requires " +
+				"-control-token-file")
+		}
+	}
 
 	if cfg.MapScaleFactor > 8 {
 		return fmt.Errorf(
@@ -88,39 +148,141 @@ func (cfg *Config) Validate() error {
 		)
 	}
 
+	switch reporter.OTLPProtocol(cfg.OTLPProtocol) {
+	case "", reporter.OTLPProtocolGRPC, reporter.OTLPProtocolHTTPProtobuf,
+		reporter.OTLPProtocolHTTPJSON:
+	default:
+		return fmt.Errorf("invalid argument for otlp-protocol: %s", cfg.OTLPProtocol)
+	}
+
+	switch reporter.DemangleMode(cfg.Demangle) {
+	case "", reporter.DemangleNone, reporter.DemangleSimple, reporter.DemangleFull:
+	default:
+		return fmt.Errorf("invalid argument for demangle: %s", cfg.Demangle)
+	}
+
 	if cfg.OffCPUThreshold < 0.0 || cfg.OffCPUThreshold > 1.0 {
 		return errors.New(
 			"invalid argument for off-cpu-threshold. The value " +
 				"should be in the range [0..1]. 0 disables off-cpu profiling")
 	}
+	if cfg.OffCPUWakeups && cfg.OffCPUThreshold == 0.0 {
+		return errors.New("off-cpu-wakeups requires off-cpu-threshold")
+	}
 
-	if !cfg.NoKernelVersionCheck {
-		major, minor, patch, err := tracer.GetCurrentKernelVersion()
-		if err != nil {
-			return fmt.Errorf("failed to get kernel version: %v", err)
+	if cfg.ContentionThreshold < 0.0 || cfg.ContentionThreshold > 1.0 {
+		return errors.New(
+			"invalid argument for contention-threshold. The value " +
+				"should be in the range [0..1]. 0 disables lock contention profiling")
+	}
+
+	if cfg.RunQueueThreshold < 0.0 || cfg.RunQueueThreshold > 1.0 {
+		return errors.New(
+			"invalid argument for run-queue-threshold. The value " +
+				"should be in the range [0..1]. 0 disables run queue latency profiling")
+	}
+
+	if cfg.SymbolizeNativeDWARF && !cfg.SymbolizeNative {
+		return errors.New("symbolize-native-dwarf requires symbolize-native")
+	}
+
+	if cfg.SymbolizeNative && cfg.SymbolizeNativeCache == 0 {
+		return errors.New("invalid argument for symbolize-native-cache-size: " +
+			"the value should be greater than 0")
+	}
+
+	cgroupFilterCfg := cfg.CgroupFilterConfig()
+	if err := cgroupFilterCfg.Validate(); err != nil {
+		return fmt.Errorf("invalid cgroup filter: %v", err)
+	}
+
+	if _, err := tracertypes.ParsePerfEvents(cfg.PerfEvents); err != nil {
+		return fmt.Errorf("invalid argument for perf-events: %v", err)
+	}
+
+	if _, err := tracertypes.ParseUprobes(cfg.Uprobes); err != nil {
+		return fmt.Errorf("invalid argument for uprobes: %v", err)
+	}
+
+	if cfg.AllocSampleInterval > math.MaxUint32 {
+		return fmt.Errorf("invalid argument for alloc-sample-interval: "+
+			"the value should be at most %d", uint32(math.MaxUint32))
+	}
+	if _, err := tracertypes.ParseAllocLibraries(cfg.AllocLibraries); err != nil {
+		return fmt.Errorf("invalid argument for alloc-libraries: %v", err)
+	}
+	if cfg.AllocInUse && cfg.AllocSampleInterval == 0 {
+		return errors.New("alloc-in-use requires alloc-sample-interval")
+	}
+
+	if cfg.TargetChildren && cfg.TargetPID == 0 {
+		return errors.New("children requires pid")
+	}
+
+	if cfg.TargetPID != 0 {
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", cfg.TargetPID)); err != nil {
+			return fmt.Errorf("invalid argument for pid: %v", err)
 		}
+	}
 
-		var minMajor, minMinor uint32
-		switch runtime.GOARCH {
-		case "amd64":
-			if cfg.VerboseMode {
-				minMajor, minMinor = 5, 2
-			} else {
-				minMajor, minMinor = 4, 19
-			}
-		case "arm64":
-			// Older ARM64 kernel versions have broken bpf_probe_read.
-			// https://github.com/torvalds/linux/commit/6ae08ae3dea2cfa03dd3665a3c8475c2d429ef47
-			minMajor, minMinor = 5, 5
-		default:
-			return fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	if !cfg.NoKernelVersionCheck {
+		if err := CheckKernelVersion(cfg.VerboseMode); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+// CheckKernelVersion checks that the kernel of the host is recent enough for the agent.
+// On amd64, the verbose mode requires a more recent kernel.
+func CheckKernelVersion(verbose bool) error {
+	major, minor, patch, err := tracer.GetCurrentKernelVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get kernel version: %v", err)
+	}
 
-		if major < minMajor || (major == minMajor && minor < minMinor) {
-			return fmt.Errorf("host Agent requires kernel version "+
-				"%d.%d or newer but got %d.%d.%d", minMajor, minMinor, major, minor, patch)
+	var minMajor, minMinor uint32
+	switch runtime.GOARCH {
+	case "amd64":
+		if verbose {
+			minMajor, minMinor = 5, 2
+		} else {
+			minMajor, minMinor = 4, 19
 		}
+	case "arm64":
+		// Older ARM64 kernel versions have broken bpf_probe_read.
+		// https://github.com/torvalds/linux/commit/6ae08ae3dea2cfa03dd3665a3c8475c2d429ef47
+		minMajor, minMinor = 5, 5
+	default:
+		return fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	}
+
+	if major < minMajor || (major == minMajor && minor < minMinor) {
+		return fmt.Errorf("host Agent requires kernel version "+
+			"%d.%d or newer but got %d.%d.%d", minMajor, minMinor, major, minor, patch)
 	}
 
 	return nil
 }
+
+// CgroupFilterConfig returns the cgroup and container filter rules of the configuration.
+func (cfg *Config) CgroupFilterConfig() pm.CgroupFilterConfig {
+	return pm.CgroupFilterConfig{
+		AllowCgroups:    splitList(cfg.CgroupAllow),
+		DenyCgroups:     splitList(cfg.CgroupDeny),
+		AllowContainers: splitList(cfg.ContainerAllow),
+		DenyContainers:  splitList(cfg.ContainerDeny),
+	}
+}
+
+// splitList returns the non-empty elements of the comma separated list s.
+func splitList(s string) []string {
+	var list []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
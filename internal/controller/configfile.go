@@ -0,0 +1,343 @@
+package controller // import "go.opentelemetry.io/ebpf-profiler/internal/controller"
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+// commandFlags holds the flags that select what the agent does instead of configuring
+// it. They can not be set in the configuration file.
+var commandFlags = libpf.Set[string]{
+	"config":       {},
+	"copyright":    {},
+	"print-config": {},
+	"version":      {},
+}
+
+// flagAliases maps the short aliases of flags to the flags. The configuration file only
+// accepts the long names.
+var flagAliases = map[string]string{
+	"t": "tracers",
+	"v": "verbose",
+}
+
+// configSections maps the sections of the configuration file to the flags that are set
+// in them, keyed by their key in the section. All other flags are set with top-level
+// keys of the same name.
+var configSections = map[string]map[string]string{
+	"filters": {
+		"cgroup-allow":    "cgroup-allow",
+		"cgroup-deny":     "cgroup-deny",
+		"children":        "children",
+		"container-allow": "container-allow",
+		"container-deny":  "container-deny",
+		"pid":             "pid",
+	},
+	"reporter": {
+		"collection-agent":       "collection-agent",
+		"demangle":               "demangle",
+		"disable-tls":            "disable-tls",
+		"folded-group-by":        "folded-group-by",
+		"folded-output":          "folded-output",
+		"headers":                "otlp-headers",
+		"interval":               "reporter-interval",
+		"pprof-output-dir":       "pprof-output-dir",
+		"pprof-output-max-files": "pprof-output-max-files",
+		"pprof-output-max-size":  "pprof-output-max-size",
+		"protocol":               "otlp-protocol",
+		"spool-dir":              "spool-dir",
+		"spool-max-age":          "spool-max-age",
+		"spool-max-size":         "spool-max-size",
+	},
+	"tracers": {
+		"include": "tracers",
+	},
+}
+
+// listFlags holds the flags that take a comma separated list, which the configuration
+// file also accepts as a sequence.
+var listFlags = libpf.Set[string]{
+	"alloc-libraries": {},
+	"cgroup-allow":    {},
+	"cgroup-deny":     {},
+	"container-allow": {},
+	"container-deny":  {},
+	"env-vars":        {},
+	"folded-group-by": {},
+	"perf-events":     {},
+	"tracers":         {},
+	"uprobes":         {},
+}
+
+// configKey is the place of a flag in the configuration file.
+type configKey struct {
+	// section is the section of the flag, empty for top-level flags.
+	section string
+	// key is the key of the flag.
+	key string
+}
+
+func (k configKey) String() string {
+	if k.section == "" {
+		return k.key
+	}
+	return k.section + "." + k.key
+}
+
+// configKeys returns the places of the flags of fs in the configuration file.
+func configKeys(fs *flag.FlagSet) map[string]configKey {
+	keys := make(map[string]configKey)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := commandFlags[f.Name]; ok {
+			return
+		}
+		if _, ok := flagAliases[f.Name]; ok {
+			return
+		}
+		keys[f.Name] = configKey{key: f.Name}
+	})
+	for section, flags := range configSections {
+		for key, name := range flags {
+			if _, ok := keys[name]; ok {
+				keys[name] = configKey{section: section, key: key}
+			}
+		}
+	}
+	return keys
+}
+
+// ParseConfigFile parses the structured configuration file in YAML or JSON format from
+// r and calls set with the name and value of each flag of fs that it sets. Unknown
+// keys, values of the wrong type and keys that are set twice are rejected with the
+// line of the file in the error. file is the name of the file used in errors.
+func ParseConfigFile(file string, r io.Reader, fs *flag.FlagSet,
+	set func(name, value string) error) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			// An empty file sets nothing.
+			return nil
+		}
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	flags := make(map[configKey]*flag.Flag)
+	for name, key := range configKeys(fs) {
+		flags[key] = fs.Lookup(name)
+	}
+	p := &configFileParser{
+		file:  file,
+		flags: flags,
+		set:   set,
+		seen:  make(map[string]int),
+	}
+	return p.parseSection("", doc.Content[0])
+}
+
+// configFileParser holds the state of ParseConfigFile.
+type configFileParser struct {
+	file string
+	// flags holds the flags by their place in the configuration file.
+	flags map[configKey]*flag.Flag
+	set   func(name, value string) error
+	// seen holds the line of each flag that was set.
+	seen map[string]int
+}
+
+// errorf returns an error for line of the configuration file.
+func (p *configFileParser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.file, line, fmt.Sprintf(format, args...))
+}
+
+// parseSection parses the keys of section, the top level if section is empty.
+func (p *configFileParser) parseSection(section string, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		if section == "" {
+			return p.errorf(node.Line, "expected a mapping of settings")
+		}
+		return p.errorf(node.Line, "expected a mapping of settings in section %s", section)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := configKey{section: section, key: keyNode.Value}
+
+		if _, ok := configSections[key.key]; ok && section == "" {
+			if err := p.parseSection(key.key, valueNode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, ok := p.flags[key]
+		if !ok {
+			return p.errorf(keyNode.Line, "unknown setting %s%s", key, p.hint(key))
+		}
+		if line, ok := p.seen[f.Name]; ok {
+			return p.errorf(keyNode.Line, "%s is already set on line %d", key, line)
+		}
+		p.seen[f.Name] = keyNode.Line
+
+		value, err := p.value(key, f, valueNode)
+		if err != nil {
+			return err
+		}
+		if err = checkFlagValue(f, value); err != nil {
+			return p.errorf(valueNode.Line, "invalid value %q for %s: %v", value, key, err)
+		}
+		if err = p.set(f.Name, value); err != nil {
+			return p.errorf(valueNode.Line, "%v", err)
+		}
+	}
+	return nil
+}
+
+// hint returns where the unknown setting key belongs, if it is at the wrong place.
+func (p *configFileParser) hint(key configKey) string {
+	for place, f := range p.flags {
+		if f.Name == key.key || place.key == key.key ||
+			place.section+"-"+place.key == key.key {
+			return fmt.Sprintf(", did you mean %s?", place)
+		}
+	}
+	return ""
+}
+
+// value returns the flag value of the node of the setting key.
+func (p *configFileParser) value(key configKey, f *flag.Flag, node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", p.errorf(node.Line, "missing value for %s", key)
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		if _, ok := listFlags[f.Name]; !ok {
+			return "", p.errorf(node.Line, "%s takes a single value", key)
+		}
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", p.errorf(item.Line, "expected a list of values for %s", key)
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	case yaml.MappingNode:
+		if f.Name != "otlp-headers" {
+			return "", p.errorf(node.Line, "%s takes a single value", key)
+		}
+		pairs := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Kind != yaml.ScalarNode {
+				return "", p.errorf(node.Content[i+1].Line,
+					"expected a mapping of header names to values for %s", key)
+			}
+			pairs = append(pairs, node.Content[i].Value+"="+node.Content[i+1].Value)
+		}
+		return strings.Join(pairs, ","), nil
+	}
+	return "", p.errorf(node.Line, "unsupported value for %s", key)
+}
+
+// checkFlagValue checks that value parses as the type of the flag f.
+func checkFlagValue(f *flag.Flag, value string) error {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch getter.Get().(type) {
+	case bool:
+		_, err = strconv.ParseBool(value)
+	case int:
+		_, err = strconv.ParseInt(value, 0, strconv.IntSize)
+	case uint:
+		_, err = strconv.ParseUint(value, 0, strconv.IntSize)
+	case float64:
+		_, err = strconv.ParseFloat(value, 64)
+	case time.Duration:
+		_, err = time.ParseDuration(value)
+	}
+	if numErr, ok := err.(*strconv.NumError); ok {
+		err = numErr.Err
+	}
+	return err
+}
+
+// redactedValue replaces the values of secrets in the printed configuration.
+const redactedValue = "REDACTED"
+
+// PrintConfig writes the values of the flags of fs as structured configuration file
+// in YAML format to w. The values of the OTLP headers are redacted, as they usually
+// hold credentials.
+func PrintConfig(w io.Writer, fs *flag.FlagSet) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+
+	keys := configKeys(fs)
+	for _, name := range slices.Sorted(maps.Keys(keys)) {
+		key := keys[name]
+		f := fs.Lookup(name)
+		var v any = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			v = getter.Get()
+		}
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+		if name == "otlp-headers" {
+			v = redactHeaders(f.Value.String())
+		}
+		value := &yaml.Node{}
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+
+		parent := root
+		if key.section != "" {
+			parent = sections[key.section]
+			if parent == nil {
+				parent = &yaml.Node{Kind: yaml.MappingNode}
+				sections[key.section] = parent
+			}
+		}
+		parent.Content = append(parent.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key.key}, value)
+	}
+	for _, section := range slices.Sorted(maps.Keys(sections)) {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: section}, sections[section])
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactHeaders replaces the values of the comma separated key=value pairs of headers.
+func redactHeaders(headers string) string {
+	if headers == "" {
+		return ""
+	}
+	pairs := strings.Split(headers, ",")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		pairs[i] = key + "=" + redactedValue
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newConfigFileFlags returns a flag set with a subset of the flags of the agent.
+func newConfigFileFlags(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&cfg.CgroupAllow, "cgroup-allow", "", "")
+	fs.StringVar(&cfg.CollAgentAddr, "collection-agent", "", "")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "")
+	fs.BoolVar(&cfg.DisableTLS, "disable-tls", false, "")
+	fs.StringVar(&cfg.OTLPHeaders, "otlp-headers", "", "")
+	fs.Float64Var(&cfg.OffCPUThreshold, "off-cpu-threshold", 0, "")
+	fs.DurationVar(&cfg.ReporterInterval, "reporter-interval", 5*time.Second, "")
+	fs.IntVar(&cfg.SamplesPerSecond, "samples-per-second", 20, "")
+	fs.StringVar(&cfg.Tracers, "t", "all", "")
+	fs.StringVar(&cfg.Tracers, "tracers", "all", "")
+	fs.BoolVar(&cfg.Version, "version", false, "")
+	return fs
+}
+
+func parseConfigFile(file, content string) (*Config, error) {
+	var cfg Config
+	fs := newConfigFileFlags(&cfg)
+	return &cfg, ParseConfigFile(file, strings.NewReader(content), fs, fs.Set)
+}
+
+func TestParseConfigFile(t *testing.T) {
+	cfg, err := parseConfigFile("agent.yaml", `
+samples-per-second: 50
+off-cpu-threshold: 0.1
+reporter:
+  collection-agent: localhost:4317
+  disable-tls: true
+  interval: 10s
+  headers:
+    authorization: token
+    tenant: a
+filters:
+  cgroup-allow: [/kubepods.slice/*, /system.slice/*]
+tracers:
+  include:
+    - perl
+    - python
+`)
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.SamplesPerSecond)
+	assert.InDelta(t, 0.1, cfg.OffCPUThreshold, 1e-9)
+	assert.Equal(t, "localhost:4317", cfg.CollAgentAddr)
+	assert.True(t, cfg.DisableTLS)
+	assert.Equal(t, 10*time.Second, cfg.ReporterInterval)
+	assert.Equal(t, "authorization=token,tenant=a", cfg.OTLPHeaders)
+	assert.Equal(t, "/kubepods.slice/*,/system.slice/*", cfg.CgroupAllow)
+	assert.Equal(t, "perl,python", cfg.Tracers)
+
+	cfg, err = parseConfigFile("agent.json",
+		`{"samples-per-second": 30, "reporter": {"interval": "1m"}}`)
+	require.NoError(t, err)
+	assert.Equal(t, 30, cfg.SamplesPerSecond)
+	assert.Equal(t, time.Minute, cfg.ReporterInterval)
+
+	_, err = parseConfigFile("empty.yaml", "")
+	require.NoError(t, err)
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	for content, wantErr := range map[string]string{
+		"samples-per-second: 20\nsamples: 20\n": "agent.yaml:2: unknown setting samples",
+		"reporter-interval: 10s\n": "agent.yaml:1: unknown setting reporter-interval, " +
+			"did you mean reporter.interval?",
+		"reporter:\n  interval: 10\n":     `agent.yaml:2: invalid value "10" for reporter.interval`,
+		"samples-per-second: many\n":      `invalid value "many" for samples-per-second`,
+		"samples-per-second: [1, 2]\n":    "agent.yaml:1: samples-per-second takes a single value",
+		"samples-per-second:\n":           "agent.yaml:1: missing value for samples-per-second",
+		"tracers: perl\n":                 "agent.yaml:1: expected a mapping of settings in section",
+		"t: perl\n":                       "agent.yaml:1: unknown setting t",
+		"version: true\n":                 "agent.yaml:1: unknown setting version",
+		"- samples-per-second\n":          "agent.yaml:1: expected a mapping of settings",
+		"filters:\n  cgroup-allow: [[a]]": "agent.yaml:2: expected a list of values",
+		"tracers:\n  include: perl\ntracers:\n  include: python\n": "agent.yaml:4: " +
+			"tracers.include is already set on line 2",
+		"reporter: {interval: 1s\n": "agent.yaml: yaml: line 1",
+	} {
+		_, err := parseConfigFile("agent.yaml", content)
+		require.ErrorContains(t, err, wantErr, content)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	var cfg Config
+	fs := newConfigFileFlags(&cfg)
+	require.NoError(t, fs.Parse([]string{"-collection-agent=localhost:4317",
+		"-reporter-interval=10s", "-tracers=perl,python", "-off-cpu-threshold=0.5",
+		"-otlp-headers=Authorization=Bearer secret,X-Tenant=a"}))
+
+	var out bytes.Buffer
+	require.NoError(t, PrintConfig(&out, fs))
+	assert.Equal(t, `off-cpu-threshold: 0.5
+samples-per-second: 20
+filters:
+  cgroup-allow: ""
+reporter:
+  collection-agent: localhost:4317
+  disable-tls: false
+  headers: Authorization=REDACTED,X-Tenant=REDACTED
+  interval: 10s
+tracers:
+  include: perl,python
+`, out.String())
+	assert.NotContains(t, out.String(), "secret")
+
+	// The printed configuration parses to the same configuration.
+	parsed, err := parseConfigFile("agent.yaml", out.String())
+	require.NoError(t, err)
+	assert.Equal(t, cfg.CollAgentAddr, parsed.CollAgentAddr)
+	assert.Equal(t, cfg.ReporterInterval, parsed.ReporterInterval)
+	assert.Equal(t, cfg.Tracers, parsed.Tracers)
+	assert.InDelta(t, cfg.OffCPUThreshold, parsed.OffCPUThreshold, 1e-9)
+}
@@ -0,0 +1,334 @@
+package controller // import "go.opentelemetry.io/ebpf-profiler/internal/controller"
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter"
+	"go.opentelemetry.io/ebpf-profiler/tracer"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// maxCaptureDuration is the maximum duration of a one-shot profile.
+const maxCaptureDuration = 5 * time.Minute
+
+// controlTracer is the part of the tracer that the control API operates on.
+type controlTracer interface {
+	Status() tracer.Status
+	SetProfilingMode(mode tracer.ProfilingMode)
+	HoldProfiling() (release func())
+	SetSamplingFrequency(frequency int) error
+	SetOffCPUProfiling(enable bool) error
+	SetIncludedTracers(tracers tracertypes.IncludedTracers) error
+}
+
+// profileCapturer is implemented by reporters that capture one-shot profiles.
+type profileCapturer interface {
+	Capture(ctx context.Context, pids libpf.Set[libpf.PID],
+		duration time.Duration) ([]byte, error)
+}
+
+// controlStatus is the JSON encoding of tracer.Status that the control API returns.
+type controlStatus struct {
+	Mode             string   `json:"mode"`
+	Profiling        bool     `json:"profiling"`
+	Paused           bool     `json:"paused"`
+	SamplesPerSecond int      `json:"samples_per_second"`
+	OffCPU           bool     `json:"off_cpu"`
+	Tracers          []string `json:"tracers"`
+}
+
+// controlServer serves the control API, which allows operators to control profiling
+// of the running agent. All calls return the live status of the tracer as JSON,
+// except for one-shot profiles, which return the status in the Profiler-Status header.
+//
+//	GET  /v1/status
+//	POST /v1/profiling?mode=on|off|auto
+//	POST /v1/sampling?frequency=HZ
+//	POST /v1/offcpu?enabled=true|false
+//	POST /v1/tracers?enable=LIST&disable=LIST
+//	POST /v1/profile?seconds=N&pid=LIST
+type controlServer struct {
+	tracer controlTracer
+	// capturer captures one-shot profiles, nil if the reporter does not support them.
+	capturer profileCapturer
+}
+
+// newControlHandler returns the handler of the control API. If token is not empty,
+// the handler rejects requests that do not carry it as bearer token.
+func newControlHandler(trc controlTracer, capturer profileCapturer,
+	token string) http.Handler {
+	s := &controlServer{tracer: trc, capturer: capturer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("POST /v1/profiling", s.handleProfiling)
+	mux.HandleFunc("POST /v1/sampling", s.handleSampling)
+	mux.HandleFunc("POST /v1/offcpu", s.handleOffCPU)
+	mux.HandleFunc("POST /v1/tracers", s.handleTracers)
+	mux.HandleFunc("POST /v1/profile", s.handleProfile)
+	if token == "" {
+		return mux
+	}
+	return requireToken(token, mux)
+}
+
+// requireToken returns a handler that passes only the requests to next that carry
+// token in the header Authorization: Bearer TOKEN.
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startControlServer serves the control API on addr until ctx is done. addr is
+// either the path of a Unix socket or a loopback address. Clients must authenticate
+// with the token in tokenFile, which is required for loopback addresses.
+func startControlServer(ctx context.Context, addr, tokenFile string, trc controlTracer,
+	capturer profileCapturer) error {
+	var token string
+	if tokenFile != "" {
+		var err error
+		if token, err = readControlToken(tokenFile); err != nil {
+			return err
+		}
+	} else if !isUnixSocket(addr) {
+		return fmt.Errorf("serving the control API on %s requires a token", addr)
+	}
+
+	listener, err := listenControl(addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           newControlHandler(trc, capturer, token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Serving control API on %s failed: %v", addr, err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			log.Errorf("Failed to close control API server: %v", err)
+		}
+	}()
+	return nil
+}
+
+// listenControl listens on the Unix socket or the loopback address addr.
+func listenControl(addr string) (net.Listener, error) {
+	if !isUnixSocket(addr) {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove the socket left behind by a previous run.
+	if err := os.Remove(addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %v", err)
+	}
+	// Only the user of the agent may control it. The socket is created with these
+	// permissions, as changing them afterwards leaves a window in which everyone can
+	// connect. The umask is process wide, but the agent creates the socket at startup.
+	oldMask := unix.Umask(0o177)
+	listener, err := net.Listen("unix", addr)
+	unix.Umask(oldMask)
+	return listener, err
+}
+
+// readControlToken reads the bearer token of the control API from path.
+func readControlToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read control token: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("control token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// isUnixSocket returns whether the control address addr is the path of a Unix socket.
+func isUnixSocket(addr string) bool {
+	return strings.Contains(addr, "/")
+}
+
+// validateControlAddr checks that addr is a Unix socket or a loopback address.
+func validateControlAddr(addr string) error {
+	if isUnixSocket(addr) {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", host)
+	}
+	return nil
+}
+
+func (s *controlServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.writeStatus(w)
+}
+
+func (s *controlServer) handleProfiling(w http.ResponseWriter, r *http.Request) {
+	var mode tracer.ProfilingMode
+	switch r.URL.Query().Get("mode") {
+	case "on":
+		mode = tracer.ProfilingOn
+	case "off":
+		mode = tracer.ProfilingOff
+	case "auto":
+		mode = tracer.ProfilingAuto
+	default:
+		http.Error(w, "mode must be on, off or auto", http.StatusBadRequest)
+		return
+	}
+	s.tracer.SetProfilingMode(mode)
+	s.writeStatus(w)
+}
+
+func (s *controlServer) handleSampling(w http.ResponseWriter, r *http.Request) {
+	frequency, err := strconv.Atoi(r.URL.Query().Get("frequency"))
+	if err != nil || frequency < 1 {
+		http.Error(w, "frequency must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if err = s.tracer.SetSamplingFrequency(frequency); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.writeStatus(w)
+}
+
+func (s *controlServer) handleOffCPU(w http.ResponseWriter, r *http.Request) {
+	enable, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+	if err = s.tracer.SetOffCPUProfiling(enable); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.writeStatus(w)
+}
+
+func (s *controlServer) handleTracers(w http.ResponseWriter, r *http.Request) {
+	enable, err := tracertypes.Parse(r.URL.Query().Get("enable"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	disable, err := tracertypes.Parse(r.URL.Query().Get("disable"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tracers := (s.tracer.Status().Tracers | enable) &^ disable
+	if err = s.tracer.SetIncludedTracers(tracers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeStatus(w)
+}
+
+func (s *controlServer) handleProfile(w http.ResponseWriter, r *http.Request) {
+	if s.capturer == nil {
+		http.Error(w, "the reporter does not support one-shot profiles",
+			http.StatusNotImplemented)
+		return
+	}
+
+	seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+	duration := time.Duration(seconds) * time.Second
+	if err != nil || duration <= 0 || duration > maxCaptureDuration {
+		http.Error(w, fmt.Sprintf("seconds must be between 1 and %d",
+			int(maxCaptureDuration.Seconds())), http.StatusBadRequest)
+		return
+	}
+	pids := libpf.Set[libpf.PID]{}
+	for _, elem := range splitList(r.URL.Query().Get("pid")) {
+		pid, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid pid %q", elem), http.StatusBadRequest)
+			return
+		}
+		pids[libpf.PID(pid)] = libpf.Void{}
+	}
+
+	// Profiling stays enabled during the capture, unless it is paused by the budget.
+	release := s.tracer.HoldProfiling()
+	profile, err := s.capturer.Capture(r.Context(), pids, duration)
+	release()
+	switch {
+	case errors.Is(err, reporter.ErrCaptureRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, reporter.ErrNoSamples):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status, err := json.Marshal(s.status())
+	if err == nil {
+		w.Header().Set("Profiler-Status", string(status))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile.pb.gz"`)
+	if _, err = w.Write(profile); err != nil {
+		log.Debugf("Failed to send one-shot profile: %v", err)
+	}
+}
+
+// status returns the live status of the tracer.
+func (s *controlServer) status() controlStatus {
+	st := s.tracer.Status()
+	return controlStatus{
+		Mode:             st.Mode.String(),
+		Profiling:        st.Profiling,
+		Paused:           st.Paused,
+		SamplesPerSecond: st.SamplesPerSecond,
+		OffCPU:           st.OffCPU,
+		Tracers:          splitList(st.Tracers.String()),
+	}
+}
+
+// writeStatus writes the live status of the tracer as JSON to w.
+func (s *controlServer) writeStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.status()); err != nil {
+		log.Debugf("Failed to send control status: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/tracer"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+type fakeControlTracer struct {
+	status tracer.Status
+	holds  int
+}
+
+func (f *fakeControlTracer) Status() tracer.Status { return f.status }
+
+func (f *fakeControlTracer) SetProfilingMode(mode tracer.ProfilingMode) {
+	f.status.Mode = mode
+	f.status.Profiling = mode != tracer.ProfilingOff
+}
+
+func (f *fakeControlTracer) HoldProfiling() func() {
+	f.holds++
+	return func() { f.holds-- }
+}
+
+func (f *fakeControlTracer) SetSamplingFrequency(frequency int) error {
+	f.status.SamplesPerSecond = frequency
+	return nil
+}
+
+func (f *fakeControlTracer) SetOffCPUProfiling(enable bool) error {
+	if enable {
+		return errors.New("off-cpu profiling is not configured")
+	}
+	f.status.OffCPU = false
+	return nil
+}
+
+func (f *fakeControlTracer) SetIncludedTracers(tracers tracertypes.IncludedTracers) error {
+	f.status.Tracers = tracers
+	return nil
+}
+
+type fakeCapturer struct {
+	pids     libpf.Set[libpf.PID]
+	duration time.Duration
+	holds    int
+	trc      *fakeControlTracer
+}
+
+func (f *fakeCapturer) Capture(_ context.Context, pids libpf.Set[libpf.PID],
+	duration time.Duration) ([]byte, error) {
+	f.pids = pids
+	f.duration = duration
+	f.holds = f.trc.holds
+	return []byte("profile"), nil
+}
+
+func TestControlServer(t *testing.T) {
+	tracers, err := tracertypes.Parse("python,perl")
+	require.NoError(t, err)
+	trc := &fakeControlTracer{status: tracer.Status{
+		Profiling:        true,
+		SamplesPerSecond: 20,
+		OffCPU:           true,
+		Tracers:          tracers,
+	}}
+	capturer := &fakeCapturer{trc: trc}
+	server := httptest.NewServer(newControlHandler(trc, capturer, ""))
+	defer server.Close()
+
+	call := func(method, path string, wantCode int) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, http.NoBody)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, wantCode, resp.StatusCode, "%s %s", method, path)
+		return resp
+	}
+	status := func(method, path string) controlStatus {
+		var st controlStatus
+		require.NoError(t, json.NewDecoder(call(method, path, http.StatusOK).Body).Decode(&st))
+		return st
+	}
+
+	assert.Equal(t, controlStatus{
+		Mode:             "auto",
+		Profiling:        true,
+		SamplesPerSecond: 20,
+		OffCPU:           true,
+		Tracers:          []string{"perl", "python"},
+	}, status(http.MethodGet, "/v1/status"))
+
+	st := status(http.MethodPost, "/v1/profiling?mode=off")
+	assert.Equal(t, "off", st.Mode)
+	assert.False(t, st.Profiling)
+	call(http.MethodPost, "/v1/profiling?mode=maybe", http.StatusBadRequest)
+	call(http.MethodGet, "/v1/profiling?mode=on", http.StatusMethodNotAllowed)
+
+	assert.Equal(t, 50, status(http.MethodPost, "/v1/sampling?frequency=50").SamplesPerSecond)
+	call(http.MethodPost, "/v1/sampling?frequency=0", http.StatusBadRequest)
+
+	assert.False(t, status(http.MethodPost, "/v1/offcpu?enabled=false").OffCPU)
+	call(http.MethodPost, "/v1/offcpu?enabled=true", http.StatusConflict)
+
+	assert.Equal(t, []string{"perl", "ruby"},
+		status(http.MethodPost, "/v1/tracers?enable=ruby&disable=python").Tracers)
+	call(http.MethodPost, "/v1/tracers?enable=cobol", http.StatusBadRequest)
+
+	resp := call(http.MethodPost, "/v1/profile?seconds=10&pid=42,43", http.StatusOK)
+	assert.Equal(t, libpf.Set[libpf.PID]{42: {}, 43: {}}, capturer.pids)
+	assert.Equal(t, 10*time.Second, capturer.duration)
+	assert.Equal(t, 1, capturer.holds)
+	assert.Equal(t, 0, trc.holds)
+	assert.Contains(t, resp.Header.Get("Profiler-Status"), `"mode":"off"`)
+	call(http.MethodPost, "/v1/profile?seconds=0", http.StatusBadRequest)
+	call(http.MethodPost, "/v1/profile?seconds=1&pid=x", http.StatusBadRequest)
+}
+
+func TestValidateControlAddr(t *testing.T) {
+	for addr, wantErr := range map[string]bool{
+		"/run/ebpf-profiler.sock": false,
+		"localhost:6061":          false,
+		"127.0.0.1:6061":          false,
+		"[::1]:6061":              false,
+		"0.0.0.0:6061":            true,
+		"example.com:6061":        true,
+		"localhost":               true,
+	} {
+		err := validateControlAddr(addr)
+		assert.Equal(t, wantErr, err != nil, "%s: %v", addr, err)
+	}
+}
+
+func TestControlServerToken(t *testing.T) {
+	trc := &fakeControlTracer{}
+	server := httptest.NewServer(newControlHandler(trc, nil, "secret"))
+	defer server.Close()
+
+	for auth, wantCode := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Basic secret":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/status", http.NoBody)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, wantCode, resp.StatusCode, auth)
+	}
+}
+
+func TestListenControl(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "control.sock")
+	// A stale socket of a previous run is replaced.
+	require.NoError(t, os.WriteFile(addr, nil, 0o644))
+
+	listener, err := listenControl(addr)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	info, err := os.Stat(addr)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestReadControlToken(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+	token, err := readControlToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", token)
+
+	require.NoError(t, os.WriteFile(path, []byte(" \n"), 0o600))
+	_, err = readControlToken(path)
+	require.Error(t, err)
+	_, err = readControlToken(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	err = startControlServer(context.Background(), "localhost:0", "", nil, nil)
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package controller // import "go.opentelemetry.io/ebpf-profiler/internal/control
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/host"
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
+	pm "go.opentelemetry.io/ebpf-profiler/processmanager"
 	"go.opentelemetry.io/ebpf-profiler/reporter"
 	"go.opentelemetry.io/ebpf-profiler/times"
 	"go.opentelemetry.io/ebpf-profiler/tracehandler"
@@ -25,9 +27,17 @@ const MiB = 1 << 20
 
 // Controller is an instance that runs, manages and stops the agent.
 type Controller struct {
-	config   *Config
-	reporter reporter.Reporter
-	tracer   *tracer.Tracer
+	config       *Config
+	reporter     reporter.Reporter
+	tracer       *tracer.Tracer
+	cgroupFilter *pm.CgroupFilter
+	// budget is the budget of the agent, nil if it has none.
+	budget *budget
+
+	// includeTracers holds the tracers whose unwinders are loaded.
+	includeTracers tracertypes.IncludedTracers
+	// offCPU tells whether off-cpu profiling was started.
+	offCPU bool
 }
 
 // New creates a new controller
@@ -69,20 +79,42 @@ func (c *Controller) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to parse the included tracers: %w", err)
 	}
 
+	perfEvents, err := tracertypes.ParsePerfEvents(c.config.PerfEvents)
+	if err != nil {
+		return fmt.Errorf("failed to parse the perf events: %w", err)
+	}
+
+	uprobes, err := tracertypes.ParseUprobes(c.config.Uprobes)
+	if err != nil {
+		return fmt.Errorf("failed to parse the uprobes: %w", err)
+	}
+
+	allocLibraries, err := tracertypes.ParseAllocLibraries(c.config.AllocLibraries)
+	if err != nil {
+		return fmt.Errorf("failed to parse the allocator libraries: %w", err)
+	}
+
 	err = c.reporter.Start(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start reporter: %w", err)
 	}
 
-	envVars := libpf.Set[string]{}
-	splittedEnvVars := strings.Split(c.config.IncludeEnvVars, ",")
-	for _, envVar := range splittedEnvVars {
-		envVar = strings.TrimSpace(envVar)
-		if envVar != "" {
-			envVars[envVar] = libpf.Void{}
-		}
+	envVars := parseEnvVars(c.config.IncludeEnvVars)
+
+	c.cgroupFilter, err = pm.NewCgroupFilter(c.config.CgroupFilterConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create cgroup filter: %w", err)
+	}
+
+	var nativeSymbolCacheSize uint64
+	if c.config.SymbolizeNative {
+		nativeSymbolCacheSize = uint64(c.config.SymbolizeNativeCache) * 1024 * 1024
 	}
 
+	// The budget and the control API change the sampling frequency at runtime.
+	adjustableSampling := c.config.BudgetCPU > 0 || c.config.BudgetMemory > 0 ||
+		c.config.ControlAddr != ""
+
 	// Load the eBPF code and map definitions
 	trc, err := tracer.NewTracer(ctx, &tracer.Config{
 		Reporter:               c.reporter,
@@ -90,6 +122,8 @@ func (c *Controller) Start(ctx context.Context) error {
 		IncludeTracers:         includeTracers,
 		FilterErrorFrames:      !c.config.SendErrorFrames,
 		SamplesPerSecond:       c.config.SamplesPerSecond,
+		MinSamplesPerSecond:    c.config.MinSamplesPerSecond,
+		AdjustableSampling:     adjustableSampling,
 		MapScaleFactor:         int(c.config.MapScaleFactor),
 		KernelVersionCheck:     !c.config.NoKernelVersionCheck,
 		DebugTracer:            c.config.VerboseMode,
@@ -97,12 +131,25 @@ func (c *Controller) Start(ctx context.Context) error {
 		ProbabilisticInterval:  c.config.ProbabilisticInterval,
 		ProbabilisticThreshold: c.config.ProbabilisticThreshold,
 		OffCPUThreshold:        uint32(c.config.OffCPUThreshold * float64(math.MaxUint32)),
+		OffCPUWakeups:          c.config.OffCPUWakeups,
 		IncludeEnvVars:         envVars,
+		NativeSymbolCacheSize:  nativeSymbolCacheSize,
+		NativeSymbolDWARF:      c.config.SymbolizeNativeDWARF,
+		TargetPID:              libpf.PID(c.config.TargetPID),
+		TargetChildren:         c.config.TargetChildren,
+		PerfEvents:             perfEvents,
+		Uprobes:                uprobes,
+		AllocSampleInterval:    uint32(c.config.AllocSampleInterval),
+		AllocInUse:             c.config.AllocInUse,
+		AllocLibraries:         allocLibraries,
+		ContentionThreshold:    uint32(c.config.ContentionThreshold * float64(math.MaxUint32)),
+		RunQueueThreshold:      uint32(c.config.RunQueueThreshold * float64(math.MaxUint32)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to load eBPF tracer: %w", err)
 	}
 	c.tracer = trc
+	c.includeTracers = includeTracers
 	log.Printf("eBPF tracer loaded")
 
 	now := time.Now()
@@ -117,12 +164,51 @@ func (c *Controller) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to attach to perf event: %w", err)
 	}
 	log.Info("Attached tracer program")
+	if c.config.MinSamplesPerSecond > 0 &&
+		c.config.MinSamplesPerSecond < c.config.SamplesPerSecond {
+		log.Printf("Enabled adaptive sampling down to %d Hz", c.config.MinSamplesPerSecond)
+	}
 
 	if c.config.OffCPUThreshold > 0.0 {
 		if err := trc.StartOffCPUProfiling(); err != nil {
 			return fmt.Errorf("failed to start off-cpu profiling: %v", err)
 		}
+		c.offCPU = true
 		log.Printf("Enabled off-cpu profiling with p=%f", c.config.OffCPUThreshold)
+		if c.config.OffCPUWakeups {
+			log.Printf("Enabled wakeup attribution of off-cpu profiling")
+		}
+	}
+
+	if c.config.ContentionThreshold > 0.0 {
+		if err := trc.StartContentionProfiling(); err != nil {
+			return fmt.Errorf("failed to start lock contention profiling: %v", err)
+		}
+		log.Printf("Enabled lock contention profiling with p=%f",
+			c.config.ContentionThreshold)
+	}
+
+	if c.config.RunQueueThreshold > 0.0 {
+		if err := trc.StartRunQueueProfiling(); err != nil {
+			return fmt.Errorf("failed to start run queue latency profiling: %v", err)
+		}
+		log.Printf("Enabled run queue latency profiling with p=%f",
+			c.config.RunQueueThreshold)
+	}
+
+	if len(uprobes) > 0 {
+		if err := trc.AttachUprobes(); err != nil {
+			return fmt.Errorf("failed to attach uprobes: %w", err)
+		}
+		log.Printf("Attached %d uprobes", len(uprobes))
+	}
+
+	if c.config.AllocSampleInterval > 0 {
+		if err := trc.AttachAllocProbes(ctx); err != nil {
+			return fmt.Errorf("failed to attach allocation probes: %w", err)
+		}
+		log.Printf("Enabled allocation profiling with an interval of %d bytes",
+			c.config.AllocSampleInterval)
 	}
 
 	if c.config.ProbabilisticThreshold < tracer.ProbabilisticThresholdMax {
@@ -134,6 +220,14 @@ func (c *Controller) Start(ctx context.Context) error {
 		}
 	}
 
+	if c.config.BudgetCPU > 0 || c.config.BudgetMemory > 0 {
+		c.budget = newBudget(c.config.BudgetCPU, uint64(c.config.BudgetMemory)*MiB,
+			c.config.SamplesPerSecond, includeTracers, trc)
+		c.budget.start(ctx, c.config.MonitorInterval)
+		log.Printf("Enabled budget of %.1f%% CPU and %d MiB memory",
+			c.config.BudgetCPU, c.config.BudgetMemory)
+	}
+
 	if err := trc.AttachSchedMonitor(); err != nil {
 		return fmt.Errorf("failed to attach scheduler monitor: %w", err)
 	}
@@ -142,14 +236,48 @@ func (c *Controller) Start(ctx context.Context) error {
 	// So if you change this log line update also the system test.
 	log.Printf("Attached sched monitor")
 
-	if err := startTraceHandling(ctx, c.reporter, intervals, trc,
+	trc.StartCgroupFilter(ctx, c.cgroupFilter)
+
+	if err := startTraceHandling(ctx, c.reporter, intervals, trc, c.cgroupFilter,
 		traceHandlerCacheSize); err != nil {
 		return fmt.Errorf("failed to start trace handling: %w", err)
 	}
 
+	if c.config.ControlAddr != "" {
+		capturer, _ := c.reporter.(profileCapturer)
+		var ctrl controlTracer = trc
+		if c.budget != nil {
+			ctrl = &budgetControlTracer{controlTracer: trc, budget: c.budget}
+		}
+		if err := startControlServer(ctx, c.config.ControlAddr,
+			c.config.ControlTokenFile, ctrl, capturer); err != nil {
+			return fmt.Errorf("failed to start control API: %w", err)
+		}
+		log.Printf("Serving control API on %s", c.config.ControlAddr)
+	}
+
 	return nil
 }
 
+// UpdateCgroupFilter replaces the cgroup and container filter rules of the running
+// controller.
+func (c *Controller) UpdateCgroupFilter(cfg pm.CgroupFilterConfig) error {
+	if c.cgroupFilter == nil {
+		return errors.New("controller is not started")
+	}
+	return c.cgroupFilter.Update(cfg)
+}
+
+// Drain stops profiling and waits until the traces that were recorded so far are
+// handed over to the reporter. It allows to report all traces before Shutdown.
+func (c *Controller) Drain(ctx context.Context) error {
+	if c.tracer == nil {
+		return errors.New("controller is not started")
+	}
+	c.tracer.SetProfilingMode(tracer.ProfilingOff)
+	return c.tracer.FlushTraces(ctx)
+}
+
 // Shutdown stops the controller
 func (c *Controller) Shutdown() {
 	log.Info("Stop processing ...")
@@ -162,8 +290,21 @@ func (c *Controller) Shutdown() {
 	}
 }
 
+// parseEnvVars returns the set of environment variables in the comma separated list s.
+func parseEnvVars(s string) libpf.Set[string] {
+	envVars := libpf.Set[string]{}
+	for _, envVar := range strings.Split(s, ",") {
+		envVar = strings.TrimSpace(envVar)
+		if envVar != "" {
+			envVars[envVar] = libpf.Void{}
+		}
+	}
+	return envVars
+}
+
 func startTraceHandling(ctx context.Context, rep reporter.TraceReporter,
-	intervals *times.Times, trc *tracer.Tracer, cacheSize uint32) error {
+	intervals *times.Times, trc *tracer.Tracer, traceFilter tracehandler.TraceFilter,
+	cacheSize uint32) error {
 	// Spawn monitors for the various result maps
 	traceCh := make(chan *host.Trace)
 
@@ -171,7 +312,7 @@ func startTraceHandling(ctx context.Context, rep reporter.TraceReporter,
 		return fmt.Errorf("failed to start map monitors: %v", err)
 	}
 
-	_, err := tracehandler.Start(ctx, rep, trc.TraceProcessor(),
+	_, err := tracehandler.Start(ctx, rep, trc.TraceProcessor(), traceFilter,
 		traceCh, intervals, cacheSize)
 	return err
 }
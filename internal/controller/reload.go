@@ -0,0 +1,228 @@
+package controller // import "go.opentelemetry.io/ebpf-profiler/internal/controller"
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// reloadableFlags holds the flags whose changes Reload applies to the running agent.
+// Changes of all other flags require a restart.
+var reloadableFlags = libpf.Set[string]{
+	"cgroup-allow":            {},
+	"cgroup-deny":             {},
+	"collection-agent":        {},
+	"container-allow":         {},
+	"container-deny":          {},
+	"disable-tls":             {},
+	"env-vars":                {},
+	"off-cpu-threshold":       {},
+	"otlp-headers":            {},
+	"otlp-protocol":           {},
+	"probabilistic-interval":  {},
+	"probabilistic-threshold": {},
+	"reporter-interval":       {},
+	"t":                       {},
+	"tracers":                 {},
+}
+
+// endpointFlags holds the flags that select the backend of the reporter.
+var endpointFlags = []string{"collection-agent", "disable-tls", "otlp-headers", "otlp-protocol"}
+
+// Reload applies the configuration cfg, and the reporter configuration repCfg derived
+// from it, to the running controller without restarting the tracer. It rejects cfg if
+// it changes a setting that requires a restart. If applying a change fails, the
+// changes before it stay applied and are recorded in the configuration of the
+// controller. While the budget disables the interpreter unwinders, they stay disabled.
+// Changes that the control API made to a reloaded setting are replaced.
+func (c *Controller) Reload(ctx context.Context, cfg *Config, repCfg *reporter.Config) error {
+	if c.tracer == nil {
+		return errors.New("controller is not started")
+	}
+	changed, err := c.checkReload(cfg)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		log.Info("Configuration is unchanged")
+		return nil
+	}
+
+	status := c.tracer.Status()
+
+	// The reporter connects to a new backend first, as it is most likely to fail.
+	if hasAny(changed, endpointFlags...) {
+		if err = c.reporter.(reporter.ReconnectReporter).Reconnect(ctx, repCfg); err != nil {
+			return fmt.Errorf("failed to connect to the new backend: %v", err)
+		}
+		c.applied(cfg, endpointFlags...)
+	}
+	if hasAny(changed, "off-cpu-threshold") {
+		if cfg.OffCPUThreshold > 0 && c.config.OffCPUThreshold > 0 && !status.OffCPU {
+			log.Warnf("Switching off-cpu profiling back on, " +
+				"which the control API switched off")
+		}
+		threshold := uint32(cfg.OffCPUThreshold * float64(math.MaxUint32))
+		if err = c.tracer.SetOffCPUThreshold(threshold); err != nil {
+			return fmt.Errorf("failed to change the off-cpu threshold: %v", err)
+		}
+		c.applied(cfg, "off-cpu-threshold")
+	}
+	if hasAny(changed, "t", "tracers") {
+		// checkReload made sure that the tracers parse.
+		tracers, _ := tracertypes.Parse(cfg.Tracers)
+		if err = c.setIncludedTracers(status.Tracers, tracers); err != nil {
+			return fmt.Errorf("failed to change the tracers: %v", err)
+		}
+		c.applied(cfg, "t", "tracers")
+	}
+	if hasAny(changed, "probabilistic-interval", "probabilistic-threshold") {
+		if err = c.tracer.SetProbabilisticProfiling(ctx, cfg.ProbabilisticInterval,
+			cfg.ProbabilisticThreshold); err != nil {
+			return fmt.Errorf("failed to change probabilistic profiling: %v", err)
+		}
+		c.applied(cfg, "probabilistic-interval", "probabilistic-threshold")
+	}
+	if hasAny(changed, "env-vars") {
+		c.tracer.SetIncludeEnvVars(parseEnvVars(cfg.IncludeEnvVars))
+		c.applied(cfg, "env-vars")
+	}
+	if hasAny(changed, "cgroup-allow", "cgroup-deny", "container-allow", "container-deny") {
+		if err = c.cgroupFilter.Update(cfg.CgroupFilterConfig()); err != nil {
+			return fmt.Errorf("failed to change the filters: %v", err)
+		}
+		c.applied(cfg, "cgroup-allow", "cgroup-deny", "container-allow", "container-deny")
+	}
+	if hasAny(changed, "reporter-interval") {
+		c.reporter.(reporter.IntervalReporter).SetReportInterval(cfg.ReporterInterval)
+		c.applied(cfg, "reporter-interval")
+	}
+
+	cfg.Reporter = c.config.Reporter
+	c.config = cfg
+	log.Infof("Reloaded configuration with changed %s", flagList(changed))
+	return nil
+}
+
+// setIncludedTracers switches on tracers, which replace the active tracers of the
+// tracer. With a budget, the budget decides which of them are switched on.
+func (c *Controller) setIncludedTracers(active,
+	tracers tracertypes.IncludedTracers) error {
+	expected, _ := tracertypes.Parse(c.config.Tracers)
+	if c.budget != nil {
+		expected = c.budget.activeTracers(expected)
+	}
+	if active != expected&c.includeTracers {
+		log.Warnf("Replacing the tracers %s that were set with the control API",
+			active.String())
+	}
+
+	if c.budget != nil {
+		return c.budget.setIncludedTracers(tracers)
+	}
+	return c.tracer.SetIncludedTracers(tracers)
+}
+
+// applied records the values of the flags names of cfg in the configuration of the
+// controller, once their changes are applied.
+func (c *Controller) applied(cfg *Config, names ...string) {
+	for _, name := range names {
+		f := cfg.Fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		// The flag sets bind the flags to the fields of their configuration.
+		if err := c.config.Fs.Set(name, f.Value.String()); err != nil {
+			log.Errorf("Failed to record the reloaded value of -%s: %v", name, err)
+		}
+	}
+}
+
+// checkReload validates cfg and returns the flags that it changes. It returns an error
+// if cfg changes a setting that requires a restart.
+func (c *Controller) checkReload(cfg *Config) (libpf.Set[string], error) {
+	if c.config.Fs == nil || cfg.Fs == nil {
+		return nil, errors.New("reload requires a configuration that is parsed from flags")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	changed := changedFlags(c.config.Fs, cfg.Fs)
+	restart := libpf.Set[string]{}
+	for name := range changed {
+		if _, ok := reloadableFlags[name]; !ok {
+			restart[name] = libpf.Void{}
+		}
+	}
+	if len(restart) > 0 {
+		return nil, fmt.Errorf("changing %s requires a restart", flagList(restart))
+	}
+
+	if hasAny(changed, "t", "tracers") {
+		tracers, err := tracertypes.Parse(cfg.Tracers)
+		if err != nil {
+			return nil, err
+		}
+		if missing := tracers &^ c.includeTracers; missing != 0 {
+			return nil, fmt.Errorf("enabling the tracers %s requires a restart",
+				missing.String())
+		}
+	}
+	if hasAny(changed, "off-cpu-threshold") && cfg.OffCPUThreshold > 0 && !c.offCPU {
+		return nil, errors.New("enabling off-cpu profiling requires a restart")
+	}
+	if hasAny(changed, "reporter-interval") {
+		if _, ok := c.reporter.(reporter.IntervalReporter); !ok {
+			return nil, errors.New("the reporter does not support changing -reporter-interval")
+		}
+	}
+	if hasAny(changed, endpointFlags...) {
+		if _, ok := c.reporter.(reporter.ReconnectReporter); !ok {
+			return nil, errors.New("the reporter does not support changing its backend")
+		}
+	}
+	return changed, nil
+}
+
+// changedFlags returns the names of the flags whose values differ between the flag
+// sets old and updated.
+func changedFlags(old, updated *flag.FlagSet) libpf.Set[string] {
+	changed := libpf.Set[string]{}
+	old.VisitAll(func(f *flag.Flag) {
+		if u := updated.Lookup(f.Name); u == nil || u.Value.String() != f.Value.String() {
+			changed[f.Name] = libpf.Void{}
+		}
+	})
+	return changed
+}
+
+// hasAny returns whether any of names is in flags.
+func hasAny(flags libpf.Set[string], names ...string) bool {
+	for _, name := range names {
+		if _, ok := flags[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flagList returns the sorted flags as a comma separated list, e.g. -a, -b.
+func flagList(flags libpf.Set[string]) string {
+	names := slices.Sorted(maps.Keys(flags))
+	for i, name := range names {
+		names[i] = "-" + name
+	}
+	return strings.Join(names, ", ")
+}
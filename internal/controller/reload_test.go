@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// intervalReporter is a reporter that supports changing the report interval only.
+type intervalReporter struct {
+	reporter.Reporter
+}
+
+func (intervalReporter) SetReportInterval(time.Duration) {}
+
+// newReloadConfig returns a valid configuration with a subset of the flags of the
+// agent, parsed from args.
+func newReloadConfig(t *testing.T, args ...string) *Config {
+	cfg := &Config{NoKernelVersionCheck: true}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&cfg.SamplesPerSecond, "samples-per-second", 20, "")
+	fs.DurationVar(&cfg.ProbabilisticInterval, "probabilistic-interval", time.Minute, "")
+	fs.UintVar(&cfg.ProbabilisticThreshold, "probabilistic-threshold", 100, "")
+	fs.DurationVar(&cfg.ReporterInterval, "reporter-interval", 5*time.Second, "")
+	fs.StringVar(&cfg.Tracers, "t", "perl", "")
+	fs.StringVar(&cfg.Tracers, "tracers", "perl", "")
+	fs.Float64Var(&cfg.OffCPUThreshold, "off-cpu-threshold", 0, "")
+	fs.StringVar(&cfg.CollAgentAddr, "collection-agent", "", "")
+	require.NoError(t, fs.Parse(args))
+	cfg.Fs = fs
+	return cfg
+}
+
+func TestCheckReload(t *testing.T) {
+	loaded, err := tracertypes.Parse("perl,python")
+	require.NoError(t, err)
+	c := &Controller{
+		config:         newReloadConfig(t),
+		reporter:       intervalReporter{},
+		includeTracers: loaded,
+	}
+
+	tests := map[string]struct {
+		args    []string
+		changed libpf.Set[string]
+		err     string
+	}{
+		"unchanged": {
+			changed: libpf.Set[string]{},
+		},
+		"reloadable": {
+			args: []string{"-reporter-interval=10s", "-probabilistic-threshold=50"},
+			changed: libpf.Set[string]{
+				"reporter-interval":       {},
+				"probabilistic-threshold": {},
+			},
+		},
+		"loaded tracers": {
+			args:    []string{"-tracers=perl,python"},
+			changed: libpf.Set[string]{"t": {}, "tracers": {}},
+		},
+		"restart": {
+			args: []string{"-samples-per-second=50", "-reporter-interval=10s"},
+			err:  "changing -samples-per-second requires a restart",
+		},
+		"invalid": {
+			args: []string{"-probabilistic-interval=10s"},
+			err:  "invalid argument for probabilistic-interval",
+		},
+		"unloaded tracers": {
+			args: []string{"-tracers=perl,ruby"},
+			err:  "enabling the tracers ruby requires a restart",
+		},
+		"off-cpu": {
+			args: []string{"-off-cpu-threshold=0.1"},
+			err:  "enabling off-cpu profiling requires a restart",
+		},
+		"endpoint": {
+			args: []string{"-collection-agent=localhost:4317"},
+			err:  "the reporter does not support changing its backend",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed, err := c.checkReload(newReloadConfig(t, tc.args...))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.changed, changed)
+		})
+	}
+}
+
+func TestReloadApplied(t *testing.T) {
+	c := &Controller{config: newReloadConfig(t)}
+	cfg := newReloadConfig(t, "-reporter-interval=10s", "-tracers=perl,python",
+		"-probabilistic-threshold=50")
+
+	c.applied(cfg, "reporter-interval", "t", "tracers")
+	assert.Equal(t, 10*time.Second, c.config.ReporterInterval)
+	assert.Equal(t, "perl,python", c.config.Tracers)
+	assert.Equal(t, uint(100), c.config.ProbabilisticThreshold)
+	// A later reload only sees the changes that were not applied.
+	assert.Equal(t, libpf.Set[string]{"probabilistic-threshold": {}},
+		changedFlags(c.config.Fs, cfg.Fs))
+}
+
+func TestReloadTracersWithBudget(t *testing.T) {
+	loaded, err := tracertypes.Parse("perl,python")
+	require.NoError(t, err)
+	actuator := &fakeActuator{tracers: loaded}
+	c := &Controller{
+		config:         newReloadConfig(t, "-tracers=perl,python"),
+		includeTracers: loaded,
+		budget:         newBudget(10, 0, 20, loaded, actuator),
+	}
+	c.budget.level = budgetLevelNoInterpreters
+
+	perl, err := tracertypes.Parse("perl")
+	require.NoError(t, err)
+	require.NoError(t, c.setIncludedTracers(withoutInterpreters(loaded), perl))
+	assert.Equal(t, withoutInterpreters(perl), actuator.tracers)
+	assert.Equal(t, perl, c.budget.includeTracers)
+}
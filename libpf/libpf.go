@@ -37,6 +37,27 @@ type UnixTime64 uint64
 // a native file.
 type AddressOrLineno uint64
 
+// inlineDepthShift is the bit position of the inline depth in the AddressOrLineno of
+// native frames. User space virtual addresses of ELF files fit into the bits below.
+const inlineDepthShift = 56
+
+// WithInlineDepth returns the native address tagged with the inline depth. Depth zero
+// is the function that contains the address in machine code, higher depths are the
+// functions inlined into it. This gives each inlined frame its own FrameID.
+func (a AddressOrLineno) WithInlineDepth(depth uint8) AddressOrLineno {
+	return a.StripInlineDepth() | AddressOrLineno(depth)<<inlineDepthShift
+}
+
+// InlineDepth returns the inline depth of a native address.
+func (a AddressOrLineno) InlineDepth() uint8 {
+	return uint8(a >> inlineDepthShift)
+}
+
+// StripInlineDepth returns the native address without the inline depth.
+func (a AddressOrLineno) StripInlineDepth() AddressOrLineno {
+	return a &^ (0xff << inlineDepthShift)
+}
+
 type FrameMetadata struct {
 	FileID         FileID
 	AddressOrLine  AddressOrLineno
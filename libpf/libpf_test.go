@@ -42,3 +42,15 @@ func TestTraceType(t *testing.T) {
 		assert.Equal(t, test.str, test.ty.String())
 	}
 }
+
+func TestInlineDepth(t *testing.T) {
+	addr := AddressOrLineno(0x7f1234)
+	assert.Equal(t, uint8(0), addr.InlineDepth())
+
+	inlined := addr.WithInlineDepth(3)
+	assert.NotEqual(t, addr, inlined)
+	assert.Equal(t, uint8(3), inlined.InlineDepth())
+	assert.Equal(t, addr, inlined.StripInlineDepth())
+	assert.Equal(t, uint8(1), inlined.WithInlineDepth(1).InlineDepth())
+	assert.Equal(t, addr, inlined.WithInlineDepth(0))
+}
@@ -22,6 +22,7 @@ package pfelf // import "go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
 import (
 	"bytes"
 	"debug/buildinfo"
+	"debug/dwarf"
 	"debug/elf"
 	"errors"
 	"fmt"
@@ -587,6 +588,16 @@ func (f *File) GoVersion() (string, error) {
 	return bi.GoVersion, nil
 }
 
+// DWARF returns the DWARF debug information of the ELF file. It is read with debug/elf,
+// which decompresses the debug sections and copies them into memory.
+func (f *File) DWARF() (*dwarf.Data, error) {
+	ef, err := elf.NewFile(f.elfReader)
+	if err != nil {
+		return nil, err
+	}
+	return ef.DWARF()
+}
+
 func (f *File) IsCgoEnabled() (bool, error) {
 	_, err := f.GoVersion()
 	if err != nil {
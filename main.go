@@ -12,6 +12,7 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 
 	"golang.org/x/sys/unix"
 
@@ -57,6 +58,13 @@ func main() {
 }
 
 func mainWithExitCode() exitCode {
+	if len(os.Args) > 1 && os.Args[1] == "record" {
+		return recordWithExitCode(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		return doctorWithExitCode(os.Args[2:])
+	}
+
 	cfg, err := parseArgs()
 	if err != nil {
 		log.Errorf("Failure to parse arguments: %v", err)
@@ -84,6 +92,13 @@ func mainWithExitCode() exitCode {
 		return exitFailure
 	}
 
+	if cfg.PrintConfig {
+		if err = controller.PrintConfig(os.Stdout, cfg.Fs); err != nil {
+			return failure("Failed to print configuration: %v", err)
+		}
+		return exitSuccess
+	}
+
 	// Context to drive main goroutine and the Tracer monitors.
 	ctx, mainCancel := signal.NotifyContext(context.Background(),
 		unix.SIGINT, unix.SIGTERM, unix.SIGABRT)
@@ -101,22 +116,13 @@ func mainWithExitCode() exitCode {
 	intervals := times.New(cfg.ReporterInterval,
 		cfg.MonitorInterval, cfg.ProbabilisticInterval)
 
-	rep, err := reporter.NewOTLP(&reporter.Config{
-		Name:                     os.Args[0],
-		Version:                  vc.Version(),
-		CollAgentAddr:            cfg.CollAgentAddr,
-		DisableTLS:               cfg.DisableTLS,
-		MaxRPCMsgSize:            32 << 20, // 32 MiB
-		MaxGRPCRetries:           5,
-		GRPCOperationTimeout:     intervals.GRPCOperationTimeout(),
-		GRPCStartupBackoffTime:   intervals.GRPCStartupBackoffTime(),
-		GRPCConnectionTimeout:    intervals.GRPCConnectionTimeout(),
-		ReportInterval:           intervals.ReportInterval(),
-		ExecutablesCacheElements: 16384,
-		// Next step: Calculate FramesCacheElements from numCores and samplingRate.
-		FramesCacheElements: 131072,
-		SamplesPerSecond:    cfg.SamplesPerSecond,
-	})
+	repCfg, err := newReporterConfig(cfg, intervals)
+	if err != nil {
+		log.Error(err)
+		return exitFailure
+	}
+
+	rep, err := newReporter(cfg, repCfg)
 	if err != nil {
 		log.Error(err)
 		return exitFailure
@@ -133,6 +139,8 @@ func mainWithExitCode() exitCode {
 	}
 	defer ctlr.Shutdown()
 
+	startReload(ctx, ctlr, cfg.ConfigFile)
+
 	// Block waiting for a signal to indicate the program should terminate
 	<-ctx.Done()
 
@@ -140,6 +148,116 @@ func mainWithExitCode() exitCode {
 	return exitSuccess
 }
 
+// newReporterConfig returns the reporter configuration for the command line arguments.
+func newReporterConfig(cfg *controller.Config, intervals *times.Times) (*reporter.Config, error) {
+	headers, err := parseHeaders(cfg.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reporter.Config{
+		Name:                     os.Args[0],
+		Version:                  vc.Version(),
+		CollAgentAddr:            cfg.CollAgentAddr,
+		DisableTLS:               cfg.DisableTLS,
+		MaxRPCMsgSize:            32 << 20, // 32 MiB
+		MaxGRPCRetries:           5,
+		GRPCOperationTimeout:     intervals.GRPCOperationTimeout(),
+		GRPCStartupBackoffTime:   intervals.GRPCStartupBackoffTime(),
+		GRPCConnectionTimeout:    intervals.GRPCConnectionTimeout(),
+		ReportInterval:           intervals.ReportInterval(),
+		ExecutablesCacheElements: 16384,
+		// Next step: Calculate FramesCacheElements from numCores and samplingRate.
+		FramesCacheElements: 131072,
+		SamplesPerSecond:    cfg.SamplesPerSecond,
+		AllocSampleInterval: uint32(cfg.AllocSampleInterval),
+		AllocInUse:          cfg.AllocInUse,
+		OTLPProtocol:        reporter.OTLPProtocol(cfg.OTLPProtocol),
+		HTTPHeaders:         headers,
+		SpoolDir:            cfg.SpoolDir,
+		SpoolMaxSize:        int64(cfg.SpoolMaxSize) << 20,
+		SpoolMaxAge:         cfg.SpoolMaxAge,
+		FoldedGroupBy:       cfg.FoldedGroupBy,
+		PprofOutputDir:      cfg.PprofOutputDir,
+		PprofMaxFiles:       int(cfg.PprofOutputMaxFiles),
+		PprofMaxTotalSize:   int64(cfg.PprofOutputMaxSize) << 20,
+		Demangle:            reporter.DemangleMode(cfg.Demangle),
+	}, nil
+}
+
+// newReporter returns the reporter for the outputs selected by the command line
+// arguments. If multiple outputs are selected, the profiles are sent to all of them.
+func newReporter(cfg *controller.Config, repCfg *reporter.Config) (reporter.Reporter, error) {
+	var reporters []reporter.Reporter
+
+	if cfg.PprofOutputDir != "" {
+		rep, err := reporter.NewPprof(repCfg)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, rep)
+	}
+
+	if cfg.FoldedOutput != "" {
+		foldedCfg := *repCfg
+		foldedCfg.FoldedOutput = os.Stdout
+		if cfg.FoldedOutput != "-" {
+			// The file stays open for the lifetime of the agent.
+			f, err := os.OpenFile(cfg.FoldedOutput,
+				os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open folded stacks output: %v", err)
+			}
+			foldedCfg.FoldedOutput = f
+		}
+		rep, err := reporter.NewFolded(&foldedCfg)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, rep)
+	}
+
+	if cfg.CollAgentAddr != "" || len(reporters) == 0 {
+		rep, err := reporter.NewOTLP(repCfg)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, rep)
+	}
+
+	rep := reporters[0]
+	if len(reporters) > 1 {
+		multi, err := reporter.NewMulti(reporters...)
+		if err != nil {
+			return nil, err
+		}
+		rep = multi
+	}
+
+	if cfg.ControlAddr != "" {
+		// The control API takes one-shot profiles from the reported traces.
+		rep = reporter.NewCapture(repCfg, rep)
+	}
+	return rep, nil
+}
+
+// parseHeaders parses a comma separated list of key=value pairs.
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if s == "" {
+		return headers, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(kv, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid header %q: expected key=value", kv)
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
 func failure(msg string, args ...any) exitCode {
 	log.Errorf(msg, args...)
 	return exitFailure
@@ -647,6 +647,57 @@ const (
 	// Number of failures reading Go custom labels
 	IDUnwindGoLabelsFailures = 279
 
+	// Number of report batches in the on-disk spool
+	IDReporterSpoolBatches = 280
+
+	// Total size of the report batches in the on-disk spool
+	IDReporterSpoolSize = 281
+
+	// Number of report batches dropped from the on-disk spool
+	IDReporterSpoolDroppedBatches = 282
+
+	// Number of traces dropped by the cgroup and container filter in user space
+	IDTraceFiltered = 283
+
+	// Number of uprobe hits without trace due to the rate limit of the uprobe
+	IDUprobeRateLimited = 284
+
+	// Number of traces dropped because the trace_events ring buffer was full
+	IDTraceEventRingbufDropped = 285
+
+	// Number of events dropped because the report_events ring buffer was full
+	IDReportEventRingbufDropped = 286
+
+	// Maximum latency of handing traces over to the trace handler, in milliseconds
+	IDTraceEventLatency = 287
+
+	// Frequency of the adaptive stack trace sampling, in Hz
+	IDSamplingFrequency = 288
+
+	// Number of times updating the sampling frequency of a perf event hook failed
+	IDPerfEventUpdatePeriodErr = 289
+
+	// CPU usage of the agent in percent of one CPU, as tracked by the budget
+	IDBudgetCPUUsage = 290
+
+	// Resident memory of the agent in bytes, as tracked by the budget
+	IDBudgetMemoryUsage = 291
+
+	// Degradation level of the agent due to budget overruns, 0 if not degraded
+	IDBudgetLevel = 292
+
+	// Number of times the sampling frequency was lowered due to budget overruns
+	IDBudgetSamplingReduced = 293
+
+	// Number of times the interpreter unwinders were disabled due to budget overruns
+	IDBudgetTracersDisabled = 294
+
+	// Number of times profiling was paused due to budget overruns
+	IDBudgetProfilingPaused = 295
+
+	// Number of times a degradation was reverted as the agent was within its budget
+	IDBudgetRecovered = 296
+
 	// max number of ID values, keep this as *last entry*
-	IDMax = 280
+	IDMax = 297
 )
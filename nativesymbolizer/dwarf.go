@@ -0,0 +1,391 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package nativesymbolizer // import "go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
+
+import (
+	"cmp"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	lru "github.com/elastic/go-freelru"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/hash"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+)
+
+// attrGNUDwoName is DW_AT_GNU_dwo_name, which the GNU extension for split DWARF
+// before DWARF 5 uses instead of DW_AT_dwo_name.
+const attrGNUDwoName dwarf.Attr = 0x2130
+
+// maxReferenceDepth limits following DW_AT_abstract_origin and DW_AT_specification
+// references when looking up the name of a function.
+const maxReferenceDepth = 8
+
+// maxUnitLines is the maximum number of indexed line tables kept per executable.
+// The index of a line table is much larger than its encoded form, so only the line
+// tables of recently looked up compilation units are kept.
+const maxUnitLines = 64
+
+// errNoDWARF is returned if an executable has no DWARF debug information.
+var errNoDWARF = errors.New("no DWARF debug information")
+
+// errSplitDWARF is returned if the DWARF debug information of an executable is split
+// into .dwo or .dwp files, which are not supported. The symbol table is used instead.
+var errSplitDWARF = errors.New("split DWARF debug information is not supported")
+
+// unitRange is an address range of a compilation unit.
+type unitRange struct {
+	low, high uint64
+	offset    dwarf.Offset
+}
+
+// lineRow is a row of a line table. It covers the addresses from address up to the
+// address of the next row.
+type lineRow struct {
+	address uint64
+	file    *dwarf.LineFile
+	line    int
+	// endSequence marks the end of a sequence, which covers no source line.
+	endSequence bool
+}
+
+// unitLines is the line table of a compilation unit indexed by address.
+type unitLines struct {
+	// files holds the file table, which DW_AT_call_file indexes.
+	files []*dwarf.LineFile
+	// rows holds the rows of all sequences sorted by address.
+	rows []lineRow
+}
+
+// dwarfTable resolves addresses to inlined call chains using the DWARF debug
+// information of an executable.
+type dwarfTable struct {
+	// mu serializes the lookups as debug/dwarf is not safe for concurrent use.
+	mu   sync.Mutex
+	data *dwarf.Data
+	// units holds the address ranges of the compilation units sorted by start.
+	units []unitRange
+	// lines caches the indexed line tables of the recently looked up compilation units
+	// by the offset of the compilation unit.
+	lines *lru.LRU[dwarf.Offset, *unitLines]
+}
+
+// dwarfSize returns the estimated memory needed to load the DWARF debug information
+// of ef, or errNoDWARF if it has none. As debug/elf keeps the decompressed debug
+// sections in memory, the decompressed size of compressed sections is used.
+func dwarfSize(ef *pfelf.File) (uint64, error) {
+	if err := ef.LoadSections(); err != nil {
+		return 0, err
+	}
+	var size uint64
+	var hasInfo bool
+	for i := range ef.Sections {
+		sh := &ef.Sections[i]
+		if sh.Type == elf.SHT_NOBITS {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(sh.Name, ".z"), ".")
+		if !strings.HasPrefix(name, "debug_") {
+			continue
+		}
+		if name == "debug_info" {
+			hasInfo = true
+		}
+		size += decompressedSize(sh)
+	}
+	if !hasInfo {
+		return 0, errNoDWARF
+	}
+	return size, nil
+}
+
+// decompressedSize returns the size of the data of the section sh after decompression.
+func decompressedSize(sh *pfelf.Section) uint64 {
+	switch {
+	case sh.Flags&elf.SHF_COMPRESSED != 0:
+		// The data starts with an ELF compression header.
+		var chdr elf.Chdr64
+		if _, err := sh.ReadAt(libpf.SliceFrom(&chdr), 0); err == nil {
+			return chdr.Size
+		}
+	case strings.HasPrefix(sh.Name, ".zdebug_"):
+		// The legacy GNU format starts with "ZLIB" and the big endian size.
+		var hdr [12]byte
+		if _, err := sh.ReadAt(hdr[:], 0); err == nil && string(hdr[:4]) == "ZLIB" {
+			return binary.BigEndian.Uint64(hdr[4:])
+		}
+	}
+	return sh.Size
+}
+
+// loadDWARF reads the DWARF debug information of ef and indexes its compilation units.
+func loadDWARF(ef *pfelf.File) (*dwarfTable, error) {
+	data, err := ef.DWARF()
+	if err != nil {
+		return nil, err
+	}
+
+	var units []unitRange
+	hasSkeletons := false
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == dwarf.TagSkeletonUnit || e.Val(dwarf.AttrDwoName) != nil ||
+			e.Val(attrGNUDwoName) != nil {
+			// The functions of the unit are in a .dwo or .dwp file.
+			hasSkeletons = true
+		} else if e.Tag == dwarf.TagCompileUnit || e.Tag == dwarf.TagPartialUnit {
+			ranges, err := data.Ranges(e)
+			if err == nil {
+				for _, rng := range ranges {
+					if rng[0] < rng[1] {
+						units = append(units, unitRange{rng[0], rng[1], e.Offset})
+					}
+				}
+			}
+		}
+		r.SkipChildren()
+	}
+	if len(units) == 0 {
+		if hasSkeletons {
+			return nil, errSplitDWARF
+		}
+		return nil, errNoDWARF
+	}
+	slices.SortFunc(units, func(a, b unitRange) int {
+		return cmp.Compare(a.low, b.low)
+	})
+
+	lines, err := lru.New[dwarf.Offset, *unitLines](maxUnitLines, hashOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dwarfTable{
+		data:  data,
+		units: slices.Clip(units),
+		lines: lines,
+	}, nil
+}
+
+// hashOffset returns the hash of a DWARF offset for use in an LRU.
+func hashOffset(offset dwarf.Offset) uint32 {
+	return uint32(hash.Uint64(uint64(offset)))
+}
+
+// lookup returns the functions that contain addr, the innermost inlined function first
+// and the function that contains addr in machine code last.
+func (t *dwarfTable) lookup(addr uint64) []Frame {
+	idx := sort.Search(len(t.units), func(i int) bool {
+		return t.units[i].low > addr
+	}) - 1
+	if idx < 0 || addr >= t.units[idx].high {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := t.data.Reader()
+	r.Seek(t.units[idx].offset)
+	cu, err := r.Next()
+	if err != nil || cu == nil {
+		return nil
+	}
+	chain := t.findChain(r, addr)
+	if len(chain) == 0 {
+		return nil
+	}
+
+	// The location in the innermost function is given by the line table. For all
+	// other functions it is the call site of the function inlined into them.
+	lines := t.unitLines(cu)
+	files := lines.files
+	row := lines.lineForPC(addr)
+
+	frames := make([]Frame, len(chain))
+	for i := range chain {
+		e := chain[len(chain)-1-i]
+		frame := Frame{FunctionName: t.functionName(e)}
+		if i == 0 {
+			if row.file != nil {
+				frame.SourceFile = row.file.Name
+			}
+			frame.SourceLine = uint64(row.line)
+		} else {
+			callee := chain[len(chain)-i]
+			if fileIdx, ok := callee.Val(dwarf.AttrCallFile).(int64); ok &&
+				fileIdx >= 0 && int(fileIdx) < len(files) && files[fileIdx] != nil {
+				frame.SourceFile = files[fileIdx].Name
+			}
+			if line, ok := callee.Val(dwarf.AttrCallLine).(int64); ok && line > 0 {
+				frame.SourceLine = uint64(line)
+			}
+		}
+		frames[i] = frame
+	}
+	return frames
+}
+
+// unitLines returns the line table of the compilation unit cu, which is read and indexed
+// on its first lookup. Caller must hold t.mu.
+func (t *dwarfTable) unitLines(cu *dwarf.Entry) *unitLines {
+	if lines, ok := t.lines.Get(cu.Offset); ok {
+		return lines
+	}
+	lines := &unitLines{}
+	if lr, err := t.data.LineReader(cu); err == nil && lr != nil {
+		lines = indexLines(lr)
+	}
+	t.lines.Add(cu.Offset, lines)
+	return lines
+}
+
+// indexLines reads the line table of lr and sorts its rows by address. Unlike
+// LineReader.SeekPC, it does not assume that the sequences are sorted by address.
+func indexLines(lr *dwarf.LineReader) *unitLines {
+	var rows []lineRow
+	var entry dwarf.LineEntry
+	for lr.Next(&entry) == nil {
+		rows = append(rows, lineRow{
+			address:     entry.Address,
+			file:        entry.File,
+			line:        entry.Line,
+			endSequence: entry.EndSequence,
+		})
+	}
+	// The rows of a sequence are sorted by address, so the stable sort keeps their
+	// order. A sequence may start at the address where another one ends, so the ends
+	// of sequences come first.
+	slices.SortStableFunc(rows, func(a, b lineRow) int {
+		if c := cmp.Compare(a.address, b.address); c != 0 {
+			return c
+		}
+		switch {
+		case a.endSequence && !b.endSequence:
+			return -1
+		case !a.endSequence && b.endSequence:
+			return 1
+		}
+		return 0
+	})
+	return &unitLines{
+		files: lr.Files(),
+		rows:  slices.Clip(rows),
+	}
+}
+
+// lineForPC returns the last line table row that covers addr.
+func (l *unitLines) lineForPC(addr uint64) lineRow {
+	idx := sort.Search(len(l.rows), func(i int) bool {
+		return l.rows[i].address > addr
+	}) - 1
+	if idx < 0 || l.rows[idx].endSequence {
+		return lineRow{}
+	}
+	return l.rows[idx]
+}
+
+// findChain returns the subprogram that contains addr followed by the nested inlined
+// subroutines that contain it. r must be positioned at the children of a compilation unit.
+func (t *dwarfTable) findChain(r *dwarf.Reader, addr uint64) []*dwarf.Entry {
+	var chain []*dwarf.Entry
+	// depth is the nesting level of e, funcDepth the one of the subprogram in chain.
+	depth, funcDepth := 0, 0
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			return chain
+		}
+		if e.Tag == 0 {
+			// End of the children of the enclosing entry.
+			depth--
+			if depth < 0 || (len(chain) > 0 && depth <= funcDepth) {
+				return chain
+			}
+			continue
+		}
+
+		switch e.Tag {
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine:
+			if (e.Tag == dwarf.TagSubprogram) != (len(chain) == 0) ||
+				!t.contains(e, addr) {
+				break
+			}
+			if len(chain) == 0 {
+				funcDepth = depth
+			}
+			chain = append(chain, e)
+			if !e.Children {
+				return chain
+			}
+			depth++
+			continue
+		case dwarf.TagNamespace, dwarf.TagLexDwarfBlock, dwarf.TagModule:
+			if e.Children {
+				depth++
+				continue
+			}
+		}
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+}
+
+// contains returns true if the address ranges of e contain addr.
+func (t *dwarfTable) contains(e *dwarf.Entry, addr uint64) bool {
+	ranges, err := t.data.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, rng := range ranges {
+		if addr >= rng[0] && addr < rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// functionName returns the linkage name of the function described by e, or its plain
+// name if there is none. Abstract origins and specifications are followed.
+func (t *dwarfTable) functionName(e *dwarf.Entry) string {
+	var name string
+	for range maxReferenceDepth {
+		if linkage, ok := e.Val(dwarf.AttrLinkageName).(string); ok && linkage != "" {
+			return linkage
+		}
+		if n, ok := e.Val(dwarf.AttrName).(string); ok && name == "" {
+			name = n
+		}
+
+		ref, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if ref, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				break
+			}
+		}
+		r := t.data.Reader()
+		r.Seek(ref)
+		next, err := r.Next()
+		if err != nil || next == nil {
+			break
+		}
+		e = next
+	}
+	return name
+}
@@ -0,0 +1,418 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package nativesymbolizer resolves addresses of native frames to function names
+// using the ELF symbol tables and, optionally, the DWARF debug information of the
+// executables on the host. DWARF debug information that is split into .dwo or .dwp
+// files is not supported, the symbol table is used for such executables.
+package nativesymbolizer // import "go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
+
+import (
+	"cmp"
+	"container/list"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"unsafe"
+
+	lru "github.com/elastic/go-freelru"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+)
+
+// maxSources is the maximum number of executables for which the information
+// to open them is kept.
+const maxSources = 16384
+
+// maxResults is the maximum number of DWARF lookup results that are cached.
+const maxResults = 65536
+
+// maxLoads is the maximum number of symbol tables that are loaded concurrently.
+const maxLoads = 2
+
+// maxLookups is the maximum number of pending DWARF lookups. Addresses are not
+// symbolized while the limit is reached, and are retried when symbolized again.
+const maxLookups = 1024
+
+// maxLookupWorkers is the maximum number of DWARF lookups done concurrently.
+const maxLookupWorkers = 2
+
+// symbolOverhead is the estimated memory used per symbol in addition to the
+// length of its name.
+const symbolOverhead = uint64(unsafe.Sizeof(symbol{}))
+
+// unitOverhead is the estimated memory used per indexed compilation unit range.
+const unitOverhead = uint64(unsafe.Sizeof(unitRange{}))
+
+// tableOverhead is the estimated memory used per symbol table in addition to
+// its symbols.
+const tableOverhead = uint64(unsafe.Sizeof(symbolTable{})) + 64
+
+// resultOverhead is the estimated memory used per cached DWARF lookup result in
+// addition to its frames.
+const resultOverhead = uint64(unsafe.Sizeof(libpf.FrameID{})+unsafe.Sizeof([]Frame{})) + 32
+
+// frameOverhead is the estimated memory used per frame of a cached DWARF lookup
+// result in addition to its strings.
+const frameOverhead = uint64(unsafe.Sizeof(Frame{}))
+
+// Frame is a function that contains a native address. If functions are inlined,
+// a single address is contained in multiple functions.
+type Frame struct {
+	// FunctionName is the linkage name of the function if known, its plain name otherwise.
+	FunctionName string
+	// FunctionOffset is the offset of the address from the function start. It is only
+	// set for frames resolved from the ELF symbol table.
+	FunctionOffset uint64
+	// SourceFile is the source file of the code at the address, if known.
+	SourceFile string
+	// SourceLine is the source line of the code at the address, if known.
+	SourceLine uint64
+}
+
+// source describes how to open an executable.
+type source struct {
+	fileName string
+	opener   pfelf.ELFOpener
+}
+
+// symbol is a function symbol with a non-zero size.
+type symbol struct {
+	address uint64
+	size    uint64
+	name    string
+}
+
+// symbolTable holds the sorted function symbols of an executable.
+type symbolTable struct {
+	fileID  libpf.FileID
+	symbols []symbol
+	// dwarf holds the DWARF debug information, if loaded.
+	dwarf *dwarfTable
+	// size is the estimated memory used by the table.
+	size uint64
+	// err is set if the executable could not be opened.
+	err error
+}
+
+// Symbolizer resolves native addresses to function names. The symbol tables are
+// loaded in the background on demand and kept in a least recently used cache that
+// is limited by the estimated memory usage of the tables.
+type Symbolizer struct {
+	mu sync.Mutex
+
+	// sources holds the information to open the executables by file ID.
+	sources *lru.LRU[libpf.FileID, source]
+
+	// loading holds the file IDs whose tables are being loaded.
+	loading libpf.Set[libpf.FileID]
+	// loadSlots limits the number of concurrent loads to maxLoads.
+	loadSlots chan libpf.Void
+
+	// tables maps file IDs to their element in lruList.
+	tables map[libpf.FileID]*list.Element
+	// lruList holds the loaded *symbolTable, most recently used first.
+	lruList *list.List
+	// size is the estimated memory used by all loaded tables and cached results.
+	size uint64
+	// maxSize is the memory budget for the loaded tables and cached results.
+	maxSize uint64
+
+	// useDWARF enables resolving inlined functions and source lines from DWARF.
+	useDWARF bool
+	// results caches the frames of DWARF lookups, as these are expensive.
+	results *lru.LRU[libpf.FrameID, []Frame]
+	// lookups holds the frames whose DWARF lookup is pending.
+	lookups libpf.Set[libpf.FrameID]
+	// lookupSlots limits the number of concurrent DWARF lookups to maxLookupWorkers.
+	lookupSlots chan libpf.Void
+}
+
+// New returns a Symbolizer that keeps symbol tables using up to maxSize bytes.
+// If useDWARF is set, the DWARF debug information is used to resolve inlined
+// functions and source lines, as long as it fits into maxSize.
+func New(maxSize uint64, useDWARF bool) (*Symbolizer, error) {
+	sources, err := lru.New[libpf.FileID, source](maxSources, libpf.FileID.Hash32)
+	if err != nil {
+		return nil, err
+	}
+	results, err := lru.New[libpf.FrameID, []Frame](maxResults, libpf.FrameID.Hash32)
+	if err != nil {
+		return nil, err
+	}
+	s := &Symbolizer{
+		sources:   sources,
+		loading:   make(libpf.Set[libpf.FileID]),
+		loadSlots: make(chan libpf.Void, maxLoads),
+		tables:    make(map[libpf.FileID]*list.Element),
+		lruList:   list.New(),
+		maxSize:   maxSize,
+		useDWARF:  useDWARF,
+		results:   results,
+
+		lookups:     make(libpf.Set[libpf.FrameID]),
+		lookupSlots: make(chan libpf.Void, maxLookupWorkers),
+	}
+	// The results are only changed with mu held.
+	results.SetOnEvict(func(_ libpf.FrameID, frames []Frame) {
+		s.size -= resultSize(frames)
+	})
+	return s, nil
+}
+
+// Register records how to open the executable with fileID. The symbol table is
+// only loaded once an address in the executable is symbolized.
+func (s *Symbolizer) Register(fileID libpf.FileID, fileName string, opener pfelf.ELFOpener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources.Add(fileID, source{fileName: fileName, opener: opener})
+
+	// Allow a retry if opening the executable failed previously.
+	if elem, ok := s.tables[fileID]; ok && elem.Value.(*symbolTable).err != nil {
+		s.remove(elem)
+	}
+}
+
+// Symbolize returns the functions that contain addr. The innermost inlined function
+// comes first and the function that contains addr in machine code last. Without
+// DWARF debug information, at most one frame is returned. The result is nil if
+// no function was found. Symbolize does not block on reading the executable: if
+// its symbol table is not loaded yet, the load is started in the background and
+// the result is nil until it completes. Likewise, DWARF lookups are done in the
+// background and the result is nil until the lookup of addr completes.
+func (s *Symbolizer) Symbolize(fileID libpf.FileID, addr libpf.AddressOrLineno) []Frame {
+	table := s.getTable(fileID)
+	if table == nil {
+		return nil
+	}
+	if table.dwarf == nil {
+		return table.lookup(uint64(addr))
+	}
+
+	frameID := libpf.NewFrameID(fileID, addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if frames, ok := s.results.Get(frameID); ok {
+		return frames
+	}
+	if _, ok := s.lookups[frameID]; !ok && len(s.lookups) < maxLookups {
+		s.lookups[frameID] = libpf.Void{}
+		go s.lookupDWARF(table, frameID, uint64(addr))
+	}
+	return nil
+}
+
+// lookupDWARF looks up the functions that contain addr in the DWARF debug
+// information of table and caches them as the result for frameID.
+func (s *Symbolizer) lookupDWARF(table *symbolTable, frameID libpf.FrameID, addr uint64) {
+	// Look up the functions without holding the lock, as this can take a while.
+	s.lookupSlots <- libpf.Void{}
+	frames := table.dwarf.lookup(addr)
+	if frames == nil {
+		// Fall back to the symbol table for code without debug information.
+		frames = table.lookup(addr)
+	}
+	<-s.lookupSlots
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lookups, frameID)
+	if !s.results.Contains(frameID) {
+		s.results.Add(frameID, frames)
+		s.size += resultSize(frames)
+		s.shrink()
+	}
+}
+
+// lookup returns the frame of the symbol that contains addr.
+func (t *symbolTable) lookup(addr uint64) []Frame {
+	// Find the last symbol that starts at or before addr.
+	idx := sort.Search(len(t.symbols), func(i int) bool {
+		return t.symbols[i].address > addr
+	}) - 1
+	if idx < 0 {
+		return nil
+	}
+	sym := &t.symbols[idx]
+	offset := addr - sym.address
+	if offset >= sym.size {
+		return nil
+	}
+	return []Frame{{FunctionName: sym.name, FunctionOffset: offset}}
+}
+
+// getTable returns the symbol table for fileID. If the table is not loaded, it
+// starts loading it in the background and returns nil.
+func (s *Symbolizer) getTable(fileID libpf.FileID) *symbolTable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.tables[fileID]; ok {
+		s.lruList.MoveToFront(elem)
+		return elem.Value.(*symbolTable)
+	}
+	if _, ok := s.loading[fileID]; ok {
+		return nil
+	}
+	src, ok := s.sources.Get(fileID)
+	if !ok {
+		return nil
+	}
+	s.loading[fileID] = libpf.Void{}
+	go s.load(fileID, src)
+	return nil
+}
+
+// load loads the symbol table for fileID from src and adds it to the cache.
+func (s *Symbolizer) load(fileID libpf.FileID, src source) {
+	// Load the table without holding the lock, as this can take a while.
+	s.loadSlots <- libpf.Void{}
+	table := s.loadTable(fileID, src)
+	<-s.loadSlots
+	if table.err != nil {
+		log.Debugf("Failed to load symbols of %s: %v", src.fileName, table.err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.loading, fileID)
+	if table.size > s.maxSize {
+		// Do not evict everything else for a table that does not fit anyway.
+		log.Debugf("Symbols of %s exceed the memory budget", src.fileName)
+		table.symbols = nil
+		table.dwarf = nil
+		table.size = tableOverhead
+	}
+	s.tables[fileID] = s.lruList.PushFront(table)
+	s.size += table.size
+	s.shrink()
+}
+
+// shrink drops cached results, and then the least recently used tables except for
+// the most recent one, until the cache fits into the memory budget. Results are
+// dropped first as they are cheaper to recompute than the tables. The caller must
+// hold mu.
+func (s *Symbolizer) shrink() {
+	for s.size > s.maxSize {
+		if _, _, ok := s.results.RemoveOldest(); ok {
+			continue
+		}
+		if s.lruList.Len() <= 1 {
+			return
+		}
+		s.remove(s.lruList.Back())
+	}
+}
+
+// resultSize returns the estimated memory used by the cached DWARF lookup result frames.
+func resultSize(frames []Frame) uint64 {
+	size := resultOverhead
+	for i := range frames {
+		size += frameOverhead + uint64(len(frames[i].FunctionName)+len(frames[i].SourceFile))
+	}
+	return size
+}
+
+// remove drops the table of elem from the cache. The caller must hold mu.
+func (s *Symbolizer) remove(elem *list.Element) {
+	table := s.lruList.Remove(elem).(*symbolTable)
+	delete(s.tables, table.fileID)
+	s.size -= table.size
+}
+
+// loadTable reads the function symbols of the executable described by src.
+// The full symbol table is preferred, which might be in the file referenced by
+// .gnu_debuglink. The dynamic symbol table is used as fallback. The DWARF debug
+// information is read from the executable or the file referenced by .gnu_debuglink.
+func (s *Symbolizer) loadTable(fileID libpf.FileID, src source) *symbolTable {
+	table := &symbolTable{fileID: fileID, size: tableOverhead}
+
+	ef, err := src.opener.OpenELF(src.fileName)
+	if err != nil {
+		table.err = err
+		return table
+	}
+	defer ef.Close()
+
+	var debugELF *pfelf.File
+	openDebugLink := func() *pfelf.File {
+		if debugELF == nil {
+			debugELF, _ = ef.OpenDebugLink(src.fileName, src.opener)
+		}
+		return debugELF
+	}
+	defer func() {
+		if debugELF != nil {
+			_ = debugELF.Close()
+		}
+	}()
+
+	symMap, err := ef.ReadSymbols()
+	if err != nil {
+		if dbg := openDebugLink(); dbg != nil {
+			symMap, err = dbg.ReadSymbols()
+		}
+	}
+	if err != nil {
+		symMap, err = ef.ReadDynamicSymbols()
+	}
+	if err == nil {
+		table.addSymbols(symMap)
+	} else if !errors.Is(err, pfelf.ErrSymbolNotFound) {
+		log.Debugf("No symbols found in %s: %v", src.fileName, err)
+	}
+
+	if s.useDWARF {
+		dwarfELF := ef
+		size, err := dwarfSize(ef)
+		if errors.Is(err, errNoDWARF) {
+			if dwarfELF = openDebugLink(); dwarfELF != nil {
+				size, err = dwarfSize(dwarfELF)
+			}
+		}
+		switch {
+		case err != nil || dwarfELF == nil:
+		case table.size+size > s.maxSize:
+			log.Debugf("DWARF of %s exceeds the memory budget", src.fileName)
+		default:
+			if table.dwarf, err = loadDWARF(dwarfELF); err != nil {
+				log.Debugf("Failed to load DWARF of %s: %v", src.fileName, err)
+			} else {
+				table.size += size + uint64(len(table.dwarf.units))*unitOverhead
+			}
+		}
+	}
+	return table
+}
+
+// addSymbols adds the function symbols of symMap to the table.
+func (t *symbolTable) addSymbols(symMap *libpf.SymbolMap) {
+	t.symbols = make([]symbol, 0, symMap.Len())
+	symMap.VisitAll(func(sym libpf.Symbol) {
+		if sym.Size == 0 || sym.Address == 0 {
+			return
+		}
+		t.symbols = append(t.symbols, symbol{
+			address: uint64(sym.Address),
+			size:    sym.Size,
+			name:    string(sym.Name),
+		})
+		t.size += symbolOverhead + uint64(len(sym.Name))
+	})
+	t.symbols = slices.Clip(t.symbols)
+	slices.SortFunc(t.symbols, func(a, b symbol) int {
+		return cmp.Compare(a.address, b.address)
+	})
+}
+
+// String returns a summary of the state of the cache, for debugging purposes.
+func (s *Symbolizer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d symbol tables and %d results using %d of %d bytes",
+		s.lruList.Len(), s.results.Len(), s.size, s.maxSize)
+}
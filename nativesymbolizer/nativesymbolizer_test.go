@@ -0,0 +1,248 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package nativesymbolizer
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+)
+
+const (
+	withDebugSymsPath    = "../libpf/pfelf/testdata/with-debug-syms"
+	withoutDebugSymsPath = "../libpf/pfelf/testdata/without-debug-syms"
+	inlinePath           = "testdata/inline"
+	compressedPath       = "testdata/compressed"
+	splitPath            = "testdata/split"
+)
+
+// lookupSymbol returns the address of the symbol name in the executable at path.
+func lookupSymbol(t *testing.T, path string, name libpf.SymbolName) libpf.AddressOrLineno {
+	t.Helper()
+	ef, err := pfelf.Open(path)
+	require.NoError(t, err)
+	defer ef.Close()
+	symMap, err := ef.ReadSymbols()
+	require.NoError(t, err)
+	sym, err := symMap.LookupSymbol(name)
+	require.NoError(t, err)
+	return libpf.AddressOrLineno(sym.Address)
+}
+
+// lookupCallSite returns the address of the first call instruction in the executable
+// at path that has a DWARF call site entry.
+func lookupCallSite(t *testing.T, path string) libpf.AddressOrLineno {
+	t.Helper()
+	ef, err := pfelf.Open(path)
+	require.NoError(t, err)
+	defer ef.Close()
+	data, err := ef.DWARF()
+	require.NoError(t, err)
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		require.NoError(t, err)
+		require.NotNil(t, e, "no call site found")
+		if e.Tag != dwarf.TagCallSite {
+			continue
+		}
+		// The call site address is the return address of the call.
+		if pc, ok := e.Val(dwarf.AttrCallReturnPC).(uint64); ok {
+			return libpf.AddressOrLineno(pc) - 1
+		}
+		if pc, ok := e.Val(dwarf.AttrLowpc).(uint64); ok {
+			return libpf.AddressOrLineno(pc) - 1
+		}
+	}
+}
+
+// symbolize returns the result of Symbolize once the table of fileID is loaded.
+func symbolize(t *testing.T, s *Symbolizer, fileID libpf.FileID,
+	addr libpf.AddressOrLineno) []Frame {
+	t.Helper()
+	idle := func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, loading := s.loading[fileID]
+		return !loading && len(s.lookups) == 0
+	}
+	// The first call loads the table, the second one looks up addr in the DWARF
+	// debug information.
+	for range 2 {
+		s.Symbolize(fileID, addr)
+		require.Eventually(t, idle, 10*time.Second, time.Millisecond)
+	}
+	return s.Symbolize(fileID, addr)
+}
+
+func TestSymbolize(t *testing.T) {
+	addr := lookupSymbol(t, withDebugSymsPath, "main") + 4
+
+	s, err := New(64*1024*1024, false)
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(1, 2)
+
+	// Unknown executables are not symbolized.
+	assert.Nil(t, s.Symbolize(fileID, addr))
+
+	// The first lookup starts loading the table in the background.
+	s.Register(fileID, withDebugSymsPath, pfelf.SystemOpener)
+	assert.Nil(t, s.Symbolize(fileID, addr))
+	assert.Equal(t, []Frame{{FunctionName: "main", FunctionOffset: 4}},
+		symbolize(t, s, fileID, addr))
+	assert.Nil(t, s.Symbolize(fileID, 0))
+
+	// Stripped executables without exported functions have no symbols.
+	strippedID := libpf.NewFileID(3, 4)
+	s.Register(strippedID, withoutDebugSymsPath, pfelf.SystemOpener)
+	assert.Nil(t, symbolize(t, s, strippedID, addr))
+	assert.Contains(t, s.tables, strippedID)
+
+	// Executables that can not be opened are cached until they are registered again.
+	missingID := libpf.NewFileID(5, 6)
+	s.Register(missingID, "/nonexistent", pfelf.SystemOpener)
+	assert.Nil(t, symbolize(t, s, missingID, addr))
+	assert.Contains(t, s.tables, missingID)
+	assert.Empty(t, s.loading)
+	s.Register(missingID, "/nonexistent", pfelf.SystemOpener)
+	assert.NotContains(t, s.tables, missingID)
+}
+
+func TestSymbolizeDWARF(t *testing.T) {
+	// The only call site is the call to sink from main, into which the calls
+	// main -> outer -> inner are inlined.
+	callAddr := lookupCallSite(t, inlinePath)
+
+	s, err := New(64*1024*1024, true)
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+	s.Register(fileID, inlinePath, pfelf.SystemOpener)
+
+	frames := symbolize(t, s, fileID, callAddr)
+	require.Len(t, frames, 3)
+	for i, fn := range []string{"inner", "outer", "main"} {
+		assert.Equal(t, fn, frames[i].FunctionName)
+		assert.Equal(t, "inline.c", filepath.Base(frames[i].SourceFile))
+	}
+	assert.Equal(t, []uint64{12, 16, 21}, []uint64{
+		frames[0].SourceLine, frames[1].SourceLine, frames[2].SourceLine})
+
+	// DWARF lookups are done in the background. Functions without inlining resolve to
+	// a single frame.
+	sinkAddr := lookupSymbol(t, inlinePath, "sink")
+	assert.Nil(t, s.Symbolize(fileID, sinkAddr))
+	frames = symbolize(t, s, fileID, sinkAddr)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "sink", frames[0].FunctionName)
+	assert.Equal(t, uint64(8), frames[0].SourceLine)
+
+	// Without DWARF, the symbol table is used.
+	s, err = New(64*1024*1024, false)
+	require.NoError(t, err)
+	s.Register(fileID, inlinePath, pfelf.SystemOpener)
+	mainAddr := lookupSymbol(t, inlinePath, "main")
+	assert.Equal(t, []Frame{{FunctionName: "main", FunctionOffset: uint64(callAddr - mainAddr)}},
+		symbolize(t, s, fileID, callAddr))
+}
+
+func TestSymbolizeSplitDWARF(t *testing.T) {
+	// The functions are in the .dwo file, so the symbol table is used.
+	s, err := New(64*1024*1024, true)
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+	s.Register(fileID, splitPath, pfelf.SystemOpener)
+
+	sinkAddr := lookupSymbol(t, splitPath, "sink")
+	assert.Equal(t, []Frame{{FunctionName: "sink"}}, symbolize(t, s, fileID, sinkAddr))
+	assert.Nil(t, s.tables[fileID].Value.(*symbolTable).dwarf)
+
+	ef, err := pfelf.Open(splitPath)
+	require.NoError(t, err)
+	defer ef.Close()
+	_, err = loadDWARF(ef)
+	require.ErrorIs(t, err, errSplitDWARF)
+}
+
+func TestDWARFSize(t *testing.T) {
+	// Compressed debug sections are charged with their decompressed size.
+	for _, path := range []string{inlinePath, compressedPath} {
+		ef, err := pfelf.Open(path)
+		require.NoError(t, err)
+		size, err := dwarfSize(ef)
+		ef.Close()
+		require.NoError(t, err)
+
+		// debug/elf decompresses the sections when reading their data.
+		stdELF, err := elf.Open(path)
+		require.NoError(t, err)
+		var wantSize uint64
+		for _, sec := range stdELF.Sections {
+			if strings.HasPrefix(sec.Name, ".debug_") {
+				data, err := sec.Data()
+				require.NoError(t, err)
+				wantSize += uint64(len(data))
+			}
+		}
+		stdELF.Close()
+		assert.Equal(t, wantSize, size, path)
+	}
+
+	ef, err := pfelf.Open(withoutDebugSymsPath)
+	require.NoError(t, err)
+	defer ef.Close()
+	_, err = dwarfSize(ef)
+	require.ErrorIs(t, err, errNoDWARF)
+}
+
+func TestSymbolizeResultsBudget(t *testing.T) {
+	s, err := New(64*1024*1024, true)
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+	s.Register(fileID, inlinePath, pfelf.SystemOpener)
+
+	// The cached results are part of the memory budget.
+	frames := symbolize(t, s, fileID, lookupCallSite(t, inlinePath))
+	require.Len(t, frames, 3)
+	tableSize := s.tables[fileID].Value.(*symbolTable).size
+	assert.Equal(t, 1, s.results.Len())
+	assert.Equal(t, tableSize+resultSize(frames), s.size)
+
+	// Results are dropped before the tables to fit into the budget.
+	s.mu.Lock()
+	s.maxSize = tableSize
+	s.shrink()
+	s.mu.Unlock()
+	assert.Zero(t, s.results.Len())
+	assert.Equal(t, tableSize, s.size)
+	assert.Contains(t, s.tables, fileID)
+}
+
+func TestSymbolizeBudget(t *testing.T) {
+	// A budget too small for any symbols still caches the empty table.
+	s, err := New(tableOverhead, true)
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(1, 2)
+	s.Register(fileID, inlinePath, pfelf.SystemOpener)
+	assert.Nil(t, symbolize(t, s, fileID, 0x1000))
+	assert.Equal(t, 1, s.lruList.Len())
+	assert.Equal(t, tableOverhead, s.size)
+
+	// Tables of other executables replace it.
+	otherID := libpf.NewFileID(5, 6)
+	s.Register(otherID, "/nonexistent", pfelf.SystemOpener)
+	assert.Nil(t, symbolize(t, s, otherID, 0x1000))
+	assert.Equal(t, 1, s.lruList.Len())
+	assert.Contains(t, s.tables, otherID)
+}
@@ -0,0 +1,23 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// The functions below are inlined into main, which calls the opaque function
+// "sink" from the innermost one to have a known call site.
+
+__attribute__((noinline)) void sink(volatile int *v) {
+	*v += 1;
+}
+
+static inline __attribute__((always_inline)) void inner(volatile int *v) {
+	sink(v);
+}
+
+static inline __attribute__((always_inline)) void outer(volatile int *v) {
+	inner(v);
+}
+
+int main(void) {
+	volatile int v = 0;
+	outer(&v);
+	return v;
+}
@@ -0,0 +1,196 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package processmanager // import "go.opentelemetry.io/ebpf-profiler/processmanager"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoots are the mount points of the cgroup v2 hierarchy: the unified mode
+// mount point first and the hybrid mode mount point second.
+var cgroupRoots = []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"}
+
+// CgroupFilterConfig defines the processes a CgroupFilter allows. A process is denied if
+// its cgroup or container matches a deny rule. Otherwise, it is allowed if there are no
+// allow rules or if its cgroup or container matches an allow rule.
+type CgroupFilterConfig struct {
+	// AllowCgroups and DenyCgroups are globs (see path.Match) for cgroup v2 paths, like
+	// /system.slice/*. A glob also matches all cgroups below a matching cgroup.
+	AllowCgroups []string
+	DenyCgroups  []string
+	// AllowContainers and DenyContainers are container IDs or prefixes of these.
+	AllowContainers []string
+	DenyContainers  []string
+}
+
+// Empty returns true if cfg contains no rules.
+func (cfg *CgroupFilterConfig) Empty() bool {
+	return len(cfg.AllowCgroups) == 0 && len(cfg.DenyCgroups) == 0 &&
+		len(cfg.AllowContainers) == 0 && len(cfg.DenyContainers) == 0
+}
+
+// Validate returns an error if cfg contains an invalid rule.
+func (cfg *CgroupFilterConfig) Validate() error {
+	for _, glob := range slices.Concat(cfg.AllowCgroups, cfg.DenyCgroups) {
+		if !strings.HasPrefix(glob, "/") {
+			return fmt.Errorf("cgroup glob %s is not an absolute path", glob)
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid cgroup glob %s: %v", glob, err)
+		}
+	}
+	for _, id := range slices.Concat(cfg.AllowContainers, cfg.DenyContainers) {
+		if id == "" {
+			return errors.New("empty container ID")
+		}
+	}
+	return nil
+}
+
+// CgroupFilter decides by cgroup and container which processes are profiled.
+// Its rules can be updated at runtime.
+type CgroupFilter struct {
+	cfg atomic.Pointer[CgroupFilterConfig]
+}
+
+// NewCgroupFilter creates a CgroupFilter with the rules of cfg.
+func NewCgroupFilter(cfg CgroupFilterConfig) (*CgroupFilter, error) {
+	f := &CgroupFilter{}
+	if err := f.Update(cfg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update replaces the rules of the filter.
+func (f *CgroupFilter) Update(cfg CgroupFilterConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	f.cfg.Store(&cfg)
+	return nil
+}
+
+// Allowed returns true if processes in the cgroup cgroupPath and the container
+// containerID are profiled. Both values may be empty if they are unknown.
+func (f *CgroupFilter) Allowed(cgroupPath, containerID string) bool {
+	cfg := f.cfg.Load()
+	if matchCgroup(cfg.DenyCgroups, cgroupPath) ||
+		matchContainer(cfg.DenyContainers, containerID) {
+		return false
+	}
+	if len(cfg.AllowCgroups) == 0 && len(cfg.AllowContainers) == 0 {
+		return true
+	}
+	return matchCgroup(cfg.AllowCgroups, cgroupPath) ||
+		matchContainer(cfg.AllowContainers, containerID)
+}
+
+// DeniedCgroupIDs returns the IDs of all existing cgroups whose processes are not
+// profiled. It returns an error if the cgroup v2 hierarchy is not mounted.
+func (f *CgroupFilter) DeniedCgroupIDs() (map[uint64]string, error) {
+	root, err := cgroupRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	denied := make(map[uint64]string)
+	if cfg := f.cfg.Load(); cfg.Empty() {
+		return denied, nil
+	}
+	err = filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// The cgroup was removed in the meantime.
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		cgroupPath := "/" + strings.TrimPrefix(strings.TrimPrefix(dir, root), "/")
+		containerID := parseContainerID(strings.NewReader("0::" + cgroupPath))
+		if f.Allowed(cgroupPath, containerID) {
+			return nil
+		}
+
+		id, err := cgroupID(dir)
+		if err != nil {
+			log.Debugf("Failed to get ID of cgroup %s: %v", cgroupPath, err)
+			return nil
+		}
+		denied[id] = cgroupPath
+		return nil
+	})
+	return denied, err
+}
+
+// matchCgroup returns true if cgroupPath or one of its parents matches one of globs.
+func matchCgroup(globs []string, cgroupPath string) bool {
+	if cgroupPath == "" {
+		return false
+	}
+	for _, glob := range globs {
+		for p := cgroupPath; ; p = path.Dir(p) {
+			if ok, _ := path.Match(glob, p); ok {
+				return true
+			}
+			if p == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// matchContainer returns true if containerID starts with one of ids.
+func matchContainer(ids []string, containerID string) bool {
+	if containerID == "" {
+		return false
+	}
+	for _, id := range ids {
+		if strings.HasPrefix(containerID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupRoot returns the mount point of the cgroup v2 hierarchy.
+func cgroupRoot() (string, error) {
+	for _, root := range cgroupRoots {
+		var st unix.Statfs_t
+		if err := unix.Statfs(root, &st); err == nil && st.Type == unix.CGROUP2_SUPER_MAGIC {
+			return root, nil
+		}
+	}
+	return "", errors.New("cgroup v2 hierarchy not found")
+}
+
+// cgroupID returns the ID of the cgroup at dir, as returned by the eBPF helper
+// bpf_get_current_cgroup_id. The file handle of a cgroup directory consists of it.
+func cgroupID(dir string) (uint64, error) {
+	handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, dir, 0)
+	if err != nil {
+		return 0, err
+	}
+	b := handle.Bytes()
+	if len(b) < 8 {
+		return 0, fmt.Errorf("unexpected file handle size %d", len(b))
+	}
+	return binary.NativeEndian.Uint64(b), nil
+}
@@ -0,0 +1,168 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package processmanager // import "go.opentelemetry.io/ebpf-profiler/processmanager"
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupFilterAllowed(t *testing.T) {
+	const podCgroup = "/kubepods.slice/kubepods-pod1.slice/cri-containerd-" +
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.scope"
+	const containerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := map[string]struct {
+		cfg         CgroupFilterConfig
+		cgroupPath  string
+		containerID string
+		want        bool
+	}{
+		"no rules": {
+			cgroupPath: "/system.slice/sshd.service",
+			want:       true,
+		},
+		"denied cgroup": {
+			cfg:        CgroupFilterConfig{DenyCgroups: []string{"/system.slice/*"}},
+			cgroupPath: "/system.slice/sshd.service",
+			want:       false,
+		},
+		"denied parent cgroup": {
+			cfg:         CgroupFilterConfig{DenyCgroups: []string{"/kubepods.slice"}},
+			cgroupPath:  podCgroup,
+			containerID: containerID,
+			want:        false,
+		},
+		"not denied cgroup": {
+			cfg:        CgroupFilterConfig{DenyCgroups: []string{"/system.slice/*"}},
+			cgroupPath: "/user.slice/user-1000.slice",
+			want:       true,
+		},
+		"allowed cgroup": {
+			cfg:        CgroupFilterConfig{AllowCgroups: []string{"/kubepods.slice/*"}},
+			cgroupPath: podCgroup,
+			want:       true,
+		},
+		"not allowed cgroup": {
+			cfg:        CgroupFilterConfig{AllowCgroups: []string{"/kubepods.slice/*"}},
+			cgroupPath: "/system.slice/sshd.service",
+			want:       false,
+		},
+		"unknown cgroup with allow rules": {
+			cfg:  CgroupFilterConfig{AllowCgroups: []string{"/kubepods.slice/*"}},
+			want: false,
+		},
+		"allowed container prefix": {
+			cfg:         CgroupFilterConfig{AllowContainers: []string{"0123456789ab"}},
+			cgroupPath:  podCgroup,
+			containerID: containerID,
+			want:        true,
+		},
+		"denied container in allowed cgroup": {
+			cfg: CgroupFilterConfig{
+				AllowCgroups:   []string{"/kubepods.slice"},
+				DenyContainers: []string{containerID},
+			},
+			cgroupPath:  podCgroup,
+			containerID: containerID,
+			want:        false,
+		},
+		"allowed container or cgroup": {
+			cfg: CgroupFilterConfig{
+				AllowCgroups:    []string{"/system.slice/*"},
+				AllowContainers: []string{"fedcba"},
+			},
+			cgroupPath: "/system.slice/sshd.service",
+			want:       true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := NewCgroupFilter(tc.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, filter.Allowed(tc.cgroupPath, tc.containerID))
+		})
+	}
+}
+
+func TestCgroupFilterUpdate(t *testing.T) {
+	filter, err := NewCgroupFilter(CgroupFilterConfig{})
+	require.NoError(t, err)
+	assert.True(t, filter.Allowed("/system.slice/sshd.service", ""))
+
+	require.NoError(t, filter.Update(CgroupFilterConfig{
+		DenyCgroups: []string{"/system.slice/*"},
+	}))
+	assert.False(t, filter.Allowed("/system.slice/sshd.service", ""))
+
+	// Invalid rules are rejected and the previous rules stay in effect.
+	require.Error(t, filter.Update(CgroupFilterConfig{DenyCgroups: []string{"["}}))
+	assert.False(t, filter.Allowed("/system.slice/sshd.service", ""))
+}
+
+func TestCgroupFilterConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg     CgroupFilterConfig
+		wantErr bool
+	}{
+		"empty": {},
+		"valid": {
+			cfg: CgroupFilterConfig{
+				AllowCgroups:   []string{"/kubepods.slice/*"},
+				DenyContainers: []string{"abc"},
+			},
+		},
+		"relative glob": {
+			cfg:     CgroupFilterConfig{DenyCgroups: []string{"system.slice"}},
+			wantErr: true,
+		},
+		"malformed glob": {
+			cfg:     CgroupFilterConfig{AllowCgroups: []string{"/system.slice/["}},
+			wantErr: true,
+		},
+		"empty container ID": {
+			cfg:     CgroupFilterConfig{AllowContainers: []string{""}},
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseCgroupPath(t *testing.T) {
+	tests := map[string]struct {
+		cgroup string
+		want   string
+	}{
+		"cgroup v2": {
+			cgroup: "0::/system.slice/sshd.service\n",
+			want:   "/system.slice/sshd.service",
+		},
+		"hybrid": {
+			cgroup: "12:cpu,cpuacct:/user.slice\n1:name=systemd:/user.slice\n" +
+				"0::/user.slice/user-1000.slice/session-1.scope\n",
+			want: "/user.slice/user-1000.slice/session-1.scope",
+		},
+		"cgroup v1": {
+			cgroup: "12:cpu,cpuacct:/user.slice\n1:name=systemd:/user.slice\n",
+			want:   "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseCgroupPath(strings.NewReader(tc.cgroup)))
+		})
+	}
+}
@@ -151,12 +151,12 @@ func LoadMaps(ctx context.Context, maps map[string]*cebpf.Map) (EbpfHandler, err
 		impl.ExeIDToStackDeltaMaps[i-support.StackDeltaBucketSmallest] = deltasMap
 	}
 
-	if err := probeBatchOperations(cebpf.Hash); err == nil {
+	if err := ProbeBatchOperations(cebpf.Hash); err == nil {
 		log.Infof("Supports generic eBPF map batch operations")
 		impl.hasGenericBatchOperations = true
 	}
 
-	if err := probeBatchOperations(cebpf.LPMTrie); err == nil {
+	if err := ProbeBatchOperations(cebpf.LPMTrie); err == nil {
 		log.Infof("Supports LPM trie eBPF map batch operations")
 		impl.hasLPMTrieBatchOperations = true
 	}
@@ -377,9 +377,9 @@ func getPIDPageMappingInfo(fileID, biasAndUnwindProgram uint64) *support.PIDPage
 	return cInfo
 }
 
-// probeBatchOperations tests if the BPF syscall accepts batch operations. It
+// ProbeBatchOperations tests if the BPF syscall accepts batch operations. It
 // returns nil if batch operations are supported for mapType or an error otherwise.
-func probeBatchOperations(mapType cebpf.MapType) error {
+func ProbeBatchOperations(mapType cebpf.MapType) error {
 	restoreRlimit, err := rlimit.MaximizeMemlock()
 	if err != nil {
 		// In environment like github action runners, we can not adjust rlimit.
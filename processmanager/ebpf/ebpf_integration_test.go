@@ -78,7 +78,7 @@ func TestLPM(t *testing.T) {
 func TestBatchOperations(t *testing.T) {
 	for _, mapType := range []cebpf.MapType{cebpf.Hash, cebpf.Array, cebpf.LPMTrie} {
 		t.Run(mapType.String(), func(t *testing.T) {
-			err := probeBatchOperations(mapType)
+			err := ProbeBatchOperations(mapType)
 			if err != nil {
 				require.ErrorIs(t, err, cebpf.ErrNotSupported)
 			}
@@ -103,7 +103,27 @@ func NewExecutableInfoManager(
 	ebpf pmebpf.EbpfHandler,
 	includeTracers types.IncludedTracers,
 ) (*ExecutableInfoManager, error) {
-	// Initialize interpreter loaders.
+	deferredFileIDs, err := lru.NewSynced[host.FileID, libpf.Void](deferredFileIDSize,
+		func(id host.FileID) uint32 { return uint32(id) })
+	if err != nil {
+		return nil, err
+	}
+	deferredFileIDs.SetLifetime(deferredFileIDTimeout)
+
+	return &ExecutableInfoManager{
+		sdp: sdp,
+		state: xsync.NewRWMutex(executableInfoManagerState{
+			interpreterLoaders: interpreterLoaders(includeTracers),
+			executables:        map[host.FileID]*entry{},
+			unwindInfoIndex:    map[sdtypes.UnwindInfo]uint16{},
+			ebpf:               ebpf,
+		}),
+		deferredFileIDs: deferredFileIDs,
+	}, nil
+}
+
+// interpreterLoaders returns the interpreter loaders of includeTracers.
+func interpreterLoaders(includeTracers types.IncludedTracers) []interpreter.Loader {
 	interpreterLoaders := make([]interpreter.Loader, 0)
 	if includeTracers.Has(types.PerlTracer) {
 		interpreterLoaders = append(interpreterLoaders, perl.Loader)
@@ -134,24 +154,18 @@ func NewExecutableInfoManager(
 	if includeTracers.Has(types.Labels) {
 		interpreterLoaders = append(interpreterLoaders, golabels.Loader)
 	}
+	return interpreterLoaders
+}
 
-	deferredFileIDs, err := lru.NewSynced[host.FileID, libpf.Void](deferredFileIDSize,
-		func(id host.FileID) uint32 { return uint32(id) })
-	if err != nil {
-		return nil, err
-	}
-	deferredFileIDs.SetLifetime(deferredFileIDTimeout)
-
-	return &ExecutableInfoManager{
-		sdp: sdp,
-		state: xsync.NewRWMutex(executableInfoManagerState{
-			interpreterLoaders: interpreterLoaders,
-			executables:        map[host.FileID]*entry{},
-			unwindInfoIndex:    map[sdtypes.UnwindInfo]uint16{},
-			ebpf:               ebpf,
-		}),
-		deferredFileIDs: deferredFileIDs,
-	}, nil
+// SetIncludedTracers replaces the interpreter loaders by the ones of includeTracers.
+// Executables that are already known keep their interpreter information, and
+// executables that are added while a loader is disabled are not detected by it
+// until they are added again after their last reference was removed.
+func (mgr *ExecutableInfoManager) SetIncludedTracers(includeTracers types.IncludedTracers) {
+	loaders := interpreterLoaders(includeTracers)
+	state := mgr.state.WLock()
+	defer mgr.state.WUnlock(&state)
+	state.interpreterLoaders = loaders
 }
 
 // AddOrIncRef either adds information about an executable to the internal cache (when first
@@ -120,6 +120,31 @@ func parseContainerID(cgroupFile io.Reader) string {
 	return ""
 }
 
+// parseCgroupPath returns the cgroup v2 path from the content of /proc/PID/cgroup.
+func parseCgroupPath(cgroupFile io.Reader) string {
+	scanner := bufio.NewScanner(cgroupFile)
+	buf := make([]byte, 512)
+	// See parseContainerID for the buffer size.
+	scanner.Buffer(buf, 8192)
+	for scanner.Scan() {
+		if cgroupPath, ok := bytes.CutPrefix(scanner.Bytes(), []byte("0::")); ok {
+			return string(cgroupPath)
+		}
+	}
+	return ""
+}
+
+// extractCgroupPath returns the cgroup path for pid if cgroup v2 is used.
+func extractCgroupPath(pid libpf.PID) (string, error) {
+	cgroupFile, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	defer cgroupFile.Close()
+
+	return parseCgroupPath(cgroupFile), nil
+}
+
 // extractContainerID returns the containerID for pid if cgroup v2 is used.
 func extractContainerID(pid libpf.PID) (string, error) {
 	cgroupFile, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	lru "github.com/elastic/go-freelru"
@@ -21,6 +22,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/lpm"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
 	"go.opentelemetry.io/ebpf-profiler/nativeunwind"
 	sdtypes "go.opentelemetry.io/ebpf-profiler/nativeunwind/stackdeltatypes"
 	"go.opentelemetry.io/ebpf-profiler/periodiccaller"
@@ -42,6 +44,10 @@ const (
 
 	// TTL of entries in the LRU cache holding the executables' ELF information.
 	elfInfoCacheTTL = 6 * time.Hour
+
+	// Maximum size of the LRU cache holding the number of inlined functions of
+	// symbolized native frames.
+	nativeInlinesCacheSize = 65536
 )
 
 var (
@@ -65,11 +71,13 @@ var (
 //
 // Three external interfaces are used to access the processes and related resources: ebpf,
 // fileIDMapper and symbolReporter. Specify nil for fileIDMapper to use the default
-// implementation.
+// implementation. Specify nil for targetPIDs to synchronize all processes.
 func New(ctx context.Context, includeTracers types.IncludedTracers, monitorInterval time.Duration,
 	ebpf pmebpf.EbpfHandler, fileIDMapper FileIDMapper, symbolReporter reporter.SymbolReporter,
 	sdp nativeunwind.StackDeltaProvider, filterErrorFrames bool,
-	includeEnvVars libpf.Set[string]) (*ProcessManager, error) {
+	includeEnvVars libpf.Set[string],
+	nativeSymbolizer *nativesymbolizer.Symbolizer,
+	targetPIDs *TargetPIDs) (*ProcessManager, error) {
 	if fileIDMapper == nil {
 		var err error
 		fileIDMapper, err = newFileIDMapper(lruFileIDCacheSize)
@@ -92,6 +100,15 @@ func New(ctx context.Context, includeTracers types.IncludedTracers, monitorInter
 
 	interpreters := make(map[libpf.PID]map[util.OnDiskFileIdentifier]interpreter.Instance)
 
+	var nativeInlines *lru.SyncedLRU[libpf.FrameID, uint8]
+	if nativeSymbolizer != nil {
+		nativeInlines, err = lru.NewSynced[libpf.FrameID, uint8](nativeInlinesCacheSize,
+			libpf.FrameID.Hash32)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create nativeInlines: %v", err)
+		}
+	}
+
 	pm := &ProcessManager{
 		interpreterTracerEnabled: em.NumInterpreterLoaders() > 0,
 		eim:                      em,
@@ -105,6 +122,9 @@ func New(ctx context.Context, includeTracers types.IncludedTracers, monitorInter
 		metricsAddSlice:          metrics.AddSlice,
 		filterErrorFrames:        filterErrorFrames,
 		includeEnvVars:           includeEnvVars,
+		nativeSymbolizer:         nativeSymbolizer,
+		nativeInlines:            nativeInlines,
+		targetPIDs:               targetPIDs,
 	}
 
 	collectInterpreterMetrics(ctx, pm, monitorInterval)
@@ -192,6 +212,20 @@ func collectInterpreterMetrics(ctx context.Context, pm *ProcessManager,
 func (pm *ProcessManager) Close() {
 }
 
+// SetIncludedTracers changes the interpreters that are detected in executables that
+// are not known yet.
+func (pm *ProcessManager) SetIncludedTracers(includeTracers types.IncludedTracers) {
+	pm.eim.SetIncludedTracers(includeTracers)
+}
+
+// SetIncludeEnvVars changes the environment variables that are captured from processes.
+// Processes that are already known keep the variables that were captured before.
+func (pm *ProcessManager) SetIncludeEnvVars(includeEnvVars libpf.Set[string]) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.includeEnvVars = includeEnvVars
+}
+
 func (pm *ProcessManager) symbolizeFrame(frame int, trace *host.Trace,
 	newTrace *libpf.Trace) error {
 	pm.mu.Lock()
@@ -289,6 +323,11 @@ func (pm *ProcessManager) ConvertTrace(trace *host.Trace) (newTrace *libpf.Trace
 				continue
 			}
 
+			if frame.Type.Interpreter() == libpf.Native {
+				pm.symbolizeNativeFrame(newTrace, frame.Type, fileID, relativeRIP,
+					mappingStart, mappingEnd, fileOffset)
+			}
+
 			newTrace.AppendFrameFull(frame.Type, fileID,
 				relativeRIP, mappingStart, mappingEnd, fileOffset)
 		default:
@@ -306,6 +345,57 @@ func (pm *ProcessManager) ConvertTrace(trace *host.Trace) (newTrace *libpf.Trace
 	return newTrace
 }
 
+// symbolizeNativeFrame reports the functions that contain the address of a native
+// frame, if native symbolization is enabled and the reporter does not know the frame
+// yet. Functions inlined at the address are appended to newTrace as native frames
+// tagged with their inline depth, so that the caller appends the frame of the function
+// containing the address after them. Known frames are not symbolized again, their
+// inlined functions are appended from the nativeInlines cache. The symbolizer does
+// not block on reading executables or debug information, so frames whose lookup is
+// still in progress are reported without symbols until they occur again.
+func (pm *ProcessManager) symbolizeNativeFrame(newTrace *libpf.Trace,
+	frameType libpf.FrameType, fileID libpf.FileID, addr libpf.AddressOrLineno,
+	mappingStart, mappingEnd libpf.Address, fileOffset uint64) {
+	if pm.nativeSymbolizer == nil {
+		return
+	}
+	frameID := libpf.NewFrameID(fileID, addr)
+	if inlines, ok := pm.nativeInlines.Get(frameID); ok && pm.reporter.FrameKnown(frameID) {
+		for depth := int(inlines); depth > 0; depth-- {
+			newTrace.AppendFrameFull(frameType, fileID, addr.WithInlineDepth(uint8(depth)),
+				mappingStart, mappingEnd, fileOffset)
+		}
+		return
+	}
+
+	frames := pm.nativeSymbolizer.Symbolize(fileID, addr)
+	if len(frames) > math.MaxUint8+1 {
+		// Drop the innermost functions that can not be tagged.
+		frames = frames[len(frames)-math.MaxUint8-1:]
+	}
+	if len(frames) > 0 {
+		pm.nativeInlines.Add(frameID, uint8(len(frames)-1))
+	}
+	for i, frame := range frames {
+		depth := uint8(len(frames) - 1 - i)
+		frameAddr := addr.WithInlineDepth(depth)
+		frameID := libpf.NewFrameID(fileID, frameAddr)
+		if !pm.reporter.FrameKnown(frameID) {
+			pm.reporter.FrameMetadata(&reporter.FrameMetadataArgs{
+				FrameID:        frameID,
+				FunctionName:   libpf.Intern(frame.FunctionName),
+				SourceFile:     libpf.Intern(frame.SourceFile),
+				SourceLine:     libpf.SourceLineno(frame.SourceLine),
+				FunctionOffset: uint32(frame.FunctionOffset),
+			})
+		}
+		if depth > 0 {
+			newTrace.AppendFrameFull(frameType, fileID, frameAddr,
+				mappingStart, mappingEnd, fileOffset)
+		}
+	}
+}
+
 func (pm *ProcessManager) MaybeNotifyAPMAgent(
 	rawTrace *host.Trace, umTraceHash libpf.TraceHash, count uint16) string {
 	pm.mu.RLock()
@@ -7,6 +7,7 @@ package processmanager
 
 import (
 	"context"
+	"debug/dwarf"
 	"errors"
 	"fmt"
 	"math/rand/v2"
@@ -21,10 +22,12 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
 	"go.opentelemetry.io/ebpf-profiler/lpm"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
 	"go.opentelemetry.io/ebpf-profiler/nativeunwind"
 	sdtypes "go.opentelemetry.io/ebpf-profiler/nativeunwind/stackdeltatypes"
 	"go.opentelemetry.io/ebpf-profiler/process"
 	pmebpf "go.opentelemetry.io/ebpf-profiler/processmanager/ebpf"
+	eim "go.opentelemetry.io/ebpf-profiler/processmanager/execinfomanager"
 	"go.opentelemetry.io/ebpf-profiler/remotememory"
 	"go.opentelemetry.io/ebpf-profiler/reporter"
 	"go.opentelemetry.io/ebpf-profiler/support"
@@ -32,6 +35,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/traceutil"
 	"go.opentelemetry.io/ebpf-profiler/util"
 
+	lru "github.com/elastic/go-freelru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -322,7 +326,9 @@ func TestInterpreterConvertTrace(t *testing.T) {
 				&symbolReporterMockup{},
 				nil,
 				true,
-				libpf.Set[string]{})
+				libpf.Set[string]{},
+				nil,
+				nil)
 			require.NoError(t, err)
 
 			newTrace := manager.ConvertTrace(testcase.trace)
@@ -407,7 +413,9 @@ func TestNewMapping(t *testing.T) {
 				symRepMockup,
 				&dummyProvider,
 				true,
-				libpf.Set[string]{})
+				libpf.Set[string]{},
+				nil,
+				nil)
 			require.NoError(t, err)
 
 			// Replace the internal hooks for the tests. These hooks catch the
@@ -592,7 +600,9 @@ func TestProcExit(t *testing.T) {
 				repMockup,
 				&dummyProvider,
 				true,
-				libpf.Set[string]{})
+				libpf.Set[string]{},
+				nil,
+				nil)
 			require.NoError(t, err)
 			defer cancel()
 
@@ -616,3 +626,94 @@ func TestProcExit(t *testing.T) {
 		})
 	}
 }
+
+// frameRecorder is a symbol reporter that knows the frames it received metadata for.
+type frameRecorder struct {
+	symbolReporterMockup
+	frames map[libpf.FrameID]string
+}
+
+func (r *frameRecorder) FrameKnown(frameID libpf.FrameID) bool {
+	_, ok := r.frames[frameID]
+	return ok
+}
+
+func (r *frameRecorder) FrameMetadata(args *reporter.FrameMetadataArgs) {
+	r.frames[args.FrameID] = args.FunctionName.String()
+}
+
+func TestSymbolizeNativeFrame(t *testing.T) {
+	const inlinePath = "../nativesymbolizer/testdata/inline"
+
+	// The call to sink from main has the calls main -> outer -> inner inlined.
+	ef, err := pfelf.Open(inlinePath)
+	require.NoError(t, err)
+	data, err := ef.DWARF()
+	require.NoError(t, err)
+	var addr libpf.AddressOrLineno
+	for r := data.Reader(); addr == 0; {
+		e, err := r.Next()
+		require.NoError(t, err)
+		require.NotNil(t, e, "no call site found")
+		if pc, ok := e.Val(dwarf.AttrCallReturnPC).(uint64); ok &&
+			e.Tag == dwarf.TagCallSite {
+			addr = libpf.AddressOrLineno(pc) - 1
+		}
+	}
+	require.NoError(t, ef.Close())
+
+	symbolizer, err := nativesymbolizer.New(64*1024*1024, true)
+	require.NoError(t, err)
+	fileID := libpf.NewFileID(1, 2)
+	symbolizer.Register(fileID, inlinePath, pfelf.SystemOpener)
+	require.Eventually(t, func() bool {
+		return symbolizer.Symbolize(fileID, addr) != nil
+	}, 10*time.Second, time.Millisecond)
+
+	inlines, err := lru.NewSynced[libpf.FrameID, uint8](16, libpf.FrameID.Hash32)
+	require.NoError(t, err)
+	rep := &frameRecorder{frames: make(map[libpf.FrameID]string)}
+	pm := &ProcessManager{
+		reporter:         rep,
+		nativeSymbolizer: symbolizer,
+		nativeInlines:    inlines,
+	}
+
+	expected := &libpf.Trace{}
+	for depth := uint8(2); depth > 0; depth-- {
+		expected.AppendFrameFull(libpf.NativeFrame, fileID, addr.WithInlineDepth(depth),
+			0x1000, 0x2000, 0)
+	}
+
+	trace := &libpf.Trace{}
+	pm.symbolizeNativeFrame(trace, libpf.NativeFrame, fileID, addr, 0x1000, 0x2000, 0)
+	assert.Equal(t, expected, trace)
+	assert.Equal(t, map[libpf.FrameID]string{
+		libpf.NewFrameID(fileID, addr.WithInlineDepth(2)): "inner",
+		libpf.NewFrameID(fileID, addr.WithInlineDepth(1)): "outer",
+		libpf.NewFrameID(fileID, addr):                    "main",
+	}, rep.frames)
+
+	// Known frames are not symbolized again, but keep their inlined functions.
+	pm.nativeSymbolizer, err = nativesymbolizer.New(64*1024*1024, true)
+	require.NoError(t, err)
+	trace = &libpf.Trace{}
+	pm.symbolizeNativeFrame(trace, libpf.NativeFrame, fileID, addr, 0x1000, 0x2000, 0)
+	assert.Equal(t, expected, trace)
+	assert.Len(t, rep.frames, 3)
+}
+
+func TestSetIncludedTracers(t *testing.T) {
+	em, err := eim.NewExecutableInfoManager(nil, nil, tracertypes.AllTracers())
+	require.NoError(t, err)
+	pm := &ProcessManager{eim: em}
+	all := em.NumInterpreterLoaders()
+
+	noInterpreters, err := tracertypes.Parse("")
+	require.NoError(t, err)
+	pm.SetIncludedTracers(noInterpreters)
+	assert.Less(t, em.NumInterpreterLoaders(), all)
+
+	pm.SetIncludedTracers(tracertypes.AllTracers())
+	assert.Equal(t, all, em.NumInterpreterLoaders())
+}
@@ -149,12 +149,17 @@ func (pm *ProcessManager) updatePidInformation(pid libpf.PID, m *Mapping) (bool,
 		if err != nil {
 			log.Debugf("Failed extracting containerID for %d: %v", pid, err)
 		}
+		cgroupPath, err := extractCgroupPath(pid)
+		if err != nil {
+			log.Debugf("Failed extracting cgroup path for %d: %v", pid, err)
+		}
 
 		info = &processInfo{
 			meta: ProcessMeta{
 				Name:         processName,
 				Executable:   exePath,
 				ContainerID:  containerID,
+				CgroupPath:   cgroupPath,
 				EnvVariables: envVarMap},
 			mappings:         make(map[libpf.Address]*Mapping),
 			mappingsByFileID: make(map[host.FileID]map[libpf.Address]*Mapping),
@@ -427,6 +432,12 @@ func (pm *ProcessManager) processNewExecMapping(pr process.Process, mapping *pro
 		return
 	}
 
+	if pm.nativeSymbolizer != nil {
+		if fileID, ok := pm.FileIDMapper.Get(info.fileID); ok {
+			pm.nativeSymbolizer.Register(fileID, mapping.Path.String(), pr)
+		}
+	}
+
 	if err := pm.handleNewMapping(pr,
 		&Mapping{
 			FileID:     info.fileID,
@@ -587,6 +598,9 @@ func (pm *ProcessManager) processPIDExit(pid libpf.PID) {
 		}
 	}()
 	defer pm.ebpf.RemoveReportedPID(pid)
+	if pm.targetPIDs != nil {
+		pm.targetPIDs.Remove(pid)
+	}
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -627,6 +641,11 @@ func (pm *ProcessManager) SynchronizeProcess(pr process.Process) {
 	pid := pr.PID()
 	log.Debugf("= PID: %v", pid)
 
+	if pm.targetPIDs != nil && !pm.targetPIDs.Contains(pid) {
+		log.Debugf("PID %v is not targeted, aborting SynchronizeProcess", pid)
+		return
+	}
+
 	// Abort early if process is waiting for cleanup in ProcessedUntil
 	pm.mu.Lock()
 	_, ok := pm.exitEvents[pid]
@@ -788,6 +807,9 @@ func (pm *ProcessManager) ProcessedUntil(traceCaptureKTime times.KTime) {
 		}
 		delete(pm.interpreters, pid)
 		delete(pm.exitEvents, pid)
+		if allocReporter, ok := pm.reporter.(reporter.AllocationReporter); ok {
+			allocReporter.ReportAllocationsFreed(pid)
+		}
 		log.Debugf("PID %v exit latency %v ms", pid, (nowKTime-pidExitKTime)/1e6)
 	}
 }
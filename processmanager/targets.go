@@ -0,0 +1,162 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package processmanager // import "go.opentelemetry.io/ebpf-profiler/processmanager"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+// maxAncestorDepth limits how many parent processes are inspected to decide whether
+// a running process is a descendant of a target process.
+const maxAncestorDepth = 64
+
+// TargetPIDs is the set of processes profiling is restricted to. It consists of a
+// root process and, if children are followed, all of its descendants.
+type TargetPIDs struct {
+	root     libpf.PID
+	children bool
+	// forked returns true if a process was recorded as descendant of a target process
+	// when it was forked.
+	forked func(libpf.PID) bool
+
+	mu   sync.RWMutex
+	pids libpf.Set[libpf.PID]
+}
+
+// NewTargetPIDs creates a TargetPIDs set for root. If children is true, processes
+// forked by any process in the set become part of it: the descendants that run at
+// the time of Scan are added by it, and forked reports the ones forked later.
+func NewTargetPIDs(root libpf.PID, children bool, forked func(libpf.PID) bool) *TargetPIDs {
+	return &TargetPIDs{
+		root:     root,
+		children: children,
+		forked:   forked,
+		pids:     libpf.Set[libpf.PID]{root: libpf.Void{}},
+	}
+}
+
+// FollowChildren returns true if descendants of the root process are targeted.
+func (t *TargetPIDs) FollowChildren() bool {
+	return t.children
+}
+
+// Scan adds the currently running descendants of the root process to the set and
+// returns all PIDs in the set.
+func (t *TargetPIDs) Scan() ([]libpf.PID, error) {
+	if t.children {
+		parents, err := readParentPIDs()
+		if err != nil {
+			return nil, err
+		}
+
+		t.mu.Lock()
+		for pid := range parents {
+			if isDescendant(pid, parents, t.pids) {
+				t.pids[pid] = libpf.Void{}
+			}
+		}
+		t.mu.Unlock()
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.pids.ToSlice(), nil
+}
+
+// Contains returns true if pid is a target process. Processes that were forked by a
+// target process are added to the set.
+func (t *TargetPIDs) Contains(pid libpf.PID) bool {
+	t.mu.RLock()
+	_, ok := t.pids[pid]
+	t.mu.RUnlock()
+	if ok || !t.children || t.forked == nil || !t.forked(pid) {
+		return ok
+	}
+
+	t.mu.Lock()
+	t.pids[pid] = libpf.Void{}
+	t.mu.Unlock()
+	return true
+}
+
+// Remove removes an exited process from the set.
+func (t *TargetPIDs) Remove(pid libpf.PID) {
+	t.mu.Lock()
+	delete(t.pids, pid)
+	t.mu.Unlock()
+}
+
+// isDescendant returns true if pid or one of its ancestors in parents is in pids.
+func isDescendant(pid libpf.PID, parents map[libpf.PID]libpf.PID,
+	pids libpf.Set[libpf.PID]) bool {
+	for range maxAncestorDepth {
+		if _, ok := pids[pid]; ok {
+			return true
+		}
+		parent, ok := parents[pid]
+		if !ok || parent <= 1 {
+			return false
+		}
+		pid = parent
+	}
+	return false
+}
+
+// readParentPIDs returns the parent PID of each running process.
+func readParentPIDs() (map[libpf.PID]libpf.PID, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[libpf.PID]libpf.PID, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		parent, err := readParentPID(libpf.PID(pid))
+		if err != nil {
+			// The process exited in the meantime.
+			continue
+		}
+		parents[libpf.PID(pid)] = parent
+	}
+	return parents, nil
+}
+
+// readParentPID returns the parent PID of the process pid.
+func readParentPID(pid libpf.PID) (libpf.PID, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseParentPID(stat)
+}
+
+// parseParentPID extracts the parent PID from the content of /proc/PID/stat.
+func parseParentPID(stat []byte) (libpf.PID, error) {
+	// The command name in the second field may contain spaces and parentheses,
+	// so parse the fields following its last closing parenthesis.
+	idx := bytes.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, errors.New("missing command name")
+	}
+	fields := bytes.Fields(stat[idx+1:])
+	if len(fields) < 2 {
+		return 0, errors.New("missing parent PID")
+	}
+	parent, err := strconv.ParseUint(string(fields[1]), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid parent PID: %v", err)
+	}
+	return libpf.PID(parent), nil
+}
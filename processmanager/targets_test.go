@@ -0,0 +1,95 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package processmanager // import "go.opentelemetry.io/ebpf-profiler/processmanager"
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+func TestParseParentPID(t *testing.T) {
+	tests := map[string]struct {
+		stat    string
+		want    libpf.PID
+		wantErr bool
+	}{
+		"simple": {
+			stat: "1234 (bash) S 1000 1234 1234 34817 1234 4194304 1263",
+			want: 1000,
+		},
+		"parentheses in comm": {
+			stat: "42 (a) b (c)) R 7 42 42 0 -1 4194560 99",
+			want: 7,
+		},
+		"truncated": {
+			stat:    "42 (a) R",
+			wantErr: true,
+		},
+		"no comm": {
+			stat:    "42",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent, err := parseParentPID([]byte(tc.stat))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, parent)
+		})
+	}
+}
+
+func TestTargetPIDs(t *testing.T) {
+	self := libpf.PID(os.Getpid())
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	child := libpf.PID(cmd.Process.Pid)
+
+	forked := libpf.Set[libpf.PID]{}
+	isForked := func(pid libpf.PID) bool {
+		_, ok := forked[pid]
+		return ok
+	}
+
+	targets := NewTargetPIDs(self, false, isForked)
+	assert.True(t, targets.Contains(self))
+	assert.False(t, targets.Contains(child))
+
+	targets = NewTargetPIDs(self, true, isForked)
+	pids, err := targets.Scan()
+	require.NoError(t, err)
+	assert.Contains(t, pids, self)
+	assert.Contains(t, pids, child)
+	assert.False(t, targets.Contains(libpf.PID(os.Getppid())))
+
+	// Descendants are not looked up in the process tree, but recorded when forked.
+	targets = NewTargetPIDs(self, true, isForked)
+	assert.False(t, targets.Contains(child))
+	forked[child] = libpf.Void{}
+	assert.True(t, targets.Contains(child))
+	delete(forked, child)
+	assert.True(t, targets.Contains(child))
+	targets.Remove(child)
+	assert.False(t, targets.Contains(child))
+
+	// Forked processes are only targeted if children are followed.
+	forked[child] = libpf.Void{}
+	targets = NewTargetPIDs(self, false, isForked)
+	assert.False(t, targets.Contains(child))
+}
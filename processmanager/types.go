@@ -14,6 +14,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
 	pmebpf "go.opentelemetry.io/ebpf-profiler/processmanager/ebpf"
 	eim "go.opentelemetry.io/ebpf-profiler/processmanager/execinfomanager"
 	"go.opentelemetry.io/ebpf-profiler/reporter"
@@ -100,6 +101,15 @@ type ProcessManager struct {
 
 	// includeEnvVars holds a list of env vars that should be captured from processes
 	includeEnvVars libpf.Set[string]
+
+	// nativeSymbolizer resolves function names of native frames, nil if disabled.
+	nativeSymbolizer *nativesymbolizer.Symbolizer
+	// nativeInlines caches the number of functions inlined at the address of native
+	// frames that the reporter knows, so that these are not symbolized again.
+	nativeInlines *lru.SyncedLRU[libpf.FrameID, uint8]
+
+	// targetPIDs restricts the processes to synchronize, nil if all processes are profiled.
+	targetPIDs *TargetPIDs
 }
 
 // Mapping represents an executable memory mapping of a process.
@@ -149,6 +159,8 @@ type ProcessMeta struct {
 	EnvVariables map[string]string
 	// container ID retrieved from /proc/PID/cgroup
 	ContainerID string
+	// cgroup v2 path retrieved from /proc/PID/cgroup
+	CgroupPath string
 }
 
 // processInfo contains information about the executable mappings
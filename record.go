@@ -0,0 +1,109 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/internal/controller"
+	"go.opentelemetry.io/ebpf-profiler/reporter"
+	"go.opentelemetry.io/ebpf-profiler/times"
+)
+
+// recordDrainTimeout limits the time to wait for the recorded traces to be reported.
+const recordDrainTimeout = 30 * time.Second
+
+// recordArgs holds the arguments of the record subcommand.
+type recordArgs struct {
+	duration time.Duration
+	output   string
+}
+
+// recordWithExitCode runs the record subcommand, which profiles for a fixed duration
+// and writes the profile to a local file, without sending it to a collector.
+func recordWithExitCode(arguments []string) exitCode {
+	cfg, rec, err := parseRecordArgs(arguments)
+	if err != nil {
+		log.Errorf("Failure to parse arguments: %v", err)
+		return exitParseError
+	}
+
+	if cfg.VerboseMode {
+		log.SetLevel(log.DebugLevel)
+		cfg.Dump()
+	}
+
+	if err = cfg.Validate(); err != nil {
+		log.Error(err)
+		return exitFailure
+	}
+	if cfg.PrintConfig {
+		if err = controller.PrintConfig(os.Stdout, cfg.Fs); err != nil {
+			return failure("Failed to print configuration: %v", err)
+		}
+		return exitSuccess
+	}
+	if rec.duration <= 0 {
+		return failure("Invalid recording duration: %v", rec.duration)
+	}
+	if rec.output == "" {
+		return failure("No output file given")
+	}
+
+	// A signal ends the recording early, the profile is written regardless.
+	sigCtx, sigCancel := signal.NotifyContext(context.Background(),
+		unix.SIGINT, unix.SIGTERM)
+	defer sigCancel()
+
+	// The controller keeps running until the recorded traces are reported.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	intervals := times.New(cfg.ReporterInterval,
+		cfg.MonitorInterval, cfg.ProbabilisticInterval)
+
+	repCfg, err := newReporterConfig(cfg, intervals)
+	if err != nil {
+		log.Error(err)
+		return exitFailure
+	}
+	repCfg.PprofOutputFile = rec.output
+
+	rep, err := reporter.NewPprof(repCfg)
+	if err != nil {
+		log.Error(err)
+		return exitFailure
+	}
+	cfg.Reporter = rep
+
+	ctlr := controller.New(cfg)
+	if err = ctlr.Start(ctx); err != nil {
+		return failure("Failed to start agent controller: %v", err)
+	}
+
+	log.Infof("Recording for %v ...", rec.duration)
+	timer := time.NewTimer(rec.duration)
+	select {
+	case <-timer.C:
+	case <-sigCtx.Done():
+		timer.Stop()
+		log.Info("Recording interrupted")
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(ctx, recordDrainTimeout)
+	if err = ctlr.Drain(drainCtx); err != nil {
+		log.Warnf("Profile might miss recorded traces: %v", err)
+	}
+	drainCancel()
+
+	// Stopping the reporter writes the profile.
+	ctlr.Shutdown()
+	return exitSuccess
+}
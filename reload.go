@@ -0,0 +1,98 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/internal/controller"
+	"go.opentelemetry.io/ebpf-profiler/times"
+)
+
+// configWatchInterval is the interval in which the configuration file is checked
+// for changes.
+const configWatchInterval = 5 * time.Second
+
+// configFileVersion identifies the content of the configuration file.
+type configFileVersion struct {
+	modTime int64
+	size    int64
+}
+
+// startReload reloads the configuration of the running controller on SIGHUP and when
+// configFile changes, until ctx is done. Changes of settings that require a restart
+// are rejected and logged.
+func startReload(ctx context.Context, ctlr *controller.Controller, configFile string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, unix.SIGHUP)
+
+	var watch <-chan time.Time
+	var version configFileVersion
+	var stopWatch func()
+	if configFile != "" {
+		version = statConfigFile(configFile)
+		ticker := time.NewTicker(configWatchInterval)
+		watch, stopWatch = ticker.C, ticker.Stop
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		if stopWatch != nil {
+			defer stopWatch()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Info("Reloading configuration on SIGHUP")
+			case <-watch:
+				current := statConfigFile(configFile)
+				if current == version {
+					continue
+				}
+				version = current
+				log.Infof("Reloading configuration on change of %s", configFile)
+			}
+			if err := reload(ctx, ctlr); err != nil {
+				log.Errorf("Failed to reload configuration: %v", err)
+			}
+		}
+	}()
+}
+
+// reload parses the arguments, the environment and the configuration file again and
+// applies the result to the running controller.
+func reload(ctx context.Context, ctlr *controller.Controller) error {
+	cfg, err := reparseArgs()
+	if err != nil {
+		return err
+	}
+
+	intervals := times.New(cfg.ReporterInterval,
+		cfg.MonitorInterval, cfg.ProbabilisticInterval)
+
+	repCfg, err := newReporterConfig(cfg, intervals)
+	if err != nil {
+		return err
+	}
+	return ctlr.Reload(ctx, cfg, repCfg)
+}
+
+// statConfigFile returns the version of the configuration file path, or the zero
+// version if it does not exist.
+func statConfigFile(path string) configFileVersion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return configFileVersion{}
+	}
+	return configFileVersion{modTime: info.ModTime().UnixNano(), size: info.Size()}
+}
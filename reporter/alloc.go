@@ -0,0 +1,181 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"time"
+
+	lru "github.com/elastic/go-freelru"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/hash"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+const (
+	// allocFreesSize is the maximum number of frees that are kept until the trace
+	// of their allocation is reported.
+	allocFreesSize = 4096
+
+	// allocFreeLifetime is the time a free is kept until the trace of its allocation
+	// is reported.
+	allocFreeLifetime = time.Minute
+)
+
+// allocKey identifies a tracked allocation.
+type allocKey struct {
+	pid  libpf.PID
+	addr uint64
+}
+
+func (k allocKey) hash32() uint32 {
+	return uint32(hash.Uint64(k.addr ^ uint64(k.pid)))
+}
+
+// inUseAlloc is a tracked allocation that was not freed yet.
+type inUseAlloc struct {
+	containerID samples.ContainerID
+	key         samples.TraceAndMetaKey
+	trace       *libpf.Trace
+	envVars     map[string]string
+	timestamp   libpf.UnixTime64
+	size        int64
+}
+
+// allocTracker tracks the sampled allocations until they are freed, so that the
+// allocations in use can be reported.
+type allocTracker struct {
+	// inUse holds the tracked allocations that were not freed yet. Its capacity
+	// matches the number of allocations tracked by the eBPF programs.
+	inUse *lru.SyncedLRU[allocKey, inUseAlloc]
+
+	// frees holds the time of frees that are reported before the trace of their
+	// allocation. Frees and traces are reported independently, so their order is
+	// not guaranteed.
+	frees *lru.SyncedLRU[allocKey, libpf.UnixTime64]
+}
+
+// newAllocTracker returns a new allocTracker if cfg enables the tracking of the
+// allocations in use, nil otherwise.
+func newAllocTracker(cfg *Config) (*allocTracker, error) {
+	if !cfg.AllocInUse {
+		return nil, nil
+	}
+
+	inUse, err := lru.NewSynced[allocKey, inUseAlloc](support.MaxAllocsInUse,
+		allocKey.hash32)
+	if err != nil {
+		return nil, err
+	}
+	frees, err := lru.NewSynced[allocKey, libpf.UnixTime64](allocFreesSize,
+		allocKey.hash32)
+	if err != nil {
+		return nil, err
+	}
+	frees.SetLifetime(allocFreeLifetime)
+
+	return &allocTracker{
+		inUse: inUse,
+		frees: frees,
+	}, nil
+}
+
+// track starts tracking the allocation of an allocation trace, unless the allocation
+// was already freed.
+func (a *allocTracker) track(containerID samples.ContainerID, key samples.TraceAndMetaKey,
+	trace *libpf.Trace, meta *samples.TraceEventMeta) {
+	k := allocKey{pid: meta.PID, addr: meta.Addr}
+	if freed, ok := a.frees.Peek(k); ok {
+		a.frees.Remove(k)
+		if freed >= meta.Timestamp {
+			return
+		}
+	}
+
+	a.inUse.Add(k, inUseAlloc{
+		containerID: containerID,
+		key:         key,
+		trace:       trace,
+		envVars:     meta.EnvVars,
+		timestamp:   meta.Timestamp,
+		size:        meta.OffTime,
+	})
+}
+
+// free stops tracking the allocation at addr of pid that was freed at timestamp.
+func (a *allocTracker) free(pid libpf.PID, addr uint64, timestamp libpf.UnixTime64) {
+	k := allocKey{pid: pid, addr: addr}
+	alloc, ok := a.inUse.Peek(k)
+	if !ok {
+		a.frees.Add(k, timestamp)
+		return
+	}
+	// A newer allocation at the same address is kept, e.g. if realloc returned the
+	// address of the reallocated allocation.
+	if alloc.timestamp <= timestamp {
+		a.inUse.Remove(k)
+	}
+}
+
+// freeProcess stops tracking all allocations of pid.
+func (a *allocTracker) freeProcess(pid libpf.PID) {
+	for _, k := range a.inUse.Keys() {
+		if k.pid == pid {
+			a.inUse.Remove(k)
+		}
+	}
+}
+
+// reconcile stops tracking the allocations sampled before timestamp that are not in
+// tracked. The eBPF programs evicted them to track newer allocations, so their frees
+// are never reported.
+func (a *allocTracker) reconcile(tracked libpf.Set[support.AllocKey],
+	timestamp libpf.UnixTime64) {
+	for _, k := range a.inUse.Keys() {
+		alloc, ok := a.inUse.Peek(k)
+		if !ok || alloc.timestamp >= timestamp {
+			continue
+		}
+		if _, ok = tracked[support.AllocKey{Addr: k.addr, Pid: uint32(k.pid)}]; !ok {
+			a.inUse.Remove(k)
+		}
+	}
+}
+
+// addInUse adds the allocations in use to tree.
+func (a *allocTracker) addInUse(tree samples.TraceEventsTree) {
+	for _, k := range a.inUse.Keys() {
+		alloc, ok := a.inUse.Peek(k)
+		if !ok {
+			continue
+		}
+
+		if _, exists := tree[alloc.containerID]; !exists {
+			tree[alloc.containerID] = make(map[libpf.Origin]samples.KeyToEventMapping)
+		}
+		if _, exists := tree[alloc.containerID][support.TraceOriginAllocInUse]; !exists {
+			tree[alloc.containerID][support.TraceOriginAllocInUse] =
+				make(samples.KeyToEventMapping)
+		}
+
+		events := tree[alloc.containerID][support.TraceOriginAllocInUse]
+		if traceEvents, exists := events[alloc.key]; exists {
+			traceEvents.Timestamps = append(traceEvents.Timestamps, uint64(alloc.timestamp))
+			traceEvents.OffTimes = append(traceEvents.OffTimes, alloc.size)
+			continue
+		}
+		events[alloc.key] = &samples.TraceEvents{
+			Files:              alloc.trace.Files,
+			Linenos:            alloc.trace.Linenos,
+			FrameTypes:         alloc.trace.FrameTypes,
+			MappingStarts:      alloc.trace.MappingStart,
+			MappingEnds:        alloc.trace.MappingEnd,
+			MappingFileOffsets: alloc.trace.MappingFileOffsets,
+			Timestamps:         []uint64{uint64(alloc.timestamp)},
+			OffTimes:           []int64{alloc.size},
+			EnvVars:            alloc.envVars,
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func newTestAllocTracker(t *testing.T) *allocTracker {
+	t.Helper()
+	allocs, err := newAllocTracker(&Config{AllocInUse: true})
+	require.NoError(t, err)
+	require.NotNil(t, allocs)
+	return allocs
+}
+
+func trackTestAlloc(allocs *allocTracker, key samples.TraceAndMetaKey, pid libpf.PID,
+	addr uint64, timestamp libpf.UnixTime64, size int64) {
+	trace := &libpf.Trace{
+		Files:      []libpf.FileID{libpf.NewFileID(1, 2)},
+		Linenos:    []libpf.AddressOrLineno{0x10},
+		FrameTypes: []libpf.FrameType{libpf.NativeFrame},
+	}
+	allocs.track("container", key, trace, &samples.TraceEventMeta{
+		PID:       pid,
+		Addr:      addr,
+		Timestamp: timestamp,
+		OffTime:   size,
+	})
+}
+
+func TestNewAllocTrackerDisabled(t *testing.T) {
+	allocs, err := newAllocTracker(&Config{})
+	require.NoError(t, err)
+	assert.Nil(t, allocs)
+}
+
+func TestAllocTrackerInUse(t *testing.T) {
+	allocs := newTestAllocTracker(t)
+	keyA := samples.TraceAndMetaKey{Hash: libpf.NewTraceHash(1, 1), Pid: 1}
+	keyB := samples.TraceAndMetaKey{Hash: libpf.NewTraceHash(2, 2), Pid: 1}
+
+	trackTestAlloc(allocs, keyA, 1, 0x1000, 10, 16)
+	trackTestAlloc(allocs, keyA, 1, 0x2000, 20, 32)
+	trackTestAlloc(allocs, keyB, 1, 0x3000, 30, 64)
+	trackTestAlloc(allocs, keyB, 2, 0x3000, 40, 128)
+
+	allocs.free(1, 0x3000, 50)
+	allocs.freeProcess(2)
+
+	tree := make(samples.TraceEventsTree)
+	allocs.addInUse(tree)
+
+	events := tree["container"][support.TraceOriginAllocInUse]
+	require.Len(t, events, 1)
+	require.Contains(t, events, keyA)
+	assert.ElementsMatch(t, []uint64{10, 20}, events[keyA].Timestamps)
+	assert.ElementsMatch(t, []int64{16, 32}, events[keyA].OffTimes)
+	assert.Len(t, events[keyA].Files, 1)
+}
+
+func TestAllocTrackerFreeOrder(t *testing.T) {
+	allocs := newTestAllocTracker(t)
+	key := samples.TraceAndMetaKey{Hash: libpf.NewTraceHash(1, 1), Pid: 1}
+
+	// The free is reported before the trace of its allocation.
+	allocs.free(1, 0x1000, 20)
+	trackTestAlloc(allocs, key, 1, 0x1000, 10, 16)
+
+	// The free of a previous allocation at the same address is reported before the
+	// trace of the new allocation.
+	allocs.free(1, 0x2000, 20)
+	trackTestAlloc(allocs, key, 1, 0x2000, 30, 32)
+
+	// The free of a previous allocation at the same address is reported after the
+	// trace of the new allocation.
+	trackTestAlloc(allocs, key, 1, 0x3000, 30, 64)
+	allocs.free(1, 0x3000, 20)
+
+	tree := make(samples.TraceEventsTree)
+	allocs.addInUse(tree)
+
+	events := tree["container"][support.TraceOriginAllocInUse]
+	require.Contains(t, events, key)
+	assert.ElementsMatch(t, []int64{32, 64}, events[key].OffTimes)
+}
+
+func TestAllocTrackerReconcile(t *testing.T) {
+	allocs := newTestAllocTracker(t)
+	key := samples.TraceAndMetaKey{Hash: libpf.NewTraceHash(1, 1), Pid: 1}
+
+	trackTestAlloc(allocs, key, 1, 0x1000, 10, 16)
+	trackTestAlloc(allocs, key, 1, 0x2000, 20, 32)
+	trackTestAlloc(allocs, key, 2, 0x1000, 30, 64)
+	trackTestAlloc(allocs, key, 1, 0x3000, 50, 128)
+
+	// The allocation at 0x2000 of process 1 and the allocation of process 2 were
+	// evicted by the eBPF programs. The allocation at 0x3000 was sampled after the
+	// tracked allocations were read.
+	allocs.reconcile(libpf.Set[support.AllocKey]{
+		{Addr: 0x1000, Pid: 1}: libpf.Void{},
+	}, 40)
+
+	tree := make(samples.TraceEventsTree)
+	allocs.addInUse(tree)
+
+	events := tree["container"][support.TraceOriginAllocInUse]
+	require.Contains(t, events, key)
+	assert.ElementsMatch(t, []int64{16, 128}, events[key].OffTimes)
+}
@@ -16,6 +16,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
 	"go.opentelemetry.io/ebpf-profiler/support"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
 )
 
 // baseReporter encapsulates shared behavior between all the available reporters.
@@ -37,6 +38,9 @@ type baseReporter struct {
 	// traceEvents stores reported trace events (trace metadata with frames and counts)
 	traceEvents xsync.RWMutex[samples.TraceEventsTree]
 
+	// allocs tracks the sampled allocations that are in use, nil if disabled.
+	allocs *allocTracker
+
 	// hostmetadata stores metadata that is sent out with every request.
 	hostmetadata *lru.SyncedLRU[string, string]
 }
@@ -47,6 +51,10 @@ func (b *baseReporter) Stop() {
 	b.runLoop.Stop()
 }
 
+func (b *baseReporter) SetReportInterval(interval time.Duration) {
+	b.runLoop.SetInterval(interval)
+}
+
 func (b *baseReporter) ReportHostMetadata(metadataMap map[string]string) {
 	b.addHostmetadata(metadataMap)
 }
@@ -82,8 +90,14 @@ func (b *baseReporter) ExecutableMetadata(args *ExecutableMetadataArgs) {
 }
 
 func (b *baseReporter) ReportTraceEvent(trace *libpf.Trace, meta *samples.TraceEventMeta) error {
-	if meta.Origin != support.TraceOriginSampling && meta.Origin != support.TraceOriginOffCPU {
-		// At the moment only on-CPU and off-CPU traces are reported.
+	if _, isPerfEvent := tracertypes.PerfEventName(meta.Origin); !isPerfEvent &&
+		meta.Origin != support.TraceOriginSampling && meta.Origin != support.TraceOriginOffCPU &&
+		meta.Origin != support.TraceOriginUprobe && meta.Origin != support.TraceOriginAlloc &&
+		meta.Origin != support.TraceOriginContention &&
+		meta.Origin != support.TraceOriginRunQueue &&
+		meta.Origin != support.TraceOriginWakeup {
+		// At the moment only on-CPU, off-CPU, perf event, uprobe, allocation, lock
+		// contention, run queue and wakeup traces are reported.
 		return fmt.Errorf("skip reporting trace for %d origin: %w", meta.Origin,
 			errUnknownOrigin)
 	}
@@ -105,6 +119,22 @@ func (b *baseReporter) ReportTraceEvent(trace *libpf.Trace, meta *samples.TraceE
 		Tid:            int64(meta.TID),
 		ExtraMeta:      extraMeta,
 	}
+	switch meta.Origin {
+	case support.TraceOriginSampling:
+		key.SamplePeriod = meta.OffTime
+	case support.TraceOriginOffCPU:
+		key.TaskState = meta.TaskState
+		key.WaitChannel = meta.WaitChannel
+		key.WakerPid = int64(meta.WakerPID)
+		key.WakerTid = int64(meta.WakerTID)
+		key.WakerHash = meta.WakerHash
+	case support.TraceOriginContention:
+		key.LockAddr = meta.Addr
+	}
+
+	if b.allocs != nil && meta.Origin == support.TraceOriginAlloc && meta.Addr != 0 {
+		b.allocs.track(samples.ContainerID(containerID), key, trace, meta)
+	}
 
 	eventsTree := b.traceEvents.WLock()
 	defer b.traceEvents.WUnlock(&eventsTree)
@@ -139,6 +169,44 @@ func (b *baseReporter) ReportTraceEvent(trace *libpf.Trace, meta *samples.TraceE
 	return nil
 }
 
+// takeTraceEvents returns the trace events reported since its last call. If the
+// allocations in use are tracked, they are added to the returned trace events.
+func (b *baseReporter) takeTraceEvents() samples.TraceEventsTree {
+	traceEventsPtr := b.traceEvents.WLock()
+	reportedEvents := (*traceEventsPtr)
+	newEvents := make(samples.TraceEventsTree)
+	*traceEventsPtr = newEvents
+	b.traceEvents.WUnlock(&traceEventsPtr)
+
+	if b.allocs != nil {
+		b.allocs.addInUse(reportedEvents)
+	}
+	return reportedEvents
+}
+
+// ReportAllocationFree implements the AllocationReporter interface.
+func (b *baseReporter) ReportAllocationFree(pid libpf.PID, addr uint64,
+	timestamp libpf.UnixTime64) {
+	if b.allocs != nil {
+		b.allocs.free(pid, addr, timestamp)
+	}
+}
+
+// ReportAllocationsFreed implements the AllocationReporter interface.
+func (b *baseReporter) ReportAllocationsFreed(pid libpf.PID) {
+	if b.allocs != nil {
+		b.allocs.freeProcess(pid)
+	}
+}
+
+// ReportAllocationsTracked implements the AllocationReporter interface.
+func (b *baseReporter) ReportAllocationsTracked(tracked libpf.Set[support.AllocKey],
+	timestamp libpf.UnixTime64) {
+	if b.allocs != nil {
+		b.allocs.reconcile(tracked, timestamp)
+	}
+}
+
 func (b *baseReporter) FrameMetadata(args *FrameMetadataArgs) {
 	log.Debugf("FrameMetadata [%x] %v+%v at %v:%v",
 		args.FrameID.FileID(), args.FunctionName, args.FunctionOffset,
@@ -147,7 +215,7 @@ func (b *baseReporter) FrameMetadata(args *FrameMetadataArgs) {
 		LineNumber:     args.SourceLine,
 		FilePath:       args.SourceFile,
 		FunctionOffset: args.FunctionOffset,
-		FunctionName:   args.FunctionName,
 	}
+	si.FunctionName, si.MangledName = demangleFunctionName(args.FunctionName, b.cfg.Demangle)
 	b.pdata.Frames.Add(args.FrameID, si)
 }
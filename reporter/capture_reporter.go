@@ -0,0 +1,204 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/elastic/go-freelru"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/xsync"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pprof"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// Assert that we implement the full Reporter interface.
+var _ Reporter = (*CaptureReporter)(nil)
+
+var (
+	// ErrCaptureRunning is returned by Capture if another capture is running.
+	ErrCaptureRunning = errors.New("another capture is running")
+	// ErrNoSamples is returned by Capture if no samples were captured.
+	ErrNoSamples = errors.New("no samples were captured")
+)
+
+// CaptureReporter forwards all calls to a Reporter. On request, it additionally
+// captures the on-CPU trace events of selected processes for a limited time into a
+// pprof profile.
+type CaptureReporter struct {
+	Reporter
+
+	cfg *Config
+
+	// running is the capture in progress, nil if there is none.
+	running atomic.Pointer[capture]
+}
+
+// capture collects the trace events of a single Capture call.
+type capture struct {
+	*baseReporter
+
+	// pids holds the processes whose trace events are captured, all if empty.
+	pids libpf.Set[libpf.PID]
+}
+
+// NewCapture returns a new instance of CaptureReporter that forwards all calls to rep.
+func NewCapture(cfg *Config, rep Reporter) *CaptureReporter {
+	return &CaptureReporter{
+		Reporter: rep,
+		cfg:      cfg,
+	}
+}
+
+// Capture records the on-CPU trace events of the processes pids, or of all processes
+// if pids is empty, for duration. It returns them as a gzip compressed pprof profile.
+// Only one capture can run at a time.
+func (r *CaptureReporter) Capture(ctx context.Context, pids libpf.Set[libpf.PID],
+	duration time.Duration) ([]byte, error) {
+	hostmetadata, err := lru.NewSynced[string, string](115, hashString)
+	if err != nil {
+		return nil, err
+	}
+	data, err := pdata.New(
+		r.cfg.SamplesPerSecond,
+		r.cfg.AllocSampleInterval,
+		r.cfg.ExecutablesCacheElements,
+		r.cfg.FramesCacheElements,
+		r.cfg.ExtraSampleAttrProd,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &capture{
+		baseReporter: &baseReporter{
+			cfg:          r.cfg,
+			pdata:        data,
+			traceEvents:  xsync.NewRWMutex(make(samples.TraceEventsTree)),
+			hostmetadata: hostmetadata,
+		},
+		pids: pids,
+	}
+	if !r.running.CompareAndSwap(nil, c) {
+		return nil, ErrCaptureRunning
+	}
+
+	timer := time.NewTimer(duration)
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+	}
+	timer.Stop()
+	r.running.Store(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := pprof.Generate(c.pdata, c.takeTraceEvents(),
+		support.TraceOriginSampling, r.cfg.SamplesPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, ErrNoSamples
+	}
+	var buf bytes.Buffer
+	if err = profile.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReportTraceEvent forwards the trace event and captures it if it is on-CPU and
+// belongs to a captured process.
+func (r *CaptureReporter) ReportTraceEvent(trace *libpf.Trace,
+	meta *samples.TraceEventMeta) error {
+	if c := r.running.Load(); c != nil && meta.Origin == support.TraceOriginSampling {
+		if _, ok := c.pids[meta.PID]; ok || len(c.pids) == 0 {
+			_ = c.ReportTraceEvent(trace, meta)
+		}
+	}
+	return r.Reporter.ReportTraceEvent(trace, meta)
+}
+
+// ExecutableKnown returns whether the executable is known to the reporter and to the
+// running capture, so that the capture receives the metadata of all executables.
+func (r *CaptureReporter) ExecutableKnown(fileID libpf.FileID) bool {
+	if c := r.running.Load(); c != nil && !c.ExecutableKnown(fileID) {
+		return false
+	}
+	return r.Reporter.ExecutableKnown(fileID)
+}
+
+// ExecutableMetadata forwards the metadata to the reporter and to the running capture.
+func (r *CaptureReporter) ExecutableMetadata(args *ExecutableMetadataArgs) {
+	if c := r.running.Load(); c != nil {
+		c.ExecutableMetadata(args)
+	}
+	r.Reporter.ExecutableMetadata(args)
+}
+
+// FrameKnown returns whether the frame is known to the reporter and to the running
+// capture, so that the capture receives the metadata of all frames.
+func (r *CaptureReporter) FrameKnown(frameID libpf.FrameID) bool {
+	if c := r.running.Load(); c != nil && !c.FrameKnown(frameID) {
+		return false
+	}
+	return r.Reporter.FrameKnown(frameID)
+}
+
+// FrameMetadata forwards the metadata to the reporter and to the running capture.
+func (r *CaptureReporter) FrameMetadata(args *FrameMetadataArgs) {
+	if c := r.running.Load(); c != nil {
+		c.FrameMetadata(args)
+	}
+	r.Reporter.FrameMetadata(args)
+}
+
+// SetReportInterval forwards the report interval if the reporter supports it.
+func (r *CaptureReporter) SetReportInterval(interval time.Duration) {
+	if rep, ok := r.Reporter.(IntervalReporter); ok {
+		rep.SetReportInterval(interval)
+	}
+}
+
+// Reconnect forwards the reconnect if the reporter connects to a backend.
+func (r *CaptureReporter) Reconnect(ctx context.Context, cfg *Config) error {
+	if rep, ok := r.Reporter.(ReconnectReporter); ok {
+		return rep.Reconnect(ctx, cfg)
+	}
+	return errReconnectUnsupported
+}
+
+// ReportAllocationFree forwards the free if the reporter tracks allocations.
+func (r *CaptureReporter) ReportAllocationFree(pid libpf.PID, addr uint64,
+	timestamp libpf.UnixTime64) {
+	if rep, ok := r.Reporter.(AllocationReporter); ok {
+		rep.ReportAllocationFree(pid, addr, timestamp)
+	}
+}
+
+// ReportAllocationsFreed forwards the process exit if the reporter tracks allocations.
+func (r *CaptureReporter) ReportAllocationsFreed(pid libpf.PID) {
+	if rep, ok := r.Reporter.(AllocationReporter); ok {
+		rep.ReportAllocationsFreed(pid)
+	}
+}
+
+// ReportAllocationsTracked forwards the tracked allocations if the reporter tracks
+// allocations.
+func (r *CaptureReporter) ReportAllocationsTracked(tracked libpf.Set[support.AllocKey],
+	timestamp libpf.UnixTime64) {
+	if rep, ok := r.Reporter.(AllocationReporter); ok {
+		rep.ReportAllocationsTracked(tracked, timestamp)
+	}
+}
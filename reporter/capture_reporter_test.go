@@ -0,0 +1,77 @@
+package reporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func TestCaptureReporter(t *testing.T) {
+	fake := &fakeReporter{known: true}
+	r := NewCapture(&Config{
+		ExecutablesCacheElements: 16,
+		FramesCacheElements:      16,
+		SamplesPerSecond:         20,
+	}, fake)
+
+	trace := &libpf.Trace{
+		Files:              []libpf.FileID{libpf.NewFileID(1, 1)},
+		Linenos:            []libpf.AddressOrLineno{0x42},
+		FrameTypes:         []libpf.FrameType{libpf.NativeFrame},
+		MappingStart:       []libpf.Address{0},
+		MappingEnd:         []libpf.Address{0x1000},
+		MappingFileOffsets: []uint64{0},
+		Hash:               libpf.NewTraceHash(1, 2),
+	}
+	report := func(pid libpf.PID) {
+		require.NoError(t, r.ReportTraceEvent(trace, &samples.TraceEventMeta{
+			Origin: support.TraceOriginSampling,
+			PID:    pid,
+		}))
+	}
+
+	assert.True(t, r.ExecutableKnown(libpf.NewFileID(1, 1)))
+	report(42)
+
+	type result struct {
+		profile []byte
+		err     error
+	}
+	done := make(chan result)
+	go func() {
+		profile, err := r.Capture(context.Background(),
+			libpf.Set[libpf.PID]{42: {}}, 100*time.Millisecond)
+		done <- result{profile, err}
+	}()
+	require.Eventually(t, func() bool { return r.running.Load() != nil },
+		time.Second, time.Millisecond)
+
+	_, err := r.Capture(context.Background(), nil, time.Millisecond)
+	require.ErrorIs(t, err, ErrCaptureRunning)
+
+	// The capture asks for the metadata that the reporter already knows.
+	assert.False(t, r.ExecutableKnown(libpf.NewFileID(1, 1)))
+	report(42)
+	report(43)
+
+	res := <-done
+	require.NoError(t, res.err)
+	assert.NotEmpty(t, res.profile)
+	traces, _, _ := fake.counts()
+	assert.Equal(t, 3, traces)
+
+	_, err = r.Capture(context.Background(), libpf.Set[libpf.PID]{43: {}}, time.Millisecond)
+	require.ErrorIs(t, err, ErrNoSamples)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Capture(ctx, nil, time.Minute)
+	require.ErrorIs(t, err, context.Canceled)
+}
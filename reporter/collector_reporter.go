@@ -38,6 +38,7 @@ func NewCollector(cfg *Config, nextConsumer xconsumer.Profiles) (*CollectorRepor
 
 	data, err := pdata.New(
 		cfg.SamplesPerSecond,
+		cfg.AllocSampleInterval,
 		cfg.ExecutablesCacheElements,
 		cfg.FramesCacheElements,
 		cfg.ExtraSampleAttrProd,
@@ -46,6 +47,11 @@ func NewCollector(cfg *Config, nextConsumer xconsumer.Profiles) (*CollectorRepor
 		return nil, err
 	}
 
+	allocs, err := newAllocTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	tree := make(samples.TraceEventsTree)
 
 	return &CollectorReporter{
@@ -55,6 +61,7 @@ func NewCollector(cfg *Config, nextConsumer xconsumer.Profiles) (*CollectorRepor
 			version:      cfg.Version,
 			pdata:        data,
 			traceEvents:  xsync.NewRWMutex(tree),
+			allocs:       allocs,
 			hostmetadata: hostmetadata,
 			runLoop: &runLoop{
 				stopSignal: make(chan libpf.Void),
@@ -90,11 +97,7 @@ func (r *CollectorReporter) Start(ctx context.Context) error {
 
 // reportProfile creates and sends out a profile.
 func (r *CollectorReporter) reportProfile(ctx context.Context) error {
-	traceEventsPtr := r.traceEvents.WLock()
-	reportedEvents := (*traceEventsPtr)
-	newEvents := make(samples.TraceEventsTree)
-	*traceEventsPtr = newEvents
-	r.traceEvents.WUnlock(&traceEventsPtr)
+	reportedEvents := r.takeTraceEvents()
 
 	profiles, err := r.pdata.Generate(reportedEvents, r.name, r.version)
 	if err != nil {
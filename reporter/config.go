@@ -4,6 +4,7 @@
 package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
 
 import (
+	"io"
 	"time"
 
 	"google.golang.org/grpc"
@@ -32,8 +33,15 @@ type Config struct {
 	FramesCacheElements uint32
 	// samplesPerSecond defines the number of samples per second.
 	SamplesPerSecond int
+	// AllocSampleInterval is the average number of allocated bytes between two
+	// sampled allocations.
+	AllocSampleInterval uint32
+	// AllocInUse enables reporting the sampled allocations that are still in use.
+	AllocInUse bool
 
 	// Number of connection attempts to the collector after which we give up retrying.
+	// With OTLP/HTTP, it is the maximum number of retries of a failed export, which
+	// only start within ReportInterval, or GRPCOperationTimeout if it is longer.
 	MaxGRPCRetries uint32
 
 	GRPCOperationTimeout   time.Duration
@@ -51,4 +59,47 @@ type Config struct {
 	// GRPCDialOptions allows passing additional gRPC dial options when establishing
 	// the connection to the collector. These options are appended after the default options.
 	GRPCDialOptions []grpc.DialOption
+
+	// OTLPProtocol selects the transport and encoding used by OTLPReporter.
+	// Defaults to OTLPProtocolGRPC if empty. For the OTLP/HTTP protocols the
+	// gRPC timeouts, backoff time and retries apply to each HTTP request.
+	OTLPProtocol OTLPProtocol
+	// HTTPHeaders are added to each OTLP/HTTP request.
+	HTTPHeaders map[string]string
+	// DisableHTTPCompression disables gzip compression of OTLP/HTTP requests.
+	DisableHTTPCompression bool
+
+	// SpoolDir is the directory where OTLPReporter stores reports until they
+	// are sent. Reports are kept across restarts. An empty value disables spooling.
+	SpoolDir string
+	// SpoolMaxSize limits the total size in bytes of the spooled reports.
+	// 0 disables the limit.
+	SpoolMaxSize int64
+	// SpoolMaxAge limits the age of the spooled reports. 0 disables the limit.
+	SpoolMaxAge time.Duration
+
+	// FoldedOutput is where FoldedReporter writes the folded stacks to.
+	FoldedOutput io.Writer
+	// FoldedGroupBy is a comma separated list of fields that FoldedReporter
+	// adds as root frames to each stack. Valid fields are origin, container,
+	// pid and comm.
+	FoldedGroupBy string
+
+	// PprofOutputDir is the directory where PprofReporter writes profiles.
+	PprofOutputDir string
+	// PprofOutputFile is the file that PprofReporter writes all trace events to when
+	// it is stopped, instead of writing them to PprofOutputDir periodically.
+	PprofOutputFile string
+	// PprofMaxFiles limits the number of profile files PprofReporter keeps.
+	// 0 disables the limit.
+	PprofMaxFiles int
+	// PprofMaxTotalSize limits the total size in bytes of the profile files
+	// PprofReporter keeps. The newest file is kept even if it exceeds the limit.
+	// 0 disables the limit.
+	PprofMaxTotalSize int64
+
+	// Demangle selects how mangled C++ and Rust function names are reported.
+	// Defaults to DemangleFull if empty. The mangled name is kept as the
+	// system name of the function.
+	Demangle DemangleMode
 }
@@ -0,0 +1,49 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"github.com/ianlancetaylor/demangle"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+// DemangleMode defines how mangled C++ and Rust function names are reported.
+type DemangleMode string
+
+const (
+	// DemangleNone reports function names as they are.
+	DemangleNone DemangleMode = "none"
+	// DemangleSimple reports demangled function names without parameters,
+	// return types and template arguments.
+	DemangleSimple DemangleMode = "simple"
+	// DemangleFull reports the complete demangled function names. This is the default.
+	DemangleFull DemangleMode = "full"
+)
+
+// demangleMaxLength limits the length of demangled names to 64 KiB, as names of deeply
+// nested templates can grow exponentially.
+var demangleMaxLength = demangle.MaxLength(16)
+
+// demangleFunctionName returns the demangled form of name according to mode.
+// If name is not demangled, an empty mangled name is returned.
+func demangleFunctionName(name libpf.String, mode DemangleMode) (
+	demangled, mangled libpf.String) {
+	if mode == DemangleNone {
+		return name, libpf.NullString
+	}
+	s := name.String()
+	if len(s) < 2 || s[0] != '_' || (s[1] != 'Z' && s[1] != 'R') {
+		return name, libpf.NullString
+	}
+	options := []demangle.Option{demangleMaxLength}
+	if mode == DemangleSimple {
+		options = append(options, demangle.NoParams, demangle.NoTemplateParams)
+	}
+	d, err := demangle.ToString(s, options...)
+	if err != nil {
+		return name, libpf.NullString
+	}
+	return libpf.Intern(d), name
+}
@@ -0,0 +1,71 @@
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+func TestDemangleFunctionName(t *testing.T) {
+	for name, tc := range map[string]struct {
+		name          string
+		mode          DemangleMode
+		wantDemangled string
+		wantMangled   string
+	}{
+		"default": {
+			name:          "_ZN3foo3barEi",
+			wantDemangled: "foo::bar(int)",
+			wantMangled:   "_ZN3foo3barEi",
+		},
+		"full": {
+			name:          "_ZN3foo3barEi",
+			mode:          DemangleFull,
+			wantDemangled: "foo::bar(int)",
+			wantMangled:   "_ZN3foo3barEi",
+		},
+		"simple": {
+			name:          "_ZN3foo3barEi",
+			mode:          DemangleSimple,
+			wantDemangled: "foo::bar",
+			wantMangled:   "_ZN3foo3barEi",
+		},
+		"none": {
+			name:          "_ZN3foo3barEi",
+			mode:          DemangleNone,
+			wantDemangled: "_ZN3foo3barEi",
+		},
+		"simple template": {
+			name:          "_ZNSt6vectorIiSaIiEE9push_backERKi",
+			mode:          DemangleSimple,
+			wantDemangled: "std::vector::push_back",
+			wantMangled:   "_ZNSt6vectorIiSaIiEE9push_backERKi",
+		},
+		"rust legacy": {
+			name:          "_ZN3lib6caller17he1bbdc496b6f167fE",
+			wantDemangled: "lib::caller",
+			wantMangled:   "_ZN3lib6caller17he1bbdc496b6f167fE",
+		},
+		"rust": {
+			name:          "_RNvCsd31AUCFlsec_3lib6caller",
+			wantDemangled: "lib::caller",
+			wantMangled:   "_RNvCsd31AUCFlsec_3lib6caller",
+		},
+		"not mangled": {
+			name:          "main",
+			wantDemangled: "main",
+		},
+		"invalid": {
+			name:          "_Z3foo3",
+			wantDemangled: "_Z3foo3",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			demangled, mangled := demangleFunctionName(libpf.Intern(tc.name), tc.mode)
+			assert.Equal(t, tc.wantDemangled, demangled.String())
+			assert.Equal(t, tc.wantMangled, mangled.String())
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	lru "github.com/elastic/go-freelru"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/xsync"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/folded"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+)
+
+// Assert that we implement the full Reporter interface.
+var _ Reporter = (*FoldedReporter)(nil)
+
+// FoldedReporter writes the collected stacks in the folded format, also known
+// as collapsed stacks, that is used to generate flame graphs. Each report interval
+// appends the stacks of that interval to the output.
+type FoldedReporter struct {
+	*baseReporter
+
+	// groupBy selects the fields that are added as root frames.
+	groupBy folded.GroupBy
+
+	// mu serializes writes to out.
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewFolded returns a new instance of FoldedReporter.
+func NewFolded(cfg *Config) (*FoldedReporter, error) {
+	if cfg.FoldedOutput == nil {
+		return nil, errors.New("no output for folded stacks configured")
+	}
+	groupBy, err := folded.ParseGroupBy(cfg.FoldedGroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Next step: Dynamically configure the size of this LRU.
+	// Currently, we use the length of the JSON array in
+	// hostmetadata/hostmetadata.json.
+	hostmetadata, err := lru.NewSynced[string, string](115, hashString)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := pdata.New(
+		cfg.SamplesPerSecond,
+		cfg.AllocSampleInterval,
+		cfg.ExecutablesCacheElements,
+		cfg.FramesCacheElements,
+		cfg.ExtraSampleAttrProd,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, err := newAllocTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(samples.TraceEventsTree)
+
+	return &FoldedReporter{
+		baseReporter: &baseReporter{
+			cfg:          cfg,
+			name:         cfg.Name,
+			version:      cfg.Version,
+			pdata:        data,
+			traceEvents:  xsync.NewRWMutex(tree),
+			allocs:       allocs,
+			hostmetadata: hostmetadata,
+			runLoop: &runLoop{
+				stopSignal: make(chan libpf.Void),
+			},
+		},
+		groupBy: groupBy,
+		out:     cfg.FoldedOutput,
+	}, nil
+}
+
+// Start starts writing folded stacks periodically.
+func (r *FoldedReporter) Start(ctx context.Context) error {
+	r.runLoop.Start(ctx, r.cfg.ReportInterval, func() {
+		if err := r.reportStacks(); err != nil {
+			log.Errorf("Writing folded stacks failed: %v", err)
+		}
+	}, func() {
+		// Allow the GC to purge expired entries to avoid memory leaks.
+		r.pdata.Purge()
+	})
+
+	return nil
+}
+
+// Stop stops the periodic writing and flushes all pending trace events.
+func (r *FoldedReporter) Stop() {
+	r.runLoop.Stop()
+	if err := r.reportStacks(); err != nil {
+		log.Errorf("Writing folded stacks failed: %v", err)
+	}
+}
+
+// reportStacks writes the trace events collected since the last call.
+func (r *FoldedReporter) reportStacks() error {
+	reportedEvents := r.takeTraceEvents()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return folded.Write(r.out, r.pdata, reportedEvents, r.groupBy)
+}
@@ -0,0 +1,50 @@
+package reporter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func TestFoldedReporter(t *testing.T) {
+	var out bytes.Buffer
+	r, err := NewFolded(&Config{
+		ExecutablesCacheElements: 1,
+		FramesCacheElements:      1,
+		SamplesPerSecond:         20,
+		FoldedOutput:             &out,
+		FoldedGroupBy:            "comm,origin",
+	})
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(1, 1)
+	r.ExecutableMetadata(&ExecutableMetadataArgs{FileID: fileID, FileName: "app"})
+	trace := &libpf.Trace{
+		Files:              []libpf.FileID{fileID, fileID},
+		Linenos:            []libpf.AddressOrLineno{0x42, 0x10},
+		FrameTypes:         []libpf.FrameType{libpf.NativeFrame, libpf.NativeFrame},
+		MappingStart:       []libpf.Address{0, 0},
+		MappingEnd:         []libpf.Address{0x1000, 0x1000},
+		MappingFileOffsets: []uint64{0, 0},
+		Hash:               libpf.NewTraceHash(1, 2),
+	}
+	for range 2 {
+		require.NoError(t, r.ReportTraceEvent(trace, &samples.TraceEventMeta{
+			Origin: support.TraceOriginSampling,
+			Comm:   "main",
+		}))
+	}
+
+	require.NoError(t, r.reportStacks())
+	assert.Equal(t, "cpu;main;app+0x10;app+0x42 2\n", out.String())
+
+	// Stacks are only written once.
+	require.NoError(t, r.reportStacks())
+	assert.Equal(t, "cpu;main;app+0x10;app+0x42 2\n", out.String())
+}
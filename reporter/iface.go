@@ -5,11 +5,13 @@ package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/process"
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
 )
 
 // Reporter is the top-level interface implemented by a full reporter.
@@ -36,6 +38,43 @@ type TraceReporter interface {
 	ReportTraceEvent(trace *libpf.Trace, meta *samples.TraceEventMeta) error
 }
 
+// AllocationReporter is implemented by reporters that report the sampled allocations
+// that are still in use.
+type AllocationReporter interface {
+	// ReportAllocationFree reports that the sampled allocation at addr of the process
+	// pid was freed at timestamp.
+	ReportAllocationFree(pid libpf.PID, addr uint64, timestamp libpf.UnixTime64)
+
+	// ReportAllocationsFreed reports that all allocations of the process pid were
+	// freed because the process exited.
+	ReportAllocationsFreed(pid libpf.PID)
+
+	// ReportAllocationsTracked reports the allocations that the eBPF programs tracked
+	// at timestamp. Allocations sampled before timestamp that are not in tracked were
+	// evicted by the eBPF programs, so their frees are never reported.
+	ReportAllocationsTracked(tracked libpf.Set[support.AllocKey], timestamp libpf.UnixTime64)
+}
+
+// IntervalReporter is implemented by reporters whose report interval can change
+// while they are running.
+type IntervalReporter interface {
+	// SetReportInterval changes the interval between two reports, starting after
+	// the next report.
+	SetReportInterval(interval time.Duration)
+}
+
+// ReconnectReporter is implemented by reporters that can switch to another backend
+// while they are running.
+type ReconnectReporter interface {
+	// Reconnect connects to the backend that cfg describes and replaces the current
+	// connection with it. On error, the current connection is kept.
+	Reconnect(ctx context.Context, cfg *Config) error
+}
+
+// errReconnectUnsupported is returned by Reconnect of reporters that forward the call
+// if none of their reporters supports it.
+var errReconnectUnsupported = errors.New("the reporter does not connect to a backend")
+
 // ExecutableOpener is a function that attempts to open an executable.
 type ExecutableOpener = func() (process.ReadAtCloser, error)
 
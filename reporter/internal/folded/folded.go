@@ -0,0 +1,204 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package folded implements a writer for the folded stack format, also known as
+// collapsed stacks, as consumed by flamegraph.pl and compatible tools.
+// Each line holds the frames of a stack from root to leaf, separated by
+// semicolons, followed by a space and the value of the stack.
+package folded // import "go.opentelemetry.io/ebpf-profiler/reporter/internal/folded"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// GroupBy is a bit set of the fields that stacks are grouped by. Each field
+// is rendered as an additional root frame.
+type GroupBy uint8
+
+const (
+	// GroupByOrigin groups stacks by trace origin (cpu, offcpu).
+	GroupByOrigin GroupBy = 1 << iota
+	// GroupByContainerID groups stacks by container ID.
+	GroupByContainerID
+	// GroupByPID groups stacks by process ID.
+	GroupByPID
+	// GroupByComm groups stacks by thread name.
+	GroupByComm
+)
+
+// groupByNames maps the names of the fields to group by to their flag.
+var groupByNames = map[string]GroupBy{
+	"origin":    GroupByOrigin,
+	"container": GroupByContainerID,
+	"pid":       GroupByPID,
+	"comm":      GroupByComm,
+}
+
+// ParseGroupBy parses a comma separated list of field names to group by.
+// Valid names are origin, container, pid and comm. Independent of their order
+// in s, the root frames are always ordered as listed here.
+func ParseGroupBy(s string) (GroupBy, error) {
+	var groupBy GroupBy
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		flag, ok := groupByNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown field to group folded stacks by: %s", name)
+		}
+		groupBy |= flag
+	}
+	return groupBy, nil
+}
+
+// originNames maps the supported trace origins to their root frame name.
+// Perf event origins are named after their event.
+var originNames = map[libpf.Origin]string{
+	support.TraceOriginSampling:   "cpu",
+	support.TraceOriginOffCPU:     "offcpu",
+	support.TraceOriginUprobe:     "uprobe",
+	support.TraceOriginAlloc:      "alloc",
+	support.TraceOriginAllocInUse: "inuse",
+	support.TraceOriginContention: "contention",
+	support.TraceOriginRunQueue:   "runqueue",
+	support.TraceOriginWakeup:     "wakeup",
+}
+
+// originFrameName returns the root frame name of origin.
+func originFrameName(origin libpf.Origin) (string, bool) {
+	if name, ok := originNames[origin]; ok {
+		return name, true
+	}
+	return tracertypes.PerfEventName(origin)
+}
+
+// Write writes all events in tree as folded stacks to w. On-CPU stacks are
+// valued by the number of samples at the configured sampling frequency, which
+// weights samples of adaptive sampling by their effective period, off-CPU stacks
+// by the off-CPU time in nanoseconds, perf event stacks by the number of events,
+// uprobe stacks by the number of calls, allocation stacks by the allocated bytes,
+// lock contention stacks by the time waited for locks in nanoseconds, run queue
+// stacks by the time waited for a CPU in nanoseconds and wakeup stacks by the
+// off-CPU time of the woken up tasks in nanoseconds. As the values of the origins have different
+// units, the stacks of all origins other than on-CPU sampling get the origin as
+// root frame even without GroupByOrigin. Frame and executable metadata is looked
+// up in the caches of data. Lines are sorted to produce stable output.
+func Write(w io.Writer, data *pdata.Pdata, tree samples.TraceEventsTree,
+	groupBy GroupBy) error {
+	values := make(map[string]int64)
+	var frames []string
+	for containerID, originToEvents := range tree {
+		for origin, events := range originToEvents {
+			originName, ok := originFrameName(origin)
+			if !ok {
+				continue
+			}
+			for traceKey, traceInfo := range events {
+				frames = frames[:0]
+				if groupBy&GroupByOrigin != 0 || origin != support.TraceOriginSampling {
+					frames = append(frames, originName)
+				}
+				if groupBy&GroupByContainerID != 0 && containerID != "" {
+					frames = append(frames, sanitize(string(containerID)))
+				}
+				if groupBy&GroupByPID != 0 {
+					frames = append(frames, strconv.FormatInt(traceKey.Pid, 10))
+				}
+				if groupBy&GroupByComm != 0 && traceKey.Comm != "" {
+					frames = append(frames, sanitize(traceKey.Comm))
+				}
+				// Frames of the trace are ordered from leaf to root.
+				for i := len(traceInfo.FrameTypes) - 1; i >= 0; i-- {
+					frames = append(frames, frameName(data, traceInfo, i))
+				}
+
+				var value int64
+				switch origin {
+				case support.TraceOriginSampling:
+					value = data.SampleWeight(int64(len(traceInfo.Timestamps)),
+						traceKey.SamplePeriod)
+				case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+					for _, size := range traceInfo.OffTimes {
+						_, bytes := data.AllocWeights(size)
+						value += bytes
+					}
+				default:
+					for _, offTime := range traceInfo.OffTimes {
+						value += offTime
+					}
+				}
+				values[strings.Join(frames, ";")] += value
+			}
+		}
+	}
+
+	stacks := make([]string, 0, len(values))
+	for stack := range values {
+		stacks = append(stacks, stack)
+	}
+	slices.Sort(stacks)
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", stack, values[stack]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// frameName returns the rendered name of frame i of traceInfo.
+func frameName(data *pdata.Pdata, traceInfo *samples.TraceEvents, i int) string {
+	fileID := traceInfo.Files[i]
+	addrOrLine := traceInfo.Linenos[i]
+	frameType := traceInfo.FrameTypes[i]
+
+	if frameType == libpf.AbortFrame {
+		return "[" + frameType.String() + "]"
+	}
+
+	si, symbolized := data.Frames.GetAndRefresh(libpf.NewFrameID(fileID, addrOrLine),
+		pdata.FramesCacheLifetime)
+	if symbolized && si.FunctionName.String() != "" {
+		name := sanitize(si.FunctionName.String())
+		if si.LineNumber != 0 {
+			name += ":" + strconv.FormatUint(uint64(si.LineNumber), 10)
+		}
+		return name
+	}
+
+	if frameType == libpf.NativeFrame {
+		fileName := fileID.StringNoQuotes()
+		if ei, exists := data.Executables.GetAndRefresh(fileID,
+			pdata.ExecutableCacheLifetime); exists && ei.FileName != "" {
+			fileName = filepath.Base(ei.FileName)
+		}
+		return fmt.Sprintf("%s+0x%x", sanitize(fileName), uint64(addrOrLine.StripInlineDepth()))
+	}
+	return "UNRESOLVED[" + frameType.String() + "]"
+}
+
+// sanitize replaces characters that have a special meaning in the folded format.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ';', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package folded
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	groupBy, err := ParseGroupBy("pid, comm,,origin")
+	require.NoError(t, err)
+	assert.Equal(t, GroupByPID|GroupByComm|GroupByOrigin, groupBy)
+
+	groupBy, err = ParseGroupBy("")
+	require.NoError(t, err)
+	assert.Zero(t, groupBy)
+
+	_, err = ParseGroupBy("pid,tid")
+	require.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	data, err := pdata.New(20, 0, 16, 16, nil)
+	require.NoError(t, err)
+	nativeFile := libpf.NewFileID(1, 2)
+	pythonFile := libpf.NewFileID(3, 4)
+	data.Executables.Add(nativeFile, samples.ExecInfo{FileName: "/usr/lib/libc.so.6"})
+	data.Frames.Add(libpf.NewFrameID(pythonFile, 17), samples.SourceInfo{
+		FunctionName: libpf.Intern("handler"),
+		FilePath:     libpf.Intern("app.py"),
+		LineNumber:   12,
+	})
+
+	events := func(pid int64, timestamps int) samples.KeyToEventMapping {
+		return samples.KeyToEventMapping{
+			{Hash: libpf.NewTraceHash(uint64(pid), 1), Comm: "my;worker", Pid: pid}: {
+				Files:   []libpf.FileID{nativeFile, pythonFile, pythonFile},
+				Linenos: []libpf.AddressOrLineno{0x1234, 17, 99},
+				FrameTypes: []libpf.FrameType{
+					libpf.NativeFrame, libpf.PythonFrame, libpf.PythonFrame,
+				},
+				Timestamps: make([]uint64, timestamps),
+				OffTimes:   make([]int64, timestamps),
+			},
+		}
+	}
+	offCPU := events(42, 2)
+	for _, traceInfo := range offCPU {
+		traceInfo.OffTimes = []int64{100, 200}
+	}
+	pageFaults := events(43, 1)
+	for _, traceInfo := range pageFaults {
+		traceInfo.OffTimes = []int64{1000}
+	}
+	// With adaptive sampling at 10 Hz, each sample stands for two samples at 20 Hz.
+	adaptive := events(44, 2)
+	for traceKey, traceInfo := range adaptive {
+		delete(adaptive, traceKey)
+		traceKey.SamplePeriod = int64(100 * time.Millisecond)
+		adaptive[traceKey] = traceInfo
+	}
+	tree := samples.TraceEventsTree{
+		"abc": {
+			support.TraceOriginSampling: events(42, 3),
+			support.TraceOriginOffCPU:   offCPU,
+		},
+		"def": {
+			support.TraceOriginSampling: adaptive,
+		},
+		"": {
+			support.TraceOriginSampling:   events(43, 1),
+			support.TraceOriginPageFaults: pageFaults,
+		},
+	}
+
+	tests := map[string]struct {
+		groupBy GroupBy
+		want    string
+	}{
+		"no grouping": {
+			want: "UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 8\n" +
+				"offcpu;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 300\n" +
+				"page-faults;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 1000\n",
+		},
+		"all": {
+			groupBy: GroupByOrigin | GroupByContainerID | GroupByPID | GroupByComm,
+			want: "cpu;43;my_worker;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 1\n" +
+				"cpu;abc;42;my_worker;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 3\n" +
+				"cpu;def;44;my_worker;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 4\n" +
+				"offcpu;abc;42;my_worker;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 300\n" +
+				"page-faults;43;my_worker;UNRESOLVED[cpython];handler:12;libc.so.6+0x1234 " +
+				"1000\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Write(&buf, data, tree, tc.groupBy))
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
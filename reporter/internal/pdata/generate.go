@@ -19,6 +19,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
 	"go.opentelemetry.io/ebpf-profiler/support"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
 )
 
 const (
@@ -30,6 +31,30 @@ const (
 // DummyFileID is used as the FileID for a dummy mapping
 var dummyFileID = libpf.NewFileID(0, 0)
 
+// valueType selects the value of the samples of a profile.
+type valueType int
+
+const (
+	// valueDefault is the value of the origins that are reported as a single profile.
+	valueDefault valueType = iota
+	// valueObjects is the number of allocations of allocation profiles.
+	valueObjects
+	// valueSpace is the number of allocated bytes of allocation profiles.
+	valueSpace
+)
+
+// valueTypes returns the value types of the profiles that are generated for origin.
+// Allocation traces are reported as separate profiles for the number of allocations
+// and the allocated bytes.
+func valueTypes(origin libpf.Origin) []valueType {
+	switch origin {
+	case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+		return []valueType{valueObjects, valueSpace}
+	default:
+		return []valueType{valueDefault}
+	}
+}
+
 // Generate generates a pdata request out of internal profiles data, to be
 // exported.
 func (p *Pdata) Generate(tree samples.TraceEventsTree,
@@ -66,17 +91,29 @@ func (p *Pdata) Generate(tree samples.TraceEventsTree,
 		for _, origin := range []libpf.Origin{
 			support.TraceOriginSampling,
 			support.TraceOriginOffCPU,
+			support.TraceOriginPageFaults,
+			support.TraceOriginContextSwitches,
+			support.TraceOriginCacheMisses,
+			support.TraceOriginBranchMisses,
+			support.TraceOriginUprobe,
+			support.TraceOriginAlloc,
+			support.TraceOriginAllocInUse,
+			support.TraceOriginContention,
+			support.TraceOriginRunQueue,
+			support.TraceOriginWakeup,
 		} {
 			if len(originToEvents[origin]) == 0 {
 				// Do not append empty profiles.
 				continue
 			}
 
-			prof := sp.Profiles().AppendEmpty()
-			if err := p.setProfile(dic,
-				stringSet, funcSet, mappingSet, locationSet,
-				origin, originToEvents[origin], prof); err != nil {
-				return profiles, err
+			for _, value := range valueTypes(origin) {
+				prof := sp.Profiles().AppendEmpty()
+				if err := p.setProfile(dic,
+					stringSet, funcSet, mappingSet, locationSet,
+					origin, value, originToEvents[origin], prof); err != nil {
+					return profiles, err
+				}
 			}
 		}
 	}
@@ -90,6 +127,7 @@ func (p *Pdata) Generate(tree samples.TraceEventsTree,
 	for v, idx := range funcSet {
 		f := funcTable.At(int(idx))
 		f.SetNameStrindex(v.nameIdx)
+		f.SetSystemNameStrindex(v.systemNameIdx)
 		f.SetFilenameStrindex(v.fileNameIdx)
 	}
 
@@ -111,6 +149,7 @@ func (p *Pdata) setProfile(
 	mappingSet OrderedSet[libpf.FileID],
 	locationSet OrderedSet[locationInfo],
 	origin libpf.Origin,
+	value valueType,
 	events map[samples.TraceAndMetaKey]*samples.TraceEvents,
 	profile pprofile.Profile,
 ) error {
@@ -127,9 +166,38 @@ func (p *Pdata) setProfile(
 	case support.TraceOriginOffCPU:
 		st.SetTypeStrindex(stringSet.Add("events"))
 		st.SetUnitStrindex(stringSet.Add("nanoseconds"))
+	case support.TraceOriginUprobe:
+		st.SetTypeStrindex(stringSet.Add("calls"))
+		st.SetUnitStrindex(stringSet.Add("count"))
+	case support.TraceOriginContention:
+		st.SetTypeStrindex(stringSet.Add("delay"))
+		st.SetUnitStrindex(stringSet.Add("nanoseconds"))
+	case support.TraceOriginRunQueue:
+		st.SetTypeStrindex(stringSet.Add("sched_delay"))
+		st.SetUnitStrindex(stringSet.Add("nanoseconds"))
+	case support.TraceOriginWakeup:
+		st.SetTypeStrindex(stringSet.Add("wakee_off_cpu"))
+		st.SetUnitStrindex(stringSet.Add("nanoseconds"))
+	case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+		prefix := "alloc"
+		if origin == support.TraceOriginAllocInUse {
+			prefix = "inuse"
+		}
+		if value == valueObjects {
+			st.SetTypeStrindex(stringSet.Add(prefix + "_objects"))
+			st.SetUnitStrindex(stringSet.Add("count"))
+		} else {
+			st.SetTypeStrindex(stringSet.Add(prefix + "_space"))
+			st.SetUnitStrindex(stringSet.Add("bytes"))
+		}
 	default:
-		// Should never happen
-		return fmt.Errorf("generating profile for unsupported origin %d", origin)
+		name, ok := tracertypes.PerfEventName(origin)
+		if !ok {
+			// Should never happen
+			return fmt.Errorf("generating profile for unsupported origin %d", origin)
+		}
+		st.SetTypeStrindex(stringSet.Add(name))
+		st.SetUnitStrindex(stringSet.Add("count"))
 	}
 
 	attrMgr := samples.NewAttrTableManager(dic.AttributeTable())
@@ -149,7 +217,22 @@ func (p *Pdata) setProfile(
 		switch origin {
 		case support.TraceOriginSampling:
 			sample.Value().Append(1)
-		case support.TraceOriginOffCPU:
+		case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+			// Allocation traces store the size of the sampled allocation.
+			for _, size := range traceInfo.OffTimes {
+				objects, bytes := p.AllocWeights(size)
+				if value == valueObjects {
+					sample.Value().Append(objects)
+				} else {
+					sample.Value().Append(bytes)
+				}
+			}
+		default:
+			// Off-CPU traces are valued by the time off CPU, perf event traces
+			// by the sample period of the event, uprobe traces by the number
+			// of calls, lock contention traces by the time waited for the lock,
+			// run queue traces by the time waited for a CPU and wakeup traces by
+			// the time the woken up task was off CPU.
 			sample.Value().Append(traceInfo.OffTimes...)
 		}
 
@@ -161,6 +244,9 @@ func (p *Pdata) setProfile(
 			}
 			switch frameKind := traceInfo.FrameTypes[i]; frameKind {
 			case libpf.NativeFrame:
+				// Inlined frames share the address of the frame they are inlined into.
+				locInfo.address = uint64(traceInfo.Linenos[i].StripInlineDepth())
+
 				// As native frames are resolved in the backend, we use Mapping to
 				// report these frames.
 				locationMappingIndex, exists := mappingSet.AddWithCheck(traceInfo.Files[i])
@@ -191,6 +277,20 @@ func (p *Pdata) setProfile(
 						traceInfo.Files[i].StringNoQuotes())
 				}
 				locInfo.mappingIndex = locationMappingIndex
+
+				// Native frames symbolized by the agent also carry a function.
+				if si, exists := p.Frames.GetAndRefresh(
+					libpf.NewFrameID(traceInfo.Files[i], traceInfo.Linenos[i]),
+					FramesCacheLifetime); exists {
+					locInfo.hasLine = true
+					locInfo.lineNumber = int64(si.LineNumber)
+					fi := funcInfo{
+						nameIdx:       stringSet.Add(si.FunctionName.String()),
+						systemNameIdx: stringSet.Add(si.MangledName.String()),
+						fileNameIdx:   stringSet.Add(si.FilePath.String()),
+					}
+					locInfo.functionIndex = funcSet.Add(fi)
+				}
 			case libpf.AbortFrame:
 				// Next step: Figure out how the OTLP protocol
 				// could handle artificial frames, like AbortFrame,
@@ -204,8 +304,9 @@ func (p *Pdata) setProfile(
 					FramesCacheLifetime); exists {
 					locInfo.lineNumber = int64(si.LineNumber)
 					fi := funcInfo{
-						nameIdx:     stringSet.Add(si.FunctionName.String()),
-						fileNameIdx: stringSet.Add(si.FilePath.String()),
+						nameIdx:       stringSet.Add(si.FunctionName.String()),
+						systemNameIdx: stringSet.Add(si.MangledName.String()),
+						fileNameIdx:   stringSet.Add(si.FilePath.String()),
 					}
 					locInfo.functionIndex = funcSet.Add(fi)
 				} else {
@@ -261,6 +362,36 @@ func (p *Pdata) setProfile(
 		attrMgr.AppendInt(sample.AttributeIndices(),
 			semconv.ThreadIDKey, traceKey.Tid)
 
+		attrMgr.AppendOptionalString(sample.AttributeIndices(),
+			attribute.Key("thread.state"), traceKey.TaskState)
+		attrMgr.AppendOptionalString(sample.AttributeIndices(),
+			attribute.Key("thread.wait_channel"), traceKey.WaitChannel)
+		if traceKey.LockAddr != 0 {
+			attrMgr.AppendOptionalString(sample.AttributeIndices(),
+				attribute.Key("lock.address"), fmt.Sprintf("0x%x", traceKey.LockAddr))
+		}
+		if traceKey.WakerTid != 0 {
+			attrMgr.AppendInt(sample.AttributeIndices(),
+				attribute.Key("thread.waker.pid"), traceKey.WakerPid)
+			attrMgr.AppendInt(sample.AttributeIndices(),
+				attribute.Key("thread.waker.tid"), traceKey.WakerTid)
+		}
+		if !traceKey.WakerHash.IsZero() {
+			attrMgr.AppendOptionalString(sample.AttributeIndices(),
+				attribute.Key("thread.waker.stack_hash"), fmt.Sprintf("%x", traceKey.WakerHash))
+		}
+		if traceKey.SamplePeriod != 0 {
+			// With adaptive sampling, the period of the profile is the configured one,
+			// while samples are weighted by their effective period.
+			attrMgr.AppendInt(sample.AttributeIndices(),
+				attribute.Key("profile.sample.period"), traceKey.SamplePeriod)
+		}
+		if origin == support.TraceOriginWakeup {
+			// The hash links the trace of the waker to the off-cpu traces it woke up.
+			attrMgr.AppendOptionalString(sample.AttributeIndices(),
+				attribute.Key("thread.stack_hash"), fmt.Sprintf("%x", traceKey.Hash))
+		}
+
 		for key, value := range traceInfo.EnvVars {
 			attrMgr.AppendOptionalString(
 				sample.AttributeIndices(),
@@ -182,7 +182,7 @@ func TestFunctionTableOrder(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			d, err := New(100, 100, 100, nil)
+			d, err := New(100, 0, 100, 100, nil)
 			require.NoError(t, err)
 			for fileID, addrWithSourceInfos := range tt.frames {
 				for addr, si := range addrWithSourceInfos {
@@ -239,7 +239,7 @@ func TestProfileDuration(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			d, err := New(100, 100, 100, nil)
+			d, err := New(100, 0, 100, 100, nil)
 			require.NoError(t, err)
 
 			tree := make(samples.TraceEventsTree)
@@ -254,7 +254,7 @@ func TestProfileDuration(t *testing.T) {
 	}
 }
 func TestGenerate_EmptyTree(t *testing.T) {
-	d, err := New(100, 100, 100, nil)
+	d, err := New(100, 0, 100, 100, nil)
 	require.NoError(t, err)
 
 	tree := make(samples.TraceEventsTree)
@@ -264,7 +264,7 @@ func TestGenerate_EmptyTree(t *testing.T) {
 }
 
 func TestGenerate_SingleContainerSingleOrigin(t *testing.T) {
-	d, err := New(100, 100, 100, nil)
+	d, err := New(100, 0, 100, 100, nil)
 	require.NoError(t, err)
 
 	fileID := libpf.NewFileID(1, 2)
@@ -342,7 +342,7 @@ func TestGenerate_SingleContainerSingleOrigin(t *testing.T) {
 }
 
 func TestGenerate_MultipleOriginsAndContainers(t *testing.T) {
-	d, err := New(100, 100, 100, nil)
+	d, err := New(100, 0, 100, 100, nil)
 	require.NoError(t, err)
 
 	fileID := libpf.NewFileID(5, 6)
@@ -409,8 +409,297 @@ func TestGenerate_MultipleOriginsAndContainers(t *testing.T) {
 	assert.Equal(t, 1, containerProfileCounts["c2"])
 }
 
+func TestGenerate_EventCountOrigins(t *testing.T) {
+	tests := map[string]struct {
+		origin   libpf.Origin
+		wantType string
+	}{
+		"perf event": {origin: support.TraceOriginPageFaults, wantType: "page-faults"},
+		"uprobe":     {origin: support.TraceOriginUprobe, wantType: "calls"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := New(100, 0, 100, 100, nil)
+			require.NoError(t, err)
+
+			fileID := libpf.NewFileID(5, 6)
+			traceKey := samples.TraceAndMetaKey{ExecutablePath: "/bin/foo"}
+			tree := samples.TraceEventsTree{
+				"": {
+					tc.origin: {
+						traceKey: &samples.TraceEvents{
+							Files:      []libpf.FileID{fileID},
+							Linenos:    []libpf.AddressOrLineno{0x20},
+							FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+							Timestamps: []uint64{1, 2},
+							OffTimes:   []int64{1000, 1000},
+						},
+					},
+				},
+			}
+
+			profiles, err := d.Generate(tree, "agent", "v1")
+			require.NoError(t, err)
+			require.Equal(t, 1, profiles.ResourceProfiles().Len())
+			profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+			require.Equal(t, 1, profs.Len())
+
+			strs := profiles.ProfilesDictionary().StringTable()
+			st := profs.At(0).SampleType().At(0)
+			assert.Equal(t, tc.wantType, strs.At(int(st.TypeStrindex())))
+			assert.Equal(t, "count", strs.At(int(st.UnitStrindex())))
+			assert.Equal(t, []int64{1000, 1000}, profs.At(0).Sample().At(0).Value().AsRaw())
+		})
+	}
+}
+
+func TestGenerate_AllocOrigins(t *testing.T) {
+	tests := map[string]struct {
+		origin     libpf.Origin
+		wantPrefix string
+	}{
+		"alloc":  {origin: support.TraceOriginAlloc, wantPrefix: "alloc"},
+		"in use": {origin: support.TraceOriginAllocInUse, wantPrefix: "inuse"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := New(100, 1024, 100, 100, nil)
+			require.NoError(t, err)
+
+			traceKey := samples.TraceAndMetaKey{ExecutablePath: "/bin/foo"}
+			tree := samples.TraceEventsTree{
+				"": {
+					tc.origin: {
+						traceKey: &samples.TraceEvents{
+							Files:      []libpf.FileID{libpf.NewFileID(5, 6)},
+							Linenos:    []libpf.AddressOrLineno{0x20},
+							FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+							Timestamps: []uint64{1, 2},
+							OffTimes:   []int64{16, 4096},
+						},
+					},
+				},
+			}
+
+			profiles, err := d.Generate(tree, "agent", "v1")
+			require.NoError(t, err)
+			profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+			require.Equal(t, 2, profs.Len())
+
+			strs := profiles.ProfilesDictionary().StringTable()
+			st := profs.At(0).SampleType().At(0)
+			assert.Equal(t, tc.wantPrefix+"_objects", strs.At(int(st.TypeStrindex())))
+			assert.Equal(t, "count", strs.At(int(st.UnitStrindex())))
+			assert.Equal(t, []int64{64, 1}, profs.At(0).Sample().At(0).Value().AsRaw())
+
+			st = profs.At(1).SampleType().At(0)
+			assert.Equal(t, tc.wantPrefix+"_space", strs.At(int(st.TypeStrindex())))
+			assert.Equal(t, "bytes", strs.At(int(st.UnitStrindex())))
+			assert.Equal(t, []int64{1024, 4096}, profs.At(1).Sample().At(0).Value().AsRaw())
+		})
+	}
+}
+
+func TestGenerate_ContentionOrigin(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	traceKey := samples.TraceAndMetaKey{ExecutablePath: "/bin/foo", LockAddr: 0x7f00c0de}
+	tree := samples.TraceEventsTree{
+		"": {
+			support.TraceOriginContention: {
+				traceKey: &samples.TraceEvents{
+					Files:      []libpf.FileID{libpf.NewFileID(5, 6)},
+					Linenos:    []libpf.AddressOrLineno{0x20},
+					FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+					Timestamps: []uint64{1, 2},
+					OffTimes:   []int64{1500, 2500},
+				},
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+	profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+	require.Equal(t, 1, profs.Len())
+
+	strs := profiles.ProfilesDictionary().StringTable()
+	st := profs.At(0).SampleType().At(0)
+	assert.Equal(t, "delay", strs.At(int(st.TypeStrindex())))
+	assert.Equal(t, "nanoseconds", strs.At(int(st.UnitStrindex())))
+	sample := profs.At(0).Sample().At(0)
+	assert.Equal(t, []int64{1500, 2500}, sample.Value().AsRaw())
+
+	attrs := profiles.ProfilesDictionary().AttributeTable()
+	var lockAddr string
+	for _, idx := range sample.AttributeIndices().All() {
+		if attr := attrs.At(int(idx)); attr.Key() == "lock.address" {
+			lockAddr = attr.Value().Str()
+		}
+	}
+	assert.Equal(t, "0x7f00c0de", lockAddr)
+}
+
+func TestGenerate_RunQueueOrigin(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	traceKey := samples.TraceAndMetaKey{ExecutablePath: "/bin/foo", Pid: 42, Tid: 43}
+	tree := samples.TraceEventsTree{
+		"": {
+			support.TraceOriginRunQueue: {
+				traceKey: &samples.TraceEvents{
+					Files:      []libpf.FileID{libpf.NewFileID(5, 6)},
+					Linenos:    []libpf.AddressOrLineno{0x20},
+					FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+					Timestamps: []uint64{1, 2},
+					OffTimes:   []int64{30000, 70000},
+				},
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+	profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+	require.Equal(t, 1, profs.Len())
+
+	strs := profiles.ProfilesDictionary().StringTable()
+	st := profs.At(0).SampleType().At(0)
+	assert.Equal(t, "sched_delay", strs.At(int(st.TypeStrindex())))
+	assert.Equal(t, "nanoseconds", strs.At(int(st.UnitStrindex())))
+	require.Equal(t, 1, profs.At(0).Sample().Len())
+	sample := profs.At(0).Sample().At(0)
+	assert.Equal(t, []int64{30000, 70000}, sample.Value().AsRaw())
+	assert.Equal(t, []uint64{1, 2}, sample.TimestampsUnixNano().AsRaw())
+}
+
+func TestGenerate_OffCPUAttributes(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	diskKey := samples.TraceAndMetaKey{
+		ExecutablePath: "/bin/foo",
+		TaskState:      "uninterruptible",
+		WaitChannel:    "folio_wait_bit_common",
+	}
+	preemptedKey := samples.TraceAndMetaKey{
+		ExecutablePath: "/bin/foo",
+		TaskState:      "preempted",
+	}
+	events := func() *samples.TraceEvents {
+		return &samples.TraceEvents{
+			Files:      []libpf.FileID{libpf.NewFileID(5, 6)},
+			Linenos:    []libpf.AddressOrLineno{0x20},
+			FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+			Timestamps: []uint64{1},
+			OffTimes:   []int64{1000},
+		}
+	}
+	tree := samples.TraceEventsTree{
+		"": {
+			support.TraceOriginOffCPU: {
+				diskKey:      events(),
+				preemptedKey: events(),
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+	profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+	require.Equal(t, 1, profs.Len())
+	require.Equal(t, 2, profs.At(0).Sample().Len())
+
+	attrs := profiles.ProfilesDictionary().AttributeTable()
+	var got []map[string]string
+	for _, sample := range profs.At(0).Sample().All() {
+		sampleAttrs := make(map[string]string)
+		for _, idx := range sample.AttributeIndices().All() {
+			attr := attrs.At(int(idx))
+			if key := attr.Key(); key == "thread.state" || key == "thread.wait_channel" {
+				sampleAttrs[key] = attr.Value().Str()
+			}
+		}
+		got = append(got, sampleAttrs)
+	}
+	assert.ElementsMatch(t, []map[string]string{
+		{"thread.state": "uninterruptible", "thread.wait_channel": "folio_wait_bit_common"},
+		{"thread.state": "preempted"},
+	}, got)
+}
+
+func TestGenerate_WakeupLinks(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	wakerHash := libpf.NewTraceHash(0x1234, 0x5678)
+	offCPUKey := samples.TraceAndMetaKey{
+		Hash:      libpf.NewTraceHash(1, 2),
+		Pid:       10,
+		Tid:       11,
+		TaskState: "interruptible",
+		WakerPid:  20,
+		WakerTid:  21,
+		WakerHash: wakerHash,
+	}
+	wakeupKey := samples.TraceAndMetaKey{
+		Hash: wakerHash,
+		Pid:  20,
+		Tid:  21,
+	}
+	events := func() *samples.TraceEvents {
+		return &samples.TraceEvents{
+			Files:      []libpf.FileID{libpf.NewFileID(5, 6)},
+			Linenos:    []libpf.AddressOrLineno{0x20},
+			FrameTypes: []libpf.FrameType{libpf.PythonFrame},
+			Timestamps: []uint64{1},
+			OffTimes:   []int64{1000},
+		}
+	}
+	tree := samples.TraceEventsTree{
+		"": {
+			support.TraceOriginOffCPU: {offCPUKey: events()},
+			support.TraceOriginWakeup: {wakeupKey: events()},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+	dic := profiles.ProfilesDictionary()
+	profs := profiles.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+	require.Equal(t, 2, profs.Len())
+
+	attrs := dic.AttributeTable()
+	sampleAttrs := func(prof pprofile.Profile) map[string]any {
+		require.Equal(t, 1, prof.Sample().Len())
+		got := make(map[string]any)
+		for _, idx := range prof.Sample().At(0).AttributeIndices().All() {
+			attr := attrs.At(int(idx))
+			got[attr.Key()] = attr.Value().AsRaw()
+		}
+		return got
+	}
+
+	offCPUAttrs := sampleAttrs(profs.At(0))
+	assert.Equal(t, int64(20), offCPUAttrs["thread.waker.pid"])
+	assert.Equal(t, int64(21), offCPUAttrs["thread.waker.tid"])
+	assert.NotContains(t, offCPUAttrs, "thread.stack_hash")
+
+	wakeupProf := profs.At(1)
+	assert.Equal(t, "wakee_off_cpu",
+		dic.StringTable().At(int(wakeupProf.SampleType().At(0).TypeStrindex())))
+	wakeupAttrs := sampleAttrs(wakeupProf)
+	assert.NotContains(t, wakeupAttrs, "thread.waker.tid")
+	require.Contains(t, wakeupAttrs, "thread.stack_hash")
+	assert.Equal(t, wakeupAttrs["thread.stack_hash"], offCPUAttrs["thread.waker.stack_hash"])
+}
+
 func TestGenerate_StringAndFunctionTablePopulation(t *testing.T) {
-	d, err := New(100, 100, 100, nil)
+	d, err := New(100, 0, 100, 100, nil)
 	require.NoError(t, err)
 
 	fileID := libpf.NewFileID(7, 8)
@@ -459,7 +748,7 @@ func TestGenerate_StringAndFunctionTablePopulation(t *testing.T) {
 }
 
 func TestGenerate_NativeFrame(t *testing.T) {
-	d, err := New(100, 100, 100, nil)
+	d, err := New(100, 0, 100, 100, nil)
 	require.NoError(t, err)
 
 	fileID := libpf.NewFileID(9, 10)
@@ -551,3 +840,129 @@ func TestGenerate_NativeFrame(t *testing.T) {
 	assert.Equal(t, 0, dic.FunctionTable().Len(),
 		"Function table should be empty for native frames")
 }
+
+func TestGenerate_SymbolizedNativeFrame(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(11, 12)
+	d.Executables.Add(fileID, samples.ExecInfo{FileName: "/usr/bin/app"})
+	d.Frames.Add(libpf.NewFrameID(fileID, 0x1234), samples.SourceInfo{
+		FunctionName: libpf.Intern("main"),
+	})
+
+	tree := samples.TraceEventsTree{
+		"": map[libpf.Origin]samples.KeyToEventMapping{
+			support.TraceOriginSampling: {
+				samples.TraceAndMetaKey{Pid: 1}: &samples.TraceEvents{
+					Files:              []libpf.FileID{fileID},
+					Linenos:            []libpf.AddressOrLineno{0x1234},
+					FrameTypes:         []libpf.FrameType{libpf.NativeFrame},
+					MappingStarts:      []libpf.Address{0x1000},
+					MappingEnds:        []libpf.Address{0x2000},
+					MappingFileOffsets: []uint64{0},
+					Timestamps:         []uint64{1},
+				},
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+
+	dic := profiles.ProfilesDictionary()
+	require.Equal(t, 1, dic.LocationTable().Len())
+	loc := dic.LocationTable().At(0)
+	assert.Equal(t, uint64(0x1234), loc.Address())
+	assert.NotZero(t, loc.MappingIndex())
+	require.Equal(t, 1, loc.Line().Len())
+	fn := dic.FunctionTable().At(int(loc.Line().At(0).FunctionIndex()))
+	assert.Equal(t, "main", dic.StringTable().At(int(fn.NameStrindex())))
+	assert.Zero(t, fn.SystemNameStrindex())
+}
+
+func TestGenerate_DemangledNativeFrame(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(13, 14)
+	d.Frames.Add(libpf.NewFrameID(fileID, 0x1234), samples.SourceInfo{
+		FunctionName: libpf.Intern("foo()"),
+		MangledName:  libpf.Intern("_Z3foov"),
+	})
+
+	tree := samples.TraceEventsTree{
+		"": map[libpf.Origin]samples.KeyToEventMapping{
+			support.TraceOriginSampling: {
+				samples.TraceAndMetaKey{Pid: 1}: &samples.TraceEvents{
+					Files:              []libpf.FileID{fileID},
+					Linenos:            []libpf.AddressOrLineno{0x1234},
+					FrameTypes:         []libpf.FrameType{libpf.NativeFrame},
+					MappingStarts:      []libpf.Address{0x1000},
+					MappingEnds:        []libpf.Address{0x2000},
+					MappingFileOffsets: []uint64{0},
+					Timestamps:         []uint64{1},
+				},
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+
+	dic := profiles.ProfilesDictionary()
+	require.Equal(t, 1, dic.FunctionTable().Len())
+	fn := dic.FunctionTable().At(0)
+	assert.Equal(t, "foo()", dic.StringTable().At(int(fn.NameStrindex())))
+	assert.Equal(t, "_Z3foov", dic.StringTable().At(int(fn.SystemNameStrindex())))
+}
+
+func TestGenerate_InlinedNativeFrame(t *testing.T) {
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+
+	fileID := libpf.NewFileID(11, 12)
+	addr := libpf.AddressOrLineno(0x1234)
+	inlinedAddr := addr.WithInlineDepth(1)
+	d.Executables.Add(fileID, samples.ExecInfo{FileName: "/usr/bin/app"})
+	d.Frames.Add(libpf.NewFrameID(fileID, inlinedAddr), samples.SourceInfo{
+		FunctionName: libpf.Intern("inlined"),
+		FilePath:     libpf.Intern("app.c"),
+		LineNumber:   3,
+	})
+	d.Frames.Add(libpf.NewFrameID(fileID, addr), samples.SourceInfo{
+		FunctionName: libpf.Intern("main"),
+		FilePath:     libpf.Intern("app.c"),
+		LineNumber:   10,
+	})
+
+	tree := samples.TraceEventsTree{
+		"": map[libpf.Origin]samples.KeyToEventMapping{
+			support.TraceOriginSampling: {
+				samples.TraceAndMetaKey{Pid: 1}: &samples.TraceEvents{
+					Files:              []libpf.FileID{fileID, fileID},
+					Linenos:            []libpf.AddressOrLineno{inlinedAddr, addr},
+					FrameTypes:         []libpf.FrameType{libpf.NativeFrame, libpf.NativeFrame},
+					MappingStarts:      []libpf.Address{0x1000, 0x1000},
+					MappingEnds:        []libpf.Address{0x2000, 0x2000},
+					MappingFileOffsets: []uint64{0, 0},
+					Timestamps:         []uint64{1},
+				},
+			},
+		},
+	}
+
+	profiles, err := d.Generate(tree, "agent", "v1")
+	require.NoError(t, err)
+
+	// Both frames are reported at the same address, but with different functions.
+	dic := profiles.ProfilesDictionary()
+	require.Equal(t, 2, dic.LocationTable().Len())
+	for i, name := range []string{"inlined", "main"} {
+		loc := dic.LocationTable().At(i)
+		assert.Equal(t, uint64(addr), loc.Address())
+		require.Equal(t, 1, loc.Line().Len())
+		fn := dic.FunctionTable().At(int(loc.Line().At(0).FunctionIndex()))
+		assert.Equal(t, name, dic.StringTable().At(int(fn.NameStrindex())))
+	}
+}
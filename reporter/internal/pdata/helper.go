@@ -42,6 +42,7 @@ type locationInfo struct {
 
 // funcInfo is a helper to construct profile.Function messages.
 type funcInfo struct {
-	nameIdx     int32
-	fileNameIdx int32
+	nameIdx       int32
+	systemNameIdx int32
+	fileNameIdx   int32
 }
@@ -4,6 +4,8 @@
 package pdata // import "go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
 
 import (
+	"time"
+
 	lru "github.com/elastic/go-freelru"
 
 	"go.opentelemetry.io/ebpf-profiler/libpf"
@@ -16,6 +18,10 @@ type Pdata struct {
 	// samplesPerSecond is the number of samples per second.
 	samplesPerSecond int
 
+	// allocSampleInterval is the average number of allocated bytes between two
+	// sampled allocations.
+	allocSampleInterval uint32
+
 	// Executables stores metadata for executables.
 	Executables *lru.SyncedLRU[libpf.FileID, samples.ExecInfo]
 
@@ -27,7 +33,8 @@ type Pdata struct {
 	ExtraSampleAttrProd samples.SampleAttrProducer
 }
 
-func New(samplesPerSecond int, executablesCacheElements, framesCacheElements uint32,
+func New(samplesPerSecond int, allocSampleInterval uint32,
+	executablesCacheElements, framesCacheElements uint32,
 	extra samples.SampleAttrProducer) (*Pdata, error) {
 	executables, err :=
 		lru.NewSynced[libpf.FileID, samples.ExecInfo](executablesCacheElements, libpf.FileID.Hash32)
@@ -45,12 +52,37 @@ func New(samplesPerSecond int, executablesCacheElements, framesCacheElements uin
 
 	return &Pdata{
 		samplesPerSecond:    samplesPerSecond,
+		allocSampleInterval: allocSampleInterval,
 		Executables:         executables,
 		Frames:              frames,
 		ExtraSampleAttrProd: extra,
 	}, nil
 }
 
+// AllocWeights returns the number of allocations and allocated bytes that a sampled
+// allocation of size bytes stands for. Allocations smaller than the sampling interval
+// are sampled with a probability of size/interval, so that they stand for interval/size
+// allocations.
+func (p *Pdata) AllocWeights(size int64) (objects, bytes int64) {
+	interval := int64(p.allocSampleInterval)
+	if size <= 0 || size >= interval {
+		return 1, size
+	}
+	return (interval + size/2) / size, interval
+}
+
+// SampleWeight returns the number of samples at the configured sampling frequency that
+// count samples taken with the effective sampling period samplePeriod in nanoseconds
+// stand for. A samplePeriod of 0 means that the samples were taken at the configured
+// frequency.
+func (p *Pdata) SampleWeight(count, samplePeriod int64) int64 {
+	if samplePeriod == 0 || p.samplesPerSecond <= 0 {
+		return count
+	}
+	period := int64(time.Second) / int64(p.samplesPerSecond)
+	return (count*samplePeriod + period/2) / period
+}
+
 // Purge purges all the expired data
 func (p *Pdata) Purge() {
 	p.Executables.PurgeExpired()
@@ -0,0 +1,56 @@
+package pdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocWeights(t *testing.T) {
+	tests := map[string]struct {
+		interval    uint32
+		size        int64
+		wantObjects int64
+		wantBytes   int64
+	}{
+		"small allocation":    {interval: 1000, size: 300, wantObjects: 3, wantBytes: 1000},
+		"rounded objects":     {interval: 1000, size: 400, wantObjects: 3, wantBytes: 1000},
+		"large allocation":    {interval: 1000, size: 5000, wantObjects: 1, wantBytes: 5000},
+		"interval allocation": {interval: 1000, size: 1000, wantObjects: 1, wantBytes: 1000},
+		"no interval":         {size: 10, wantObjects: 1, wantBytes: 10},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := New(100, tc.interval, 100, 100, nil)
+			require.NoError(t, err)
+
+			objects, bytes := d.AllocWeights(tc.size)
+			assert.Equal(t, tc.wantObjects, objects)
+			assert.Equal(t, tc.wantBytes, bytes)
+		})
+	}
+}
+
+func TestSampleWeight(t *testing.T) {
+	tests := map[string]struct {
+		count        int64
+		samplePeriod int64
+		want         int64
+	}{
+		"configured frequency": {count: 3, want: 3},
+		"equal period":         {count: 3, samplePeriod: int64(10 * time.Millisecond), want: 3},
+		"half frequency":       {count: 3, samplePeriod: int64(20 * time.Millisecond), want: 6},
+		"rounded":              {count: 1, samplePeriod: int64(14 * time.Millisecond), want: 1},
+	}
+
+	d, err := New(100, 0, 100, 100, nil)
+	require.NoError(t, err)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, d.SampleWeight(tc.count, tc.samplePeriod))
+		})
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package pprof // import "go.opentelemetry.io/ebpf-profiler/reporter/internal/pprof"
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	tracertypes "go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// locationKey is used to deduplicate Locations.
+type locationKey struct {
+	fileID    libpf.FileID
+	addrOrLn  libpf.AddressOrLineno
+	frameType libpf.FrameType
+	// mappingID is the Mapping of native frames, which differs between processes.
+	mappingID uint64
+}
+
+// mappingKey is used to deduplicate Mappings. The same file is mapped at different
+// addresses in each process and with a mapping for each of its segments.
+type mappingKey struct {
+	pid        int64
+	fileID     libpf.FileID
+	start      libpf.Address
+	end        libpf.Address
+	fileOffset uint64
+}
+
+// functionKey is used to deduplicate Functions.
+type functionKey struct {
+	name       string
+	systemName string
+	fileName   string
+}
+
+// builder collects the tables of a single pprof profile.
+type builder struct {
+	data *pdata.Pdata
+
+	profile *Profile
+
+	strings   pdata.OrderedSet[string]
+	mappings  map[mappingKey]uint64
+	locations map[locationKey]uint64
+	functions map[functionKey]uint64
+}
+
+// Generate creates a pprof profile from all events of the given origin in tree.
+// Frame and executable metadata is looked up in the caches of data.
+// It returns nil if there are no events for the origin.
+func Generate(data *pdata.Pdata, tree samples.TraceEventsTree, origin libpf.Origin,
+	samplesPerSecond int) (*Profile, error) {
+	b := &builder{
+		data:      data,
+		profile:   &Profile{},
+		strings:   make(pdata.OrderedSet[string], 64),
+		mappings:  make(map[mappingKey]uint64),
+		locations: make(map[locationKey]uint64),
+		functions: make(map[functionKey]uint64),
+	}
+	// By specification, the first element of the string table must be empty.
+	b.strings.Add("")
+
+	p := b.profile
+	switch origin {
+	case support.TraceOriginSampling:
+		period := int64(1e9 / samplesPerSecond)
+		p.SampleTypes = []ValueType{
+			{Type: b.str("samples"), Unit: b.str("count")},
+			{Type: b.str("cpu"), Unit: b.str("nanoseconds")},
+		}
+		p.PeriodType = ValueType{Type: b.str("cpu"), Unit: b.str("nanoseconds")}
+		p.Period = period
+		p.DefaultSampleType = b.str("cpu")
+	case support.TraceOriginOffCPU:
+		p.SampleTypes = []ValueType{
+			{Type: b.str("events"), Unit: b.str("count")},
+			{Type: b.str("off_cpu"), Unit: b.str("nanoseconds")},
+		}
+		p.PeriodType = ValueType{Type: b.str("off_cpu"), Unit: b.str("nanoseconds")}
+		p.DefaultSampleType = b.str("off_cpu")
+	case support.TraceOriginUprobe:
+		p.SampleTypes = []ValueType{
+			{Type: b.str("samples"), Unit: b.str("count")},
+			{Type: b.str("calls"), Unit: b.str("count")},
+		}
+		p.PeriodType = ValueType{Type: b.str("calls"), Unit: b.str("count")}
+		p.DefaultSampleType = b.str("calls")
+	case support.TraceOriginContention:
+		p.SampleTypes = []ValueType{
+			{Type: b.str("contentions"), Unit: b.str("count")},
+			{Type: b.str("delay"), Unit: b.str("nanoseconds")},
+		}
+		p.PeriodType = ValueType{Type: b.str("contentions"), Unit: b.str("count")}
+		p.DefaultSampleType = b.str("delay")
+	case support.TraceOriginRunQueue:
+		p.SampleTypes = []ValueType{
+			{Type: b.str("events"), Unit: b.str("count")},
+			{Type: b.str("sched_delay"), Unit: b.str("nanoseconds")},
+		}
+		p.PeriodType = ValueType{Type: b.str("sched_delay"), Unit: b.str("nanoseconds")}
+		p.DefaultSampleType = b.str("sched_delay")
+	case support.TraceOriginWakeup:
+		p.SampleTypes = []ValueType{
+			{Type: b.str("wakeups"), Unit: b.str("count")},
+			{Type: b.str("wakee_off_cpu"), Unit: b.str("nanoseconds")},
+		}
+		p.PeriodType = ValueType{Type: b.str("wakee_off_cpu"), Unit: b.str("nanoseconds")}
+		p.DefaultSampleType = b.str("wakee_off_cpu")
+	case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+		prefix := "alloc"
+		if origin == support.TraceOriginAllocInUse {
+			prefix = "inuse"
+		}
+		p.SampleTypes = []ValueType{
+			{Type: b.str(prefix + "_objects"), Unit: b.str("count")},
+			{Type: b.str(prefix + "_space"), Unit: b.str("bytes")},
+		}
+		p.PeriodType = ValueType{Type: b.str("space"), Unit: b.str("bytes")}
+		p.DefaultSampleType = b.str(prefix + "_space")
+	default:
+		name, ok := tracertypes.PerfEventName(origin)
+		if !ok {
+			return nil, fmt.Errorf("generating pprof profile for unsupported origin %d",
+				origin)
+		}
+		p.SampleTypes = []ValueType{
+			{Type: b.str("samples"), Unit: b.str("count")},
+			{Type: b.str(name), Unit: b.str("count")},
+		}
+		p.PeriodType = ValueType{Type: b.str(name), Unit: b.str("count")}
+		p.DefaultSampleType = b.str(name)
+	}
+
+	startTS, endTS := uint64(math.MaxUint64), uint64(0)
+	for containerID, originToEvents := range tree {
+		for traceKey, traceInfo := range originToEvents[origin] {
+			for _, ts := range traceInfo.Timestamps {
+				startTS = min(startTS, ts)
+				endTS = max(endTS, ts)
+			}
+			b.addSample(string(containerID), &traceKey, traceInfo, origin)
+		}
+	}
+	if len(p.Samples) == 0 {
+		return nil, nil
+	}
+
+	p.TimeNanos = int64(startTS)
+	p.DurationNanos = int64(endTS - startTS)
+	p.StringTable = b.strings.ToSlice()
+	return p, nil
+}
+
+// str returns the string table index of s.
+func (b *builder) str(s string) int64 {
+	return int64(b.strings.Add(s))
+}
+
+// addSample adds a single deduplicated trace with all its events as sample.
+func (b *builder) addSample(containerID string, traceKey *samples.TraceAndMetaKey,
+	traceInfo *samples.TraceEvents, origin libpf.Origin) {
+	count := int64(len(traceInfo.Timestamps))
+	var values []int64
+	switch origin {
+	case support.TraceOriginSampling:
+		// With adaptive sampling, samples are weighted by their effective period.
+		period := b.profile.Period
+		if traceKey.SamplePeriod != 0 {
+			period = traceKey.SamplePeriod
+		}
+		values = []int64{count, count * period}
+	case support.TraceOriginAlloc, support.TraceOriginAllocInUse:
+		// Allocation traces store the size of the sampled allocation.
+		var objects, bytes int64
+		for _, size := range traceInfo.OffTimes {
+			sizeObjects, sizeBytes := b.data.AllocWeights(size)
+			objects += sizeObjects
+			bytes += sizeBytes
+		}
+		values = []int64{objects, bytes}
+	default:
+		// Off-CPU traces are valued by the time off CPU, perf event traces by
+		// the sample period of the event, uprobe traces by the number of calls,
+		// lock contention traces by the time waited for the lock, run queue traces
+		// by the time waited for a CPU and wakeup traces by the time the woken up
+		// task was off CPU.
+		var value int64
+		for _, offTime := range traceInfo.OffTimes {
+			value += offTime
+		}
+		values = []int64{count, value}
+	}
+
+	sample := Sample{
+		LocationIDs: make([]uint64, 0, len(traceInfo.FrameTypes)),
+		Values:      values,
+	}
+	for i := range traceInfo.FrameTypes {
+		if traceInfo.FrameTypes[i] == libpf.AbortFrame {
+			// Artificial frames can not be represented in pprof.
+			continue
+		}
+		sample.LocationIDs = append(sample.LocationIDs, b.location(traceKey, traceInfo, i))
+	}
+
+	exeName := traceKey.ExecutablePath
+	if exeName != "" {
+		_, exeName = filepath.Split(exeName)
+	}
+	b.addStrLabel(&sample, "thread.name", traceKey.Comm)
+	b.addStrLabel(&sample, "process.executable.name", exeName)
+	b.addStrLabel(&sample, "process.executable.path", traceKey.ExecutablePath)
+	b.addStrLabel(&sample, "service.name", traceKey.ApmServiceName)
+	b.addStrLabel(&sample, "container.id", containerID)
+	b.addNumLabel(&sample, "process.pid", traceKey.Pid)
+	b.addNumLabel(&sample, "thread.id", traceKey.Tid)
+	b.addStrLabel(&sample, "thread.state", traceKey.TaskState)
+	b.addStrLabel(&sample, "thread.wait_channel", traceKey.WaitChannel)
+	if traceKey.LockAddr != 0 {
+		b.addStrLabel(&sample, "lock.address", fmt.Sprintf("0x%x", traceKey.LockAddr))
+	}
+	if traceKey.SamplePeriod != 0 {
+		b.addNumLabel(&sample, "profile.sample.period", traceKey.SamplePeriod)
+	}
+	if traceKey.WakerTid != 0 {
+		b.addNumLabel(&sample, "thread.waker.pid", traceKey.WakerPid)
+		b.addNumLabel(&sample, "thread.waker.tid", traceKey.WakerTid)
+	}
+	if !traceKey.WakerHash.IsZero() {
+		b.addStrLabel(&sample, "thread.waker.stack_hash", fmt.Sprintf("%x", traceKey.WakerHash))
+	}
+	if origin == support.TraceOriginWakeup {
+		// The hash links the trace of the waker to the off-cpu traces it woke up.
+		b.addStrLabel(&sample, "thread.stack_hash", fmt.Sprintf("%x", traceKey.Hash))
+	}
+	for key, value := range traceInfo.EnvVars {
+		b.addStrLabel(&sample, "process.environment_variable."+key, value)
+	}
+
+	b.profile.Samples = append(b.profile.Samples, sample)
+}
+
+func (b *builder) addStrLabel(sample *Sample, key, value string) {
+	if value == "" {
+		return
+	}
+	sample.Labels = append(sample.Labels, Label{Key: b.str(key), Str: b.str(value)})
+}
+
+func (b *builder) addNumLabel(sample *Sample, key string, value int64) {
+	sample.Labels = append(sample.Labels, Label{Key: b.str(key), Num: value})
+}
+
+// location returns the ID of the Location for frame i of traceInfo.
+func (b *builder) location(traceKey *samples.TraceAndMetaKey, traceInfo *samples.TraceEvents,
+	i int) uint64 {
+	key := locationKey{
+		fileID:    traceInfo.Files[i],
+		addrOrLn:  traceInfo.Linenos[i],
+		frameType: traceInfo.FrameTypes[i],
+	}
+	if key.frameType == libpf.NativeFrame {
+		key.mappingID = b.mapping(traceKey, traceInfo, i)
+	}
+	if id, exists := b.locations[key]; exists {
+		return id
+	}
+
+	// IDs in pprof are 1-based, 0 is reserved.
+	loc := Location{ID: uint64(len(b.profile.Locations) + 1)}
+	if key.frameType == libpf.NativeFrame {
+		// Native frames are symbolized by pprof tooling based on the mapping,
+		// unless the agent already symbolized them. The address and the bounds of
+		// the mapping are both virtual addresses of the ELF file, so that the file
+		// offset of the address is Address - MemoryStart + FileOffset.
+		loc.Address = uint64(key.addrOrLn.StripInlineDepth())
+		loc.MappingID = key.mappingID
+		// Native frames symbolized by the agent also carry a function.
+		if si, exists := b.data.Frames.GetAndRefresh(
+			libpf.NewFrameID(key.fileID, key.addrOrLn),
+			pdata.FramesCacheLifetime); exists {
+			fid := b.function(si.FunctionName.String(), si.MangledName.String(),
+				si.FilePath.String())
+			loc.Lines = []Line{{Line: int64(si.LineNumber), FunctionID: fid}}
+		}
+	} else {
+		line := Line{}
+		if si, exists := b.data.Frames.GetAndRefresh(
+			libpf.NewFrameID(key.fileID, key.addrOrLn),
+			pdata.FramesCacheLifetime); exists {
+			line.Line = int64(si.LineNumber)
+			line.FunctionID = b.function(si.FunctionName.String(), si.MangledName.String(),
+				si.FilePath.String())
+		} else {
+			// Report a dummy entry and use the frame type as filename.
+			line.FunctionID = b.function("UNRESOLVED", "", key.frameType.String())
+		}
+		loc.Lines = []Line{line}
+	}
+
+	b.profile.Locations = append(b.profile.Locations, loc)
+	b.locations[key] = loc.ID
+	return loc.ID
+}
+
+// mapping returns the ID of the Mapping for frame i of traceInfo.
+func (b *builder) mapping(traceKey *samples.TraceAndMetaKey, traceInfo *samples.TraceEvents,
+	i int) uint64 {
+	fileID := traceInfo.Files[i]
+	key := mappingKey{
+		pid:        traceKey.Pid,
+		fileID:     fileID,
+		start:      traceInfo.MappingStarts[i],
+		end:        traceInfo.MappingEnds[i],
+		fileOffset: traceInfo.MappingFileOffsets[i],
+	}
+	if id, exists := b.mappings[key]; exists {
+		return id
+	}
+
+	fileName := "UNKNOWN"
+	var buildID string
+	if ei, exists := b.data.Executables.GetAndRefresh(fileID,
+		pdata.ExecutableCacheLifetime); exists {
+		fileName = ei.FileName
+		buildID = ei.GnuBuildID
+	}
+	if buildID == "" {
+		buildID = fileID.StringNoQuotes()
+	}
+
+	m := Mapping{
+		ID:          uint64(len(b.profile.Mappings) + 1),
+		MemoryStart: uint64(traceInfo.MappingStarts[i]),
+		MemoryLimit: uint64(traceInfo.MappingEnds[i]),
+		FileOffset:  traceInfo.MappingFileOffsets[i],
+		Filename:    b.str(fileName),
+		BuildID:     b.str(buildID),
+	}
+	b.profile.Mappings = append(b.profile.Mappings, m)
+	b.mappings[key] = m.ID
+	return m.ID
+}
+
+// function returns the ID of the Function with the given name, system name and
+// file name.
+func (b *builder) function(name, systemName, fileName string) uint64 {
+	key := functionKey{name: name, systemName: systemName, fileName: fileName}
+	if id, exists := b.functions[key]; exists {
+		return id
+	}
+	f := Function{
+		ID:         uint64(len(b.profile.Functions) + 1),
+		Name:       b.str(name),
+		SystemName: b.str(systemName),
+		Filename:   b.str(fileName),
+	}
+	b.profile.Functions = append(b.profile.Functions, f)
+	b.functions[key] = f.ID
+	return f.ID
+}
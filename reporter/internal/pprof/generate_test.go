@@ -0,0 +1,199 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func newTestTree(origin libpf.Origin) samples.TraceEventsTree {
+	nativeFile := libpf.NewFileID(1, 2)
+	pythonFile := libpf.NewFileID(3, 4)
+	return samples.TraceEventsTree{
+		"container": {
+			origin: samples.KeyToEventMapping{
+				{Hash: libpf.NewTraceHash(1, 1), Comm: "worker", Pid: 42, Tid: 43}: {
+					Files:              []libpf.FileID{pythonFile, nativeFile},
+					Linenos:            []libpf.AddressOrLineno{17, 0x1000},
+					FrameTypes:         []libpf.FrameType{libpf.PythonFrame, libpf.NativeFrame},
+					MappingStarts:      []libpf.Address{0, 0x1000},
+					MappingEnds:        []libpf.Address{0, 0x2000},
+					MappingFileOffsets: []uint64{0, 0x1000},
+					Timestamps:         []uint64{100, 200, 300},
+					OffTimes:           []int64{10, 20, 30},
+				},
+			},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	data, err := pdata.New(20, 40, 16, 16, nil)
+	require.NoError(t, err)
+	data.Executables.Add(libpf.NewFileID(1, 2), samples.ExecInfo{FileName: "libc.so.6"})
+	data.Frames.Add(libpf.NewFrameID(libpf.NewFileID(3, 4), 17), samples.SourceInfo{
+		FunctionName: libpf.Intern("handler"),
+		FilePath:     libpf.Intern("app.py"),
+		LineNumber:   12,
+	})
+	data.Frames.Add(libpf.NewFrameID(libpf.NewFileID(1, 2), 0x1000), samples.SourceInfo{
+		FunctionName: libpf.Intern("foo()"),
+		MangledName:  libpf.Intern("_Z3foov"),
+	})
+
+	for name, tc := range map[string]struct {
+		origin     libpf.Origin
+		wantValues []int64
+	}{
+		"on-cpu": {
+			origin:     support.TraceOriginSampling,
+			wantValues: []int64{3, 3 * 1e9 / 20},
+		},
+		"off-cpu": {
+			origin:     support.TraceOriginOffCPU,
+			wantValues: []int64{3, 60},
+		},
+		"alloc": {
+			origin:     support.TraceOriginAlloc,
+			wantValues: []int64{7, 120},
+		},
+		"contention": {
+			origin:     support.TraceOriginContention,
+			wantValues: []int64{3, 60},
+		},
+		"runqueue": {
+			origin:     support.TraceOriginRunQueue,
+			wantValues: []int64{3, 60},
+		},
+		"wakeup": {
+			origin:     support.TraceOriginWakeup,
+			wantValues: []int64{3, 60},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := Generate(data, newTestTree(tc.origin), tc.origin, 20)
+			require.NoError(t, err)
+			require.NotNil(t, p)
+
+			require.Len(t, p.Samples, 1)
+			assert.Equal(t, tc.wantValues, p.Samples[0].Values)
+			assert.Len(t, p.Samples[0].LocationIDs, 2)
+			assert.Len(t, p.Locations, 2)
+			assert.Len(t, p.Mappings, 1)
+			require.Len(t, p.Functions, 2)
+			assert.Equal(t, "handler", p.StringTable[p.Functions[0].Name])
+			assert.Zero(t, p.Functions[0].SystemName)
+			assert.Equal(t, "foo()", p.StringTable[p.Functions[1].Name])
+			assert.Equal(t, "_Z3foov", p.StringTable[p.Functions[1].SystemName])
+			assert.Equal(t, "libc.so.6", p.StringTable[p.Mappings[0].Filename])
+			assert.Equal(t, int64(100), p.TimeNanos)
+			assert.Equal(t, int64(200), p.DurationNanos)
+			assert.Empty(t, p.StringTable[0])
+		})
+	}
+}
+
+func TestGenerateMappings(t *testing.T) {
+	data, err := pdata.New(20, 0, 16, 16, nil)
+	require.NoError(t, err)
+
+	file := libpf.NewFileID(1, 2)
+	nativeTrace := func(addr libpf.AddressOrLineno, start, end libpf.Address,
+		offset uint64) *samples.TraceEvents {
+		return &samples.TraceEvents{
+			Files:              []libpf.FileID{file},
+			Linenos:            []libpf.AddressOrLineno{addr},
+			FrameTypes:         []libpf.FrameType{libpf.NativeFrame},
+			MappingStarts:      []libpf.Address{start},
+			MappingEnds:        []libpf.Address{end},
+			MappingFileOffsets: []uint64{offset},
+			Timestamps:         []uint64{100},
+		}
+	}
+	tree := samples.TraceEventsTree{
+		"": {
+			support.TraceOriginSampling: samples.KeyToEventMapping{
+				// The same address of the same segment in two processes.
+				{Hash: libpf.NewTraceHash(1, 1), Pid: 1}: nativeTrace(0x1100, 0x1000, 0x2000,
+					0x1000),
+				{Hash: libpf.NewTraceHash(2, 2), Pid: 2}: nativeTrace(0x1100, 0x1000, 0x2000,
+					0x1000),
+				// Another segment of the same file in the first process.
+				{Hash: libpf.NewTraceHash(3, 3), Pid: 1}: nativeTrace(0x3100, 0x3000, 0x4000,
+					0x3000),
+				// Another address in the first segment of the first process.
+				{Hash: libpf.NewTraceHash(4, 4), Pid: 1}: nativeTrace(0x1200, 0x1000, 0x2000,
+					0x1000),
+			},
+		},
+	}
+
+	p, err := Generate(data, tree, support.TraceOriginSampling, 20)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Len(t, p.Mappings, 3)
+	assert.Len(t, p.Locations, 4)
+	for _, loc := range p.Locations {
+		require.NotZero(t, loc.MappingID)
+		m := p.Mappings[loc.MappingID-1]
+		assert.GreaterOrEqual(t, loc.Address, m.MemoryStart)
+		assert.Less(t, loc.Address, m.MemoryLimit)
+		// The file offset of the address is the same as its address in the file.
+		assert.Equal(t, loc.Address, loc.Address-m.MemoryStart+m.FileOffset)
+	}
+}
+
+func TestGenerateNoEvents(t *testing.T) {
+	data, err := pdata.New(20, 0, 16, 16, nil)
+	require.NoError(t, err)
+
+	p, err := Generate(data, newTestTree(support.TraceOriginOffCPU),
+		support.TraceOriginSampling, 20)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestWrite(t *testing.T) {
+	data, err := pdata.New(20, 0, 16, 16, nil)
+	require.NoError(t, err)
+	p, err := Generate(data, newTestTree(support.TraceOriginSampling),
+		support.TraceOriginSampling, 20)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.Write(&buf))
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	// Count the top level fields to make sure the encoding is well-formed.
+	fields := make(map[protowire.Number]int)
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		require.GreaterOrEqual(t, n, 0)
+		raw = raw[n:]
+		n = protowire.ConsumeFieldValue(num, typ, raw)
+		require.GreaterOrEqual(t, n, 0)
+		raw = raw[n:]
+		fields[num]++
+	}
+	assert.Equal(t, 2, fields[profileSampleType])
+	assert.Equal(t, 1, fields[profileSample])
+	assert.Equal(t, 2, fields[profileLocation])
+	assert.Equal(t, len(p.StringTable), fields[profileStringTable])
+}
@@ -0,0 +1,260 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pprof implements a minimal writer for the pprof profile.proto format
+// as consumed by `go tool pprof`.
+package pprof // import "go.opentelemetry.io/ebpf-profiler/reporter/internal/pprof"
+
+import (
+	"compress/gzip"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages defined in profile.proto:
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+	labelNum = 3
+
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFileOffset   = 4
+	mappingFilename     = 5
+	mappingBuildID      = 6
+	mappingHasFunctions = 7
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// ValueType describes the semantics and measurement units of a value.
+type ValueType struct {
+	Type int64
+	Unit int64
+}
+
+// Label attaches a string or numeric value to a sample.
+type Label struct {
+	Key int64
+	Str int64
+	Num int64
+}
+
+// Sample records values for a stack of locations.
+type Sample struct {
+	LocationIDs []uint64
+	Values      []int64
+	Labels      []Label
+}
+
+// Mapping describes a memory mapping of an executable object.
+type Mapping struct {
+	ID           uint64
+	MemoryStart  uint64
+	MemoryLimit  uint64
+	FileOffset   uint64
+	Filename     int64
+	BuildID      int64
+	HasFunctions bool
+}
+
+// Line references a function and source line of a location.
+type Line struct {
+	FunctionID uint64
+	Line       int64
+}
+
+// Location describes a single frame of a stack.
+type Location struct {
+	ID        uint64
+	MappingID uint64
+	Address   uint64
+	Lines     []Line
+}
+
+// Function describes a function in the source code.
+type Function struct {
+	ID         uint64
+	Name       int64
+	SystemName int64
+	Filename   int64
+}
+
+// Profile is the in-memory representation of a pprof profile. All string
+// fields are indices into StringTable.
+type Profile struct {
+	SampleTypes       []ValueType
+	Samples           []Sample
+	Mappings          []Mapping
+	Locations         []Location
+	Functions         []Function
+	StringTable       []string
+	TimeNanos         int64
+	DurationNanos     int64
+	PeriodType        ValueType
+	Period            int64
+	DefaultSampleType int64
+}
+
+// Write encodes the profile as gzip compressed protobuf to w, which is
+// the on-disk format expected by pprof tooling.
+func (p *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.Marshal()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Marshal encodes the profile as uncompressed protobuf.
+func (p *Profile) Marshal() []byte {
+	var b []byte
+	for _, st := range p.SampleTypes {
+		b = appendMessage(b, profileSampleType, st.marshal(nil))
+	}
+	var msg []byte
+	for i := range p.Samples {
+		msg = p.Samples[i].marshal(msg[:0])
+		b = appendMessage(b, profileSample, msg)
+	}
+	for i := range p.Mappings {
+		msg = p.Mappings[i].marshal(msg[:0])
+		b = appendMessage(b, profileMapping, msg)
+	}
+	for i := range p.Locations {
+		msg = p.Locations[i].marshal(msg[:0])
+		b = appendMessage(b, profileLocation, msg)
+	}
+	for i := range p.Functions {
+		msg = p.Functions[i].marshal(msg[:0])
+		b = appendMessage(b, profileFunction, msg)
+	}
+	for _, s := range p.StringTable {
+		// The string table must contain all entries, including empty ones.
+		b = protowire.AppendTag(b, profileStringTable, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	b = appendVarint(b, profileTimeNanos, uint64(p.TimeNanos))
+	b = appendVarint(b, profileDurationNanos, uint64(p.DurationNanos))
+	b = appendMessage(b, profilePeriodType, p.PeriodType.marshal(nil))
+	b = appendVarint(b, profilePeriod, uint64(p.Period))
+	b = appendVarint(b, profileDefaultSampleType, uint64(p.DefaultSampleType))
+	return b
+}
+
+func (vt ValueType) marshal(b []byte) []byte {
+	b = appendVarint(b, valueTypeType, uint64(vt.Type))
+	return appendVarint(b, valueTypeUnit, uint64(vt.Unit))
+}
+
+func (s *Sample) marshal(b []byte) []byte {
+	b = appendPacked(b, sampleLocationID, s.LocationIDs)
+	values := make([]uint64, len(s.Values))
+	for i, v := range s.Values {
+		values[i] = uint64(v)
+	}
+	b = appendPacked(b, sampleValue, values)
+	for _, l := range s.Labels {
+		var msg []byte
+		msg = appendVarint(msg, labelKey, uint64(l.Key))
+		msg = appendVarint(msg, labelStr, uint64(l.Str))
+		msg = appendVarint(msg, labelNum, uint64(l.Num))
+		b = appendMessage(b, sampleLabel, msg)
+	}
+	return b
+}
+
+func (m *Mapping) marshal(b []byte) []byte {
+	b = appendVarint(b, mappingID, m.ID)
+	b = appendVarint(b, mappingMemoryStart, m.MemoryStart)
+	b = appendVarint(b, mappingMemoryLimit, m.MemoryLimit)
+	b = appendVarint(b, mappingFileOffset, m.FileOffset)
+	b = appendVarint(b, mappingFilename, uint64(m.Filename))
+	b = appendVarint(b, mappingBuildID, uint64(m.BuildID))
+	return appendVarint(b, mappingHasFunctions, protowire.EncodeBool(m.HasFunctions))
+}
+
+func (l *Location) marshal(b []byte) []byte {
+	b = appendVarint(b, locationID, l.ID)
+	b = appendVarint(b, locationMappingID, l.MappingID)
+	b = appendVarint(b, locationAddress, l.Address)
+	for _, line := range l.Lines {
+		var msg []byte
+		msg = appendVarint(msg, lineFunctionID, line.FunctionID)
+		msg = appendVarint(msg, lineLine, uint64(line.Line))
+		b = appendMessage(b, locationLine, msg)
+	}
+	return b
+}
+
+func (f *Function) marshal(b []byte) []byte {
+	b = appendVarint(b, functionID, f.ID)
+	b = appendVarint(b, functionName, uint64(f.Name))
+	b = appendVarint(b, functionSystemName, uint64(f.SystemName))
+	return appendVarint(b, functionFilename, uint64(f.Filename))
+}
+
+// appendVarint appends a varint field. Zero values are omitted as in proto3.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendPacked appends a packed repeated varint field.
+func appendPacked(b []byte, num protowire.Number, vs []uint64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	size := 0
+	for _, v := range vs {
+		size += protowire.SizeVarint(v)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(size))
+	for _, v := range vs {
+		b = protowire.AppendVarint(b, v)
+	}
+	return b
+}
+
+// appendMessage appends an embedded message field.
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,243 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package spool implements a bounded, persistent FIFO queue of batches on disk.
+// It is used to hold reports while the backend is unreachable.
+package spool // import "go.opentelemetry.io/ebpf-profiler/reporter/internal/spool"
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSuffix is the file name suffix of all batches in the spool directory.
+	batchSuffix = ".batch"
+	// tmpPrefix is the file name prefix of batches that are being written.
+	tmpPrefix = ".tmp-"
+)
+
+// batch describes a single batch stored on disk.
+type batch struct {
+	// created is the creation time in nanoseconds since the epoch. It is also
+	// the file name of the batch, which makes file names unique and sortable.
+	created int64
+	size    int64
+}
+
+func (b batch) fileName() string {
+	return fmt.Sprintf("%020d%s", b.created, batchSuffix)
+}
+
+// Spool is a persistent FIFO queue of batches. The total size of the batches and
+// their age are bounded. If a limit is exceeded, the oldest batches are dropped.
+type Spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu sync.Mutex
+	// batches holds the stored batches ordered from oldest to newest.
+	batches []batch
+	// size is the total size in bytes of all batches.
+	size int64
+	// dropped is the number of batches dropped since the last call to TakeDropped.
+	dropped uint64
+}
+
+// New returns a Spool that stores batches in dir. Batches that were left in dir
+// by a previous instance are picked up again. A maxSize or maxAge of 0 disables
+// the respective limit.
+func New(dir string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, tmpPrefix) {
+			// Leftover of an incomplete write.
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, batchSuffix) {
+			continue
+		}
+		created, err := strconv.ParseInt(strings.TrimSuffix(name, batchSuffix), 10, 64)
+		if err != nil {
+			log.Debugf("Ignoring unknown file %s in spool directory", name)
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s.batches = append(s.batches, batch{created: created, size: info.Size()})
+		s.size += info.Size()
+	}
+	slices.SortFunc(s.batches, func(a, b batch) int {
+		return cmp.Compare(a.created, b.created)
+	})
+
+	return s, nil
+}
+
+// Push stores data as the newest batch.
+func (s *Spool) Push(data []byte, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := batch{created: now.UnixNano(), size: int64(len(data))}
+	if n := len(s.batches); n > 0 && b.created <= s.batches[n-1].created {
+		// Keep file names unique and in order.
+		b.created = s.batches[n-1].created + 1
+	}
+
+	if err := s.write(b.fileName(), data); err != nil {
+		s.dropped++
+		return err
+	}
+	s.batches = append(s.batches, b)
+	s.size += b.size
+
+	s.enforceLimits(now)
+	return nil
+}
+
+// write atomically writes data to the file name in the spool directory.
+func (s *Spool) write(name string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// Front returns the oldest batch that is not expired. ok is false if the
+// spool is empty.
+func (s *Spool) Front(now time.Time) (data []byte, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforceLimits(now)
+	for len(s.batches) > 0 {
+		data, err = os.ReadFile(filepath.Join(s.dir, s.batches[0].fileName()))
+		if err == nil {
+			return data, true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+		// The file was removed externally.
+		_ = s.removeFront()
+	}
+	return nil, false, nil
+}
+
+// Pop removes the oldest batch after it was processed successfully.
+func (s *Spool) Pop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeFront()
+}
+
+// Drop removes the oldest batch and accounts it as dropped.
+func (s *Spool) Drop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.batches) == 0 {
+		return nil
+	}
+	s.dropped++
+	return s.removeFront()
+}
+
+// Len returns the number of batches in the spool.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.batches)
+}
+
+// Size returns the total size in bytes of all batches in the spool.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// TakeDropped returns the number of batches dropped since the last call.
+func (s *Spool) TakeDropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped := s.dropped
+	s.dropped = 0
+	return dropped
+}
+
+// enforceLimits drops the oldest batches until the size and age limits are met.
+// The caller must hold mu.
+func (s *Spool) enforceLimits(now time.Time) {
+	var minCreated int64
+	if s.maxAge > 0 {
+		minCreated = now.Add(-s.maxAge).UnixNano()
+	}
+	for len(s.batches) > 0 &&
+		((s.maxSize > 0 && s.size > s.maxSize) || s.batches[0].created < minCreated) {
+		log.Debugf("Dropping spooled batch %s", s.batches[0].fileName())
+		s.dropped++
+		if err := s.removeFront(); err != nil {
+			log.Warnf("Failed to remove spooled batch: %v", err)
+		}
+	}
+}
+
+// removeFront removes the oldest batch. The caller must hold mu.
+func (s *Spool) removeFront() error {
+	if len(s.batches) == 0 {
+		return nil
+	}
+	b := s.batches[0]
+	s.batches = s.batches[1:]
+	s.size -= b.size
+
+	err := os.Remove(filepath.Join(s.dir, b.fileName()))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolOrder(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+
+	s, err := New(dir, 0, 0)
+	require.NoError(t, err)
+	for _, data := range []string{"a", "b", "c"} {
+		// Pushing with the same timestamp must keep the order.
+		require.NoError(t, s.Push([]byte(data), now))
+	}
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, int64(3), s.Size())
+
+	data, ok, err := s.Front(now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a", string(data))
+	require.NoError(t, s.Pop())
+
+	// A new instance picks up the remaining batches in order.
+	s, err = New(dir, 0, 0)
+	require.NoError(t, err)
+	for _, want := range []string{"b", "c"} {
+		data, ok, err = s.Front(now)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, want, string(data))
+		require.NoError(t, s.Pop())
+	}
+
+	_, ok, err = s.Front(now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Zero(t, s.TakeDropped())
+}
+
+func TestSpoolLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := map[string]struct {
+		maxSize  int64
+		maxAge   time.Duration
+		frontAt  time.Time
+		want     string
+		wantDrop uint64
+	}{
+		"size": {
+			maxSize:  5,
+			frontAt:  now,
+			want:     "cc",
+			wantDrop: 2,
+		},
+		"age": {
+			maxAge:   90 * time.Second,
+			frontAt:  now.Add(3 * time.Minute),
+			want:     "cc",
+			wantDrop: 2,
+		},
+		"no limits": {
+			frontAt: now.Add(time.Hour),
+			want:    "aa",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(t.TempDir(), tc.maxSize, tc.maxAge)
+			require.NoError(t, err)
+			for i, data := range []string{"aa", "bb", "cc", "dd"} {
+				require.NoError(t, s.Push([]byte(data), now.Add(time.Duration(i)*time.Minute)))
+			}
+
+			data, ok, err := s.Front(tc.frontAt)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, tc.want, string(data))
+			assert.Equal(t, tc.wantDrop, s.TakeDropped())
+			assert.Zero(t, s.TakeDropped())
+		})
+	}
+}
+
+func TestSpoolDrop(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Push([]byte("a"), time.Now()))
+
+	// Unknown files and leftovers of incomplete writes are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unknown"), nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tmpPrefix+"1"), nil, 0o600))
+	s, err = New(dir, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+	assert.NoFileExists(t, filepath.Join(dir, tmpPrefix+"1"))
+
+	require.NoError(t, s.Drop())
+	assert.Equal(t, uint64(1), s.TakeDropped())
+	assert.Equal(t, 0, s.Len())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "unknown", entries[0].Name())
+}
@@ -0,0 +1,326 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// Assert that we implement the full Reporter interface.
+var _ Reporter = (*MultiReporter)(nil)
+
+// Assert that we forward allocation frees.
+var _ AllocationReporter = (*MultiReporter)(nil)
+
+const (
+	// multiQueueSize is the number of calls that are buffered for each child
+	// of MultiReporter.
+	multiQueueSize = 8192
+
+	// multiDropLogInterval is the interval for logging the number of calls
+	// that were dropped for a child of MultiReporter.
+	multiDropLogInterval = time.Minute
+)
+
+// MultiReporter forwards all calls to a set of child reporters. Each child is
+// called from its own goroutine through a bounded queue. If the queue of a child
+// is full, the call is dropped for this child, so that a slow child can not
+// block the others.
+type MultiReporter struct {
+	children []*multiChild
+}
+
+// multiChild is a single child reporter of MultiReporter.
+type multiChild struct {
+	Reporter
+
+	// index is the position of the child, used for logging.
+	index int
+
+	// mu protects queue from being used after it is closed.
+	mu sync.RWMutex
+	// started is set once the child is started and run processes queue.
+	started bool
+	// stopped is set once queue is closed.
+	stopped bool
+	// queue holds the calls to be made on the child.
+	queue chan func(Reporter)
+	// done is closed once all calls in queue are processed.
+	done chan libpf.Void
+	// dropped is the number of calls dropped since it was last logged.
+	dropped atomic.Uint64
+}
+
+// NewMulti returns a new instance of MultiReporter that forwards all calls to
+// children.
+func NewMulti(children ...Reporter) (*MultiReporter, error) {
+	if len(children) == 0 {
+		return nil, errors.New("no child reporters")
+	}
+
+	r := &MultiReporter{
+		children: make([]*multiChild, 0, len(children)),
+	}
+	for i, child := range children {
+		r.children = append(r.children, &multiChild{
+			Reporter: child,
+			index:    i,
+			queue:    make(chan func(Reporter), multiQueueSize),
+			done:     make(chan libpf.Void),
+		})
+	}
+	return r, nil
+}
+
+// Start starts all children. If a child fails to start, the already started
+// children are stopped again.
+func (r *MultiReporter) Start(ctx context.Context) error {
+	for i, c := range r.children {
+		if err := c.Start(ctx); err != nil {
+			for _, started := range r.children[:i] {
+				started.Stop()
+			}
+			return fmt.Errorf("failed to start reporter %d: %v", c.index, err)
+		}
+	}
+	for _, c := range r.children {
+		c.mu.Lock()
+		c.started = true
+		c.mu.Unlock()
+		go c.run()
+	}
+	return nil
+}
+
+// Stop processes all queued calls and stops all children. Children that were not
+// started, as Start was not called or failed, are not stopped.
+func (r *MultiReporter) Stop() {
+	var wg sync.WaitGroup
+	for _, c := range r.children {
+		wg.Add(1)
+		go func(c *multiChild) {
+			defer wg.Done()
+			c.mu.Lock()
+			running := c.started && !c.stopped
+			if !c.stopped {
+				c.stopped = true
+				close(c.queue)
+			}
+			c.mu.Unlock()
+			if !running {
+				return
+			}
+			<-c.done
+			c.Stop()
+		}(c)
+	}
+	wg.Wait()
+}
+
+// run processes the queued calls of the child until the queue is closed.
+func (c *multiChild) run() {
+	defer close(c.done)
+
+	tick := time.NewTicker(multiDropLogInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case call, ok := <-c.queue:
+			if !ok {
+				return
+			}
+			call(c.Reporter)
+		case <-tick.C:
+			if dropped := c.dropped.Swap(0); dropped > 0 {
+				log.Warnf("Reporter %d is too slow, dropped %d calls", c.index, dropped)
+			}
+		}
+	}
+}
+
+// enqueue queues call for the child without blocking. It returns false if the
+// queue is full or the child is stopped.
+func (c *multiChild) enqueue(call func(Reporter)) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stopped {
+		return false
+	}
+
+	select {
+	case c.queue <- call:
+		return true
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// ReportTraceEvent forwards the trace event to all children. It only returns
+// an error if the event was dropped for all children.
+func (r *MultiReporter) ReportTraceEvent(trace *libpf.Trace,
+	meta *samples.TraceEventMeta) error {
+	var queued bool
+	for _, c := range r.children {
+		if c.enqueue(func(child Reporter) {
+			if err := child.ReportTraceEvent(trace, meta); err != nil {
+				log.Debugf("Reporter %d failed to report trace event: %v", c.index, err)
+			}
+		}) {
+			queued = true
+		}
+	}
+	if !queued {
+		return errors.New("trace event dropped: all reporters are busy")
+	}
+	return nil
+}
+
+// ReportAllocationFree forwards the free to all children that track allocations.
+func (r *MultiReporter) ReportAllocationFree(pid libpf.PID, addr uint64,
+	timestamp libpf.UnixTime64) {
+	for _, c := range r.children {
+		if _, ok := c.Reporter.(AllocationReporter); !ok {
+			continue
+		}
+		c.enqueue(func(child Reporter) {
+			child.(AllocationReporter).ReportAllocationFree(pid, addr, timestamp)
+		})
+	}
+}
+
+// ReportAllocationsFreed forwards the process exit to all children that track
+// allocations.
+func (r *MultiReporter) ReportAllocationsFreed(pid libpf.PID) {
+	for _, c := range r.children {
+		if _, ok := c.Reporter.(AllocationReporter); !ok {
+			continue
+		}
+		c.enqueue(func(child Reporter) {
+			child.(AllocationReporter).ReportAllocationsFreed(pid)
+		})
+	}
+}
+
+// ReportAllocationsTracked forwards the tracked allocations to all children that
+// track allocations.
+func (r *MultiReporter) ReportAllocationsTracked(tracked libpf.Set[support.AllocKey],
+	timestamp libpf.UnixTime64) {
+	for _, c := range r.children {
+		if _, ok := c.Reporter.(AllocationReporter); !ok {
+			continue
+		}
+		c.enqueue(func(child Reporter) {
+			child.(AllocationReporter).ReportAllocationsTracked(tracked, timestamp)
+		})
+	}
+}
+
+// SetReportInterval changes the report interval of all children that support it.
+func (r *MultiReporter) SetReportInterval(interval time.Duration) {
+	for _, c := range r.children {
+		if rep, ok := c.Reporter.(IntervalReporter); ok {
+			rep.SetReportInterval(interval)
+		}
+	}
+}
+
+// Reconnect reconnects all children that connect to a backend and returns the
+// errors of all failed children.
+func (r *MultiReporter) Reconnect(ctx context.Context, cfg *Config) error {
+	var errs []error
+	supported := false
+	for _, c := range r.children {
+		rep, ok := c.Reporter.(ReconnectReporter)
+		if !ok {
+			continue
+		}
+		supported = true
+		if err := rep.Reconnect(ctx, cfg); err != nil {
+			errs = append(errs, fmt.Errorf("reporter %d: %v", c.index, err))
+		}
+	}
+	if !supported {
+		return errReconnectUnsupported
+	}
+	return errors.Join(errs...)
+}
+
+// ExecutableKnown returns true only if all children know the executable, so that
+// its metadata is reported again if a child is missing it.
+func (r *MultiReporter) ExecutableKnown(fileID libpf.FileID) bool {
+	for _, c := range r.children {
+		if !c.ExecutableKnown(fileID) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExecutableMetadata forwards the executable metadata to all children.
+func (r *MultiReporter) ExecutableMetadata(args *ExecutableMetadataArgs) {
+	for _, c := range r.children {
+		c.enqueue(func(child Reporter) {
+			child.ExecutableMetadata(args)
+		})
+	}
+}
+
+// FrameKnown returns true only if all children know the frame, so that its
+// metadata is reported again if a child is missing it.
+func (r *MultiReporter) FrameKnown(frameID libpf.FrameID) bool {
+	for _, c := range r.children {
+		if !c.FrameKnown(frameID) {
+			return false
+		}
+	}
+	return true
+}
+
+// FrameMetadata forwards the frame metadata to all children.
+func (r *MultiReporter) FrameMetadata(args *FrameMetadataArgs) {
+	for _, c := range r.children {
+		c.enqueue(func(child Reporter) {
+			child.FrameMetadata(args)
+		})
+	}
+}
+
+// ReportHostMetadata forwards the host metadata to all children.
+func (r *MultiReporter) ReportHostMetadata(metadataMap map[string]string) {
+	for _, c := range r.children {
+		c.enqueue(func(child Reporter) {
+			child.ReportHostMetadata(metadataMap)
+		})
+	}
+}
+
+// ReportHostMetadataBlocking sends the host metadata to all children concurrently
+// and returns the errors of all failed children.
+func (r *MultiReporter) ReportHostMetadataBlocking(ctx context.Context,
+	metadataMap map[string]string, maxRetries int, waitRetry time.Duration) error {
+	errs := make([]error, len(r.children))
+	var wg sync.WaitGroup
+	for i, c := range r.children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.ReportHostMetadataBlocking(ctx, metadataMap, maxRetries, waitRetry)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
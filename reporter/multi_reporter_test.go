@@ -0,0 +1,179 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+)
+
+// fakeReporter records the calls it receives. If block is set, ReportTraceEvent
+// blocks until block is closed.
+type fakeReporter struct {
+	block chan libpf.Void
+
+	mu sync.Mutex
+	// received counts the calls of ReportTraceEvent, including the blocked ones.
+	received int
+	traces   int
+	frames   int
+	stopped  bool
+	known    bool
+	hostErr  error
+	startErr error
+}
+
+func (f *fakeReporter) Start(context.Context) error { return f.startErr }
+
+func (f *fakeReporter) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+}
+
+func (f *fakeReporter) ReportTraceEvent(*libpf.Trace, *samples.TraceEventMeta) error {
+	f.mu.Lock()
+	f.received++
+	f.mu.Unlock()
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.traces++
+	return nil
+}
+
+func (f *fakeReporter) ExecutableKnown(libpf.FileID) bool          { return f.known }
+func (f *fakeReporter) ExecutableMetadata(*ExecutableMetadataArgs) {}
+func (f *fakeReporter) FrameKnown(libpf.FrameID) bool              { return f.known }
+
+func (f *fakeReporter) FrameMetadata(*FrameMetadataArgs) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frames++
+}
+
+func (f *fakeReporter) ReportHostMetadata(map[string]string) {}
+
+func (f *fakeReporter) ReportHostMetadataBlocking(context.Context, map[string]string,
+	int, time.Duration) error {
+	return f.hostErr
+}
+
+func (f *fakeReporter) receivedTraces() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.received
+}
+
+func (f *fakeReporter) counts() (traces, frames int, stopped bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.traces, f.frames, f.stopped
+}
+
+func TestMultiReporterIsolation(t *testing.T) {
+	fast := &fakeReporter{}
+	slow := &fakeReporter{block: make(chan libpf.Void)}
+	r, err := NewMulti(fast, slow)
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background()))
+
+	// Fill the queue of the slow reporter while it blocks on the first event. The
+	// fast reporter drains its queue in the meantime.
+	for range multiQueueSize {
+		require.NoError(t, r.ReportTraceEvent(&libpf.Trace{}, &samples.TraceEventMeta{}))
+	}
+	require.Eventually(t, func() bool {
+		traces, _, _ := fast.counts()
+		return traces == multiQueueSize && slow.receivedTraces() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The slow reporter must not block the fast one, even once its queue is full.
+	events := multiQueueSize + 10
+	for range events - multiQueueSize {
+		require.NoError(t, r.ReportTraceEvent(&libpf.Trace{}, &samples.TraceEventMeta{}))
+	}
+	r.FrameMetadata(&FrameMetadataArgs{})
+	require.Eventually(t, func() bool {
+		traces, frames, _ := fast.counts()
+		return traces == events && frames == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(slow.block)
+	r.Stop()
+
+	traces, frames, stopped := fast.counts()
+	assert.Equal(t, events, traces)
+	assert.Equal(t, 1, frames)
+	assert.True(t, stopped)
+
+	// One event is in progress, the queue is full and the rest is dropped.
+	traces, frames, stopped = slow.counts()
+	assert.Equal(t, multiQueueSize+1, traces)
+	assert.Zero(t, frames)
+	assert.True(t, stopped)
+
+	// Calls after Stop are dropped.
+	require.Error(t, r.ReportTraceEvent(&libpf.Trace{}, &samples.TraceEventMeta{}))
+}
+
+func TestMultiReporterKnown(t *testing.T) {
+	r, err := NewMulti(&fakeReporter{known: true}, &fakeReporter{})
+	require.NoError(t, err)
+	assert.False(t, r.ExecutableKnown(libpf.FileID{}))
+	assert.False(t, r.FrameKnown(libpf.FrameID{}))
+
+	r, err = NewMulti(&fakeReporter{known: true}, &fakeReporter{known: true})
+	require.NoError(t, err)
+	assert.True(t, r.ExecutableKnown(libpf.FileID{}))
+	assert.True(t, r.FrameKnown(libpf.FrameID{}))
+}
+
+func TestMultiReporterStop(t *testing.T) {
+	child := &fakeReporter{}
+	r, err := NewMulti(child)
+	require.NoError(t, err)
+
+	// Stop returns if Start was not called.
+	r.Stop()
+	_, _, stopped := child.counts()
+	assert.False(t, stopped)
+
+	r, err = NewMulti(child)
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background()))
+	r.Stop()
+	_, _, stopped = child.counts()
+	assert.True(t, stopped)
+	// Stop can be called again.
+	r.Stop()
+}
+
+func TestMultiReporterErrors(t *testing.T) {
+	errHost := errors.New("host metadata failed")
+	started := &fakeReporter{}
+	r, err := NewMulti(started, &fakeReporter{startErr: errors.New("start failed"),
+		hostErr: errHost})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, r.ReportHostMetadataBlocking(context.Background(), nil, 1, 0),
+		errHost)
+
+	require.Error(t, r.Start(context.Background()))
+	_, _, stopped := started.counts()
+	assert.True(t, stopped)
+	// Stop returns without children to stop after a failed Start.
+	r.Stop()
+
+	_, err = NewMulti()
+	require.Error(t, err)
+}
@@ -0,0 +1,226 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+)
+
+// OTLPProtocol defines the transport and encoding used by OTLPReporter.
+type OTLPProtocol string
+
+const (
+	// OTLPProtocolGRPC sends profiles via OTLP/gRPC. This is the default.
+	OTLPProtocolGRPC OTLPProtocol = "grpc"
+	// OTLPProtocolHTTPProtobuf sends protobuf encoded profiles via OTLP/HTTP.
+	OTLPProtocolHTTPProtobuf OTLPProtocol = "http/protobuf"
+	// OTLPProtocolHTTPJSON sends JSON encoded profiles via OTLP/HTTP.
+	OTLPProtocolHTTPJSON OTLPProtocol = "http/json"
+)
+
+// otlpHTTPProfilesPath is the URL path OTLP/HTTP profiles are sent to.
+const otlpHTTPProfilesPath = "/v1development/profiles"
+
+// maxHTTPErrorBodySize limits how much of an error response is included in errors.
+const maxHTTPErrorBodySize = 1024
+
+// httpRetryMinBackoff is the time before the first retry of a failed OTLP/HTTP request.
+// It doubles with every further retry.
+const httpRetryMinBackoff = 500 * time.Millisecond
+
+// errRetryable marks failed OTLP/HTTP requests that can be retried.
+var errRetryable = errors.New("retryable")
+
+// otlpHTTPClient sends OTLP export requests via HTTP.
+type otlpHTTPClient struct {
+	client *http.Client
+
+	// url is the full URL of the profiles endpoint.
+	url string
+
+	// contentType is either application/x-protobuf or application/json.
+	contentType string
+	// marshal encodes the export request according to contentType.
+	marshal func(pprofileotlp.ExportRequest) ([]byte, error)
+
+	headers  map[string]string
+	compress bool
+
+	maxRetries       uint32
+	minBackoff       time.Duration
+	operationTimeout time.Duration
+	// retryTimeout bounds the time in which retries of an export start, so that a
+	// failing export does not hold back the next reports for long.
+	retryTimeout time.Duration
+}
+
+// newOTLPHTTPClient returns an OTLP/HTTP client configured by cfg.
+func newOTLPHTTPClient(cfg *Config) (*otlpHTTPClient, error) {
+	c := &otlpHTTPClient{
+		url:              otlpHTTPURL(cfg.CollAgentAddr, cfg.DisableTLS),
+		headers:          cfg.HTTPHeaders,
+		compress:         !cfg.DisableHTTPCompression,
+		maxRetries:       cfg.MaxGRPCRetries,
+		minBackoff:       httpRetryMinBackoff,
+		operationTimeout: cfg.GRPCOperationTimeout,
+		retryTimeout:     max(cfg.ReportInterval, cfg.GRPCOperationTimeout),
+	}
+
+	switch cfg.OTLPProtocol {
+	case OTLPProtocolHTTPProtobuf:
+		c.contentType = "application/x-protobuf"
+		c.marshal = pprofileotlp.ExportRequest.MarshalProto
+	case OTLPProtocolHTTPJSON:
+		c.contentType = "application/json"
+		c.marshal = pprofileotlp.ExportRequest.MarshalJSON
+	default:
+		return nil, fmt.Errorf("unsupported OTLP/HTTP protocol: %s", cfg.OTLPProtocol)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout: cfg.GRPCConnectionTimeout,
+	}).DialContext
+	transport.TLSHandshakeTimeout = cfg.GRPCConnectionTimeout
+	if !cfg.DisableTLS {
+		transport.TLSClientConfig = &tls.Config{
+			// Support only TLS1.3+ with valid CA certificates
+			MinVersion:         tls.VersionTLS13,
+			InsecureSkipVerify: false,
+		}
+	}
+	c.client = &http.Client{Transport: transport}
+
+	return c, nil
+}
+
+// otlpHTTPURL returns the URL of the profiles endpoint for addr. addr is either
+// in the format of host:port or a URL including the scheme.
+func otlpHTTPURL(addr string, disableTLS bool) string {
+	if !strings.Contains(addr, "://") {
+		scheme := "https://"
+		if disableTLS {
+			scheme = "http://"
+		}
+		addr = scheme + addr
+	}
+	return strings.TrimSuffix(addr, "/") + otlpHTTPProfilesPath
+}
+
+// Export sends req to the profiles endpoint. Failed requests that are retryable
+// are retried up to maxRetries times with exponential backoff. Retries only start
+// within retryTimeout after the first request.
+func (c *otlpHTTPClient) Export(ctx context.Context, req pprofileotlp.ExportRequest) error {
+	body, err := c.encode(req)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(c.retryTimeout)
+	backoff := c.minBackoff
+	var retries uint32
+	for {
+		err = c.send(ctx, body)
+		if err == nil || !errors.Is(err, errRetryable) || retries >= c.maxRetries {
+			return err
+		}
+		// Sleep with the backoff time added of +/- 20% jitter.
+		wait := libpf.AddJitter(backoff, 0.2)
+		if time.Until(deadline) < wait {
+			return err
+		}
+		retries++
+		backoff *= 2
+
+		log.Warnf("Failed to send OTLP/HTTP request (try %d of %d): %v",
+			retries, c.maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// encode marshals req and compresses it if enabled.
+func (c *otlpHTTPClient) encode(req pprofileotlp.ExportRequest) ([]byte, error) {
+	data, err := c.marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export request: %v", err)
+	}
+	if !c.compress {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send makes a single POST request with the encoded body.
+func (c *otlpHTTPClient) send(ctx context.Context, body []byte) error {
+	reqCtx, cancel := context.WithTimeout(ctx, c.operationTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, c.url,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range c.headers {
+		httpReq.Header.Set(key, value)
+	}
+	httpReq.Header.Set("Content-Type", c.contentType)
+	if c.compress {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		// Network errors and timeouts of a single request are transient.
+		return fmt.Errorf("%w: %v", errRetryable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// Drain the body to allow reuse of the connection.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBodySize))
+	err = fmt.Errorf("OTLP/HTTP request failed with status %s: %s",
+		resp.Status, bytes.TrimSpace(msg))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		// As defined by the OTLP/HTTP specification.
+		return fmt.Errorf("%w: %v", errRetryable, err)
+	}
+	return err
+}
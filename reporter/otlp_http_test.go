@@ -0,0 +1,150 @@
+package reporter
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+)
+
+func TestOTLPHTTPURL(t *testing.T) {
+	tests := map[string]struct {
+		addr       string
+		disableTLS bool
+		want       string
+	}{
+		"tls": {
+			addr: "localhost:4318",
+			want: "https://localhost:4318/v1development/profiles",
+		},
+		"plaintext": {
+			addr:       "localhost:4318",
+			disableTLS: true,
+			want:       "http://localhost:4318/v1development/profiles",
+		},
+		"url": {
+			addr: "http://proxy/otlp/",
+			want: "http://proxy/otlp/v1development/profiles",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, otlpHTTPURL(tc.addr, tc.disableTLS))
+		})
+	}
+}
+
+func TestOTLPHTTPClientExport(t *testing.T) {
+	for _, protocol := range []OTLPProtocol{OTLPProtocolHTTPProtobuf, OTLPProtocolHTTPJSON} {
+		t.Run(string(protocol), func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+				requests++
+				assert.Equal(t, "/v1development/profiles", r.URL.Path)
+				assert.Equal(t, "secret", r.Header.Get("Authorization"))
+				assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+				zr, err := gzip.NewReader(r.Body)
+				require.NoError(t, err)
+				body, err := io.ReadAll(zr)
+				require.NoError(t, err)
+
+				req := pprofileotlp.NewExportRequest()
+				if protocol == OTLPProtocolHTTPJSON {
+					assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+					require.NoError(t, req.UnmarshalJSON(body))
+				} else {
+					assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+					require.NoError(t, req.UnmarshalProto(body))
+				}
+				assert.Equal(t, 1, req.Profiles().ResourceProfiles().Len())
+
+				// Fail the first request with a retryable error.
+				if requests == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c, err := newOTLPHTTPClient(&Config{
+				CollAgentAddr:         srv.URL,
+				OTLPProtocol:          protocol,
+				HTTPHeaders:           map[string]string{"Authorization": "secret"},
+				MaxGRPCRetries:        1,
+				GRPCOperationTimeout:  time.Second,
+				GRPCConnectionTimeout: time.Second,
+			})
+			require.NoError(t, err)
+			c.minBackoff = time.Millisecond
+
+			profiles := pprofile.NewProfiles()
+			profiles.ResourceProfiles().AppendEmpty()
+			require.NoError(t, c.Export(context.Background(),
+				pprofileotlp.NewExportRequestFromProfiles(profiles)))
+			assert.Equal(t, 2, requests)
+		})
+	}
+}
+
+func TestOTLPHTTPClientExportRetryTimeout(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, err := newOTLPHTTPClient(&Config{
+		CollAgentAddr:         srv.URL,
+		OTLPProtocol:          OTLPProtocolHTTPProtobuf,
+		MaxGRPCRetries:        100,
+		GRPCOperationTimeout:  100 * time.Millisecond,
+		GRPCConnectionTimeout: time.Second,
+		ReportInterval:        200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, c.retryTimeout)
+	c.minBackoff = 10 * time.Millisecond
+
+	// The backoff doubles from 10ms, so that only the retries after about 10ms,
+	// 30ms, 70ms and 150ms start within the retry timeout.
+	start := time.Now()
+	require.Error(t, c.Export(context.Background(), pprofileotlp.NewExportRequest()))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.GreaterOrEqual(t, requests, 3)
+	assert.LessOrEqual(t, requests, 6)
+}
+
+func TestOTLPHTTPClientExportPermanentError(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		http.Error(w, "invalid profile", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c, err := newOTLPHTTPClient(&Config{
+		CollAgentAddr:          srv.URL,
+		OTLPProtocol:           OTLPProtocolHTTPProtobuf,
+		DisableHTTPCompression: true,
+		MaxGRPCRetries:         3,
+		GRPCOperationTimeout:   time.Second,
+		GRPCConnectionTimeout:  time.Second,
+	})
+	require.NoError(t, err)
+
+	err = c.Export(context.Background(), pprofileotlp.NewExportRequest())
+	require.ErrorContains(t, err, "invalid profile")
+	assert.Equal(t, 1, requests)
+}
@@ -6,6 +6,7 @@ package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
 import (
 	"context"
 	"crypto/tls"
+	"sync"
 	"time"
 
 	lru "github.com/elastic/go-freelru"
@@ -19,6 +20,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/libpf/xsync"
 	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/spool"
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
 )
 
@@ -31,9 +33,25 @@ var gzipOption = grpc.UseCompressor(gzip.Name)
 type OTLPReporter struct {
 	*baseReporter
 
+	// clientMu protects conn, client and httpClient, which are replaced on Reconnect.
+	clientMu sync.RWMutex
+
+	// conn is the gRPC connection of client, nil if profiles are sent via OTLP/HTTP.
+	conn *grpc.ClientConn
+
 	// client for the connection to the receiver.
 	client pprofileotlp.GRPCClient
 
+	// httpClient sends profiles via OTLP/HTTP instead of client, if set.
+	httpClient *otlpHTTPClient
+
+	// spool holds the reports on disk until they are sent, if configured.
+	spool *spool.Spool
+	// spoolBackoff is the current delay between replay attempts of spool.
+	spoolBackoff time.Duration
+	// spoolRetryAt is the earliest time for the next replay attempt of spool.
+	spoolRetryAt time.Time
+
 	// To fill in the OTLP/profiles signal with the relevant information,
 	// this structure holds in long-term storage information that might
 	// be duplicated in other places but not accessible for OTLPReporter.
@@ -54,6 +72,7 @@ func NewOTLP(cfg *Config) (*OTLPReporter, error) {
 
 	data, err := pdata.New(
 		cfg.SamplesPerSecond,
+		cfg.AllocSampleInterval,
 		cfg.ExecutablesCacheElements,
 		cfg.FramesCacheElements,
 		cfg.ExtraSampleAttrProd,
@@ -62,6 +81,28 @@ func NewOTLP(cfg *Config) (*OTLPReporter, error) {
 		return nil, err
 	}
 
+	var httpClient *otlpHTTPClient
+	switch cfg.OTLPProtocol {
+	case "", OTLPProtocolGRPC:
+	default:
+		if httpClient, err = newOTLPHTTPClient(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var reportSpool *spool.Spool
+	if cfg.SpoolDir != "" {
+		reportSpool, err = spool.New(cfg.SpoolDir, cfg.SpoolMaxSize, cfg.SpoolMaxAge)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	allocs, err := newAllocTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	eventsTree := make(samples.TraceEventsTree)
 
 	return &OTLPReporter{
@@ -71,6 +112,7 @@ func NewOTLP(cfg *Config) (*OTLPReporter, error) {
 			version:      cfg.Version,
 			pdata:        data,
 			traceEvents:  xsync.NewRWMutex(eventsTree),
+			allocs:       allocs,
 			hostmetadata: hostmetadata,
 			runLoop: &runLoop{
 				stopSignal: make(chan libpf.Void),
@@ -78,11 +120,17 @@ func NewOTLP(cfg *Config) (*OTLPReporter, error) {
 		},
 		pkgGRPCOperationTimeout: cfg.GRPCOperationTimeout,
 		client:                  nil,
+		httpClient:              httpClient,
+		spool:                   reportSpool,
 	}, nil
 }
 
 // Start sets up and manages the reporting connection to a OTLP backend.
 func (r *OTLPReporter) Start(ctx context.Context) error {
+	if r.httpClient != nil {
+		return r.startHTTP(ctx)
+	}
+
 	// Create a child context for reporting features
 	ctx, cancelReporting := context.WithCancel(ctx)
 
@@ -95,7 +143,10 @@ func (r *OTLPReporter) Start(ctx context.Context) error {
 		r.runLoop.Stop()
 		return err
 	}
+	r.clientMu.Lock()
+	r.conn = otlpGrpcConn
 	r.client = pprofileotlp.NewGRPCClient(otlpGrpcConn)
+	r.clientMu.Unlock()
 
 	r.runLoop.Start(ctx, r.cfg.ReportInterval, func() {
 		if err := r.reportOTLPProfile(ctx); err != nil {
@@ -112,7 +163,35 @@ func (r *OTLPReporter) Start(ctx context.Context) error {
 	go func() {
 		<-r.runLoop.stopSignal
 		cancelReporting()
-		if err := otlpGrpcConn.Close(); err != nil {
+		if err := r.closeClients(); err != nil {
+			log.Fatalf("Stopping connection of OTLP client client failed: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// startHTTP starts reporting via OTLP/HTTP. Unlike gRPC, there is no connection
+// to establish upfront.
+func (r *OTLPReporter) startHTTP(ctx context.Context) error {
+	// Create a child context for reporting features
+	ctx, cancelReporting := context.WithCancel(ctx)
+
+	r.runLoop.Start(ctx, r.cfg.ReportInterval, func() {
+		if err := r.reportOTLPProfile(ctx); err != nil {
+			log.Errorf("Request failed: %v", err)
+		}
+	}, func() {
+		// Allow the GC to purge expired entries to avoid memory leaks.
+		r.pdata.Purge()
+	})
+
+	// When Stop() is called and a signal to 'stop' is received, cancel the
+	// reporting functions currently running and close idle connections.
+	go func() {
+		<-r.runLoop.stopSignal
+		cancelReporting()
+		if err := r.closeClients(); err != nil {
 			log.Fatalf("Stopping connection of OTLP client client failed: %v", err)
 		}
 	}()
@@ -120,13 +199,59 @@ func (r *OTLPReporter) Start(ctx context.Context) error {
 	return nil
 }
 
+// Reconnect connects to the collection agent of cfg with the protocol, TLS setting and
+// headers of cfg. Once connected, it replaces the current connection and closes it, so
+// that an export in flight on the current connection may fail.
+func (r *OTLPReporter) Reconnect(ctx context.Context, cfg *Config) error {
+	var conn *grpc.ClientConn
+	var client pprofileotlp.GRPCClient
+	var httpClient *otlpHTTPClient
+	var err error
+	switch cfg.OTLPProtocol {
+	case "", OTLPProtocolGRPC:
+		if conn, err = setupGrpcConnection(ctx, cfg); err != nil {
+			return err
+		}
+		client = pprofileotlp.NewGRPCClient(conn)
+	default:
+		if httpClient, err = newOTLPHTTPClient(cfg); err != nil {
+			return err
+		}
+	}
+
+	r.clientMu.Lock()
+	oldConn, oldHTTPClient := r.conn, r.httpClient
+	r.conn, r.client, r.httpClient = conn, client, httpClient
+	r.clientMu.Unlock()
+
+	if err = closeOTLPClients(oldConn, oldHTTPClient); err != nil {
+		log.Warnf("Failed to close previous OTLP connection: %v", err)
+	}
+	return nil
+}
+
+// closeClients closes the connections of the current clients.
+func (r *OTLPReporter) closeClients() error {
+	r.clientMu.RLock()
+	defer r.clientMu.RUnlock()
+	return closeOTLPClients(r.conn, r.httpClient)
+}
+
+// closeOTLPClients closes the connections of the gRPC connection conn and the OTLP/HTTP
+// client httpClient, either of which may be nil.
+func closeOTLPClients(conn *grpc.ClientConn, httpClient *otlpHTTPClient) error {
+	if httpClient != nil {
+		httpClient.client.CloseIdleConnections()
+	}
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
 // reportOTLPProfile creates and sends out an OTLP profile.
 func (r *OTLPReporter) reportOTLPProfile(ctx context.Context) error {
-	traceEventsPtr := r.traceEvents.WLock()
-	reportedEvents := (*traceEventsPtr)
-	newEvents := make(samples.TraceEventsTree)
-	*traceEventsPtr = newEvents
-	r.traceEvents.WUnlock(&traceEventsPtr)
+	reportedEvents := r.takeTraceEvents()
 
 	profiles, err := r.pdata.Generate(reportedEvents, r.name, r.version)
 	if err != nil {
@@ -135,14 +260,33 @@ func (r *OTLPReporter) reportOTLPProfile(ctx context.Context) error {
 	}
 	if profiles.SampleCount() == 0 {
 		log.Debugf("Skip sending of OTLP profile with no samples")
+		if r.spool != nil {
+			return r.replaySpool(ctx)
+		}
 		return nil
 	}
 
 	req := pprofileotlp.NewExportRequestFromProfiles(profiles)
+	if r.spool != nil {
+		return r.spoolAndReplay(ctx, req)
+	}
+	return r.export(ctx, req)
+}
+
+// export sends req to the backend.
+func (r *OTLPReporter) export(ctx context.Context, req pprofileotlp.ExportRequest) error {
+	r.clientMu.RLock()
+	client, httpClient := r.client, r.httpClient
+	r.clientMu.RUnlock()
+
+	if httpClient != nil {
+		// The HTTP client applies the operation timeout to each attempt.
+		return httpClient.Export(ctx, req)
+	}
 
 	reqCtx, ctxCancel := context.WithTimeout(ctx, r.pkgGRPCOperationTimeout)
 	defer ctxCancel()
-	_, err = r.client.Export(reqCtx, req, gzipOption)
+	_, err := client.Export(reqCtx, req, gzipOption)
 	return err
 }
 
@@ -0,0 +1,124 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/metrics"
+)
+
+// spoolMaxBackoff is the upper limit for the delay between replay attempts of
+// the spool. The lower limit is the report interval.
+const spoolMaxBackoff = 5 * time.Minute
+
+// spoolAndReplay stores req in the spool and replays the spool afterwards.
+// If req can not be stored, it is sent directly instead.
+func (r *OTLPReporter) spoolAndReplay(ctx context.Context,
+	req pprofileotlp.ExportRequest) error {
+	data, err := req.MarshalProto()
+	if err == nil {
+		err = r.spool.Push(data, time.Now())
+	}
+	if err != nil {
+		log.Warnf("Failed to spool report, sending it directly: %v", err)
+		if err = r.export(ctx, req); err != nil {
+			return err
+		}
+	}
+	return r.replaySpool(ctx)
+}
+
+// replaySpool sends the spooled reports in order, oldest first. After a failed
+// export, further attempts are delayed with exponential backoff.
+func (r *OTLPReporter) replaySpool(ctx context.Context) error {
+	defer r.reportSpoolMetrics()
+
+	if time.Now().Before(r.spoolRetryAt) {
+		return nil
+	}
+
+	for {
+		data, ok, err := r.spool.Front(time.Now())
+		if err != nil || !ok {
+			return err
+		}
+
+		req := pprofileotlp.NewExportRequest()
+		if err = req.UnmarshalProto(data); err != nil {
+			log.Warnf("Dropping corrupted spooled report: %v", err)
+			if err = r.spool.Drop(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = r.export(ctx, req); err != nil {
+			if !isRetryableExportError(err) {
+				log.Warnf("Dropping spooled report rejected by the backend: %v", err)
+				if err = r.spool.Drop(); err != nil {
+					return err
+				}
+				continue
+			}
+			r.spoolBackoff = min(max(2*r.spoolBackoff, r.cfg.ReportInterval),
+				spoolMaxBackoff)
+			r.spoolRetryAt = time.Now().Add(libpf.AddJitter(r.spoolBackoff, 0.2))
+			return fmt.Errorf("%d reports spooled, retrying in %v: %v",
+				r.spool.Len(), r.spoolBackoff, err)
+		}
+
+		r.spoolBackoff = 0
+		if err = r.spool.Pop(); err != nil {
+			return err
+		}
+	}
+}
+
+// reportSpoolMetrics reports the state of the spool.
+func (r *OTLPReporter) reportSpoolMetrics() {
+	metrics.AddSlice([]metrics.Metric{
+		{
+			ID:    metrics.IDReporterSpoolBatches,
+			Value: metrics.MetricValue(r.spool.Len()),
+		},
+		{
+			ID:    metrics.IDReporterSpoolSize,
+			Value: metrics.MetricValue(r.spool.Size()),
+		},
+		{
+			ID:    metrics.IDReporterSpoolDroppedBatches,
+			Value: metrics.MetricValue(r.spool.TakeDropped()),
+		},
+	})
+}
+
+// isRetryableExportError returns true if an export that failed with err
+// may succeed at a later point.
+func isRetryableExportError(err error) bool {
+	if errors.Is(err, errRetryable) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	// As defined by the OTLP/gRPC specification.
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
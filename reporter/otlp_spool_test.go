@@ -0,0 +1,31 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryableExportError(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"http retryable":    {err: fmt.Errorf("%w: 503", errRetryable), want: true},
+		"http permanent":    {err: errors.New("400 Bad Request")},
+		"context canceled":  {err: context.Canceled, want: true},
+		"grpc unavailable":  {err: status.Error(codes.Unavailable, ""), want: true},
+		"grpc invalid":      {err: status.Error(codes.InvalidArgument, "")},
+		"grpc unauthorized": {err: status.Error(codes.Unauthenticated, "")},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isRetryableExportError(tc.err))
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/elastic/go-freelru"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/xsync"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pdata"
+	"go.opentelemetry.io/ebpf-profiler/reporter/internal/pprof"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// Assert that we implement the full Reporter interface.
+var _ Reporter = (*PprofReporter)(nil)
+
+const (
+	// pprofFilePrefix and pprofFileSuffix enclose the names of all files written
+	// by PprofReporter. Only files matching both are considered for rotation.
+	pprofFilePrefix = "profile-"
+	pprofFileSuffix = ".pb.gz"
+
+	// pprofTimeFormat is used for the timestamp in file names. It sorts
+	// lexicographically in chronological order.
+	pprofTimeFormat = "20060102T150405.000Z"
+)
+
+// pprofOrigins maps the reported trace origins to the file name component
+// used for their profiles.
+var pprofOrigins = []struct {
+	origin libpf.Origin
+	name   string
+}{
+	{origin: support.TraceOriginSampling, name: "cpu"},
+	{origin: support.TraceOriginOffCPU, name: "offcpu"},
+	{origin: support.TraceOriginPageFaults, name: "page-faults"},
+	{origin: support.TraceOriginContextSwitches, name: "context-switches"},
+	{origin: support.TraceOriginCacheMisses, name: "cache-misses"},
+	{origin: support.TraceOriginBranchMisses, name: "branch-misses"},
+	{origin: support.TraceOriginUprobe, name: "uprobe"},
+	{origin: support.TraceOriginAlloc, name: "alloc"},
+	{origin: support.TraceOriginAllocInUse, name: "inuse"},
+	{origin: support.TraceOriginContention, name: "contention"},
+	{origin: support.TraceOriginRunQueue, name: "runqueue"},
+	{origin: support.TraceOriginWakeup, name: "wakeup"},
+}
+
+// PprofReporter writes profiles as gzip compressed pprof profile.proto files
+// to a local directory. Each report interval produces one file per trace origin.
+// Alternatively, all trace events are written to a single file per trace origin
+// when the reporter is stopped.
+type PprofReporter struct {
+	*baseReporter
+
+	// dir is the directory the profiles are written to.
+	dir string
+
+	// file is the file the profiles are written to when the reporter is stopped,
+	// empty if they are written to dir periodically.
+	file string
+
+	// maxFiles limits the number of profile files kept in dir. 0 means no limit.
+	maxFiles int
+
+	// maxTotalSize limits the total size in bytes of profile files kept in dir.
+	// 0 means no limit.
+	maxTotalSize int64
+
+	// writeMu serializes writing and rotation of profile files.
+	writeMu sync.Mutex
+}
+
+// NewPprof returns a new instance of PprofReporter.
+func NewPprof(cfg *Config) (*PprofReporter, error) {
+	if cfg.PprofOutputDir == "" && cfg.PprofOutputFile == "" {
+		return nil, errors.New("no pprof output directory or file configured")
+	}
+	dir := cfg.PprofOutputDir
+	if cfg.PprofOutputFile != "" {
+		dir = filepath.Dir(cfg.PprofOutputFile)
+	}
+
+	// Next step: Dynamically configure the size of this LRU.
+	// Currently, we use the length of the JSON array in
+	// hostmetadata/hostmetadata.json.
+	hostmetadata, err := lru.NewSynced[string, string](115, hashString)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := pdata.New(
+		cfg.SamplesPerSecond,
+		cfg.AllocSampleInterval,
+		cfg.ExecutablesCacheElements,
+		cfg.FramesCacheElements,
+		cfg.ExtraSampleAttrProd,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, err := newAllocTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(samples.TraceEventsTree)
+
+	return &PprofReporter{
+		baseReporter: &baseReporter{
+			cfg:          cfg,
+			name:         cfg.Name,
+			version:      cfg.Version,
+			pdata:        data,
+			traceEvents:  xsync.NewRWMutex(tree),
+			allocs:       allocs,
+			hostmetadata: hostmetadata,
+			runLoop: &runLoop{
+				stopSignal: make(chan libpf.Void),
+			},
+		},
+		dir:          dir,
+		file:         cfg.PprofOutputFile,
+		maxFiles:     cfg.PprofMaxFiles,
+		maxTotalSize: cfg.PprofMaxTotalSize,
+	}, nil
+}
+
+// Start creates the output directory and starts writing profiles periodically.
+func (r *PprofReporter) Start(ctx context.Context) error {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create pprof output directory: %v", err)
+	}
+	if r.file != "" {
+		// All trace events are written when the reporter is stopped.
+		return nil
+	}
+
+	r.runLoop.Start(ctx, r.cfg.ReportInterval, func() {
+		if err := r.reportProfiles(time.Now()); err != nil {
+			log.Errorf("Writing pprof profiles failed: %v", err)
+		}
+	}, func() {
+		// Allow the GC to purge expired entries to avoid memory leaks.
+		r.pdata.Purge()
+	})
+
+	return nil
+}
+
+// Stop stops the periodic writing and flushes all pending trace events to disk.
+func (r *PprofReporter) Stop() {
+	r.runLoop.Stop()
+	report := r.reportProfiles
+	if r.file != "" {
+		report = r.reportFile
+	}
+	if err := report(time.Now()); err != nil {
+		log.Errorf("Writing pprof profiles failed: %v", err)
+	}
+}
+
+// reportFile writes the trace events collected since the last call to file. The
+// profile of on-CPU traces is written to file, the profiles of other trace origins
+// to files whose names have the origin appended.
+func (r *PprofReporter) reportFile(_ time.Time) error {
+	reportedEvents := r.takeTraceEvents()
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	base := strings.TrimSuffix(r.file, pprofFileSuffix)
+	var errs error
+	var written bool
+	for _, o := range pprofOrigins {
+		profile, err := pprof.Generate(r.pdata, reportedEvents, o.origin,
+			r.cfg.SamplesPerSecond)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if profile == nil {
+			continue
+		}
+		path := r.file
+		if o.origin != support.TraceOriginSampling {
+			path = base + "-" + o.name + pprofFileSuffix
+		}
+		if err := r.writeProfile(path, profile); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		log.Infof("Wrote %s profile to %s", o.name, path)
+		written = true
+	}
+	if !written && errs == nil {
+		return errors.New("no samples were collected")
+	}
+	return errs
+}
+
+// reportProfiles writes the trace events collected since the last call to disk.
+func (r *PprofReporter) reportProfiles(now time.Time) error {
+	reportedEvents := r.takeTraceEvents()
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	var errs error
+	for _, o := range pprofOrigins {
+		profile, err := pprof.Generate(r.pdata, reportedEvents, o.origin,
+			r.cfg.SamplesPerSecond)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if profile == nil {
+			log.Debugf("Skip writing %s pprof profile with no samples", o.name)
+			continue
+		}
+		fileName := fmt.Sprintf("%s%s-%s%s", pprofFilePrefix,
+			now.UTC().Format(pprofTimeFormat), o.name, pprofFileSuffix)
+		if err := r.writeProfile(filepath.Join(r.dir, fileName), profile); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	if err := r.rotate(); err != nil {
+		errs = errors.Join(errs, err)
+	}
+	return errs
+}
+
+// writeProfile atomically writes profile to path.
+func (r *PprofReporter) writeProfile(path string, profile *pprof.Profile) error {
+	tmp, err := os.CreateTemp(r.dir, ".tmp-"+pprofFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = profile.Write(tmp); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to encode %s: %v", path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rotate removes the oldest profile files until the configured limits for
+// file count and total size are met. The newest file is always kept, even if
+// it alone exceeds the total size limit.
+func (r *PprofReporter) rotate() error {
+	if r.maxFiles <= 0 && r.maxTotalSize <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	type profileFile struct {
+		name string
+		size int64
+	}
+	files := make([]profileFile, 0, len(entries))
+	var totalSize int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, pprofFilePrefix) ||
+			!strings.HasSuffix(name, pprofFileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// The file might have been removed in the meantime.
+			continue
+		}
+		files = append(files, profileFile{name: name, size: info.Size()})
+		totalSize += info.Size()
+	}
+
+	// File names start with a sortable timestamp, so the oldest files come first.
+	slices.SortFunc(files, func(a, b profileFile) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	var errs error
+	for len(files) > 1 &&
+		((r.maxFiles > 0 && len(files) > r.maxFiles) ||
+			(r.maxTotalSize > 0 && totalSize > r.maxTotalSize)) {
+		if err := os.Remove(filepath.Join(r.dir, files[0].name)); err != nil &&
+			!errors.Is(err, os.ErrNotExist) {
+			errs = errors.Join(errs, err)
+		}
+		log.Debugf("Removed pprof profile %s", files[0].name)
+		totalSize -= files[0].size
+		files = files[1:]
+	}
+	return errs
+}
@@ -0,0 +1,156 @@
+package reporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// newTestPprofTrace returns a trace with a single native frame.
+func newTestPprofTrace() *libpf.Trace {
+	return &libpf.Trace{
+		Files:              []libpf.FileID{libpf.NewFileID(1, 1)},
+		Linenos:            []libpf.AddressOrLineno{0x42},
+		FrameTypes:         []libpf.FrameType{libpf.NativeFrame},
+		MappingStart:       []libpf.Address{0},
+		MappingEnd:         []libpf.Address{0x1000},
+		MappingFileOffsets: []uint64{0},
+		Hash:               libpf.NewTraceHash(1, 2),
+	}
+}
+
+// readDirNames returns the sorted names of the entries of dir.
+func readDirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestPprofReporterRotation(t *testing.T) {
+	tests := map[string]struct {
+		maxFiles     int
+		maxTotalSize int64
+		expected     []string
+	}{
+		"max files": {
+			maxFiles: 3,
+			expected: []string{
+				"profile-20231114T221322.000Z-offcpu.pb.gz",
+				"profile-20231114T221323.000Z-cpu.pb.gz",
+				"profile-20231114T221323.000Z-offcpu.pb.gz",
+			},
+		},
+		"newest file exceeds max total size": {
+			maxTotalSize: 1,
+			expected:     []string{"profile-20231114T221323.000Z-offcpu.pb.gz"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			r, err := NewPprof(&Config{
+				ExecutablesCacheElements: 1,
+				FramesCacheElements:      1,
+				SamplesPerSecond:         20,
+				PprofOutputDir:           dir,
+				PprofMaxFiles:            tc.maxFiles,
+				PprofMaxTotalSize:        tc.maxTotalSize,
+			})
+			require.NoError(t, err)
+
+			trace := newTestPprofTrace()
+			now := time.Unix(1700000000, 0)
+			for i := range 4 {
+				for _, origin := range []libpf.Origin{
+					support.TraceOriginSampling,
+					support.TraceOriginOffCPU,
+				} {
+					require.NoError(t, r.ReportTraceEvent(trace, &samples.TraceEventMeta{
+						Origin:    origin,
+						Timestamp: libpf.UnixTime64(now.UnixNano()),
+						OffTime:   1000,
+					}))
+				}
+				require.NoError(t, r.reportProfiles(now.Add(time.Duration(i)*time.Second)))
+			}
+
+			assert.Equal(t, tc.expected, readDirNames(t, dir))
+		})
+	}
+}
+
+func TestPprofReporterFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out", "record.pb.gz")
+	r, err := NewPprof(&Config{
+		ExecutablesCacheElements: 1,
+		FramesCacheElements:      1,
+		SamplesPerSecond:         20,
+		PprofOutputFile:          file,
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background()))
+
+	trace := newTestPprofTrace()
+	for _, origin := range []libpf.Origin{
+		support.TraceOriginSampling,
+		support.TraceOriginOffCPU,
+	} {
+		require.NoError(t, r.ReportTraceEvent(trace, &samples.TraceEventMeta{
+			Origin:  origin,
+			OffTime: 1000,
+		}))
+	}
+	r.Stop()
+
+	assert.Equal(t, []string{"record-offcpu.pb.gz", "record.pb.gz"},
+		readDirNames(t, filepath.Dir(file)))
+}
+
+func TestPprofReporterRunQueue(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewPprof(&Config{
+		ExecutablesCacheElements: 1,
+		FramesCacheElements:      1,
+		SamplesPerSecond:         20,
+		PprofOutputDir:           dir,
+	})
+	require.NoError(t, err)
+
+	trace := newTestPprofTrace()
+	for _, delay := range []int64{30000, 70000} {
+		require.NoError(t, r.ReportTraceEvent(trace, &samples.TraceEventMeta{
+			Origin:  support.TraceOriginRunQueue,
+			PID:     42,
+			TID:     43,
+			OffTime: delay,
+		}))
+	}
+
+	eventsTree := r.traceEvents.RLock()
+	events := (*eventsTree)[""][support.TraceOriginRunQueue]
+	r.traceEvents.RUnlock(&eventsTree)
+	require.Len(t, events, 1)
+	for key, traceEvents := range events {
+		assert.Equal(t, int64(43), key.Tid)
+		assert.Equal(t, []int64{30000, 70000}, traceEvents.OffTimes)
+	}
+
+	require.NoError(t, r.reportProfiles(time.Unix(1700000000, 0)))
+	assert.Equal(t, []string{"profile-20231114T221320.000Z-runqueue.pb.gz"},
+		readDirNames(t, dir))
+}
@@ -5,6 +5,7 @@ package reporter // import "go.opentelemetry.io/ebpf-profiler/reporter"
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/ebpf-profiler/libpf"
@@ -14,9 +15,13 @@ import (
 type runLoop struct {
 	// stopSignal is the stop signal for shutting down all background tasks.
 	stopSignal chan libpf.Void
+
+	// reportInterval is the interval between two runs.
+	reportInterval atomic.Int64
 }
 
 func (rl *runLoop) Start(ctx context.Context, reportInterval time.Duration, run, purge func()) {
+	rl.reportInterval.Store(int64(reportInterval))
 	go func() {
 		tick := time.NewTicker(reportInterval)
 		defer tick.Stop()
@@ -31,7 +36,8 @@ func (rl *runLoop) Start(ctx context.Context, reportInterval time.Duration, run,
 				return
 			case <-tick.C:
 				run()
-				tick.Reset(libpf.AddJitter(reportInterval, 0.2))
+				interval := time.Duration(rl.reportInterval.Load())
+				tick.Reset(libpf.AddJitter(interval, 0.2))
 			case <-purgeTick.C:
 				purge()
 			}
@@ -39,6 +45,11 @@ func (rl *runLoop) Start(ctx context.Context, reportInterval time.Duration, run,
 	}()
 }
 
+// SetInterval changes the interval between two runs, starting after the next run.
+func (rl *runLoop) SetInterval(reportInterval time.Duration) {
+	rl.reportInterval.Store(int64(reportInterval))
+}
+
 func (rl *runLoop) Stop() {
 	close(rl.stopSignal)
 }
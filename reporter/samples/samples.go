@@ -18,7 +18,15 @@ type TraceEventMeta struct {
 	CPU            int
 	Origin         libpf.Origin
 	OffTime        int64
-	EnvVars        map[string]string
+	Addr           uint64
+	TaskState      string
+	WaitChannel    string
+	// WakerPID, WakerTID and WakerHash identify the thread that woke up the task of
+	// off-cpu traces and the trace of its wakeup. WakerHash is zero if the wakeup
+	// trace is unknown.
+	WakerPID, WakerTID libpf.PID
+	WakerHash          libpf.TraceHash
+	EnvVars            map[string]string
 }
 
 // TraceEvents holds known information about a trace.
@@ -50,6 +58,21 @@ type TraceAndMetaKey struct {
 	ProcessName string
 	// Executable path is retrieved from /proc/PID/exe
 	ExecutablePath string
+	// LockAddr is the address of the contended lock of lock contention traces.
+	// Zero otherwise.
+	LockAddr uint64
+	// TaskState and WaitChannel describe why the task of off-cpu traces was off
+	// CPU. Empty otherwise.
+	TaskState   string
+	WaitChannel string
+	// WakerPid, WakerTid and WakerHash identify the waker of the task of off-cpu traces
+	// and its wakeup trace. Zero otherwise.
+	WakerPid  int64
+	WakerTid  int64
+	WakerHash libpf.TraceHash
+	// SamplePeriod is the effective sampling period in nanoseconds of sampling traces
+	// with adaptive sampling. Zero otherwise.
+	SamplePeriod int64
 
 	// ExtraMeta stores extra meta info that may have been produced by a
 	// `SampleAttrProducer` instance. May be nil.
@@ -86,4 +109,7 @@ type SourceInfo struct {
 	FunctionOffset uint32
 	FunctionName   libpf.String
 	FilePath       libpf.String
+	// MangledName is the original name of a demangled function. It is empty if
+	// FunctionName was not demangled.
+	MangledName libpf.String
 }
@@ -0,0 +1,191 @@
+// This file contains the code and map definitions for allocation profiling. The entry
+// points are attached to the allocation functions of the allocator libraries.
+
+#include "bpfdefs.h"
+#include "tracemgmt.h"
+#include "types.h"
+
+// alloc_pending holds the size of the sampled allocation that is in progress on a thread.
+// The key is the pid_tgid of the thread.
+bpf_map_def SEC("maps") alloc_pending = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(u64),
+  .max_entries = 4096,
+};
+
+// realloc_pending holds the pointer passed to a realloc that is in progress on a thread.
+// The key is the pid_tgid of the thread.
+bpf_map_def SEC("maps") realloc_pending = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(u64),
+  .max_entries = 4096,
+};
+
+// alloc_in_use holds the sampled allocations that are tracked until they are freed.
+bpf_map_def SEC("maps") alloc_in_use = {
+  .type        = BPF_MAP_TYPE_LRU_HASH,
+  .key_size    = sizeof(AllocKey),
+  .value_size  = sizeof(u8),
+  .max_entries = MAX_ALLOCS_IN_USE,
+};
+
+// alloc_frees reports the frees of tracked allocations to user space.
+bpf_map_def SEC("maps") alloc_frees = {
+  .type        = BPF_MAP_TYPE_PERF_EVENT_ARRAY,
+  .key_size    = sizeof(int),
+  .value_size  = sizeof(u32),
+  .max_entries = 0,
+};
+
+// alloc_sample decides whether an allocation of size bytes is sampled. Allocations are
+// sampled with a probability proportional to their size, so that on average one
+// allocation is sampled per alloc_sample_interval bytes. The size of a sampled
+// allocation is kept until the allocation function returns.
+static EBPF_INLINE void alloc_sample(u64 size)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg || syscfg->alloc_sample_interval == 0 || size == 0) {
+    return;
+  }
+
+  u64 interval = syscfg->alloc_sample_interval;
+  if (size < interval && (((u64)bpf_get_prandom_u32() * interval) >> 32) >= size) {
+    return;
+  }
+
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  if (!is_target_pid(pid_tgid >> 32) || is_denied_cgroup()) {
+    return;
+  }
+
+  bpf_map_update_elem(&alloc_pending, &pid_tgid, &size, BPF_ANY);
+}
+
+// alloc_free stops tracking the allocation at addr and reports its free to user space.
+static EBPF_INLINE void alloc_free(struct pt_regs *ctx, u64 addr)
+{
+  if (addr == 0) {
+    return;
+  }
+
+  AllocKey key = {
+    .addr = addr,
+    .pid  = bpf_get_current_pid_tgid() >> 32,
+  };
+  if (bpf_map_delete_elem(&alloc_in_use, &key) != 0) {
+    // The allocation is not tracked.
+    return;
+  }
+
+  AllocFree event = {
+    .key   = key,
+    .ktime = bpf_ktime_get_ns(),
+  };
+  bpf_perf_event_output(ctx, &alloc_frees, BPF_F_CURRENT_CPU, &event, sizeof(event));
+}
+
+// uprobe__malloc is the entry point of malloc(size).
+SEC("uprobe/malloc")
+int uprobe__malloc(struct pt_regs *ctx)
+{
+  alloc_sample(PT_REGS_PARM1(ctx));
+  return 0;
+}
+
+// uprobe__calloc is the entry point of calloc(nmemb, size).
+SEC("uprobe/calloc")
+int uprobe__calloc(struct pt_regs *ctx)
+{
+  alloc_sample(PT_REGS_PARM1(ctx) * PT_REGS_PARM2(ctx));
+  return 0;
+}
+
+// uprobe__realloc is the entry point of realloc(ptr, size). The previous allocation is
+// kept until realloc returns, as it stays valid if realloc fails.
+SEC("uprobe/realloc")
+int uprobe__realloc(struct pt_regs *ctx)
+{
+  u64 ptr = PT_REGS_PARM1(ctx);
+  if (ptr != 0) {
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_update_elem(&realloc_pending, &pid_tgid, &ptr, BPF_ANY);
+  }
+  alloc_sample(PT_REGS_PARM2(ctx));
+  return 0;
+}
+
+// uprobe__free is the entry point of free(ptr).
+SEC("uprobe/free")
+int uprobe__free(struct pt_regs *ctx)
+{
+  alloc_free(ctx, PT_REGS_PARM1(ctx));
+  return 0;
+}
+
+// alloc_return collects the trace of a sampled allocation when the allocation
+// function returns.
+static EBPF_INLINE int alloc_return(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u64 *pending = bpf_map_lookup_elem(&alloc_pending, &pid_tgid);
+  if (!pending) {
+    return 0;
+  }
+  u64 size = *pending;
+  bpf_map_delete_elem(&alloc_pending, &pid_tgid);
+
+  u64 addr = PT_REGS_RC(ctx);
+  if (addr == 0) {
+    // The allocation failed.
+    return 0;
+  }
+
+  u32 pid = pid_tgid >> 32;
+  u32 tid = pid_tgid & 0xFFFFFFFF;
+  u64 ts  = bpf_ktime_get_ns();
+
+  u64 tracked          = 0;
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (syscfg && syscfg->alloc_in_use) {
+    AllocKey alloc = {
+      .addr = addr,
+      .pid  = pid,
+    };
+    u8 val = 1;
+    if (bpf_map_update_elem(&alloc_in_use, &alloc, &val, BPF_ANY) == 0) {
+      tracked = addr;
+    }
+  }
+
+  DEBUG_PRINT("==== alloc %llu bytes at 0x%llx ====", size, addr);
+
+  return collect_trace(ctx, TRACE_ALLOC, pid, tid, ts, size, tracked, 0, NULL);
+}
+
+// uretprobe__alloc is the return point of malloc and calloc.
+SEC("uretprobe/alloc")
+int uretprobe__alloc(struct pt_regs *ctx)
+{
+  return alloc_return(ctx);
+}
+
+// uretprobe__realloc is the return point of realloc. The previous allocation is
+// considered freed if realloc succeeded, even if it returns the same address.
+SEC("uretprobe/realloc")
+int uretprobe__realloc(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u64 *ptr     = bpf_map_lookup_elem(&realloc_pending, &pid_tgid);
+  if (ptr) {
+    u64 prev = *ptr;
+    bpf_map_delete_elem(&realloc_pending, &pid_tgid);
+    if (PT_REGS_RC(ctx) != 0) {
+      alloc_free(ctx, prev);
+    }
+  }
+  return alloc_return(ctx);
+}
@@ -47,6 +47,11 @@ static inline u64 bpf_get_current_pid_tgid(void)
   return __cgo_ctx->id;
 }
 
+static inline u64 bpf_get_current_cgroup_id(void)
+{
+  return 0;
+}
+
 static inline void *bpf_map_lookup_elem(bpf_map_def *map, const void *key)
 {
   void *__bpf_map_lookup_elem(u64, bpf_map_def *, const void *);
@@ -69,6 +74,16 @@ static inline int bpf_perf_event_output(
   return 0;
 }
 
+static inline long bpf_ringbuf_output(bpf_map_def *ringbuf, void *data, u64 size, u64 flags)
+{
+  return 0;
+}
+
+static inline u32 bpf_get_smp_processor_id(void)
+{
+  return 0;
+}
+
 static inline int bpf_get_stackid(void *ctx, bpf_map_def *map, u64 flags)
 {
   return -1;
@@ -106,7 +121,14 @@ static int (*bpf_perf_event_output)(
   void *ctx, void *map, unsigned long long flags, void *data, int size) = (void *)
   BPF_FUNC_perf_event_output;
 static int (*bpf_get_stackid)(void *ctx, void *map, u64 flags) = (void *)BPF_FUNC_get_stackid;
+static long (*bpf_ringbuf_output)(void *ringbuf, void *data, u64 size, u64 flags) = (void *)
+  BPF_FUNC_ringbuf_output;
+static u32 (*bpf_get_smp_processor_id)(void) = (void *)BPF_FUNC_get_smp_processor_id;
 static unsigned long long (*bpf_get_prandom_u32)(void)         = (void *)BPF_FUNC_get_prandom_u32;
+static unsigned long long (*bpf_get_current_cgroup_id)(void)   = (void *)
+  BPF_FUNC_get_current_cgroup_id;
+static unsigned long long (*bpf_get_attach_cookie)(void *ctx)  = (void *)
+  BPF_FUNC_get_attach_cookie;
 
 __attribute__((format(printf, 1, 3))) static int (*bpf_trace_printk)(
   const char *fmt, int fmt_size, ...) = (void *)BPF_FUNC_trace_printk;
@@ -0,0 +1,168 @@
+// This file contains the code and map definitions for lock contention profiling. The
+// entry points are attached to the futex syscall implementation and to the slow paths
+// of the mutex lock functions of the C libraries.
+
+#include "bpfdefs.h"
+#include "tracemgmt.h"
+#include "types.h"
+
+// Futex operations that wait for a lock, copied from include/uapi/linux/futex.h.
+#define FUTEX_WAIT            0
+#define FUTEX_LOCK_PI         6
+#define FUTEX_WAIT_BITSET     9
+#define FUTEX_WAIT_REQUEUE_PI 11
+#define FUTEX_LOCK_PI2        13
+#define FUTEX_PRIVATE_FLAG    128
+#define FUTEX_CLOCK_REALTIME  256
+#define FUTEX_CMD_MASK        ~(FUTEX_PRIVATE_FLAG | FUTEX_CLOCK_REALTIME)
+
+// futex_waits holds the futex waits that are in progress. The key is the pid_tgid of
+// the waiting thread.
+bpf_map_def SEC("maps") futex_waits = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(ContentionWait),
+  .max_entries = 4096,
+};
+
+// mutex_waits holds the waits in the mutex lock slow paths that are in progress. The
+// key is the pid_tgid of the waiting thread.
+bpf_map_def SEC("maps") mutex_waits = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(ContentionWait),
+  .max_entries = 4096,
+};
+
+// is_futex_wait returns true if the futex operation op waits for a lock.
+static EBPF_INLINE bool is_futex_wait(int op)
+{
+  switch (op & FUTEX_CMD_MASK) {
+  case FUTEX_WAIT:
+  case FUTEX_WAIT_BITSET:
+  case FUTEX_WAIT_REQUEUE_PI:
+  case FUTEX_LOCK_PI:
+  case FUTEX_LOCK_PI2: return true;
+  default: return false;
+  }
+}
+
+// contention_sample decides whether a wait for a lock is sampled.
+static EBPF_INLINE bool contention_sample(u32 pid)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg) {
+    // Unreachable: array maps are always fully initialized.
+    return false;
+  }
+
+  if (bpf_get_prandom_u32() > syscfg->contention_threshold) {
+    return false;
+  }
+
+  return is_target_pid(pid) && !is_denied_cgroup();
+}
+
+// contention_collect collects the trace of a sampled wait that ended.
+static EBPF_INLINE int contention_collect(struct pt_regs *ctx, u64 pid_tgid, ContentionWait *wait)
+{
+  u32 pid = pid_tgid >> 32;
+  u32 tid = pid_tgid & 0xFFFFFFFF;
+  u64 ts  = bpf_ktime_get_ns();
+
+  DEBUG_PRINT("==== contention on 0x%llx ====", wait->addr);
+
+  return collect_trace(
+    ctx, TRACE_CONTENTION, pid, tid, ts, ts - wait->start, wait->addr, 0, NULL);
+}
+
+// kprobe__do_futex is the entry point of do_futex(uaddr, op, ...), which implements
+// the futex syscalls.
+SEC("kprobe/do_futex")
+int kprobe__do_futex(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u32 pid      = pid_tgid >> 32;
+  if (pid == 0) {
+    return 0;
+  }
+
+  if (!is_futex_wait(PT_REGS_PARM2(ctx))) {
+    return 0;
+  }
+
+  if (bpf_map_lookup_elem(&mutex_waits, &pid_tgid)) {
+    // The wait is accounted to the mutex lock slow path that is in progress.
+    return 0;
+  }
+
+  if (!contention_sample(pid)) {
+    return 0;
+  }
+
+  ContentionWait wait = {
+    .addr  = PT_REGS_PARM1(ctx),
+    .start = bpf_ktime_get_ns(),
+  };
+  bpf_map_update_elem(&futex_waits, &pid_tgid, &wait, BPF_ANY);
+  return 0;
+}
+
+// kretprobe__do_futex is the return point of do_futex. It collects the trace of
+// sampled futex waits.
+SEC("kretprobe/do_futex")
+int kretprobe__do_futex(struct pt_regs *ctx)
+{
+  u64 pid_tgid         = bpf_get_current_pid_tgid();
+  ContentionWait *wait = bpf_map_lookup_elem(&futex_waits, &pid_tgid);
+  if (!wait) {
+    return 0;
+  }
+  ContentionWait sampled = *wait;
+  bpf_map_delete_elem(&futex_waits, &pid_tgid);
+
+  return contention_collect(ctx, pid_tgid, &sampled);
+}
+
+// uprobe__mutex_lock_wait is the entry point of the slow path of the mutex lock
+// functions, whose first argument is the address of the lock. The wait is kept even
+// if it is not sampled, so that its futex waits are not sampled separately.
+SEC("uprobe/mutex_lock_wait")
+int uprobe__mutex_lock_wait(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u32 pid      = pid_tgid >> 32;
+  if (pid == 0) {
+    return 0;
+  }
+
+  ContentionWait wait = {
+    .addr = PT_REGS_PARM1(ctx),
+  };
+  if (contention_sample(pid)) {
+    wait.start = bpf_ktime_get_ns();
+  }
+  bpf_map_update_elem(&mutex_waits, &pid_tgid, &wait, BPF_ANY);
+  return 0;
+}
+
+// uretprobe__mutex_lock_wait is the return point of the slow path of the mutex lock
+// functions. It collects the trace of sampled waits.
+SEC("uretprobe/mutex_lock_wait")
+int uretprobe__mutex_lock_wait(struct pt_regs *ctx)
+{
+  u64 pid_tgid         = bpf_get_current_pid_tgid();
+  ContentionWait *wait = bpf_map_lookup_elem(&mutex_waits, &pid_tgid);
+  if (!wait) {
+    return 0;
+  }
+  ContentionWait sampled = *wait;
+  bpf_map_delete_elem(&mutex_waits, &pid_tgid);
+
+  if (sampled.start == 0) {
+    return 0;
+  }
+
+  return contention_collect(ctx, pid_tgid, &sampled);
+}
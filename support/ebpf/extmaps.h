@@ -14,12 +14,19 @@ extern bpf_map_def metrics;
 extern bpf_map_def report_events;
 extern bpf_map_def reported_pids;
 extern bpf_map_def pid_events;
+extern bpf_map_def target_pids;
+extern bpf_map_def denied_cgroups;
 extern bpf_map_def inhibit_events;
 extern bpf_map_def interpreter_offsets;
 extern bpf_map_def system_config;
 extern bpf_map_def trace_events;
+extern bpf_map_def report_events_ringbuf;
+extern bpf_map_def trace_events_ringbuf;
 extern bpf_map_def go_labels_procs;
 
+// with_ringbuf is declared in interpreter_dispatcher.ebpf.c
+extern u32 with_ringbuf;
+
 #if defined(TESTING_COREDUMP)
 
 // References to maps in alphabetical order that
@@ -48,6 +48,18 @@ bpf_map_def SEC("maps") report_events = {
   .max_entries = 0,
 };
 
+// Ring buffer for sending events to user-mode, that replaces report_events if the
+// kernel supports ring buffers. It is shared by all CPUs and delivers the events in
+// order. The size in bytes is adjusted at load time in loadAllMaps.
+bpf_map_def SEC("maps") report_events_ringbuf = {
+  .type        = BPF_MAP_TYPE_RINGBUF,
+  .max_entries = 4096,
+};
+
+// with_ringbuf is set during load time if the kernel supports ring buffers. Events and
+// traces are then sent via report_events_ringbuf and trace_events_ringbuf.
+BPF_RODATA_VAR(u32, with_ringbuf, 0)
+
 // reported_pids is a map that holds PIDs recently reported to user space.
 //
 // We use this map to avoid sending multiple notifications for the same PID to user space.
@@ -79,6 +91,27 @@ bpf_map_def SEC("maps") pid_events = {
   .max_entries = 65536,
 };
 
+// target_pids contains the PIDs of the processes to profile, if profiling is restricted to
+// a process or process tree (see SystemConfig.filter_pids). Descendants of target processes
+// are added by tracepoint__task_newtask and removed by tracepoint__sched_process_free.
+// As key we use the PID and as value always true.
+bpf_map_def SEC("maps") target_pids = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u32),
+  .value_size  = sizeof(bool),
+  .max_entries = 16384,
+};
+
+// denied_cgroups contains the IDs of the cgroups whose processes are not profiled. It is
+// maintained by user space from the cgroup allow and deny lists. As key we use the cgroup
+// ID and as value always true.
+bpf_map_def SEC("maps") denied_cgroups = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(bool),
+  .max_entries = 16384,
+};
+
 // The native unwinder needs to be able to determine how each mapping should be unwound.
 //
 // This map contains data to help the native unwinder translate from a virtual address in a given
@@ -116,6 +149,14 @@ bpf_map_def SEC("maps") trace_events = {
   .max_entries = 0,
 };
 
+// Ring buffer for sending completed traces to user-mode, that replaces trace_events if
+// the kernel supports ring buffers. The size in bytes is adjusted at load time in
+// loadAllMaps.
+bpf_map_def SEC("maps") trace_events_ringbuf = {
+  .type        = BPF_MAP_TYPE_RINGBUF,
+  .max_entries = 4096,
+};
+
 // End shared maps
 
 bpf_map_def SEC("maps") apm_int_procs = {
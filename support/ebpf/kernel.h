@@ -97,6 +97,10 @@ struct pt_regs {
   unsigned long sp;
   unsigned long ss;
 };
+  // Argument and return value registers of the user space calling convention.
+  #define PT_REGS_PARM1(x) ((x)->di)
+  #define PT_REGS_PARM2(x) ((x)->si)
+  #define PT_REGS_RC(x)    ((x)->ax)
 #elif defined(__aarch64__)
 struct pt_regs {
   u64 regs[31];
@@ -113,12 +117,30 @@ struct pt_regs {
   u64 exit_rcu;
 };
   #define reg_pc pc
+
+  // Argument and return value registers of the user space calling convention.
+  #define PT_REGS_PARM1(x) ((x)->regs[0])
+  #define PT_REGS_PARM2(x) ((x)->regs[1])
+  #define PT_REGS_RC(x)    ((x)->regs[0])
 #else
   #error "Unsupported architecture"
 #endif
 
+// Defined in include/uapi/linux/bpf_perf_event.h. The registers are of type
+// bpf_user_pt_regs_t, which is the smaller user_pt_regs on arm64.
 struct bpf_perf_event_data {
+#if defined(__x86_64)
   struct pt_regs regs;
+#elif defined(__aarch64__)
+  struct {
+    u64 regs[31];
+    u64 sp;
+    u64 pc;
+    u64 pstate;
+  } regs;
+#endif
+  u64 sample_period;
+  u64 addr;
 };
 
 // The following works with clang and gcc.
@@ -154,6 +176,12 @@ enum {
   BPF_F_CTXLEN_MASK = (0xFFFFFULL << 32),
 };
 
+// Flags for ring buffer helpers
+enum {
+  BPF_RB_NO_WAKEUP    = (1ULL << 0),
+  BPF_RB_FORCE_WAKEUP = (1ULL << 1),
+};
+
 // BPF map variants.
 enum bpf_map_type {
   BPF_MAP_TYPE_UNSPEC,
@@ -641,8 +641,9 @@ static EBPF_INLINE int unwind_native(struct pt_regs *ctx)
   return -1;
 }
 
-SEC("perf_event/native_tracer_entry")
-int native_tracer_entry(struct bpf_perf_event_data *ctx)
+// perf_event_entry collects a trace of the given origin for a perf event.
+static EBPF_INLINE int
+perf_event_entry(struct bpf_perf_event_data *ctx, TraceOrigin origin, u64 sample_period)
 {
   // Get the PID and TGID register.
   u64 id  = bpf_get_current_pid_tgid();
@@ -653,7 +654,46 @@ int native_tracer_entry(struct bpf_perf_event_data *ctx)
     return 0;
   }
 
+  // Skip processes that are not targeted before doing any unwinding work.
+  if (!is_target_pid(pid) || is_denied_cgroup()) {
+    return 0;
+  }
+
   u64 ts = bpf_ktime_get_ns();
-  return collect_trace((struct pt_regs *)&ctx->regs, TRACE_SAMPLING, pid, tid, ts, 0);
+  return collect_trace(
+    (struct pt_regs *)&ctx->regs, origin, pid, tid, ts, sample_period, 0, 0, NULL);
+}
+
+SEC("perf_event/native_tracer_entry")
+int native_tracer_entry(struct bpf_perf_event_data *ctx)
+{
+  return perf_event_entry(ctx, TRACE_SAMPLING, 0);
+}
+
+// The entry programs of the other perf events report the sample period of the
+// event, which is the number of events a trace stands for.
+
+SEC("perf_event/page_faults_entry")
+int page_faults_entry(struct bpf_perf_event_data *ctx)
+{
+  return perf_event_entry(ctx, TRACE_PAGE_FAULTS, ctx->sample_period);
+}
+
+SEC("perf_event/context_switches_entry")
+int context_switches_entry(struct bpf_perf_event_data *ctx)
+{
+  return perf_event_entry(ctx, TRACE_CONTEXT_SWITCHES, ctx->sample_period);
+}
+
+SEC("perf_event/cache_misses_entry")
+int cache_misses_entry(struct bpf_perf_event_data *ctx)
+{
+  return perf_event_entry(ctx, TRACE_CACHE_MISSES, ctx->sample_period);
+}
+
+SEC("perf_event/branch_misses_entry")
+int branch_misses_entry(struct bpf_perf_event_data *ctx)
+{
+  return perf_event_entry(ctx, TRACE_BRANCH_MISSES, ctx->sample_period);
 }
 MULTI_USE_FUNC(unwind_native)
@@ -10,17 +10,74 @@ bpf_map_def SEC("maps") kprobe_progs = {
   .max_entries = NUM_TRACER_PROGS,
 };
 
-// sched_times keeps track of sched_switch call times.
+// sched_times keeps track of sched_switch call times, task states and wakers. The key is
+// the thread ID, as threads are woken up from other threads on any CPU.
 bpf_map_def SEC("maps") sched_times = {
-  .type        = BPF_MAP_TYPE_LRU_PERCPU_HASH,
-  .key_size    = sizeof(u64), // pid_tgid
-  .value_size  = sizeof(u64), // time in ns
-  .max_entries = 256,         // value is adjusted at load time in loadAllMaps.
+  .type        = BPF_MAP_TYPE_LRU_HASH,
+  .key_size    = sizeof(u32),         // tid
+  .value_size  = sizeof(SchedSwitch), // time in ns, task state and waker
+  .max_entries = 256,                 // value is adjusted at load time in loadAllMaps.
 };
 
+// wakeups holds the wakeups of sampled tasks that are in progress. The key is the
+// pid_tgid of the waker.
+bpf_map_def SEC("maps") wakeups = {
+  .type        = BPF_MAP_TYPE_HASH,
+  .key_size    = sizeof(u64),
+  .value_size  = sizeof(Wakeup),
+  .max_entries = 4096,
+};
+
+// See /sys/kernel/debug/tracing/events/sched/sched_switch/format
+// for struct layout.
+struct sched_switch_ctx {
+  unsigned char skip[8];
+  char prev_comm[16];
+  pid_t prev_pid;
+  int prev_prio;
+  long prev_state;
+  char next_comm[16];
+  pid_t next_pid;
+  int next_prio;
+};
+
+// See /sys/kernel/debug/tracing/events/sched/sched_waking/format
+// for struct layout.
+struct sched_waking_ctx {
+  unsigned char skip[8];
+  char comm[16];
+  pid_t pid;
+  int prio;
+};
+
+// in_task_context returns whether the eBPF program runs in the context of the current
+// task. Hard and soft interrupts run on per-CPU interrupt stacks, and `current` is the
+// task they interrupted, so their wakeups must not be attributed to it. The eBPF stack
+// frame, and thus frame_marker, is located on the stack of the running context.
+static EBPF_INLINE bool in_task_context(void)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg) {
+    // Unreachable: array maps are always fully initialized.
+    return false;
+  }
+
+  struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+  u64 stack_end            = get_task_pt_regs(task, syscfg);
+  if (!stack_end) {
+    return false;
+  }
+  u64 stack_base = stack_end - syscfg->stack_ptregs_offset;
+
+  volatile u8 frame_marker = 0;
+  u64 sp                   = (u64)&frame_marker;
+  return sp >= stack_base && sp < stack_end;
+}
+
 // tracepoint__sched_switch serves as entry point for off cpu profiling.
 SEC("tracepoint/sched/sched_switch")
-int tracepoint__sched_switch(void *ctx)
+int tracepoint__sched_switch(struct sched_switch_ctx *ctx)
 {
   u64 pid_tgid = bpf_get_current_pid_tgid();
   u32 pid      = pid_tgid >> 32;
@@ -41,9 +98,16 @@ int tracepoint__sched_switch(void *ctx)
     return 0;
   }
 
-  u64 ts = bpf_ktime_get_ns();
+  if (!is_target_pid(pid) || is_denied_cgroup()) {
+    return 0;
+  }
+
+  SchedSwitch sched = {
+    .ktime      = bpf_ktime_get_ns(),
+    .task_state = ctx->prev_state,
+  };
 
-  if (bpf_map_update_elem(&sched_times, &pid_tgid, &ts, BPF_ANY) < 0) {
+  if (bpf_map_update_elem(&sched_times, &tid, &sched, BPF_ANY) < 0) {
     DEBUG_PRINT("Failed to record sched_switch event entry");
     return 0;
   }
@@ -76,18 +140,91 @@ int finish_task_switch(struct pt_regs *ctx)
 
   u64 ts = bpf_ktime_get_ns();
 
-  u64 *start_ts = bpf_map_lookup_elem(&sched_times, &pid_tgid);
-  if (!start_ts || *start_ts == 0) {
+  SchedSwitch *start = bpf_map_lookup_elem(&sched_times, &tid);
+  if (!start || start->ktime == 0) {
     // There is no information from the sched/sched_switch entry hook.
     return 0;
   }
 
-  // Remove entry from the map so the stack for the same pid_tgid does not get unwound and
+  u64 diff       = ts - start->ktime;
+  u32 task_state = start->task_state;
+  Waker waker    = start->waker;
+
+  // Remove entry from the map so the stack for the same tid does not get unwound and
   // reported accidentally without the start timestamp updated in tracepoint/sched/sched_switch.
-  bpf_map_delete_elem(&sched_times, &pid_tgid);
+  bpf_map_delete_elem(&sched_times, &tid);
 
-  u64 diff = ts - *start_ts;
   DEBUG_PRINT("==== finish_task_switch ====");
 
-  return collect_trace(ctx, TRACE_OFF_CPU, pid, tid, ts, diff);
+  return collect_trace(ctx, TRACE_OFF_CPU, pid, tid, ts, diff, 0, task_state, &waker);
+}
+
+// tracepoint__sched_waking records the thread that wakes up a sampled task for wakeup
+// attribution. Unlike sched_wakeup, which may be called on the CPU of the woken up task,
+// sched_waking is always called in the context of the waker.
+SEC("tracepoint/sched/sched_waking")
+int tracepoint__sched_waking(struct sched_waking_ctx *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u32 pid      = pid_tgid >> 32;
+  u32 tid      = pid_tgid & 0xFFFFFFFF;
+
+  if (pid == 0 || tid == 0) {
+    // Wakeups from interrupts of idle CPUs are not attributed.
+    return 0;
+  }
+  if (!in_task_context()) {
+    // Wakeups from interrupts are not attributed to the interrupted task.
+    return 0;
+  }
+
+  u32 wakee          = ctx->pid;
+  SchedSwitch *sched = bpf_map_lookup_elem(&sched_times, &wakee);
+  if (!sched || sched->waker.tid != 0) {
+    // The task is not sampled or was already woken up.
+    return 0;
+  }
+
+  u64 ts             = bpf_ktime_get_ns();
+  sched->waker.pid   = pid;
+  sched->waker.tid   = tid;
+  sched->waker.ktime = ts;
+
+  Wakeup wakeup = {
+    .ktime        = ts,
+    .off_cpu_time = ts - sched->ktime,
+  };
+  if (bpf_map_update_elem(&wakeups, &pid_tgid, &wakeup, BPF_ANY) < 0) {
+    DEBUG_PRINT("Failed to record wakeup");
+  }
+  return 0;
+}
+
+// kretprobe__try_to_wake_up is the return point of try_to_wake_up, which calls the
+// sched_waking tracepoint. It collects the trace of the waker of a sampled task.
+// It runs on every wakeup of every task, so it returns early unless sched_waking
+// recorded a sampled wakeup of the current task.
+SEC("kretprobe/try_to_wake_up")
+int kretprobe__try_to_wake_up(struct pt_regs *ctx)
+{
+  u64 pid_tgid   = bpf_get_current_pid_tgid();
+  Wakeup *wakeup = bpf_map_lookup_elem(&wakeups, &pid_tgid);
+  if (!wakeup) {
+    return 0;
+  }
+  if (!in_task_context()) {
+    // An interrupt woke up a task while the current task was waking up a sampled
+    // task. Its wakeup is collected when the current task resumes.
+    return 0;
+  }
+  Wakeup sampled = *wakeup;
+  bpf_map_delete_elem(&wakeups, &pid_tgid);
+
+  u32 pid = pid_tgid >> 32;
+  u32 tid = pid_tgid & 0xFFFFFFFF;
+
+  DEBUG_PRINT("==== wakeup after %llu ns ====", sampled.off_cpu_time);
+
+  return collect_trace(
+    ctx, TRACE_WAKEUP, pid, tid, sampled.ktime, sampled.off_cpu_time, 0, 0, NULL);
 }
@@ -0,0 +1,147 @@
+// This file contains the code and map definitions for run queue latency profiling. A
+// thread enters the run queue when it is woken up or preempted, and leaves it when it
+// is switched onto a CPU.
+
+#include "bpfdefs.h"
+#include "tracemgmt.h"
+#include "types.h"
+
+// run_queue_times keeps track of the times sampled threads entered the run queue, or 0
+// for sampled threads that block. The key is the thread ID, as threads are woken up
+// from other threads.
+bpf_map_def SEC("maps") run_queue_times = {
+  .type        = BPF_MAP_TYPE_LRU_HASH,
+  .key_size    = sizeof(u32), // tid
+  .value_size  = sizeof(u64), // time in ns
+  .max_entries = 256,         // value is adjusted at load time in loadAllMaps.
+};
+
+// See /sys/kernel/debug/tracing/events/sched/sched_wakeup/format
+// for struct layout.
+struct sched_wakeup_ctx {
+  unsigned char skip[8];
+  char comm[16];
+  pid_t pid;
+  int prio;
+};
+
+// See /sys/kernel/debug/tracing/events/sched/sched_switch/format
+// for struct layout.
+struct sched_switch_run_queue_ctx {
+  unsigned char skip[8];
+  char prev_comm[16];
+  pid_t prev_pid;
+  int prev_prio;
+  long prev_state;
+};
+
+// run_queue_sample returns true if a thread that enters the run queue is sampled. The
+// filters apply to the current task, as the wakeup tracepoints only know the thread ID
+// of the woken up thread.
+static EBPF_INLINE bool run_queue_sample(void)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg) {
+    // Unreachable: array maps are always fully initialized.
+    return false;
+  }
+
+  if (bpf_get_prandom_u32() > syscfg->run_queue_threshold) {
+    return false;
+  }
+
+  u32 pid = bpf_get_current_pid_tgid() >> 32;
+  return pid != 0 && is_target_pid(pid) && !is_denied_cgroup();
+}
+
+// run_queue_record records the time ts the thread tid entered the run queue. A time of 0
+// marks a sampled thread that blocks, which enters the run queue when it is woken up.
+static EBPF_INLINE void run_queue_record(u32 tid, u64 ts)
+{
+  if (bpf_map_update_elem(&run_queue_times, &tid, &ts, BPF_ANY) < 0) {
+    DEBUG_PRINT("Failed to record run queue entry");
+  }
+}
+
+// tracepoint__sched_wakeup serves as entry point for run queue latency profiling of
+// woken up threads. Only threads that were sampled when they blocked are recorded.
+SEC("tracepoint/sched/sched_wakeup")
+int tracepoint__sched_wakeup(struct sched_wakeup_ctx *ctx)
+{
+  u32 tid       = ctx->pid;
+  u64 *enqueued = bpf_map_lookup_elem(&run_queue_times, &tid);
+  if (enqueued && *enqueued == 0) {
+    *enqueued = bpf_ktime_get_ns();
+  }
+  return 0;
+}
+
+// tracepoint__sched_wakeup_new serves as entry point for run queue latency profiling
+// of new threads. They are filtered by the process and cgroup of the forking task, which
+// they share or inherit.
+SEC("tracepoint/sched/sched_wakeup_new")
+int tracepoint__sched_wakeup_new(struct sched_wakeup_ctx *ctx)
+{
+  u32 tid = ctx->pid;
+  if (tid != 0 && run_queue_sample()) {
+    run_queue_record(tid, bpf_ktime_get_ns());
+  }
+  return 0;
+}
+
+// tracepoint__sched_switch_run_queue serves as entry point for run queue latency
+// profiling of threads that are switched off the CPU. The switched off thread is the
+// current task, which the filters apply to.
+SEC("tracepoint/sched/sched_switch")
+int tracepoint__sched_switch_run_queue(struct sched_switch_run_queue_ctx *ctx)
+{
+  u32 tid = ctx->prev_pid;
+  if (tid == 0 || !run_queue_sample()) {
+    return 0;
+  }
+
+  u64 ts = 0;
+  if (ctx->prev_state == TASK_REPORT_RUNNING || ctx->prev_state == TASK_REPORT_PREEMPTED) {
+    // The thread stays runnable, e.g. because it was preempted.
+    ts = bpf_ktime_get_ns();
+  }
+  run_queue_record(tid, ts);
+  return 0;
+}
+
+// finish_task_switch_run_queue is triggered right after the scheduler switched a
+// thread onto the CPU. It collects the trace of sampled threads that left the run
+// queue.
+SEC("kprobe/finish_task_switch")
+int finish_task_switch_run_queue(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u32 pid      = pid_tgid >> 32;
+  u32 tid      = pid_tgid & 0xFFFFFFFF;
+
+  if (pid == 0 || tid == 0) {
+    return 0;
+  }
+
+  u64 *start_ts = bpf_map_lookup_elem(&run_queue_times, &tid);
+  if (!start_ts) {
+    return 0;
+  }
+  u64 start = *start_ts;
+  bpf_map_delete_elem(&run_queue_times, &tid);
+  if (start == 0) {
+    // The wakeup of the blocked thread was missed.
+    return 0;
+  }
+  u64 ts    = bpf_ktime_get_ns();
+  u64 delay = ts - start;
+
+  if (!is_target_pid(pid) || is_denied_cgroup()) {
+    return 0;
+  }
+
+  DEBUG_PRINT("==== run queue latency %llu ns ====", delay);
+
+  return collect_trace(ctx, TRACE_RUN_QUEUE, pid, tid, ts, delay, 0, 0, NULL);
+}
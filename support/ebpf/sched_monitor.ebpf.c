@@ -31,5 +31,58 @@ int tracepoint__sched_process_free(struct sched_process_free_ctx *ctx)
     increment_metric(metricID_NumProcExit);
   }
 exit:
+  // The pid of the tracepoint is the ID of the freed task, which is the PID of the
+  // process for its main thread.
+  bpf_map_delete_elem(&target_pids, &pid);
+  return 0;
+}
+
+// CLONE_THREAD is the clone flag that creates a thread instead of a process.
+#define CLONE_THREAD 0x00010000
+
+// See /sys/kernel/debug/tracing/events/task/task_newtask/format
+// for struct layout.
+struct task_newtask_ctx {
+  unsigned char skip[8];
+  pid_t pid;
+  char comm[16];
+  u64 clone_flags;
+  short oom_score_adj;
+};
+
+// tracepoint__task_newtask is a tracepoint attached to the creation of tasks. It adds
+// the children of target processes to target_pids when they are forked, so that the
+// process tree of a target process is followed.
+SEC("tracepoint/task/task_newtask")
+int tracepoint__task_newtask(struct task_newtask_ctx *ctx)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg) {
+    // Unreachable: array maps are always fully initialized.
+    return 0;
+  }
+
+  if (!syscfg->filter_pids || !syscfg->follow_children) {
+    return 0;
+  }
+
+  // Only processes are tracked, new threads belong to the process of the current task.
+  if (ctx->clone_flags & CLONE_THREAD) {
+    return 0;
+  }
+
+  // The forking task is the current task.
+  u32 parent = bpf_get_current_pid_tgid() >> 32;
+  if (!bpf_map_lookup_elem(&target_pids, &parent)) {
+    return 0;
+  }
+
+  // The ID of the new main thread is the PID of the new process.
+  u32 child  = ctx->pid;
+  bool value = true;
+  if (bpf_map_update_elem(&target_pids, &child, &value, BPF_ANY) < 0) {
+    DEBUG_PRINT("Failed to add child %u of target process %u", child, parent);
+  }
   return 0;
 }
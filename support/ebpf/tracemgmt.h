@@ -72,6 +72,14 @@ static inline EBPF_INLINE void event_send_trigger(struct pt_regs *ctx, u32 event
   }
 
   Event event = {.event_type = event_type};
+  if (with_ringbuf) {
+    int ret = bpf_ringbuf_output(&report_events_ringbuf, &event, sizeof(event), 0);
+    if (ret < 0) {
+      increment_metric(metricID_ReportEventRingbufDropped);
+      DEBUG_PRINT("event_send_trigger failed to send event %d: error %d", event_type, ret);
+    }
+    return;
+  }
   int ret = bpf_perf_event_output(ctx, &report_events, BPF_F_CURRENT_CPU, &event, sizeof(event));
   if (ret < 0) {
     DEBUG_PRINT("event_send_trigger failed to send event %d: error %d", event_type, ret);
@@ -365,7 +373,8 @@ static inline EBPF_INLINE ErrorCode push_error(Trace *trace, ErrorCode error)
   return _push_with_max_frames(trace, 0, error, FRAME_MARKER_ABORT, 0, MAX_FRAME_UNWINDS);
 }
 
-// Send a trace to user-land via the `trace_events` perf event buffer.
+// Send a trace to user-land via the `trace_events` perf event buffer, or via the
+// `trace_events_ringbuf` ring buffer if the kernel supports ring buffers.
 static inline EBPF_INLINE void send_trace(void *ctx, Trace *trace)
 {
   const u64 num_empty_frames = (MAX_FRAME_UNWINDS - trace->stack_len);
@@ -375,6 +384,16 @@ static inline EBPF_INLINE void send_trace(void *ctx, Trace *trace)
     return; // unreachable
   }
 
+  trace->cpu = bpf_get_smp_processor_id();
+
+  if (with_ringbuf) {
+    // User-land polls the ring buffer periodically, so there is no need to wake it up.
+    if (bpf_ringbuf_output(&trace_events_ringbuf, trace, send_size, BPF_RB_NO_WAKEUP) < 0) {
+      increment_metric(metricID_TraceEventRingbufDropped);
+    }
+    return;
+  }
+
   bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, trace, send_size);
 }
 
@@ -728,8 +747,39 @@ get_usermode_regs(struct pt_regs *ctx, UnwindState *state, bool *has_usermode_re
 
 #endif // TESTING_COREDUMP
 
+// is_target_pid returns true if the process with the given PID is to be profiled.
+static inline EBPF_INLINE bool is_target_pid(u32 pid)
+{
+  u32 key              = 0;
+  SystemConfig *syscfg = bpf_map_lookup_elem(&system_config, &key);
+  if (!syscfg) {
+    // Unreachable: array maps are always fully initialized.
+    return false;
+  }
+
+  if (!syscfg->filter_pids) {
+    return true;
+  }
+  return bpf_map_lookup_elem(&target_pids, &pid) != NULL;
+}
+
+// is_denied_cgroup returns true if the cgroup of the current task is not to be profiled.
+static inline EBPF_INLINE bool is_denied_cgroup(void)
+{
+  u64 cgroup_id = bpf_get_current_cgroup_id();
+  return bpf_map_lookup_elem(&denied_cgroups, &cgroup_id) != NULL;
+}
+
 static inline EBPF_INLINE int collect_trace(
-  struct pt_regs *ctx, TraceOrigin origin, u32 pid, u32 tid, u64 trace_timestamp, u64 off_cpu_time)
+  struct pt_regs *ctx,
+  TraceOrigin origin,
+  u32 pid,
+  u32 tid,
+  u64 trace_timestamp,
+  u64 off_cpu_time,
+  u64 addr,
+  u32 task_state,
+  const Waker *waker)
 {
   // The trace is reused on each call to this function so we have to reset the
   // variables used to maintain state.
@@ -739,12 +789,19 @@ static inline EBPF_INLINE int collect_trace(
     return -1;
   }
 
-  Trace *trace   = &record->trace;
-  trace->origin  = origin;
-  trace->pid     = pid;
-  trace->tid     = tid;
-  trace->ktime   = trace_timestamp;
-  trace->offtime = off_cpu_time;
+  Trace *trace      = &record->trace;
+  trace->origin     = origin;
+  trace->pid        = pid;
+  trace->tid        = tid;
+  trace->ktime      = trace_timestamp;
+  trace->offtime    = off_cpu_time;
+  trace->addr       = addr;
+  trace->task_state = task_state;
+  if (waker) {
+    trace->waker = *waker;
+  } else {
+    trace->waker = (Waker){};
+  }
   if (bpf_get_current_comm(&(trace->comm), sizeof(trace->comm)) < 0) {
     increment_metric(metricID_ErrBPFCurrentComm);
   }
@@ -307,6 +307,15 @@ enum {
   // number of failures to read Go custom labels
   metricID_UnwindGoLabelsFailures,
 
+  // number of uprobe hits without trace due to the rate limit of the uprobe
+  metricID_UprobeRateLimited,
+
+  // number of traces dropped because trace_events_ringbuf was full
+  metricID_TraceEventRingbufDropped,
+
+  // number of events dropped because report_events_ringbuf was full
+  metricID_ReportEventRingbufDropped,
+
   //
   // Metric IDs above are for counters (cumulative values)
   //
@@ -344,6 +353,17 @@ typedef enum TraceOrigin {
   TRACE_UNKNOWN,
   TRACE_SAMPLING,
   TRACE_OFF_CPU,
+  TRACE_PAGE_FAULTS,
+  TRACE_CONTEXT_SWITCHES,
+  TRACE_CACHE_MISSES,
+  TRACE_BRANCH_MISSES,
+  TRACE_UPROBE,
+  TRACE_ALLOC,
+  // Only used in user space for the sampled allocations that are still in use.
+  TRACE_ALLOC_IN_USE,
+  TRACE_CONTENTION,
+  TRACE_RUN_QUEUE,
+  TRACE_WAKEUP,
 } TraceOrigin;
 
 // MAX_FRAME_UNWINDS defines the maximum number of frames per
@@ -544,6 +564,17 @@ typedef struct CustomLabelsArray {
   CustomLabel labels[MAX_CUSTOM_LABELS];
 } CustomLabelsArray;
 
+// Waker describes the thread that woke up a task that was switched off the CPU.
+typedef struct Waker {
+  // The process ID of the waker.
+  u32 pid;
+  // The thread ID of the waker.
+  u32 tid;
+  // Monotonic kernel time of the wakeup in nanoseconds. It is also the ktime of the
+  // wakeup trace of the waker.
+  u64 ktime;
+} Waker;
+
 // Container for a stack trace
 typedef struct Trace {
   // The process ID
@@ -570,9 +601,31 @@ typedef struct Trace {
   // origin indicates the source of the trace.
   TraceOrigin origin;
 
-  // offtime stores the nanoseconds that the trace was off-cpu for.
+  // task_state stores the state of the task when it was switched off the CPU for
+  // off-cpu traces, as reported by the sched_switch tracepoint. Zero otherwise.
+  u32 task_state;
+
+  // cpu stores the CPU that the trace was collected on.
+  u32 cpu;
+
+  // offtime stores the nanoseconds that the trace was off-cpu for. For traces of
+  // perf events other than the CPU clock, it stores the sample period of the event,
+  // for uprobe traces the number of calls of the probed function, for allocation
+  // traces the size of the allocation in bytes, for contention traces the
+  // nanoseconds that the thread waited for the lock, for run queue traces the
+  // nanoseconds that the thread waited for a CPU and for wakeup traces the
+  // nanoseconds that the woken up thread was off-cpu for.
   u64 offtime;
 
+  // addr stores the address of the allocation for allocation traces that are tracked
+  // until they are freed and the address of the lock for contention traces. Zero
+  // otherwise.
+  u64 addr;
+
+  // waker identifies the thread that woke up the task for off-cpu traces, if wakeup
+  // attribution is enabled. All-zero otherwise.
+  Waker waker;
+
   // The frames of the stack trace.
   Frame frames[MAX_FRAME_UNWINDS];
 
@@ -920,10 +973,98 @@ typedef struct SystemConfig {
   // User defined threshold for off-cpu profiling.
   u32 off_cpu_threshold;
 
+  // Average number of allocated bytes between two sampled allocations.
+  u32 alloc_sample_interval;
+
+  // User defined threshold for lock contention profiling.
+  u32 contention_threshold;
+
+  // User defined threshold for run queue latency profiling.
+  u32 run_queue_threshold;
+
   // Enables the temporary hack that drops pure errors frames in unwind_stop.
   bool drop_error_only_traces;
+
+  // Restricts profiling to the processes in the target_pids map.
+  bool filter_pids;
+
+  // Adds the children of processes in the target_pids map to the map when they are forked.
+  bool follow_children;
+
+  // Tracks the sampled allocations until they are freed.
+  bool alloc_in_use;
 } SystemConfig;
 
+// Maximum number of user configured uprobes.
+#define MAX_UPROBES 64
+
+// Struct of the `uprobe_states` map. Holds the rate limiting state of an uprobe.
+typedef struct UprobeState {
+  // Maximum number of traces per second, set by the host agent. Zero disables the limit.
+  u32 max_traces;
+
+  // Number of traces collected in the current one second window.
+  u32 traces;
+
+  // Start of the current one second window in nanoseconds.
+  u64 window_start;
+
+  // Number of calls of the probed function since its last collected trace.
+  u64 calls;
+} UprobeState;
+
+// Maximum number of sampled allocations that are tracked until they are freed.
+#define MAX_ALLOCS_IN_USE 65536
+
+// Key of the `alloc_in_use` map. Identifies a sampled allocation.
+typedef struct AllocKey {
+  // The address of the allocation.
+  u64 addr;
+  // The process ID of the allocating process.
+  u32 pid;
+  u32 pad;
+} AllocKey;
+
+// Event of the `alloc_frees` map. Sent when a tracked allocation is freed.
+typedef struct AllocFree {
+  AllocKey key;
+  // Monotonic kernel time of the free in nanoseconds.
+  u64 ktime;
+} AllocFree;
+
+// States reported by the sched_switch tracepoint for tasks that are switched off the CPU
+// while runnable.
+#define TASK_REPORT_RUNNING   0
+#define TASK_REPORT_PREEMPTED 0x100
+
+// Value of the `sched_times` map. Describes a task that was switched off the CPU.
+typedef struct SchedSwitch {
+  // Monotonic kernel time of the switch in nanoseconds.
+  u64 ktime;
+  // State of the task at the switch, as reported by the sched_switch tracepoint.
+  u32 task_state;
+  u32 pad;
+  // The thread that woke up the task. All-zero until the task is woken up.
+  Waker waker;
+} SchedSwitch;
+
+// Value of the `wakeups` map. Describes a wakeup of a sampled task that is in progress.
+typedef struct Wakeup {
+  // Monotonic kernel time of the wakeup in nanoseconds.
+  u64 ktime;
+  // The nanoseconds that the woken up task was off-cpu for.
+  u64 off_cpu_time;
+} Wakeup;
+
+// Value of the `futex_waits` and `mutex_waits` maps. Describes a thread that waits for a lock.
+typedef struct ContentionWait {
+  // The address of the lock.
+  u64 addr;
+  // Monotonic kernel time of the start of the wait in nanoseconds. Zero if the wait is
+  // not sampled.
+  u64 start;
+} ContentionWait;
+
 // Avoid including all of arch/arm64/include/uapi/asm/ptrace.h by copying the
 // actually used values.
 #define PSR_MODE32_BIT 0x00000010
@@ -0,0 +1,64 @@
+#include "bpfdefs.h"
+#include "tracemgmt.h"
+#include "types.h"
+
+// uprobe_states holds the rate limiting state of the user configured uprobes. The
+// index of an uprobe is its attach cookie.
+bpf_map_def SEC("maps") uprobe_states = {
+  .type        = BPF_MAP_TYPE_ARRAY,
+  .key_size    = sizeof(u32),
+  .value_size  = sizeof(UprobeState),
+  .max_entries = MAX_UPROBES,
+};
+
+// uprobe__generic serves as entry point for the user configured uprobes.
+SEC("uprobe/generic")
+int uprobe__generic(struct pt_regs *ctx)
+{
+  u64 pid_tgid = bpf_get_current_pid_tgid();
+  u32 pid      = pid_tgid >> 32;
+  u32 tid      = pid_tgid & 0xFFFFFFFF;
+
+  if (pid == 0 || tid == 0) {
+    return 0;
+  }
+
+  if (!is_target_pid(pid) || is_denied_cgroup()) {
+    return 0;
+  }
+
+  u32 probe          = bpf_get_attach_cookie(ctx);
+  UprobeState *state = bpf_map_lookup_elem(&uprobe_states, &probe);
+  if (!state) {
+    return 0;
+  }
+
+  ATOMIC_ADD(&state->calls, 1);
+
+  u64 ts = bpf_ktime_get_ns();
+  if (state->max_traces != 0) {
+    // Concurrent hits on other CPUs may race on the window. This only makes the
+    // rate limit slightly inaccurate.
+    if (ts - state->window_start >= 1000000000ULL) {
+      state->window_start = ts;
+      state->traces       = 0;
+    }
+    if (state->traces >= state->max_traces) {
+      increment_metric(metricID_UprobeRateLimited);
+      return 0;
+    }
+    ATOMIC_ADD(&state->traces, 1);
+  }
+
+  // The trace accounts for all calls since the last trace of this uprobe, including
+  // the ones dropped by the rate limit. The count is shared by all processes and
+  // stacks that call the function, so the calls dropped by the rate limit are charged
+  // to whichever stack is collected next. The per-stack call counts are therefore
+  // only an estimate, while their sum over all stacks is accurate.
+  u64 calls = state->calls;
+  ATOMIC_ADD(&state->calls, -calls);
+
+  DEBUG_PRINT("==== uprobe %u ====", probe);
+
+  return collect_trace(ctx, TRACE_UPROBE, pid, tid, ts, calls, 0, 0, NULL);
+}
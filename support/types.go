@@ -53,7 +53,7 @@ const (
 const MaxFrameUnwinds = 0x80
 
 const (
-	MetricIDBeginCumulative = 0x62
+	MetricIDBeginCumulative = 0x65
 )
 
 const (
@@ -83,12 +83,37 @@ const (
 	PerfMaxStackDepth = 0x7f
 )
 
+const (
+	MaxUprobes     = 0x40
+	MaxAllocsInUse = 0x10000
+)
+
 const (
 	TraceOriginUnknown  = 0x0
 	TraceOriginSampling = 0x1
 	TraceOriginOffCPU   = 0x2
+
+	TraceOriginPageFaults      = 0x3
+	TraceOriginContextSwitches = 0x4
+	TraceOriginCacheMisses     = 0x5
+	TraceOriginBranchMisses    = 0x6
+	TraceOriginUprobe          = 0x7
+	TraceOriginAlloc           = 0x8
+	TraceOriginAllocInUse      = 0x9
+	TraceOriginContention      = 0xa
+	TraceOriginRunQueue        = 0xb
+	TraceOriginWakeup          = 0xc
 )
 
+type AllocFree struct {
+	Key   AllocKey
+	Ktime uint64
+}
+type AllocKey struct {
+	Addr uint64
+	Pid  uint32
+	Pad  uint32
+}
 type ApmSpanID [8]byte
 type ApmTraceID [16]byte
 type CustomLabel struct {
@@ -151,8 +176,13 @@ type SystemConfig struct {
 	Task_stack_offset      uint32
 	Stack_ptregs_offset    uint32
 	Off_cpu_threshold      uint32
+	Alloc_sample_interval  uint32
+	Contention_threshold   uint32
+	Run_queue_threshold    uint32
 	Drop_error_only_traces bool
-	Pad_cgo_0              [3]byte
+	Filter_pids            bool
+	Follow_children        bool
+	Alloc_in_use           bool
 }
 type TSDInfo struct {
 	Offset     int16
@@ -170,7 +200,11 @@ type Trace struct {
 	Kernel_stack_id    int32
 	Stack_len          uint32
 	Origin             uint32
+	Task_state         uint32
+	Cpu                uint32
 	Offtime            uint64
+	Addr               uint64
+	Waker              Waker
 	Frames             [128]Frame
 }
 type UnwindInfo struct {
@@ -180,6 +214,17 @@ type UnwindInfo struct {
 	Param       int32
 	FpParam     int32
 }
+type UprobeState struct {
+	Max_traces   uint32
+	Traces       uint32
+	Window_start uint64
+	Calls        uint64
+}
+type Waker struct {
+	Pid   uint32
+	Tid   uint32
+	Ktime uint64
+}
 
 type ApmIntProcInfo struct {
 	Offset uint64
@@ -311,7 +356,7 @@ type V8ProcInfo struct {
 const (
 	Sizeof_Frame      = 0x18
 	Sizeof_StackDelta = 0x4
-	Sizeof_Trace      = 0xed0
+	Sizeof_Trace      = 0xef0
 
 	sizeof_ApmIntProcInfo = 0x8
 	sizeof_DotnetProcInfo = 0x4
@@ -456,4 +501,7 @@ var MetricsTranslation = []metrics.MetricID{
 	0x5d: metrics.IDUnwindDotnetErrBadFP,
 	0x5e: metrics.IDUnwindDotnetErrCodeHeader,
 	0x5f: metrics.IDUnwindDotnetErrCodeTooLarge,
+	0x62: metrics.IDUprobeRateLimited,
+	0x63: metrics.IDTraceEventRingbufDropped,
+	0x64: metrics.IDReportEventRingbufDropped,
 }
@@ -94,12 +94,32 @@ const (
 	PerfMaxStackDepth = C.PERF_MAX_STACK_DEPTH
 )
 
+const (
+	// MaxUprobes is the maximum number of user configured uprobes
+	MaxUprobes = C.MAX_UPROBES
+	// MaxAllocsInUse is the maximum number of tracked sampled allocations
+	MaxAllocsInUse = C.MAX_ALLOCS_IN_USE
+)
+
 const (
 	TraceOriginUnknown  = C.TRACE_UNKNOWN
 	TraceOriginSampling = C.TRACE_SAMPLING
 	TraceOriginOffCPU   = C.TRACE_OFF_CPU
+
+	TraceOriginPageFaults      = C.TRACE_PAGE_FAULTS
+	TraceOriginContextSwitches = C.TRACE_CONTEXT_SWITCHES
+	TraceOriginCacheMisses     = C.TRACE_CACHE_MISSES
+	TraceOriginBranchMisses    = C.TRACE_BRANCH_MISSES
+	TraceOriginUprobe          = C.TRACE_UPROBE
+	TraceOriginAlloc           = C.TRACE_ALLOC
+	TraceOriginAllocInUse      = C.TRACE_ALLOC_IN_USE
+	TraceOriginContention      = C.TRACE_CONTENTION
+	TraceOriginRunQueue        = C.TRACE_RUN_QUEUE
+	TraceOriginWakeup          = C.TRACE_WAKEUP
 )
 
+type AllocFree C.AllocFree
+type AllocKey C.AllocKey
 type ApmSpanID C.ApmSpanID
 type ApmTraceID C.ApmTraceID
 type CustomLabel C.CustomLabel
@@ -117,6 +137,8 @@ type SystemConfig C.SystemConfig
 type TSDInfo C.TSDInfo
 type Trace C.Trace
 type UnwindInfo C.UnwindInfo
+type UprobeState C.UprobeState
+type Waker C.Waker
 
 type ApmIntProcInfo C.ApmIntProcInfo
 type DotnetProcInfo C.DotnetProcInfo
@@ -281,4 +303,7 @@ var MetricsTranslation = []metrics.MetricID{
 	C.metricID_UnwindDotnetErrBadFP:                       metrics.IDUnwindDotnetErrBadFP,
 	C.metricID_UnwindDotnetErrCodeHeader:                  metrics.IDUnwindDotnetErrCodeHeader,
 	C.metricID_UnwindDotnetErrCodeTooLarge:                metrics.IDUnwindDotnetErrCodeTooLarge,
+	C.metricID_UprobeRateLimited:                          metrics.IDUprobeRateLimited,
+	C.metricID_TraceEventRingbufDropped:                   metrics.IDTraceEventRingbufDropped,
+	C.metricID_ReportEventRingbufDropped:                  metrics.IDReportEventRingbufDropped,
 }
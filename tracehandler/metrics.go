@@ -15,8 +15,13 @@ func (m *traceHandler) collectMetrics() {
 			ID:    metrics.IDTraceCacheMiss,
 			Value: metrics.MetricValue(m.traceCacheMiss),
 		},
+		{
+			ID:    metrics.IDTraceFiltered,
+			Value: metrics.MetricValue(m.traceFiltered),
+		},
 	})
 
 	m.traceCacheHit = 0
 	m.traceCacheMiss = 0
+	m.traceFiltered = 0
 }
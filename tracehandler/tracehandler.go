@@ -15,6 +15,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
 	"go.opentelemetry.io/ebpf-profiler/times"
 
 	"go.opentelemetry.io/ebpf-profiler/host"
@@ -34,6 +35,16 @@ type Times interface {
 // symbolization efforts.
 var traceCacheLifetime = 5 * time.Minute
 
+// wakersCacheSize is the number of recent wakeup traces whose hashes are kept to link
+// them to the off-cpu traces of the woken up tasks.
+const wakersCacheSize = 4096
+
+// wakeupKey identifies the wakeup trace of a waker.
+type wakeupKey struct {
+	tid   libpf.PID
+	ktime times.KTime
+}
+
 // TraceProcessor is an interface used by traceHandler to convert traces
 // from a form received from eBPF to the form we wish to dispatch to the
 // collection agent.
@@ -55,20 +66,37 @@ type TraceProcessor interface {
 	ProcessedUntil(traceCaptureKTime times.KTime)
 }
 
+// TraceFilter decides whether the traces of a process are reported.
+type TraceFilter interface {
+	// Allowed returns true if the traces of processes in the cgroup cgroupPath and the
+	// container containerID are reported. Both values are empty if they are unknown.
+	Allowed(cgroupPath, containerID string) bool
+}
+
 // traceHandler provides functions for handling new traces and trace count updates
 // from the eBPF components.
 type traceHandler struct {
 	// Metrics
 	traceCacheHit  uint64
 	traceCacheMiss uint64
+	traceFiltered  uint64
 
 	traceProcessor TraceProcessor
 
+	// traceFilter drops the traces of processes that are not profiled, nil if disabled.
+	// It complements the filtering in eBPF, that is not available on all systems.
+	traceFilter TraceFilter
+
 	// traceCache stores mappings from BPF hashes to symbolized traces. This allows
 	// avoiding the overhead of re-doing user-mode symbolization of traces that
 	// we have recently seen already.
 	traceCache *lru.SyncedLRU[host.TraceHash, libpf.Trace]
 
+	// wakers stores the hashes of recent wakeup traces. The wakeup trace of a waker is
+	// usually handled before the off-cpu trace of the woken up task, as the task has to
+	// be switched onto a CPU first.
+	wakers *lru.LRU[wakeupKey, libpf.TraceHash]
+
 	// reporter instance to use to send out traces.
 	reporter reporter.TraceReporter
 
@@ -77,7 +105,8 @@ type traceHandler struct {
 
 // newTraceHandler creates a new traceHandler
 func newTraceHandler(ctx context.Context, rep reporter.TraceReporter,
-	traceProcessor TraceProcessor, intervals Times, cacheSize uint32) (*traceHandler, error) {
+	traceProcessor TraceProcessor, traceFilter TraceFilter, intervals Times,
+	cacheSize uint32) (*traceHandler, error) {
 	traceCache, err := lru.NewSynced[host.TraceHash, libpf.Trace](
 		cacheSize, func(k host.TraceHash) uint32 { return uint32(k) })
 	if err != nil {
@@ -86,6 +115,12 @@ func newTraceHandler(ctx context.Context, rep reporter.TraceReporter,
 	// Do not hold elements indefinitely in the cache.
 	traceCache.SetLifetime(traceCacheLifetime)
 
+	wakers, err := lru.New[wakeupKey, libpf.TraceHash](wakersCacheSize,
+		func(k wakeupKey) uint32 { return uint32(k.tid) ^ uint32(k.ktime) })
+	if err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 
@@ -109,13 +144,21 @@ func newTraceHandler(ctx context.Context, rep reporter.TraceReporter,
 
 	return &traceHandler{
 		traceProcessor: traceProcessor,
+		traceFilter:    traceFilter,
 		traceCache:     traceCache,
+		wakers:         wakers,
 		reporter:       rep,
 		times:          intervals,
 	}, nil
 }
 
 func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
+	if m.traceFilter != nil &&
+		!m.traceFilter.Allowed(bpfTrace.CgroupPath, bpfTrace.ContainerID) {
+		m.traceFiltered++
+		return
+	}
+
 	meta := &samples.TraceEventMeta{
 		Timestamp:      libpf.UnixTime64(bpfTrace.KTime.UnixNano()),
 		Comm:           bpfTrace.Comm,
@@ -128,13 +171,25 @@ func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
 		ContainerID:    bpfTrace.ContainerID,
 		Origin:         bpfTrace.Origin,
 		OffTime:        bpfTrace.OffTime,
+		Addr:           bpfTrace.Addr,
+		TaskState:      bpfTrace.TaskState,
+		WaitChannel:    bpfTrace.WaitChannel,
+		WakerPID:       bpfTrace.WakerPID,
+		WakerTID:       bpfTrace.WakerTID,
 		EnvVars:        bpfTrace.EnvVars,
 	}
+	if bpfTrace.WakerTID != 0 {
+		meta.WakerHash, _ = m.wakers.Get(wakeupKey{
+			tid:   bpfTrace.WakerTID,
+			ktime: bpfTrace.WakerKTime,
+		})
+	}
 
 	if trace, exists := m.traceCache.GetAndRefresh(bpfTrace.Hash,
 		traceCacheLifetime); exists {
 		m.traceCacheHit++
 		// Fast path
+		m.addWaker(bpfTrace, trace.Hash)
 		meta.APMServiceName = m.traceProcessor.MaybeNotifyAPMAgent(bpfTrace, trace.Hash, 1)
 		if err := m.reporter.ReportTraceEvent(&trace, meta); err != nil {
 			log.Errorf("Failed to report trace event: %v", err)
@@ -146,6 +201,7 @@ func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
 	// Slow path: convert trace.
 	umTrace := m.traceProcessor.ConvertTrace(bpfTrace)
 	m.traceCache.Add(bpfTrace.Hash, *umTrace)
+	m.addWaker(bpfTrace, umTrace.Hash)
 
 	meta.APMServiceName = m.traceProcessor.MaybeNotifyAPMAgent(bpfTrace, umTrace.Hash, 1)
 	if err := m.reporter.ReportTraceEvent(umTrace, meta); err != nil {
@@ -153,15 +209,25 @@ func (m *traceHandler) HandleTrace(bpfTrace *host.Trace) {
 	}
 }
 
+// addWaker keeps the hash of wakeup traces to link them to the off-cpu traces of the
+// woken up tasks.
+func (m *traceHandler) addWaker(bpfTrace *host.Trace, hash libpf.TraceHash) {
+	if bpfTrace.Origin != support.TraceOriginWakeup {
+		return
+	}
+	m.wakers.Add(wakeupKey{tid: bpfTrace.TID, ktime: bpfTrace.KTime}, hash)
+}
+
 // Start starts a goroutine that receives and processes trace updates over
 // the given channel. Updates are sent periodically to the collection agent.
 // The returned channel allows the caller to wait for the background worker
-// to exit after a cancellation through the context.
+// to exit after a cancellation through the context. Specify nil for traceFilter
+// to report the traces of all processes.
 func Start(ctx context.Context, rep reporter.TraceReporter, traceProcessor TraceProcessor,
-	traceInChan <-chan *host.Trace, intervals Times, cacheSize uint32,
+	traceFilter TraceFilter, traceInChan <-chan *host.Trace, intervals Times, cacheSize uint32,
 ) (workerExited <-chan libpf.Void, err error) {
 	handler, err :=
-		newTraceHandler(ctx, rep, traceProcessor, intervals, cacheSize)
+		newTraceHandler(ctx, rep, traceProcessor, traceFilter, intervals, cacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create traceHandler: %v", err)
 	}
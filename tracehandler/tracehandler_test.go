@@ -14,6 +14,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/host"
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/reporter/samples"
+	"go.opentelemetry.io/ebpf-profiler/support"
 	"go.opentelemetry.io/ebpf-profiler/times"
 	"go.opentelemetry.io/ebpf-profiler/tracehandler"
 )
@@ -107,7 +108,7 @@ func TestTraceHandler(t *testing.T) {
 			traceChan := make(chan *host.Trace)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			exitNotify, err := tracehandler.Start(ctx, r, &fakeTraceProcessor{},
+			exitNotify, err := tracehandler.Start(ctx, r, &fakeTraceProcessor{}, nil,
 				traceChan, defaultTimes(), 128)
 			require.NoError(t, err)
 
@@ -124,3 +125,42 @@ func TestTraceHandler(t *testing.T) {
 		})
 	}
 }
+
+type metaReporter struct {
+	metas []*samples.TraceEventMeta
+}
+
+func (m *metaReporter) ReportTraceEvent(_ *libpf.Trace, meta *samples.TraceEventMeta) error {
+	m.metas = append(m.metas, meta)
+	return nil
+}
+
+func TestTraceHandlerWakers(t *testing.T) {
+	r := &metaReporter{}
+
+	traceChan := make(chan *host.Trace)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exitNotify, err := tracehandler.Start(ctx, r, &fakeTraceProcessor{}, nil,
+		traceChan, defaultTimes(), 128)
+	require.NoError(t, err)
+
+	// The wakeup trace of the waker, followed by the off-cpu traces of two tasks of
+	// which only the first was woken up by this wakeup.
+	traceChan <- &host.Trace{Hash: host.TraceHash(1), PID: 4, TID: 5, KTime: 100,
+		Origin: support.TraceOriginWakeup}
+	traceChan <- &host.Trace{Hash: host.TraceHash(2), PID: 6, TID: 6,
+		Origin: support.TraceOriginOffCPU, WakerPID: 4, WakerTID: 5, WakerKTime: 100}
+	traceChan <- &host.Trace{Hash: host.TraceHash(3), PID: 7, TID: 7,
+		Origin: support.TraceOriginOffCPU, WakerPID: 4, WakerTID: 5, WakerKTime: 200}
+
+	cancel()
+	<-exitNotify
+
+	require.Len(t, r.metas, 3)
+	require.Equal(t, libpf.PID(4), r.metas[1].WakerPID)
+	require.Equal(t, libpf.PID(5), r.metas[1].WakerTID)
+	require.Equal(t, libpf.NewTraceHash(1, 1), r.metas[1].WakerHash)
+	require.Equal(t, libpf.PID(5), r.metas[2].WakerTID)
+	require.True(t, r.metas[2].WakerHash.IsZero())
+}
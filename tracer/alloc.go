@@ -0,0 +1,232 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+	"go.opentelemetry.io/ebpf-profiler/periodiccaller"
+	"go.opentelemetry.io/ebpf-profiler/reporter"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	"go.opentelemetry.io/ebpf-profiler/times"
+	"go.opentelemetry.io/ebpf-profiler/util"
+)
+
+// allocTrackedInterval is the interval at which the allocations tracked by the eBPF
+// programs are reported, so that the reporter stops tracking evicted allocations.
+const allocTrackedInterval = time.Minute
+
+// allocFunction describes how an allocation function is hooked.
+type allocFunction struct {
+	// symbol is the name of the function.
+	symbol string
+	// progName is the name of the eBPF program attached to the function entry.
+	progName string
+	// retProgName is the name of the eBPF program attached to the function return,
+	// empty if the function does not return a new allocation.
+	retProgName string
+}
+
+// allocFunctions are the hooked allocation functions. glibc, musl, jemalloc and
+// tcmalloc all export them with their standard names.
+var allocFunctions = []allocFunction{
+	{symbol: "malloc", progName: "uprobe__malloc", retProgName: "uretprobe__alloc"},
+	{symbol: "calloc", progName: "uprobe__calloc", retProgName: "uretprobe__alloc"},
+	{symbol: "realloc", progName: "uprobe__realloc", retProgName: "uretprobe__realloc"},
+	{symbol: "free", progName: "uprobe__free"},
+}
+
+// defaultAllocLibraries are glob patterns of the well-known locations of allocator
+// libraries, which are hooked if no allocator libraries are configured. They are
+// looked up in the mount namespace of the agent, so the allocator libraries of
+// containers are only hooked if they are the same files. Other libraries can be
+// configured with paths below /proc/PID/root.
+var defaultAllocLibraries = []string{
+	"/lib*/libc.so.6",
+	"/usr/lib*/libc.so.6",
+	"/lib/*-linux-gnu/libc.so.6",
+	"/usr/lib/*-linux-gnu/libc.so.6",
+	"/lib/ld-musl-*.so.1",
+	"/usr/lib*/libjemalloc.so.2",
+	"/usr/lib/*-linux-gnu/libjemalloc.so.2",
+	"/usr/lib*/libtcmalloc*.so.4",
+	"/usr/lib/*-linux-gnu/libtcmalloc*.so.4",
+}
+
+// allocProgs returns the loader helpers of the allocation profiling programs.
+func allocProgs(enable bool) []progLoaderHelper {
+	progs := make([]progLoaderHelper, 0, 2*len(allocFunctions))
+	seen := make(libpf.Set[string], 2*len(allocFunctions))
+	for _, function := range allocFunctions {
+		for _, name := range []string{function.progName, function.retProgName} {
+			if _, ok := seen[name]; ok || name == "" {
+				continue
+			}
+			seen[name] = libpf.Void{}
+			progs = append(progs, progLoaderHelper{
+				name:             name,
+				noTailCallTarget: true,
+				enable:           enable,
+			})
+		}
+	}
+	return progs
+}
+
+// allocLibraryPaths returns the paths of the allocator libraries to hook. Without
+// configured libraries, the existing well-known libraries are returned. Libraries
+// reached through several paths are only returned once, as uprobes on the same file
+// would otherwise sample its allocations multiple times. Paths are not resolved, so
+// that paths below /proc/PID/root refer to the libraries of the process PID.
+func allocLibraryPaths(libraries []string) ([]string, error) {
+	if len(libraries) == 0 {
+		for _, pattern := range defaultAllocLibraries {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			libraries = append(libraries, matches...)
+		}
+		if len(libraries) == 0 {
+			return nil, errors.New("no allocator libraries found")
+		}
+	}
+
+	paths := make([]string, 0, len(libraries))
+	seen := make(libpf.Set[util.OnDiskFileIdentifier], len(libraries))
+	for _, library := range libraries {
+		var st unix.Stat_t
+		if err := unix.Stat(library, &st); err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %v", library, err)
+		}
+		file := util.OnDiskFileIdentifier{DeviceID: st.Dev, InodeNum: st.Ino}
+		if _, ok := seen[file]; ok {
+			continue
+		}
+		seen[file] = libpf.Void{}
+		paths = append(paths, library)
+	}
+	return paths, nil
+}
+
+// AttachAllocProbes attaches the allocation profiling programs to the allocation
+// functions of the allocator libraries. If allocations are tracked until they are
+// freed, their frees and the tracked allocations are forwarded to the reporter until
+// ctx is done.
+//
+// The probes trap on every call of the allocation functions in every process that
+// maps the allocator libraries, not only on sampled calls. The uretprobes of malloc,
+// calloc and realloc cost a second trap per call. If a single process is profiled
+// without its children, the probes are limited to it.
+func (t *Tracer) AttachAllocProbes(ctx context.Context) error {
+	libraries, err := allocLibraryPaths(t.allocLibraries)
+	if err != nil {
+		return fmt.Errorf("failed to determine allocator libraries: %v", err)
+	}
+
+	for _, library := range libraries {
+		if err = t.attachAllocLibrary(library); err != nil {
+			return err
+		}
+	}
+
+	if !t.allocInUse {
+		return nil
+	}
+	allocReporter, ok := t.reporter.(reporter.AllocationReporter)
+	if !ok {
+		return errors.New("reporter does not support tracking allocations in use")
+	}
+	startPerfEventMonitor(ctx, t.ebpfMaps["alloc_frees"], func(data []byte) {
+		event := (*support.AllocFree)(unsafe.Pointer(&data[0]))
+		allocReporter.ReportAllocationFree(libpf.PID(event.Key.Pid), event.Key.Addr,
+			libpf.UnixTime64(times.KTime(event.Ktime).UnixNano()))
+	}, 16*os.Getpagesize())
+
+	allocInUse := t.ebpfMaps["alloc_in_use"]
+	periodiccaller.Start(ctx, allocTrackedInterval, func() {
+		timestamp := libpf.UnixTime64(time.Now().UnixNano())
+		tracked := make(libpf.Set[support.AllocKey], support.MaxAllocsInUse)
+		var key support.AllocKey
+		var val uint8
+		iter := allocInUse.Iterate()
+		for iter.Next(&key, &val) {
+			tracked[key] = libpf.Void{}
+		}
+		if err := iter.Err(); err != nil {
+			log.Warnf("Failed to read the tracked allocations: %v", err)
+			return
+		}
+		allocReporter.ReportAllocationsTracked(tracked, timestamp)
+	})
+	return nil
+}
+
+// attachAllocLibrary attaches the allocation profiling programs to the allocation
+// functions of library. Functions that library does not export are skipped.
+func (t *Tracer) attachAllocLibrary(library string) error {
+	ef, err := pfelf.Open(library)
+	if err != nil {
+		return fmt.Errorf("failed to open allocator library %s: %v", library, err)
+	}
+	defer ef.Close()
+
+	executable, err := link.OpenExecutable(library)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", library, err)
+	}
+
+	var attached int
+	for _, function := range allocFunctions {
+		offset, err := symbolOffset(ef, function.symbol)
+		if errors.Is(err, pfelf.ErrSymbolNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s in %s: %v", function.symbol, library, err)
+		}
+
+		prog, ok := t.ebpfProgs[function.progName]
+		if !ok {
+			return fmt.Errorf("program %s is not available", function.progName)
+		}
+		hookName := library + ":" + function.symbol
+		opts := &link.UprobeOptions{Address: offset, PID: int(t.allocPID)}
+		uprobeLink, err := executable.Uprobe(function.symbol, prog, opts)
+		if err != nil {
+			return fmt.Errorf("failed to attach uprobe to %s: %v", hookName, err)
+		}
+		t.hooks[hookPoint{group: "alloc", name: hookName}] = uprobeLink
+
+		if function.retProgName != "" {
+			retProg, ok := t.ebpfProgs[function.retProgName]
+			if !ok {
+				return fmt.Errorf("program %s is not available", function.retProgName)
+			}
+			uretprobeLink, err := executable.Uretprobe(function.symbol, retProg, opts)
+			if err != nil {
+				return fmt.Errorf("failed to attach uretprobe to %s: %v", hookName, err)
+			}
+			t.hooks[hookPoint{group: "alloc_return", name: hookName}] = uretprobeLink
+		}
+		attached++
+	}
+	if attached == 0 {
+		return fmt.Errorf("no allocation functions found in %s", library)
+	}
+	log.Infof("Attached allocation profiling to %d functions of %s", attached, library)
+	return nil
+}
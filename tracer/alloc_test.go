@@ -0,0 +1,33 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocLibraryPaths(t *testing.T) {
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libc.so.6")
+	require.NoError(t, os.WriteFile(library, nil, 0o644))
+	link := filepath.Join(dir, "libc.so")
+	require.NoError(t, os.Symlink(library, link))
+	other := filepath.Join(dir, "libjemalloc.so.2")
+	require.NoError(t, os.WriteFile(other, nil, 0o644))
+
+	// Paths below /proc/PID/root are kept, as resolving them leaves the mount
+	// namespace of the process. Each file is only hooked once.
+	procRoot := filepath.Join("/proc", "self", "root") + library
+	paths, err := allocLibraryPaths([]string{procRoot, library, link, other})
+	require.NoError(t, err)
+	assert.Equal(t, []string{procRoot, other}, paths)
+
+	_, err = allocLibraryPaths([]string{filepath.Join(dir, "missing.so")})
+	assert.Error(t, err)
+}
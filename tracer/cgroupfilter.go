@@ -0,0 +1,65 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"context"
+	"errors"
+
+	cebpf "github.com/cilium/ebpf"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/periodiccaller"
+	pm "go.opentelemetry.io/ebpf-profiler/processmanager"
+)
+
+// StartCgroupFilter periodically writes the IDs of the cgroups denied by filter to the
+// eBPF map denied_cgroups, so that their processes are skipped before unwinding. This
+// also picks up new cgroups and updates of the filter rules. Without the cgroup v2
+// hierarchy, the filter is only applied in user space by the trace handler.
+func (t *Tracer) StartCgroupFilter(ctx context.Context, filter *pm.CgroupFilter) {
+	deniedCgroups := t.ebpfMaps["denied_cgroups"]
+	denied := libpf.Set[uint64]{}
+
+	syncDenied := func(current map[uint64]string) {
+		for id := range denied {
+			if _, ok := current[id]; ok {
+				continue
+			}
+			if err := deniedCgroups.Delete(id); err != nil &&
+				!errors.Is(err, cebpf.ErrKeyNotExist) {
+				log.Errorf("Failed to remove cgroup %d from denied cgroups: %v", id, err)
+				continue
+			}
+			delete(denied, id)
+		}
+		for id, cgroupPath := range current {
+			if _, ok := denied[id]; ok {
+				continue
+			}
+			if err := deniedCgroups.Update(id, true, cebpf.UpdateAny); err != nil {
+				log.Errorf("Failed to add cgroup %s to denied cgroups: %v", cgroupPath, err)
+				continue
+			}
+			denied[id] = libpf.Void{}
+		}
+	}
+
+	current, err := filter.DeniedCgroupIDs()
+	if err != nil {
+		log.Infof("Filtering cgroups only in user space: %v", err)
+		return
+	}
+	syncDenied(current)
+
+	periodiccaller.Start(ctx, t.intervals.MonitorInterval(), func() {
+		current, err := filter.DeniedCgroupIDs()
+		if err != nil {
+			log.Warnf("Failed to determine denied cgroups: %v", err)
+			return
+		}
+		syncDenied(current)
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+)
+
+// futexFunction is the kernel function that implements the futex syscalls.
+const futexFunction = "do_futex"
+
+// mutexLockWait describes the slow path of the mutex lock function of a C library.
+type mutexLockWait struct {
+	// pattern is a glob pattern of the well-known locations of the library.
+	pattern string
+	// symbol is the name of the function that waits for a contended mutex. Its first
+	// argument is the address of the mutex.
+	symbol string
+}
+
+// mutexLockWaits are the hooked slow paths of the mutex lock functions. glibc waits
+// for contended mutexes in __lll_lock_wait, which is part of libpthread before glibc
+// 2.34. musl calls pthread_mutex_timedlock if locking a mutex without waiting failed.
+var mutexLockWaits = []mutexLockWait{
+	{pattern: "/lib*/libc.so.6", symbol: "__lll_lock_wait"},
+	{pattern: "/usr/lib*/libc.so.6", symbol: "__lll_lock_wait"},
+	{pattern: "/lib/*-linux-gnu/libc.so.6", symbol: "__lll_lock_wait"},
+	{pattern: "/usr/lib/*-linux-gnu/libc.so.6", symbol: "__lll_lock_wait"},
+	{pattern: "/lib*/libpthread.so.0", symbol: "__lll_lock_wait"},
+	{pattern: "/usr/lib*/libpthread.so.0", symbol: "__lll_lock_wait"},
+	{pattern: "/lib/*-linux-gnu/libpthread.so.0", symbol: "__lll_lock_wait"},
+	{pattern: "/usr/lib/*-linux-gnu/libpthread.so.0", symbol: "__lll_lock_wait"},
+	{pattern: "/lib/ld-musl-*.so.1", symbol: "pthread_mutex_timedlock"},
+}
+
+// contentionProgs returns the loader helpers of the lock contention profiling programs.
+func contentionProgs(enable bool) []progLoaderHelper {
+	progs := make([]progLoaderHelper, 0, 4)
+	for _, name := range []string{
+		"kprobe__do_futex",
+		"kretprobe__do_futex",
+		"uprobe__mutex_lock_wait",
+		"uretprobe__mutex_lock_wait",
+	} {
+		progs = append(progs, progLoaderHelper{
+			name:             name,
+			noTailCallTarget: true,
+			enable:           enable,
+		})
+	}
+	return progs
+}
+
+// StartContentionProfiling starts lock contention profiling by attaching the programs
+// to the futex syscall implementation and to the slow paths of the mutex lock
+// functions of the C libraries that are found.
+func (t *Tracer) StartContentionProfiling() error {
+	kprobeProg, ok := t.ebpfProgs["kprobe__do_futex"]
+	if !ok {
+		return errors.New("contention program kprobe__do_futex is not available")
+	}
+	kretprobeProg, ok := t.ebpfProgs["kretprobe__do_futex"]
+	if !ok {
+		return errors.New("contention program kretprobe__do_futex is not available")
+	}
+
+	// Attach the return hook first, so that no sampled wait misses its end.
+	kretprobeLink, err := link.Kretprobe(futexFunction, kretprobeProg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach kretprobe to %s: %v", futexFunction, err)
+	}
+	t.hooks[hookPoint{group: "contention_return", name: futexFunction}] = kretprobeLink
+
+	kprobeLink, err := link.Kprobe(futexFunction, kprobeProg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach kprobe to %s: %v", futexFunction, err)
+	}
+	t.hooks[hookPoint{group: "contention", name: futexFunction}] = kprobeLink
+
+	return t.attachMutexLockWaits()
+}
+
+// attachMutexLockWaits attaches the lock contention profiling programs to the slow
+// paths of the mutex lock functions. Libraries that are not found are skipped, as
+// contention on their mutexes is still profiled by its futex waits.
+func (t *Tracer) attachMutexLockWaits() error {
+	uprobeProg, ok := t.ebpfProgs["uprobe__mutex_lock_wait"]
+	if !ok {
+		return errors.New("contention program uprobe__mutex_lock_wait is not available")
+	}
+	uretprobeProg, ok := t.ebpfProgs["uretprobe__mutex_lock_wait"]
+	if !ok {
+		return errors.New("contention program uretprobe__mutex_lock_wait is not available")
+	}
+
+	// Libraries reached through several paths are only hooked once, as their waits
+	// would otherwise be tracked multiple times.
+	seen := make(libpf.Set[string])
+	for _, wait := range mutexLockWaits {
+		matches, err := filepath.Glob(wait.pattern)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			library, err := filepath.EvalSymlinks(match)
+			if err != nil {
+				return err
+			}
+			if _, ok := seen[library]; ok {
+				continue
+			}
+			seen[library] = libpf.Void{}
+
+			offset, err := binaryOffset(library, wait.symbol)
+			if errors.Is(err, pfelf.ErrSymbolNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s in %s: %v", wait.symbol, library, err)
+			}
+
+			executable, err := link.OpenExecutable(library)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %v", library, err)
+			}
+			hookName := library + ":" + wait.symbol
+			uretprobeLink, err := executable.Uretprobe(wait.symbol, uretprobeProg,
+				&link.UprobeOptions{Address: offset})
+			if err != nil {
+				return fmt.Errorf("failed to attach uretprobe to %s: %v", hookName, err)
+			}
+			t.hooks[hookPoint{group: "contention_return", name: hookName}] = uretprobeLink
+
+			uprobeLink, err := executable.Uprobe(wait.symbol, uprobeProg,
+				&link.UprobeOptions{Address: offset})
+			if err != nil {
+				return fmt.Errorf("failed to attach uprobe to %s: %v", hookName, err)
+			}
+			t.hooks[hookPoint{group: "contention", name: hookName}] = uprobeLink
+			log.Infof("Attached lock contention profiling to %s", hookName)
+		}
+	}
+	return nil
+}
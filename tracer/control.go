@@ -0,0 +1,248 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	"go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// ProfilingMode selects when the perf events of the tracer are enabled.
+type ProfilingMode int32
+
+const (
+	// ProfilingAuto enables the perf events, unless probabilistic profiling disabled
+	// them for the current interval.
+	ProfilingAuto ProfilingMode = iota
+	// ProfilingOn enables the perf events regardless of probabilistic profiling.
+	ProfilingOn
+	// ProfilingOff disables the perf events.
+	ProfilingOff
+)
+
+func (m ProfilingMode) String() string {
+	switch m {
+	case ProfilingAuto:
+		return "auto"
+	case ProfilingOn:
+		return "on"
+	case ProfilingOff:
+		return "off"
+	}
+	return fmt.Sprintf("ProfilingMode(%d)", int32(m))
+}
+
+// Status is a snapshot of the live state of the tracer.
+type Status struct {
+	// Mode is the profiling mode set with SetProfilingMode.
+	Mode ProfilingMode
+	// Profiling tells whether the perf events are enabled.
+	Profiling bool
+	// Paused tells whether profiling is paused with PauseProfiling.
+	Paused bool
+	// SamplesPerSecond is the sampling frequency of the perf events of the CPU clock.
+	SamplesPerSecond int
+	// OffCPU tells whether off-cpu profiling is running.
+	OffCPU bool
+	// Tracers holds the tracers whose unwinders are switched on.
+	Tracers types.IncludedTracers
+}
+
+// schedSwitchHook is the hook that starts the recording of off-cpu traces.
+var schedSwitchHook = hookPoint{group: "sched", name: "sched_switch"}
+
+// Status returns the live state of the tracer.
+func (t *Tracer) Status() Status {
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
+	status := Status{
+		Mode:             ProfilingMode(t.profilingMode.Load()),
+		Profiling:        t.profiling.Load(),
+		Paused:           t.paused.Load(),
+		SamplesPerSecond: t.samplesPerSecond,
+		Tracers:          t.activeTracers,
+	}
+	if t.sampling != nil {
+		status.SamplesPerSecond = t.sampling.current()
+	}
+	_, status.OffCPU = t.hooks[schedSwitchHook]
+	return status
+}
+
+// SetProfilingMode selects when the perf events are enabled.
+func (t *Tracer) SetProfilingMode(mode ProfilingMode) {
+	if ProfilingMode(t.profilingMode.Swap(int32(mode))) == mode {
+		return
+	}
+	log.Infof("Changed profiling mode to %v", mode)
+	t.updatePerfEvents()
+}
+
+// HoldProfiling enables the perf events regardless of the profiling mode and of
+// probabilistic profiling, until the returned function is called. Pausing profiling
+// still disables them.
+func (t *Tracer) HoldProfiling() (release func()) {
+	t.profilingHolds.Add(1)
+	t.updatePerfEvents()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.profilingHolds.Add(-1)
+			t.updatePerfEvents()
+		})
+	}
+}
+
+// SetSamplingFrequency changes the sampling frequency of the perf events of the CPU
+// clock to frequency Hz. With adaptive sampling, frequency becomes the upper bound of
+// the adapted frequency. It requires a tracer that was created with AdjustableSampling
+// or adaptive sampling.
+func (t *Tracer) SetSamplingFrequency(frequency int) error {
+	if t.sampling == nil {
+		return errors.New("sampling frequency is not adjustable")
+	}
+	if frequency < 1 {
+		return fmt.Errorf("invalid sampling frequency: %d", frequency)
+	}
+	t.sampling.setMaxFrequency(frequency)
+	t.applySamplingFrequency()
+	return nil
+}
+
+// wakeupHooks are the hooks that attribute off-cpu traces to their wakers, in the
+// order in which they are detached.
+var wakeupHooks = []hookPoint{
+	{group: "sched", name: "sched_waking"},
+	{group: "wakeup", name: "try_to_wake_up"},
+}
+
+// SetOffCPUProfiling switches off-cpu profiling on or off. Switching it on requires
+// that StartOffCPUProfiling was called before. Switching it off detaches the hooks of
+// sched_switch and of the wakeups. The kprobe on finish_task_switch stays attached,
+// as it completes the off-cpu traces of the tasks that are switched out when off-cpu
+// profiling is switched off. Afterwards, it only costs a map lookup per task switch.
+func (t *Tracer) SetOffCPUProfiling(enable bool) error {
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+	return t.setOffCPUProfiling(enable)
+}
+
+// setOffCPUProfiling implements SetOffCPUProfiling. Caller must hold controlMu.
+func (t *Tracer) setOffCPUProfiling(enable bool) error {
+	hook, attached := t.hooks[schedSwitchHook]
+	if enable == attached {
+		return nil
+	}
+	if !enable {
+		delete(t.hooks, schedSwitchHook)
+		if err := hook.Close(); err != nil {
+			return fmt.Errorf("failed to detach from tracepoint sched_switch: %v", err)
+		}
+		for _, hookPoint := range wakeupHooks {
+			if hook, ok := t.hooks[hookPoint]; ok {
+				delete(t.hooks, hookPoint)
+				if err := hook.Close(); err != nil {
+					return fmt.Errorf("failed to detach from %s: %v", hookPoint.name, err)
+				}
+			}
+		}
+		log.Infof("Stopped off-cpu profiling")
+		return nil
+	}
+
+	if !t.offCPUStarted {
+		return errors.New("off-cpu profiling is not configured")
+	}
+	tpLink, err := link.Tracepoint("sched", "sched_switch",
+		t.ebpfProgs["tracepoint__sched_switch"], nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach to tracepoint sched_switch: %v", err)
+	}
+	t.hooks[schedSwitchHook] = tpLink
+	if t.offCPUWakeups {
+		if err = t.attachWakeups(); err != nil {
+			return err
+		}
+	}
+	log.Infof("Resumed off-cpu profiling")
+	return nil
+}
+
+// SetOffCPUThreshold changes the probability with which off-cpu traces are recorded.
+// A threshold of 0 stops off-cpu profiling. Any other threshold requires that
+// StartOffCPUProfiling was called before.
+func (t *Tracer) SetOffCPUThreshold(threshold uint32) error {
+	// The lock also serializes the update of system_config.
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
+	if threshold == 0 {
+		return t.setOffCPUProfiling(false)
+	}
+	if !t.offCPUStarted {
+		return errors.New("off-cpu profiling is not configured")
+	}
+
+	key0 := uint32(0)
+	var syscfg support.SystemConfig
+	sysConfigMap := t.ebpfMaps["system_config"]
+	if err := sysConfigMap.Lookup(unsafe.Pointer(&key0), unsafe.Pointer(&syscfg)); err != nil {
+		return fmt.Errorf("failed to read system config: %v", err)
+	}
+	syscfg.Off_cpu_threshold = threshold
+	if err := sysConfigMap.Update(unsafe.Pointer(&key0), unsafe.Pointer(&syscfg),
+		cebpf.UpdateExist); err != nil {
+		return fmt.Errorf("failed to update system config: %v", err)
+	}
+	return t.setOffCPUProfiling(true)
+}
+
+// SetProbabilisticProfiling changes the interval and the threshold of probabilistic
+// profiling. A threshold of ProbabilisticThresholdMax stops probabilistic profiling
+// and any lower threshold starts it, bound to ctx.
+func (t *Tracer) SetProbabilisticProfiling(ctx context.Context, interval time.Duration,
+	threshold uint) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid probabilistic interval: %v", interval)
+	}
+	if threshold > ProbabilisticThresholdMax {
+		return fmt.Errorf("invalid probabilistic threshold: %d", threshold)
+	}
+
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
+	t.probabilisticInterval, t.probabilisticThreshold = interval, threshold
+	if threshold < ProbabilisticThresholdMax {
+		t.startProbabilisticProfiling(ctx)
+		return nil
+	}
+	if t.stopProbabilistic != nil {
+		t.stopProbabilistic()
+		t.stopProbabilistic = nil
+		t.probabilisticDisabled.Store(false)
+		t.updatePerfEvents()
+	}
+	return nil
+}
+
+// SetIncludeEnvVars changes the environment variables that are reported for new
+// processes.
+func (t *Tracer) SetIncludeEnvVars(envVars libpf.Set[string]) {
+	t.processManager.SetIncludeEnvVars(envVars)
+}
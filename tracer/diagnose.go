@@ -0,0 +1,330 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/kallsyms"
+	pmebpf "go.opentelemetry.io/ebpf-profiler/processmanager/ebpf"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	"go.opentelemetry.io/ebpf-profiler/times"
+	"go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// CheckStatus is the outcome of a host check.
+type CheckStatus int
+
+const (
+	// CheckPassed means that the host supports the checked capability.
+	CheckPassed CheckStatus = iota
+	// CheckWarning means that the agent runs, but with reduced functionality.
+	CheckWarning
+	// CheckFailed means that the agent does not start on the host.
+	CheckFailed
+	// CheckSkipped means that the check did not run as a check it depends on failed.
+	CheckSkipped
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPassed:
+		return "pass"
+	case CheckWarning:
+		return "warn"
+	case CheckFailed:
+		return "fail"
+	case CheckSkipped:
+		return "skip"
+	}
+	return fmt.Sprintf("CheckStatus(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CheckResult is the result of a host check.
+type CheckResult struct {
+	// Name describes the checked capability.
+	Name string `json:"name"`
+	// Status is the outcome of the check.
+	Status CheckStatus `json:"status"`
+	// Detail holds what the check found.
+	Detail string `json:"detail,omitempty"`
+	// Hint holds how to fix a failure or warning.
+	Hint string `json:"hint,omitempty"`
+}
+
+// hintPrivileges is the remediation of checks that fail for missing privileges.
+const hintPrivileges = "Run the agent as root, or with the capabilities CAP_BPF, " +
+	"CAP_PERFMON and CAP_SYS_ADMIN."
+
+// CheckHost runs the checks that the tracer performs on the host at startup and
+// returns their results. It loads the eBPF maps of the tracer temporarily, which
+// requires the same privileges as the agent.
+func CheckHost() []CheckResult {
+	results := make([]CheckResult, 0, 8)
+
+	syscallResult := checkBPFSyscall()
+	results = append(results, syscallResult)
+	hasBPF := syscallResult.Status == CheckPassed
+
+	kmod, kallsymsResult := checkKernelSymbols()
+	results = append(results, kallsymsResult, checkFinishTaskSwitch(kmod), checkBTF())
+
+	var coll *cebpf.CollectionSpec
+	var ebpfMaps map[string]*cebpf.Map
+	if hasBPF {
+		var mapsResult CheckResult
+		coll, ebpfMaps, mapsResult = checkLoadMaps()
+		results = append(results, mapsResult)
+		defer func() {
+			for _, m := range ebpfMaps {
+				_ = m.Close()
+			}
+		}()
+	} else {
+		results = append(results, skipped("eBPF maps", "eBPF syscall"))
+	}
+
+	switch {
+	case ebpfMaps == nil:
+		results = append(results, skipped("bpf_probe_read kernel bug", "eBPF maps"),
+			skipped("System configuration", "eBPF maps"))
+	case kmod == nil:
+		results = append(results, skipped("bpf_probe_read kernel bug", "Kernel symbols"),
+			skipped("System configuration", "Kernel symbols"))
+	default:
+		results = append(results, checkProbeReadBug(coll, ebpfMaps, kmod),
+			checkSystemConfig(coll, ebpfMaps, kmod))
+	}
+
+	if hasBPF {
+		results = append(results, checkBatchOperations())
+	} else {
+		results = append(results, skipped("Batch map operations", "eBPF syscall"))
+	}
+	return results
+}
+
+// skipped returns the result of the check name that did not run as the check
+// dependency failed.
+func skipped(name, dependency string) CheckResult {
+	return CheckResult{
+		Name:   name,
+		Status: CheckSkipped,
+		Detail: fmt.Sprintf("requires a passing %q check", dependency),
+	}
+}
+
+func checkBPFSyscall() CheckResult {
+	result := CheckResult{Name: "eBPF syscall"}
+	if err := ProbeBPFSyscall(); err != nil {
+		result.Status = CheckFailed
+		result.Detail = err.Error()
+		result.Hint = "Use a kernel built with CONFIG_BPF_SYSCALL=y. In a container, " +
+			"make sure that the seccomp profile allows the bpf syscall."
+		return result
+	}
+	result.Detail = "available"
+	return result
+}
+
+// checkKernelSymbols reads the kernel symbols and returns the kernel module, which is
+// nil if the check failed.
+func checkKernelSymbols() (*kallsyms.Module, CheckResult) {
+	result := CheckResult{Name: "Kernel symbols"}
+	symbolizer, err := kallsyms.NewSymbolizer()
+	var kmod *kallsyms.Module
+	if err == nil {
+		kmod, err = symbolizer.GetModuleByName(kallsyms.Kernel)
+	}
+	if err != nil {
+		result.Status = CheckFailed
+		result.Detail = fmt.Sprintf("failed to read kernel symbols: %v", err)
+		result.Hint = "Make sure that /proc/kallsyms is readable. " + hintPrivileges
+		return nil, result
+	}
+	result.Detail = "read from /proc/kallsyms"
+	return kmod, result
+}
+
+// checkFinishTaskSwitch looks up the symbols that off-cpu and run queue profiling
+// attach kprobes to.
+func checkFinishTaskSwitch(kmod *kallsyms.Module) CheckResult {
+	const name = hookSymbolPrefix + " kprobe symbols"
+	if kmod == nil {
+		return skipped(name, "Kernel symbols")
+	}
+	result := CheckResult{Name: name}
+	symbols := kmod.LookupSymbolsByPrefix(hookSymbolPrefix)
+	if len(symbols) == 0 {
+		result.Status = CheckWarning
+		result.Detail = fmt.Sprintf("no %s symbols found", hookSymbolPrefix)
+		result.Hint = "Off-cpu and run queue profiling are not available on this kernel. " +
+			"The symbol can be missing if the kernel inlined it."
+		return result
+	}
+	names := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		names = append(names, string(symbol.Name))
+	}
+	result.Detail = strings.Join(names, ", ")
+	return result
+}
+
+func checkBTF() CheckResult {
+	result := CheckResult{Name: "Kernel BTF"}
+	var syscfg support.SystemConfig
+	if err := parseBTF(&syscfg); err != nil {
+		result.Status = CheckWarning
+		result.Detail = fmt.Sprintf("not available: %v", err)
+		result.Hint = "The agent falls back to binary analysis of the kernel to find the " +
+			"offsets it needs. Use a kernel built with CONFIG_DEBUG_INFO_BTF=y to not " +
+			"depend on it."
+		return result
+	}
+	result.Detail = fmt.Sprintf("task stack %#x, tpbase %#x",
+		syscfg.Task_stack_offset, syscfg.Tpbase_offset)
+	return result
+}
+
+// checkLoadMaps loads the eBPF maps of the tracer, which the checks that run eBPF
+// programs need. The maps are nil if the check failed.
+func checkLoadMaps() (*cebpf.CollectionSpec, map[string]*cebpf.Map, CheckResult) {
+	result := CheckResult{Name: "eBPF maps"}
+	fail := func(err error) (*cebpf.CollectionSpec, map[string]*cebpf.Map, CheckResult) {
+		result.Status = CheckFailed
+		result.Detail = err.Error()
+		result.Hint = hintPrivileges + " Make sure that the memlock limit can be raised."
+		return nil, nil, result
+	}
+
+	coll, err := support.LoadCollectionSpec()
+	if err != nil {
+		return fail(fmt.Errorf("failed to load specification for tracers: %v", err))
+	}
+	if err = buildStackDeltaTemplates(coll); err != nil {
+		return fail(err)
+	}
+
+	cfg := &Config{
+		Intervals:        times.New(5*time.Second, 5*time.Second, time.Minute),
+		SamplesPerSecond: 20,
+	}
+	withRingbuf := features.HaveMapType(cebpf.RingBuf) == nil
+	ebpfMaps := make(map[string]*cebpf.Map)
+	if err = loadAllMaps(coll, cfg, withRingbuf, ebpfMaps); err != nil {
+		for _, m := range ebpfMaps {
+			_ = m.Close()
+		}
+		return fail(err)
+	}
+	//nolint:staticcheck
+	if err = coll.RewriteMaps(ebpfMaps); err != nil {
+		for _, m := range ebpfMaps {
+			_ = m.Close()
+		}
+		return fail(fmt.Errorf("failed to rewrite maps: %v", err))
+	}
+
+	result.Detail = fmt.Sprintf("loaded %d maps", len(ebpfMaps))
+	if !withRingbuf {
+		result.Detail += ", ring buffers are not available"
+	}
+	return coll, ebpfMaps, result
+}
+
+// checkProbeReadBug checks that the kernel is not affected by the bpf_probe_read bug
+// that can freeze the system.
+func checkProbeReadBug(coll *cebpf.CollectionSpec, ebpfMaps map[string]*cebpf.Map,
+	kmod *kallsyms.Module) CheckResult {
+	result := CheckResult{Name: "bpf_probe_read kernel bug"}
+	major, minor, patch, err := GetCurrentKernelVersion()
+	if err != nil {
+		result.Status = CheckFailed
+		result.Detail = err.Error()
+		return result
+	}
+	if !hasProbeReadBug(major, minor, patch) {
+		result.Detail = fmt.Sprintf("kernel %d.%d.%d is not affected", major, minor, patch)
+		return result
+	}
+	if err = checkForMaccessPatch(coll, ebpfMaps, kmod); err != nil {
+		result.Status = CheckFailed
+		result.Detail = fmt.Sprintf("kernel %d.%d.%d may be affected: %v",
+			major, minor, patch, err)
+		result.Hint = "Update the kernel to 6.1.36, 6.3.10, 6.4 or newer. Overriding the " +
+			"check with -no-kernel-version-check risks system freezes."
+		return result
+	}
+	result.Detail = fmt.Sprintf("kernel %d.%d.%d has the fix", major, minor, patch)
+	return result
+}
+
+// checkSystemConfig determines the kernel offsets that the eBPF programs need, as the
+// tracer does with all tracers enabled.
+func checkSystemConfig(coll *cebpf.CollectionSpec, ebpfMaps map[string]*cebpf.Map,
+	kmod *kallsyms.Module) CheckResult {
+	result := CheckResult{Name: "System configuration"}
+	if err := loadSystemConfig(coll, ebpfMaps, kmod, types.AllTracers(),
+		0, 0, 0, 0, false, false, false, false); err != nil {
+		result.Status = CheckFailed
+		result.Detail = err.Error()
+		if errors.Is(err, unix.EPERM) {
+			result.Hint = hintPrivileges
+		} else {
+			result.Hint = "The agent can not determine the kernel offsets on this host. " +
+				"Please report the kernel version and this output upstream."
+		}
+		return result
+	}
+
+	var syscfg support.SystemConfig
+	key0 := uint32(0)
+	if err := ebpfMaps["system_config"].Lookup(unsafe.Pointer(&key0),
+		unsafe.Pointer(&syscfg)); err != nil {
+		log.Debugf("Failed to read system config: %v", err)
+		result.Detail = "offsets determined"
+		return result
+	}
+	result.Detail = fmt.Sprintf("task stack %#x, pt_regs %#x, tpbase %#x",
+		syscfg.Task_stack_offset, syscfg.Stack_ptregs_offset, syscfg.Tpbase_offset)
+	return result
+}
+
+// checkBatchOperations checks that the kernel supports batch operations on the map
+// types that the agent updates in batches.
+func checkBatchOperations() CheckResult {
+	result := CheckResult{Name: "Batch map operations"}
+	var unsupported []string
+	var lastErr error
+	for _, mapType := range []cebpf.MapType{cebpf.Hash, cebpf.LPMTrie} {
+		if err := pmebpf.ProbeBatchOperations(mapType); err != nil {
+			unsupported = append(unsupported, mapType.String())
+			lastErr = err
+		}
+	}
+	if len(unsupported) > 0 {
+		result.Status = CheckWarning
+		result.Detail = fmt.Sprintf("not supported for %s: %v",
+			strings.Join(unsupported, ", "), lastErr)
+		result.Hint = "The agent falls back to single map updates, which take more CPU " +
+			"time. Batch operations are available since Linux 5.6."
+		return result
+	}
+	result.Detail = "supported"
+	return result
+}
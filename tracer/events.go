@@ -13,9 +13,11 @@ import (
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
 	log "github.com/sirupsen/logrus"
 
 	"go.opentelemetry.io/ebpf-profiler/host"
+	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
 	"go.opentelemetry.io/ebpf-profiler/process"
 	"go.opentelemetry.io/ebpf-profiler/support"
@@ -79,42 +81,132 @@ func (t *Tracer) triggerPidEvent(data []byte) {
 	}
 }
 
+// eventRecord is a record that is received by an eventReader.
+type eventRecord struct {
+	// rawSample holds the data of the record. It is re-used across reads.
+	rawSample []byte
+	// lostSamples is the number of records that the kernel dropped, because the
+	// buffer was full. Ring buffers do not report lost records to user-land: the
+	// eBPF code counts them in dedicated metrics instead.
+	lostSamples uint64
+}
+
+// eventReader reads the records that the eBPF code sends to user-land through a
+// perf event array or a ring buffer.
+type eventReader interface {
+	// readInto reads the next record into rec.
+	readInto(rec *eventRecord) error
+	// setDeadline controls how long readInto blocks, like os.File.SetDeadline.
+	setDeadline(t time.Time)
+}
+
+// perfEventReader is an eventReader for BPF_MAP_TYPE_PERF_EVENT_ARRAY maps, that
+// provide one buffer per CPU.
+type perfEventReader struct {
+	reader *perf.Reader
+	record perf.Record
+}
+
+func (r *perfEventReader) readInto(rec *eventRecord) error {
+	r.record.RawSample = rec.rawSample
+	if err := r.reader.ReadInto(&r.record); err != nil {
+		return err
+	}
+	rec.rawSample = r.record.RawSample
+	rec.lostSamples = r.record.LostSamples
+	return nil
+}
+
+func (r *perfEventReader) setDeadline(t time.Time) {
+	r.reader.SetDeadline(t)
+}
+
+// ringbufEventReader is an eventReader for BPF_MAP_TYPE_RINGBUF maps, that provide a
+// single buffer shared by all CPUs and deliver the records in order.
+type ringbufEventReader struct {
+	reader *ringbuf.Reader
+	record ringbuf.Record
+}
+
+func (r *ringbufEventReader) readInto(rec *eventRecord) error {
+	r.record.RawSample = rec.rawSample
+	if err := r.reader.ReadInto(&r.record); err != nil {
+		return err
+	}
+	rec.rawSample = r.record.RawSample
+	rec.lostSamples = 0
+	return nil
+}
+
+func (r *ringbufEventReader) setDeadline(t time.Time) {
+	r.reader.SetDeadline(t)
+}
+
+// newEventReader returns an eventReader for eventMap, depending on its type. The
+// size of the per-CPU buffers of perf event arrays is perCPUBufferSize, while the
+// size of ring buffers is set when the map is created.
+func newEventReader(eventMap *ebpf.Map, perCPUBufferSize int) (eventReader, error) {
+	if eventMap.Type() == ebpf.RingBuf {
+		reader, err := ringbuf.NewReader(eventMap)
+		if err != nil {
+			return nil, err
+		}
+		return &ringbufEventReader{reader: reader}, nil
+	}
+	reader, err := perf.NewReader(eventMap, perCPUBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return &perfEventReader{reader: reader}, nil
+}
+
+// eventMap returns the map that the eBPF code uses to send the events of the perf
+// event array name to user-land: the ring buffer that replaces it if the kernel
+// supports ring buffers, and the perf event array itself otherwise.
+func (t *Tracer) eventMap(name string) (*ebpf.Map, bool) {
+	if ringbufMap, ok := t.ebpfMaps[name+ringbufSuffix]; ok &&
+		ringbufMap.Type() == ebpf.RingBuf {
+		return ringbufMap, true
+	}
+	eventMap, ok := t.ebpfMaps[name]
+	return eventMap, ok
+}
+
 // startPerfEventMonitor spawns a goroutine that receives events from the given
-// perf event map by waiting for events the kernel. Every event in the buffer
-// will wake up user-land.
+// perf event array or ring buffer map by waiting for events the kernel. Every
+// event in the buffer will wake up user-land.
 //
 // For each received event, triggerFunc is called. triggerFunc may NOT store
 // references into the buffer that it is given: the buffer is re-used across
-// calls. Returns a function that can be called to retrieve perf event array
-// error counts.
+// calls. Returns a function that can be called to retrieve event error counts.
 func startPerfEventMonitor(ctx context.Context, perfEventMap *ebpf.Map,
 	triggerFunc func([]byte), perCPUBufferSize int) func() (lost, noData, readError uint64) {
-	eventReader, err := perf.NewReader(perfEventMap, perCPUBufferSize)
+	eventReader, err := newEventReader(perfEventMap, perCPUBufferSize)
 	if err != nil {
-		log.Fatalf("Failed to setup perf reporting via %s: %v", perfEventMap, err)
+		log.Fatalf("Failed to setup event reporting via %s: %v", perfEventMap, err)
 	}
 
 	var lostEventsCount, readErrorCount, noDataCount atomic.Uint64
 	go func() {
-		var data perf.Record
+		var data eventRecord
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				if err := eventReader.ReadInto(&data); err != nil {
+				if err := eventReader.readInto(&data); err != nil {
 					readErrorCount.Add(1)
 					continue
 				}
-				if data.LostSamples != 0 {
-					lostEventsCount.Add(data.LostSamples)
+				if data.lostSamples != 0 {
+					lostEventsCount.Add(data.lostSamples)
 					continue
 				}
-				if len(data.RawSample) == 0 {
+				if len(data.rawSample) == 0 {
 					noDataCount.Add(1)
 					continue
 				}
-				triggerFunc(data.RawSample)
+				triggerFunc(data.rawSample)
 			}
 		}
 	}()
@@ -128,29 +220,34 @@ func startPerfEventMonitor(ctx context.Context, perfEventMap *ebpf.Map,
 }
 
 // startTraceEventMonitor spawns a goroutine that receives trace events from
-// the kernel by periodically polling the underlying perf event buffer.
-// Events written to the perf event buffer do not wake user-land immediately.
+// the kernel by periodically polling the underlying perf event buffer or ring
+// buffer. Events written to the buffer do not wake user-land immediately.
 //
-// Returns a function that can be called to retrieve perf event array
-// error counts.
+// Returns a function that can be called to retrieve trace event error counts.
 func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 	traceOutChan chan<- *host.Trace) func() []metrics.Metric {
-	eventsMap := t.ebpfMaps["trace_events"]
-	eventReader, err := perf.NewReader(eventsMap,
+	eventsMap, ok := t.eventMap("trace_events")
+	if !ok {
+		log.Fatalf("Map trace_events is not available")
+	}
+	eventReader, err := newEventReader(eventsMap,
 		t.samplesPerSecond*support.Sizeof_Trace)
 	if err != nil {
-		log.Fatalf("Failed to setup perf reporting via %s: %v", eventsMap, err)
+		log.Fatalf("Failed to setup event reporting via %s: %v", eventsMap, err)
 	}
 
 	// A deadline of zero is treated as "no deadline". A deadline in the past
 	// means "always return immediately". We thus set a deadline 1 second after
 	// unix epoch to always ensure the latter behavior.
-	eventReader.SetDeadline(time.Unix(1, 0))
+	eventReader.setDeadline(time.Unix(1, 0))
 
 	var lostEventsCount, readErrorCount, noDataCount atomic.Uint64
+	// maxLatency holds the maximum time between collecting a trace and handing it over
+	// to the trace handler.
+	var maxLatency atomic.Int64
 	go func() {
-		var data perf.Record
-		var oldKTime, minKTime times.KTime
+		var data eventRecord
+		var oldKTime, minKTime, latency times.KTime
 		var eventCount int
 
 		pollTicker := time.NewTicker(t.intervals.TracePollInterval())
@@ -167,20 +264,25 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 				// Continue below
 			}
 
+			// flushed is set if FlushTraces waits for this iteration.
+			var flushed chan libpf.Void
 			select {
 			// This context cancellation check may not execute in timely manner
 			case <-ctx.Done():
 				break PollLoop
 			case <-pollTicker.C:
 				// Continue execution below
+			case flushed = <-t.flushTraces:
+				// Continue execution below
 			}
 
 			eventCount = 0
 			minKTime = 0
+			latency = 0
 
 			// Eagerly read events until the buffer is exhausted or we reach maxEvents
 			for {
-				if err = eventReader.ReadInto(&data); err != nil {
+				if err = eventReader.readInto(&data); err != nil {
 					if !errors.Is(err, os.ErrDeadlineExceeded) {
 						readErrorCount.Add(1)
 					}
@@ -200,11 +302,11 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 				// Regardless, the current data transmission architecture from kernel to user and
 				// the -serial- event processing pipeline in the rest of the agent is not designed
 				// for the data volumes that off-cpu profiling can generate and should be revisited.
-				if data.LostSamples != 0 {
-					lostEventsCount.Add(data.LostSamples)
+				if data.lostSamples != 0 {
+					lostEventsCount.Add(data.lostSamples)
 					continue
 				}
-				if len(data.RawSample) == 0 {
+				if len(data.rawSample) == 0 {
 					noDataCount.Add(1)
 					continue
 				}
@@ -212,14 +314,15 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 				eventCount++
 
 				// Keep track of min KTime seen in this batch processing loop
-				trace := t.loadBpfTrace(data.RawSample, data.CPU)
+				trace := t.loadBpfTrace(data.rawSample)
 				if minKTime == 0 || trace.KTime < minKTime {
 					minKTime = trace.KTime
 				}
 				// TODO: This per-event channel send couples event processing in the rest of
 				// the agent with event reading from the perf buffers slowing down the latter.
 				traceOutChan <- trace
-				if eventCount == maxEvents {
+				latency = max(latency, times.GetKTime()-trace.KTime)
+				if eventCount == maxEvents && flushed == nil {
 					// Break this inner loop to ensure ProcessedUntil logic executes
 					break
 				}
@@ -236,7 +339,7 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 			// that could in theory result in observed KTime going back in time.
 			//
 			// For example, as we don't control ordering of trace events being
-			// written by the kernel in per-CPU buffers across CPU cores, it's
+			// written by the kernel in per-CPU perf buffers across CPU cores, it's
 			// possible that given events generated on different cores with
 			// timestamps t0 < t1 < t2 < t3, this poll loop reads [t3 t1 t2]
 			// in a first iteration and [t0] in a second iteration. If we use
@@ -256,6 +359,19 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 				}
 			}
 			oldKTime = minKTime
+
+			if flushed != nil {
+				// Wait until all trace events read so far have been processed.
+				traceOutChan <- nil
+				close(flushed)
+			}
+
+			for {
+				old := maxLatency.Load()
+				if int64(latency) <= old || maxLatency.CompareAndSwap(old, int64(latency)) {
+					break
+				}
+			}
 		}
 	}()
 
@@ -263,19 +379,38 @@ func (t *Tracer) startTraceEventMonitor(ctx context.Context,
 		lost := lostEventsCount.Swap(0)
 		noData := noDataCount.Swap(0)
 		readError := readErrorCount.Swap(0)
+		latency := time.Duration(maxLatency.Swap(0))
 		return []metrics.Metric{
 			{ID: metrics.IDTraceEventLost, Value: metrics.MetricValue(lost)},
 			{ID: metrics.IDTraceEventNoData, Value: metrics.MetricValue(noData)},
 			{ID: metrics.IDTraceEventReadError, Value: metrics.MetricValue(readError)},
+			{ID: metrics.IDTraceEventLatency, Value: metrics.MetricValue(latency.Milliseconds())},
 		}
 	}
 }
 
+// FlushTraces waits until the trace events that were recorded so far are read from the
+// kernel and processed by the trace handler. It requires StartMapMonitors.
+func (t *Tracer) FlushTraces(ctx context.Context) error {
+	flushed := make(chan libpf.Void)
+	select {
+	case t.flushTraces <- flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // startEventMonitor spawns a goroutine that receives events from the
-// map report_events. Returns a function that can be called to retrieve
-// perf event array metrics.
+// map report_events, or the ring buffer that replaces it. Returns a function
+// that can be called to retrieve event metrics.
 func (t *Tracer) startEventMonitor(ctx context.Context) func() []metrics.Metric {
-	eventMap, ok := t.ebpfMaps["report_events"]
+	eventMap, ok := t.eventMap("report_events")
 	if !ok {
 		log.Fatalf("Map report_events is not available")
 	}
@@ -0,0 +1,84 @@
+//go:build integration && linux
+
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/support"
+	"go.opentelemetry.io/ebpf-profiler/times"
+)
+
+func TestEventMaps(t *testing.T) {
+	coll, err := support.LoadCollectionSpec()
+	require.NoError(t, err)
+	cfg := &Config{
+		Intervals:        times.New(5*time.Second, 5*time.Second, time.Minute),
+		SamplesPerSecond: 20,
+	}
+
+	for _, withRingbuf := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ringbuf=%v", withRingbuf), func(t *testing.T) {
+			if withRingbuf && features.HaveMapType(cebpf.RingBuf) != nil {
+				t.Skip("ring buffers are not supported")
+			}
+
+			ebpfMaps := make(map[string]*cebpf.Map)
+			defer func() {
+				for _, m := range ebpfMaps {
+					_ = m.Close()
+				}
+			}()
+			require.NoError(t, loadAllMaps(coll, cfg, withRingbuf, ebpfMaps))
+
+			if withRingbuf {
+				possibleCPUs, err := cebpf.PossibleCPU()
+				require.NoError(t, err)
+				traceEvents := ebpfMaps["trace_events"+ringbufSuffix]
+				assert.Equal(t, cebpf.RingBuf, traceEvents.Type())
+				assert.Equal(t, traceRingbufSize(possibleCPUs, cfg.SamplesPerSecond,
+					cfg.Intervals.TracePollInterval()), traceEvents.MaxEntries())
+			} else {
+				// The ring buffers are replaced by placeholders that the eBPF
+				// programs can reference.
+				for _, name := range []string{"trace_events", "report_events"} {
+					placeholder := ebpfMaps[name+ringbufSuffix]
+					require.NotNil(t, placeholder, name)
+					assert.Equal(t, cebpf.Array, placeholder.Type())
+					assert.Equal(t, uint32(1), placeholder.MaxEntries())
+				}
+			}
+
+			tracer := &Tracer{ebpfMaps: ebpfMaps}
+			for _, name := range []string{"trace_events", "report_events"} {
+				eventMap, ok := tracer.eventMap(name)
+				require.True(t, ok, name)
+				reader, err := newEventReader(eventMap, os.Getpagesize())
+				require.NoError(t, err)
+				switch reader := reader.(type) {
+				case *ringbufEventReader:
+					assert.True(t, withRingbuf, name)
+					assert.Equal(t, ebpfMaps[name+ringbufSuffix], eventMap)
+					require.NoError(t, reader.reader.Close())
+				case *perfEventReader:
+					assert.False(t, withRingbuf, name)
+					assert.Equal(t, ebpfMaps[name], eventMap)
+					require.NoError(t, reader.reader.Close())
+				default:
+					t.Fatalf("unexpected event reader %T", reader)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"errors"
+	"fmt"
+
+	perf "github.com/elastic/go-perf"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/support"
+	"go.opentelemetry.io/ebpf-profiler/tracer/types"
+)
+
+// perfEventSource describes how traces of a perf event are collected.
+type perfEventSource struct {
+	// progName is the name of the eBPF entry program for the event.
+	progName string
+	// counter configures the perf event.
+	counter perf.Configurator
+	// hardware is true if the event is counted by the PMU, which is not available
+	// on all systems, e.g. in many virtual machines.
+	hardware bool
+}
+
+// perfEventSources maps the origins of the selectable perf events to their sources.
+var perfEventSources = map[libpf.Origin]perfEventSource{
+	support.TraceOriginPageFaults: {
+		progName: "page_faults_entry",
+		counter:  perf.PageFaults,
+	},
+	support.TraceOriginContextSwitches: {
+		progName: "context_switches_entry",
+		counter:  perf.ContextSwitches,
+	},
+	support.TraceOriginCacheMisses: {
+		progName: "cache_misses_entry",
+		counter:  perf.CacheMisses,
+		hardware: true,
+	},
+	support.TraceOriginBranchMisses: {
+		progName: "branch_misses_entry",
+		counter:  perf.BranchMisses,
+		hardware: true,
+	},
+}
+
+// perfEventProgs returns the loader helpers of the entry programs of events.
+func perfEventProgs(events []types.PerfEvent) []progLoaderHelper {
+	progs := make([]progLoaderHelper, 0, len(events))
+	for _, event := range events {
+		progs = append(progs, progLoaderHelper{
+			name:             perfEventSources[event.Origin].progName,
+			noTailCallTarget: true,
+			enable:           true,
+		})
+	}
+	return progs
+}
+
+// attachPerfEvent opens event on each CPU of cpuIDs and attaches its entry program.
+// Hardware events that are not supported by the system are skipped with a warning.
+func (t *Tracer) attachPerfEvent(event types.PerfEvent, cpuIDs []int) ([]*perf.Event, error) {
+	source, ok := perfEventSources[event.Origin]
+	if !ok {
+		return nil, fmt.Errorf("unsupported perf event %s", event.Name)
+	}
+	prog, ok := t.ebpfProgs[source.progName]
+	if !ok {
+		return nil, fmt.Errorf("entry program of perf event %s is not available", event.Name)
+	}
+
+	perfAttribute := new(perf.Attr)
+	if event.Frequency != 0 {
+		perfAttribute.SetSampleFreq(event.Frequency)
+	} else {
+		perfAttribute.SetSamplePeriod(event.Period)
+	}
+	if err := source.counter.Configure(perfAttribute); err != nil {
+		return nil, fmt.Errorf("failed to configure perf event %s: %v", event.Name, err)
+	}
+
+	perfEvents := make([]*perf.Event, 0, len(cpuIDs))
+	closeAll := func() {
+		for _, perfEvent := range perfEvents {
+			_ = perfEvent.Close()
+		}
+	}
+	for _, id := range cpuIDs {
+		perfEvent, err := perf.Open(perfAttribute, perf.AllThreads, id, nil)
+		if err != nil {
+			closeAll()
+			if source.hardware && (errors.Is(err, unix.ENOENT) ||
+				errors.Is(err, unix.EOPNOTSUPP)) {
+				log.Warnf("Perf event %s is not supported on this system", event.Name)
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to open perf event %s on CPU %d: %v",
+				event.Name, id, err)
+		}
+		perfEvents = append(perfEvents, perfEvent)
+		if err := perfEvent.SetBPF(uint32(prog.FD())); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to attach eBPF program to perf event %s: %v",
+				event.Name, err)
+		}
+	}
+	return perfEvents, nil
+}
@@ -0,0 +1,66 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/link"
+)
+
+// runQueueTracepoints maps the scheduler tracepoints, at which threads enter the run
+// queue, to the programs attached to them.
+var runQueueTracepoints = map[string]string{
+	"sched_wakeup":     "tracepoint__sched_wakeup",
+	"sched_wakeup_new": "tracepoint__sched_wakeup_new",
+	"sched_switch":     "tracepoint__sched_switch_run_queue",
+}
+
+// runQueueProgs returns the loader helpers of the run queue latency profiling programs.
+func runQueueProgs(enable bool) []progLoaderHelper {
+	progs := []progLoaderHelper{{
+		name:             "finish_task_switch_run_queue",
+		noTailCallTarget: true,
+		enable:           enable,
+	}}
+	for _, name := range runQueueTracepoints {
+		progs = append(progs, progLoaderHelper{
+			name:             name,
+			noTailCallTarget: true,
+			enable:           enable,
+		})
+	}
+	return progs
+}
+
+// StartRunQueueProfiling starts run queue latency profiling by attaching the programs
+// to the hooks.
+func (t *Tracer) StartRunQueueProfiling() error {
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
+	// Attach the hook that collects the traces of threads leaving the run queue first.
+	kprobeProg, ok := t.ebpfProgs["finish_task_switch_run_queue"]
+	if !ok {
+		return errors.New("run queue program finish_task_switch_run_queue is not available")
+	}
+	if err := t.attachFinishTaskSwitch("run_queue", kprobeProg); err != nil {
+		return err
+	}
+
+	// Attach the hooks at which threads enter the run queue.
+	for tracepoint, progName := range runQueueTracepoints {
+		prog, ok := t.ebpfProgs[progName]
+		if !ok {
+			return fmt.Errorf("run queue program %s is not available", progName)
+		}
+		tpLink, err := link.Tracepoint("sched", tracepoint, prog, nil)
+		if err != nil {
+			return fmt.Errorf("failed to attach to tracepoint %s: %v", tracepoint, err)
+		}
+		t.hooks[hookPoint{group: "run_queue", name: tracepoint}] = tpLink
+	}
+	return nil
+}
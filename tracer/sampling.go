@@ -0,0 +1,227 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/times"
+)
+
+const (
+	// overloadLatencyFactor is the multiple of the trace poll interval above which the
+	// latency of the trace pipeline indicates an overload.
+	overloadLatencyFactor = 4
+	// recoveryIntervals is the number of consecutive monitor intervals without overload
+	// after which the sampling frequency is raised again.
+	recoveryIntervals = 3
+	// maxSamplingPeriods is the number of sampling frequency changes that are kept to
+	// look up the effective sampling period of traces.
+	maxSamplingPeriods = 16
+)
+
+// samplingPeriod is the sampling period that is in effect since ktime.
+type samplingPeriod struct {
+	ktime  times.KTime
+	period int64
+}
+
+// samplingController is a closed-loop controller that adapts the frequency of the
+// sampling perf events to the load of the trace pipeline. The frequency is halved
+// whenever trace events are lost or the latency of the trace pipeline exceeds
+// latencyThreshold, and raised additively up to maxFrequency after the pipeline
+// kept up for recoveryIntervals monitor intervals. Independent of the load, the
+// frequency can be capped with a limit.
+type samplingController struct {
+	minFrequency     int
+	maxFrequency     int
+	latencyThreshold time.Duration
+
+	// mu protects the fields below, which are accessed from the monitor goroutine,
+	// while loading traces and by the callers of Tracer.SetSamplingLimit.
+	mu sync.Mutex
+	// frequency is the sampling frequency in Hz that suits the load.
+	frequency int
+	// limit is the upper bound of the sampling frequency in Hz, zero if unbounded.
+	limit int
+	// applied is the sampling frequency in Hz that the perf events use.
+	applied int
+	// calmIntervals counts the consecutive monitor intervals without overload.
+	calmIntervals int
+	// periods holds the recent sampling periods in nanoseconds, ordered by ktime.
+	periods []samplingPeriod
+}
+
+// newSamplingController returns a samplingController that adapts the sampling
+// frequency between minFrequency and maxFrequency, starting at maxFrequency.
+func newSamplingController(minFrequency, maxFrequency int,
+	latencyThreshold time.Duration) *samplingController {
+	return &samplingController{
+		minFrequency:     minFrequency,
+		maxFrequency:     maxFrequency,
+		latencyThreshold: latencyThreshold,
+		frequency:        maxFrequency,
+		applied:          maxFrequency,
+		periods: []samplingPeriod{{
+			period: int64(time.Second) / int64(maxFrequency),
+		}},
+	}
+}
+
+// update feeds the number of lost trace events and the maximum latency of the trace
+// pipeline of the last monitor interval into the controller. It returns the new
+// sampling frequency and whether it changed.
+func (c *samplingController) update(lost uint64, latency time.Duration) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lost > 0 || latency > c.latencyThreshold {
+		c.calmIntervals = 0
+		frequency := max(c.frequency/2, c.minFrequency)
+		if frequency == c.frequency {
+			return c.frequency, false
+		}
+		c.frequency = frequency
+		return c.frequency, true
+	}
+
+	c.calmIntervals++
+	if c.calmIntervals < recoveryIntervals || c.frequency == c.maxFrequency {
+		return c.frequency, false
+	}
+	c.calmIntervals = 0
+	c.frequency = min(c.frequency+max(c.maxFrequency/10, 1), c.maxFrequency)
+	return c.frequency, true
+}
+
+// setLimit sets the upper bound of the sampling frequency. Zero removes the bound.
+func (c *samplingController) setLimit(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+}
+
+// setMaxFrequency changes the sampling frequency to frequency Hz. If the frequency
+// is adapted to the load, frequency becomes the upper bound, otherwise it is fixed.
+func (c *samplingController) setMaxFrequency(frequency int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.minFrequency == c.maxFrequency {
+		c.minFrequency = frequency
+	} else {
+		c.minFrequency = min(c.minFrequency, frequency)
+	}
+	c.maxFrequency = frequency
+	c.frequency = frequency
+	c.calmIntervals = 0
+}
+
+// current returns the sampling frequency that the perf events use.
+func (c *samplingController) current() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.applied
+}
+
+// pending returns the sampling frequency that the perf events should use, and
+// whether it differs from the applied one.
+func (c *samplingController) pending() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frequency := c.frequency
+	if c.limit > 0 {
+		frequency = max(min(frequency, c.limit), 1)
+	}
+	return frequency, frequency != c.applied
+}
+
+// setPeriod records that the sampling frequency changed to frequency at ktime.
+func (c *samplingController) setPeriod(ktime times.KTime, frequency int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applied = frequency
+	if len(c.periods) == maxSamplingPeriods {
+		c.periods = append(c.periods[:0], c.periods[1:]...)
+	}
+	c.periods = append(c.periods, samplingPeriod{
+		ktime:  ktime,
+		period: int64(time.Second) / int64(frequency),
+	})
+}
+
+// periodAt returns the sampling period in nanoseconds that was in effect at ktime.
+func (c *samplingController) periodAt(ktime times.KTime) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.periods) - 1; i > 0; i-- {
+		if c.periods[i].ktime <= ktime {
+			return c.periods[i].period
+		}
+	}
+	return c.periods[0].period
+}
+
+// adaptSampling updates the sampling frequency of the perf events of the CPU clock
+// from the lost trace event and trace latency metrics of the last monitor interval.
+func (t *Tracer) adaptSampling(intervalMetrics ...[]metrics.Metric) {
+	var lost uint64
+	var latency time.Duration
+	for _, metricSlice := range intervalMetrics {
+		for _, metric := range metricSlice {
+			switch metric.ID {
+			case metrics.IDTraceEventLost, metrics.IDTraceEventRingbufDropped:
+				lost += uint64(metric.Value)
+			case metrics.IDTraceEventLatency:
+				latency = time.Duration(metric.Value) * time.Millisecond
+			}
+		}
+	}
+
+	if _, changed := t.sampling.update(lost, latency); changed {
+		log.Infof("Adapting sampling frequency (lost events: %d, latency: %v)",
+			lost, latency)
+	}
+	frequency := t.applySamplingFrequency()
+	metrics.Add(metrics.IDSamplingFrequency, metrics.MetricValue(frequency))
+}
+
+// SetSamplingLimit caps the sampling frequency of the perf events of the CPU clock
+// at limit Hz. Zero removes the cap. It has no effect unless the tracer was created
+// with AdjustableSampling or adaptive sampling.
+func (t *Tracer) SetSamplingLimit(limit int) {
+	if t.sampling == nil {
+		return
+	}
+	t.sampling.setLimit(limit)
+	t.applySamplingFrequency()
+}
+
+// applySamplingFrequency updates the perf events of the CPU clock to the sampling
+// frequency of the sampling controller, and returns it.
+func (t *Tracer) applySamplingFrequency() int {
+	events := t.perfEntrypoints.WLock()
+	defer t.perfEntrypoints.WUnlock(&events)
+
+	frequency, changed := t.sampling.pending()
+	if !changed {
+		return frequency
+	}
+	var updateErr metrics.MetricValue
+	for _, event := range (*events)[:min(t.numSamplingEvents, len(*events))] {
+		// For frequency based perf events, the period is the sampling frequency.
+		if err := event.UpdatePeriod(uint64(frequency)); err != nil {
+			updateErr++
+			log.Errorf("Failed to update sampling frequency: %v", err)
+		}
+	}
+	if updateErr != 0 {
+		metrics.Add(metrics.IDPerfEventUpdatePeriodErr, updateErr)
+	}
+	t.sampling.setPeriod(times.GetKTime(), frequency)
+	log.Infof("Changed sampling frequency to %d Hz", frequency)
+	return frequency
+}
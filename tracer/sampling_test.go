@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/ebpf-profiler/times"
+)
+
+func TestSamplingControllerUpdate(t *testing.T) {
+	c := newSamplingController(2, 20, time.Second)
+
+	type step struct {
+		lost        uint64
+		latency     time.Duration
+		wantFreq    int
+		wantChanged bool
+	}
+	for i, s := range []step{
+		{wantFreq: 20},
+		{lost: 5, wantFreq: 10, wantChanged: true},
+		{latency: 2 * time.Second, wantFreq: 5, wantChanged: true},
+		{lost: 1, wantFreq: 2, wantChanged: true},
+		{lost: 1, wantFreq: 2},
+		{wantFreq: 2},
+		{wantFreq: 2},
+		{wantFreq: 4, wantChanged: true},
+		{wantFreq: 4},
+		{latency: time.Second, wantFreq: 4},
+		{wantFreq: 6, wantChanged: true},
+	} {
+		freq, changed := c.update(s.lost, s.latency)
+		assert.Equal(t, s.wantFreq, freq, "step %d", i)
+		assert.Equal(t, s.wantChanged, changed, "step %d", i)
+	}
+}
+
+func TestSamplingControllerPeriodAt(t *testing.T) {
+	c := newSamplingController(2, 20, time.Second)
+	assert.Equal(t, int64(50*time.Millisecond), c.periodAt(100))
+
+	c.setPeriod(1000, 10)
+	c.setPeriod(2000, 5)
+	assert.Equal(t, int64(50*time.Millisecond), c.periodAt(999))
+	assert.Equal(t, int64(100*time.Millisecond), c.periodAt(1000))
+	assert.Equal(t, int64(100*time.Millisecond), c.periodAt(1999))
+	assert.Equal(t, int64(200*time.Millisecond), c.periodAt(3000))
+
+	for i := range maxSamplingPeriods {
+		c.setPeriod(times.KTime(3000+i), 20)
+	}
+	assert.Len(t, c.periods, maxSamplingPeriods)
+	assert.Equal(t, int64(50*time.Millisecond), c.periodAt(3000))
+}
@@ -223,7 +223,8 @@ func determineStackLayout(coll *cebpf.CollectionSpec, maps map[string]*cebpf.Map
 
 func loadSystemConfig(coll *cebpf.CollectionSpec, maps map[string]*cebpf.Map,
 	kmod *kallsyms.Module, includeTracers types.IncludedTracers,
-	offCPUThreshold uint32, filterErrorFrames bool) error {
+	offCPUThreshold, allocSampleInterval, contentionThreshold, runQueueThreshold uint32,
+	filterErrorFrames, filterPIDs, followChildren, allocInUse bool) error {
 	pacMask := pacmask.GetPACMask()
 	if pacMask != 0 {
 		log.Infof("Determined PAC mask to be 0x%016X", pacMask)
@@ -234,6 +235,12 @@ func loadSystemConfig(coll *cebpf.CollectionSpec, maps map[string]*cebpf.Map,
 		Inverse_pac_mask:       ^pacMask,
 		Drop_error_only_traces: filterErrorFrames,
 		Off_cpu_threshold:      offCPUThreshold,
+		Filter_pids:            filterPIDs,
+		Follow_children:        followChildren,
+		Alloc_sample_interval:  allocSampleInterval,
+		Alloc_in_use:           allocInUse,
+		Contention_threshold:   contentionThreshold,
+		Run_queue_threshold:    runQueueThreshold,
 	}
 
 	if err := parseBTF(&syscfg); err != nil {
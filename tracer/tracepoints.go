@@ -29,6 +29,8 @@ func (t *Tracer) attachToTracepoint(group, name string, prog *ebpf.Program) erro
 
 // AttachSchedMonitor attaches a kprobe to the process scheduler. This hook detects the
 // exit of a process and enables us to clean up data we associated with this process.
+// If the descendants of a target process are profiled, it also attaches a hook that
+// detects the forks of target processes.
 func (t *Tracer) AttachSchedMonitor() error {
 	restoreRlimit, err := rlimit.MaximizeMemlock()
 	if err != nil {
@@ -37,5 +39,17 @@ func (t *Tracer) AttachSchedMonitor() error {
 	defer restoreRlimit()
 
 	prog := t.ebpfProgs["tracepoint__sched_process_free"]
-	return t.attachToTracepoint("sched", "sched_process_free", prog)
+	if err = t.attachToTracepoint("sched", "sched_process_free", prog); err != nil {
+		return err
+	}
+
+	prog, ok := t.ebpfProgs["tracepoint__task_newtask"]
+	if !ok {
+		return nil
+	}
+	if err = t.attachToTracepoint("task", "task_newtask", prog); err != nil {
+		return err
+	}
+	// Pick up the processes that were forked before the hook was attached.
+	return t.updateTargetPIDs()
 }
@@ -11,14 +11,18 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/bits"
 	"math/rand/v2"
+	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	cebpf "github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/features"
 	"github.com/cilium/ebpf/link"
 	"github.com/elastic/go-perf"
 	log "github.com/sirupsen/logrus"
@@ -29,6 +33,7 @@ import (
 	"go.opentelemetry.io/ebpf-profiler/libpf"
 	"go.opentelemetry.io/ebpf-profiler/libpf/xsync"
 	"go.opentelemetry.io/ebpf-profiler/metrics"
+	"go.opentelemetry.io/ebpf-profiler/nativesymbolizer"
 	"go.opentelemetry.io/ebpf-profiler/nativeunwind/elfunwindinfo"
 	"go.opentelemetry.io/ebpf-profiler/periodiccaller"
 	pm "go.opentelemetry.io/ebpf-profiler/processmanager"
@@ -56,6 +61,17 @@ const (
 	probProfilingDisable = -1
 )
 
+const (
+	// ringbufSuffix is the name suffix of the ring buffer maps that replace the perf
+	// event arrays of the same name if the kernel supports ring buffers.
+	ringbufSuffix = "_ringbuf"
+	// reportRingbufPages is the size in pages of the ring buffer for PID events.
+	reportRingbufPages = 4
+	// maxTraceRingbufSize is the upper bound of the size in bytes of the ring buffer
+	// for trace events.
+	maxTraceRingbufSize = 256 << 20
+)
+
 // Intervals is a subset of config.IntervalsAndTimers.
 type Intervals interface {
 	MonitorInterval() time.Duration
@@ -77,7 +93,7 @@ type Tracer struct {
 	// kernelSymbolizer does kernel fallback symbolization
 	kernelSymbolizer *kallsyms.Symbolizer
 
-	// perfEntrypoints holds a list of frequency based perf events that are opened on the system.
+	// perfEntrypoints holds a list of the perf events that are opened on the system.
 	perfEntrypoints xsync.RWMutex[[]*perf.Event]
 
 	// hooks holds references to loaded eBPF hooks.
@@ -110,11 +126,81 @@ type Tracer struct {
 	// samplesPerSecond holds the configured number of samples per second.
 	samplesPerSecond int
 
+	// sampling adapts the sampling frequency to the load of the trace pipeline, nil
+	// if the sampling frequency is fixed.
+	sampling *samplingController
+
+	// numSamplingEvents is the number of perf events of the CPU clock at the start of
+	// perfEntrypoints, whose sampling frequency is adapted.
+	numSamplingEvents int
+
+	// perfEvents holds the perf events sampled in addition to the CPU clock.
+	perfEvents []types.PerfEvent
+
+	// uprobes holds the functions whose calls are traced.
+	uprobes []types.Uprobe
+
+	// allocLibraries holds the allocator libraries whose allocations are profiled.
+	allocLibraries []string
+
+	// allocInUse indicates whether sampled allocations are tracked until they are freed.
+	allocInUse bool
+
+	// allocPID limits the allocation probes to a process, zero if they are attached in
+	// all processes.
+	allocPID libpf.PID
+
+	// offCPUWakeups indicates whether off-cpu traces are attributed to their wakers.
+	offCPUWakeups bool
+
+	// schedTextStart and schedTextEnd delimit the scheduler functions of the kernel.
+	// They are used to determine the wait channel of off-cpu traces, if available.
+	schedTextStart, schedTextEnd libpf.Address
+
+	// targetPIDs restricts profiling to a process tree, nil if all processes are profiled.
+	targetPIDs *pm.TargetPIDs
+
+	// includeTracers holds the tracers whose unwinders are loaded.
+	includeTracers types.IncludedTracers
+
+	// paused indicates whether profiling is paused with PauseProfiling.
+	paused atomic.Bool
+
+	// probabilisticDisabled indicates whether probabilistic profiling disabled the
+	// perf events for the current interval.
+	probabilisticDisabled atomic.Bool
+
+	// profilingMode holds the ProfilingMode set with SetProfilingMode.
+	profilingMode atomic.Int32
+
+	// profilingHolds counts the holds of HoldProfiling that are not released yet.
+	profilingHolds atomic.Int32
+
+	// profiling indicates whether the perf events are enabled.
+	profiling atomic.Bool
+
+	// controlMu serializes the changes of hooks and tail calls while the tracer is
+	// running, and protects the fields below.
+	controlMu sync.Mutex
+
+	// activeTracers holds the tracers whose unwinders are switched on.
+	activeTracers types.IncludedTracers
+
+	// offCPUStarted indicates whether StartOffCPUProfiling attached the off-cpu hooks.
+	offCPUStarted bool
+
 	// probabilisticInterval is the time interval for which probabilistic profiling will be enabled.
 	probabilisticInterval time.Duration
 
 	// probabilisticThreshold holds the threshold for probabilistic profiling.
 	probabilisticThreshold uint
+
+	// stopProbabilistic stops probabilistic profiling, nil if it is not running.
+	stopProbabilistic context.CancelFunc
+
+	// flushTraces receives the requests of FlushTraces. The trace event monitor
+	// closes the channel of a request once it processed all pending trace events.
+	flushTraces chan chan libpf.Void
 }
 
 type Config struct {
@@ -126,6 +212,13 @@ type Config struct {
 	IncludeTracers types.IncludedTracers
 	// SamplesPerSecond holds the number of samples per second.
 	SamplesPerSecond int
+	// MinSamplesPerSecond enables adaptive sampling if it is lower than SamplesPerSecond.
+	// The sampling frequency is then lowered down to MinSamplesPerSecond while the trace
+	// pipeline is overloaded.
+	MinSamplesPerSecond int
+	// AdjustableSampling allows to cap the sampling frequency at runtime with
+	// SetSamplingLimit.
+	AdjustableSampling bool
 	// MapScaleFactor is the scaling factor for eBPF map sizes.
 	MapScaleFactor int
 	// FilterErrorFrames indicates whether error frames should be filtered.
@@ -142,9 +235,39 @@ type Config struct {
 	ProbabilisticThreshold uint
 	// OffCPUThreshold is the user defined threshold for off-cpu profiling.
 	OffCPUThreshold uint32
+	// OffCPUWakeups collects the traces of the threads that wake up the tasks of off-cpu
+	// traces and links them to the off-cpu traces.
+	OffCPUWakeups bool
 	// IncludeEnvVars holds a list of environment variables that should be captured and reported
 	// from processes
 	IncludeEnvVars libpf.Set[string]
+	// NativeSymbolCacheSize is the memory budget in bytes for the ELF symbol tables used to
+	// symbolize native frames in the agent. Zero disables native symbolization.
+	NativeSymbolCacheSize uint64
+	// NativeSymbolDWARF enables resolving inlined functions and source lines of native
+	// frames from DWARF debug information.
+	NativeSymbolDWARF bool
+	// TargetPID restricts profiling to the process with this PID. Zero profiles all processes.
+	TargetPID libpf.PID
+	// TargetChildren extends profiling to the descendants of the process TargetPID.
+	TargetChildren bool
+	// PerfEvents are the perf events whose samples trigger stack unwinding in addition
+	// to the CPU clock.
+	PerfEvents []types.PerfEvent
+	// Uprobes are the functions whose calls trigger stack unwinding.
+	Uprobes []types.Uprobe
+	// AllocSampleInterval is the average number of allocated bytes between two sampled
+	// allocations. Zero disables allocation profiling.
+	AllocSampleInterval uint32
+	// AllocInUse tracks sampled allocations until they are freed.
+	AllocInUse bool
+	// AllocLibraries are the allocator libraries whose allocation functions are hooked.
+	// Well-known library locations are used if empty.
+	AllocLibraries []string
+	// ContentionThreshold is the user defined threshold for lock contention profiling.
+	ContentionThreshold uint32
+	// RunQueueThreshold is the user defined threshold for run queue latency profiling.
+	RunQueueThreshold uint32
 }
 
 // hookPoint specifies the group and name of the hooked point in the kernel.
@@ -198,9 +321,33 @@ func NewTracer(ctx context.Context, cfg *Config) (*Tracer, error) {
 
 	hasBatchOperations := ebpfHandler.SupportsGenericBatchOperations()
 
+	var nativeSymbolizer *nativesymbolizer.Symbolizer
+	if cfg.NativeSymbolCacheSize > 0 {
+		nativeSymbolizer, err = nativesymbolizer.New(cfg.NativeSymbolCacheSize,
+			cfg.NativeSymbolDWARF)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create native symbolizer: %v", err)
+		}
+	}
+
+	var allocPID libpf.PID
+	if !cfg.TargetChildren {
+		allocPID = cfg.TargetPID
+	}
+
+	var targetPIDs *pm.TargetPIDs
+	if cfg.TargetPID != 0 {
+		targetPIDMap := ebpfMaps["target_pids"]
+		targetPIDs = pm.NewTargetPIDs(cfg.TargetPID, cfg.TargetChildren,
+			func(pid libpf.PID) bool {
+				var targeted bool
+				return targetPIDMap.Lookup(uint32(pid), &targeted) == nil
+			})
+	}
+
 	processManager, err := pm.New(ctx, cfg.IncludeTracers, cfg.Intervals.MonitorInterval(),
 		ebpfHandler, nil, cfg.Reporter, elfunwindinfo.NewStackDeltaProvider(),
-		cfg.FilterErrorFrames, cfg.IncludeEnvVars)
+		cfg.FilterErrorFrames, cfg.IncludeEnvVars, nativeSymbolizer, targetPIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create processManager: %v", err)
 	}
@@ -212,6 +359,7 @@ func NewTracer(ctx context.Context, cfg *Config) (*Tracer, error) {
 		processManager:         processManager,
 		triggerPIDProcessing:   make(chan bool, 1),
 		pidEvents:              make(chan libpf.PIDTID, pidEventBufferSize),
+		flushTraces:            make(chan chan libpf.Void),
 		ebpfMaps:               ebpfMaps,
 		ebpfProgs:              ebpfProgs,
 		hooks:                  make(map[hookPoint]link.Link),
@@ -220,13 +368,56 @@ func NewTracer(ctx context.Context, cfg *Config) (*Tracer, error) {
 		perfEntrypoints:        xsync.NewRWMutex(perfEventList),
 		reporter:               cfg.Reporter,
 		samplesPerSecond:       cfg.SamplesPerSecond,
+		perfEvents:             cfg.PerfEvents,
+		uprobes:                cfg.Uprobes,
+		allocLibraries:         cfg.AllocLibraries,
+		allocInUse:             cfg.AllocInUse,
+		allocPID:               allocPID,
+		offCPUWakeups:          cfg.OffCPUWakeups,
 		probabilisticInterval:  cfg.ProbabilisticInterval,
 		probabilisticThreshold: cfg.ProbabilisticThreshold,
+		targetPIDs:             targetPIDs,
+		includeTracers:         cfg.IncludeTracers,
+		activeTracers:          cfg.IncludeTracers,
+	}
+
+	if cfg.MinSamplesPerSecond > 0 && cfg.MinSamplesPerSecond < cfg.SamplesPerSecond {
+		tracer.sampling = newSamplingController(cfg.MinSamplesPerSecond, cfg.SamplesPerSecond,
+			overloadLatencyFactor*cfg.Intervals.TracePollInterval())
+	} else if cfg.AdjustableSampling {
+		tracer.sampling = newSamplingController(cfg.SamplesPerSecond, cfg.SamplesPerSecond,
+			overloadLatencyFactor*cfg.Intervals.TracePollInterval())
+	}
+
+	if err = tracer.updateTargetPIDs(); err != nil {
+		return nil, fmt.Errorf("failed to set target PIDs: %v", err)
 	}
 
 	return tracer, nil
 }
 
+// updateTargetPIDs writes the PIDs of the currently running target processes
+// to the eBPF map target_pids.
+func (t *Tracer) updateTargetPIDs() error {
+	if t.targetPIDs == nil {
+		return nil
+	}
+
+	pids, err := t.targetPIDs.Scan()
+	if err != nil {
+		return err
+	}
+
+	targetPIDs := t.ebpfMaps["target_pids"]
+	for _, pid := range pids {
+		if err = targetPIDs.Update(uint32(pid), true, cebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to add PID %d: %v", pid, err)
+		}
+	}
+	log.Debugf("Restricted profiling to %d processes", len(pids))
+	return nil
+}
+
 // Close provides functionality for Tracer to perform cleanup tasks.
 // NOTE: Close may be called multiple times in succession.
 func (t *Tracer) Close() {
@@ -243,6 +434,8 @@ func (t *Tracer) Close() {
 	t.perfEntrypoints.WUnlock(&events)
 
 	// Avoid resource leakage by closing all kernel hooks.
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
 	for hookPoint, hook := range t.hooks {
 		if err := hook.Close(); err != nil {
 			log.Errorf("Failed to close '%s/%s': %v", hookPoint.group, hookPoint.name, err)
@@ -272,6 +465,45 @@ func buildStackDeltaTemplates(coll *cebpf.CollectionSpec) error {
 	return nil
 }
 
+// setVariable sets the global variable name of the eBPF programs to value.
+func setVariable(coll *cebpf.CollectionSpec, name string, value any) error {
+	variable, ok := coll.Variables[name]
+	if !ok {
+		return fmt.Errorf("eBPF variable %s not found, the eBPF object is outdated", name)
+	}
+	return variable.Set(value)
+}
+
+// requiredMaps returns the names of the eBPF maps that the tracer uses with cfg.
+func requiredMaps(cfg *Config, withRingbuf bool) []string {
+	names := []string{"perf_progs", "kprobe_progs", "system_config", "trace_events",
+		"report_events", "denied_cgroups"}
+	if withRingbuf {
+		names = append(names, "trace_events"+ringbufSuffix, "report_events"+ringbufSuffix)
+	}
+	if cfg.TargetPID != 0 {
+		names = append(names, "target_pids")
+	}
+	if len(cfg.Uprobes) > 0 {
+		names = append(names, "uprobe_states")
+	}
+	if cfg.AllocSampleInterval > 0 && cfg.AllocInUse {
+		names = append(names, "alloc_in_use", "alloc_frees")
+	}
+	return names
+}
+
+// requireMaps returns an error if one of the eBPF maps names was not loaded, as the
+// eBPF object does not define it.
+func requireMaps(ebpfMaps map[string]*cebpf.Map, names ...string) error {
+	for _, name := range names {
+		if _, ok := ebpfMaps[name]; !ok {
+			return fmt.Errorf("eBPF map %s not found, the eBPF object is outdated", name)
+		}
+	}
+	return nil
+}
+
 // initializeMapsAndPrograms loads the definitions for the eBPF maps and programs provided
 // by the embedded elf file and loads these into the kernel.
 func initializeMapsAndPrograms(kmod *kallsyms.Module, cfg *Config) (
@@ -288,11 +520,23 @@ func initializeMapsAndPrograms(kmod *kallsyms.Module, cfg *Config) (
 	}
 
 	if cfg.DebugTracer {
-		if err = coll.Variables["with_debug_output"].Set(uint32(1)); err != nil {
+		if err = setVariable(coll, "with_debug_output", uint32(1)); err != nil {
 			return nil, nil, fmt.Errorf("failed to set debug output: %v", err)
 		}
 	}
 
+	// Ring buffers are available since Linux 5.8. Older kernels fall back to the
+	// per-CPU perf event buffers.
+	withRingbuf := features.HaveMapType(cebpf.RingBuf) == nil
+	if withRingbuf {
+		if err = setVariable(coll, "with_ringbuf", uint32(1)); err != nil {
+			return nil, nil, fmt.Errorf("failed to enable ring buffers: %v", err)
+		}
+		log.Debug("Using ring buffers for trace and PID events")
+	} else {
+		log.Debug("Using perf event buffers for trace and PID events")
+	}
+
 	err = buildStackDeltaTemplates(coll)
 	if err != nil {
 		return nil, nil, err
@@ -304,9 +548,12 @@ func initializeMapsAndPrograms(kmod *kallsyms.Module, cfg *Config) (
 	// Load all maps into the kernel that are used later on in eBPF programs. So we can rewrite
 	// in the next step the placesholders in the eBPF programs with the file descriptors of the
 	// loaded maps in the kernel.
-	if err = loadAllMaps(coll, cfg, ebpfMaps); err != nil {
+	if err = loadAllMaps(coll, cfg, withRingbuf, ebpfMaps); err != nil {
 		return nil, nil, fmt.Errorf("failed to load eBPF maps: %v", err)
 	}
+	if err = requireMaps(ebpfMaps, requiredMaps(cfg, withRingbuf)...); err != nil {
+		return nil, nil, err
+	}
 
 	// Replace the place holders for map access in the eBPF programs with
 	// the file descriptors of the loaded maps.
@@ -335,73 +582,29 @@ func initializeMapsAndPrograms(kmod *kallsyms.Module, cfg *Config) (
 		}
 	}
 
-	tailCallProgs := []progLoaderHelper{
-		{
-			progID: uint32(support.ProgUnwindStop),
-			name:   "unwind_stop",
-			enable: true,
-		},
-		{
-			progID: uint32(support.ProgUnwindNative),
-			name:   "unwind_native",
-			enable: true,
-		},
-		{
-			progID: uint32(support.ProgUnwindHotspot),
-			name:   "unwind_hotspot",
-			enable: cfg.IncludeTracers.Has(types.HotspotTracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindPerl),
-			name:   "unwind_perl",
-			enable: cfg.IncludeTracers.Has(types.PerlTracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindPHP),
-			name:   "unwind_php",
-			enable: cfg.IncludeTracers.Has(types.PHPTracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindPython),
-			name:   "unwind_python",
-			enable: cfg.IncludeTracers.Has(types.PythonTracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindRuby),
-			name:   "unwind_ruby",
-			enable: cfg.IncludeTracers.Has(types.RubyTracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindV8),
-			name:   "unwind_v8",
-			enable: cfg.IncludeTracers.Has(types.V8Tracer),
-		},
-		{
-			progID: uint32(support.ProgUnwindDotnet),
-			name:   "unwind_dotnet",
-			enable: cfg.IncludeTracers.Has(types.DotnetTracer),
-		},
-		{
-			progID: uint32(support.ProgGoLabels),
-			name:   "go_labels",
-			enable: cfg.IncludeTracers.Has(types.Labels),
-		},
-	}
+	tailCallProgs := tailCallTargets(cfg.IncludeTracers)
 
 	if err = loadPerfUnwinders(coll, ebpfProgs, ebpfMaps["perf_progs"], tailCallProgs,
-		cfg.BPFVerifierLogLevel); err != nil {
+		cfg.BPFVerifierLogLevel, cfg.TargetPID != 0 && cfg.TargetChildren,
+		cfg.PerfEvents); err != nil {
 		return nil, nil, fmt.Errorf("failed to load perf eBPF programs: %v", err)
 	}
 
-	if cfg.OffCPUThreshold > 0 {
+	if cfg.OffCPUThreshold > 0 || len(cfg.Uprobes) > 0 || cfg.AllocSampleInterval > 0 ||
+		cfg.ContentionThreshold > 0 || cfg.RunQueueThreshold > 0 {
 		if err = loadKProbeUnwinders(coll, ebpfProgs, ebpfMaps["kprobe_progs"], tailCallProgs,
-			cfg.BPFVerifierLogLevel, ebpfMaps["perf_progs"].FD()); err != nil {
+			cfg.BPFVerifierLogLevel, ebpfMaps["perf_progs"].FD(),
+			cfg.OffCPUThreshold > 0, cfg.OffCPUThreshold > 0 && cfg.OffCPUWakeups,
+			len(cfg.Uprobes) > 0, cfg.AllocSampleInterval > 0,
+			cfg.ContentionThreshold > 0, cfg.RunQueueThreshold > 0); err != nil {
 			return nil, nil, fmt.Errorf("failed to load kprobe eBPF programs: %v", err)
 		}
 	}
 
 	if err = loadSystemConfig(coll, ebpfMaps, kmod, cfg.IncludeTracers,
-		cfg.OffCPUThreshold, cfg.FilterErrorFrames); err != nil {
+		cfg.OffCPUThreshold, cfg.AllocSampleInterval, cfg.ContentionThreshold,
+		cfg.RunQueueThreshold, cfg.FilterErrorFrames,
+		cfg.TargetPID != 0, cfg.TargetChildren, cfg.AllocInUse); err != nil {
 		return nil, nil, fmt.Errorf("failed to load system config: %v", err)
 	}
 
@@ -426,7 +629,7 @@ func removeTemporaryMaps(ebpfMaps map[string]*cebpf.Map) error {
 }
 
 // loadAllMaps loads all eBPF maps that are used in our eBPF programs.
-func loadAllMaps(coll *cebpf.CollectionSpec, cfg *Config,
+func loadAllMaps(coll *cebpf.CollectionSpec, cfg *Config, withRingbuf bool,
 	ebpfMaps map[string]*cebpf.Map) error {
 	restoreRlimit, err := rlimit.MaximizeMemlock()
 	if err != nil {
@@ -451,7 +654,19 @@ func loadAllMaps(coll *cebpf.CollectionSpec, cfg *Config,
 	adaption["stack_delta_page_to_info"] =
 		1 << uint32(stackDeltaPageToInfoSize+cfg.MapScaleFactor)
 
-	adaption["sched_times"] = schedTimesSize(cfg.OffCPUThreshold)
+	possibleCPUs, err := cebpf.PossibleCPU()
+	if err != nil {
+		return fmt.Errorf("failed to get number of possible CPUs: %v", err)
+	}
+
+	adaption["sched_times"] = schedTimesSize(possibleCPUs, cfg.OffCPUThreshold)
+	adaption["run_queue_times"] = schedTimesSize(possibleCPUs, cfg.RunQueueThreshold)
+
+	if withRingbuf {
+		adaption["trace_events"+ringbufSuffix] = traceRingbufSize(possibleCPUs,
+			cfg.SamplesPerSecond, cfg.Intervals.TracePollInterval())
+		adaption["report_events"+ringbufSuffix] = uint32(reportRingbufPages * os.Getpagesize())
+	}
 
 	for i := support.StackDeltaBucketSmallest; i <= support.StackDeltaBucketLargest; i++ {
 		mapName := fmt.Sprintf("exe_id_to_%d_stack_deltas", i)
@@ -463,6 +678,37 @@ func loadAllMaps(coll *cebpf.CollectionSpec, cfg *Config,
 			// Off CPU Profiling is disabled. So do not load this map.
 			continue
 		}
+		if mapName == "wakeups" && (cfg.OffCPUThreshold == 0 || !cfg.OffCPUWakeups) {
+			// Wakeup attribution is disabled. So do not load this map.
+			continue
+		}
+		if (mapName == "alloc_pending" || mapName == "realloc_pending" ||
+			mapName == "alloc_in_use") &&
+			cfg.AllocSampleInterval == 0 {
+			// Allocation profiling is disabled. So do not load these maps.
+			continue
+		}
+		if (mapName == "futex_waits" || mapName == "mutex_waits") &&
+			cfg.ContentionThreshold == 0 {
+			// Lock contention profiling is disabled. So do not load these maps.
+			continue
+		}
+		if mapName == "run_queue_times" && cfg.RunQueueThreshold == 0 {
+			// Run queue latency profiling is disabled. So do not load this map.
+			continue
+		}
+		if mapSpec.Type == cebpf.RingBuf && !withRingbuf {
+			// The kernel does not support ring buffers. The eBPF programs still
+			// reference the map in the code that is not used, so load a minimal
+			// placeholder instead.
+			mapSpec = &cebpf.MapSpec{
+				Name:       mapSpec.Name,
+				Type:       cebpf.Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			}
+		}
 		if newSize, ok := adaption[mapName]; ok {
 			log.Debugf("Size of eBPF map %s: %v", mapName, newSize)
 			mapSpec.MaxEntries = newSize
@@ -478,33 +724,98 @@ func loadAllMaps(coll *cebpf.CollectionSpec, cfg *Config,
 }
 
 // schedTimesSize calculates the size of the sched_times map based on the
-// configured off-cpu threshold.
+// configured off-cpu threshold, and of the run_queue_times map based on the
+// configured run queue threshold.
 // To not lose too many scheduling events but also not oversize sched_times,
 // calculate a size based on an assumed upper bound of scheduler events per
 // second (1000hz) multiplied by an average time a task remains off CPU (3s),
-// scaled by the probability of capturing a trace.
-func schedTimesSize(threshold uint32) uint32 {
+// scaled by the probability of capturing a trace. The maps are shared by all
+// possibleCPUs, so the size per CPU is multiplied by their number.
+func schedTimesSize(possibleCPUs int, threshold uint32) uint32 {
 	size := uint32((4096 * uint64(threshold)) / math.MaxUint32)
-	if size < 16 {
-		// Guarantee a minimal size of 16.
-		return 16
-	}
-	if size > 4096 {
-		// Guarantee a maximum size of 4096.
-		return 4096
+	// Guarantee a size per CPU between 16 and 4096.
+	size = min(max(size, 16), 4096)
+	return size * uint32(max(possibleCPUs, 1))
+}
+
+// traceRingbufSize calculates the size in bytes of the ring buffer for trace events.
+// The ring buffer is shared by all possibleCPUs and polled every pollInterval, so it
+// is sized to hold traces of the maximum size at samplesPerSecond from all CPUs for
+// two poll intervals. Ring buffer sizes are powers of 2 and multiples of the page size.
+func traceRingbufSize(possibleCPUs, samplesPerSecond int, pollInterval time.Duration) uint32 {
+	size := uint64(possibleCPUs) * uint64(samplesPerSecond) * support.Sizeof_Trace *
+		2 * uint64(pollInterval) / uint64(time.Second)
+	size = max(size, uint64(os.Getpagesize()))
+	size = min(uint64(1)<<bits.Len64(size-1), maxTraceRingbufSize)
+	return uint32(size)
+}
+
+// tailCallTargets returns the loader helpers of the tail call targets, that are enabled
+// according to includeTracers.
+func tailCallTargets(includeTracers types.IncludedTracers) []progLoaderHelper {
+	return []progLoaderHelper{
+		{
+			progID: uint32(support.ProgUnwindStop),
+			name:   "unwind_stop",
+			enable: true,
+		},
+		{
+			progID: uint32(support.ProgUnwindNative),
+			name:   "unwind_native",
+			enable: true,
+		},
+		{
+			progID: uint32(support.ProgUnwindHotspot),
+			name:   "unwind_hotspot",
+			enable: includeTracers.Has(types.HotspotTracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindPerl),
+			name:   "unwind_perl",
+			enable: includeTracers.Has(types.PerlTracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindPHP),
+			name:   "unwind_php",
+			enable: includeTracers.Has(types.PHPTracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindPython),
+			name:   "unwind_python",
+			enable: includeTracers.Has(types.PythonTracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindRuby),
+			name:   "unwind_ruby",
+			enable: includeTracers.Has(types.RubyTracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindV8),
+			name:   "unwind_v8",
+			enable: includeTracers.Has(types.V8Tracer),
+		},
+		{
+			progID: uint32(support.ProgUnwindDotnet),
+			name:   "unwind_dotnet",
+			enable: includeTracers.Has(types.DotnetTracer),
+		},
+		{
+			progID: uint32(support.ProgGoLabels),
+			name:   "go_labels",
+			enable: includeTracers.Has(types.Labels),
+		},
 	}
-	return size
 }
 
 // loadPerfUnwinders loads all perf eBPF Programs and their tail call targets.
 func loadPerfUnwinders(coll *cebpf.CollectionSpec, ebpfProgs map[string]*cebpf.Program,
 	tailcallMap *cebpf.Map, tailCallProgs []progLoaderHelper,
-	bpfVerifierLogLevel uint32) error {
+	bpfVerifierLogLevel uint32, followChildren bool, perfEvents []types.PerfEvent) error {
 	programOptions := cebpf.ProgramOptions{
 		LogLevel: cebpf.LogLevel(bpfVerifierLogLevel),
 	}
 
-	progs := make([]progLoaderHelper, len(tailCallProgs)+2)
+	progs := make([]progLoaderHelper, len(tailCallProgs)+3)
 	copy(progs, tailCallProgs)
 	progs = append(progs,
 		progLoaderHelper{
@@ -512,11 +823,17 @@ func loadPerfUnwinders(coll *cebpf.CollectionSpec, ebpfProgs map[string]*cebpf.P
 			noTailCallTarget: true,
 			enable:           true,
 		},
+		progLoaderHelper{
+			name:             "tracepoint__task_newtask",
+			noTailCallTarget: true,
+			enable:           followChildren,
+		},
 		progLoaderHelper{
 			name:             "native_tracer_entry",
 			noTailCallTarget: true,
 			enable:           true,
 		})
+	progs = append(progs, perfEventProgs(perfEvents)...)
 
 	for _, unwindProg := range progs {
 		if !unwindProg.enable {
@@ -567,25 +884,44 @@ func progArrayReferences(perfTailCallMapFD int, insns asm.Instructions) []int {
 // specification of these programs to kprobe eBPF programs and adjusts tail call maps.
 func loadKProbeUnwinders(coll *cebpf.CollectionSpec, ebpfProgs map[string]*cebpf.Program,
 	tailcallMap *cebpf.Map, tailCallProgs []progLoaderHelper,
-	bpfVerifierLogLevel uint32, perfTailCallMapFD int) error {
+	bpfVerifierLogLevel uint32, perfTailCallMapFD int,
+	offCPU, wakeups, uprobes, alloc, contention, runQueue bool) error {
 	programOptions := cebpf.ProgramOptions{
 		LogLevel: cebpf.LogLevel(bpfVerifierLogLevel),
 	}
 
-	progs := make([]progLoaderHelper, len(tailCallProgs)+2)
+	progs := make([]progLoaderHelper, len(tailCallProgs)+3)
 	copy(progs, tailCallProgs)
 	progs = append(progs,
 		progLoaderHelper{
 			name:             "finish_task_switch",
 			noTailCallTarget: true,
-			enable:           true,
+			enable:           offCPU,
 		},
 		progLoaderHelper{
 			name:             "tracepoint__sched_switch",
 			noTailCallTarget: true,
-			enable:           true,
+			enable:           offCPU,
+		},
+		progLoaderHelper{
+			name:             "tracepoint__sched_waking",
+			noTailCallTarget: true,
+			enable:           wakeups,
+		},
+		progLoaderHelper{
+			name:             "kretprobe__try_to_wake_up",
+			noTailCallTarget: true,
+			enable:           wakeups,
+		},
+		progLoaderHelper{
+			name:             "uprobe__generic",
+			noTailCallTarget: true,
+			enable:           uprobes,
 		},
 	)
+	progs = append(progs, allocProgs(alloc)...)
+	progs = append(progs, contentionProgs(contention)...)
+	progs = append(progs, runQueueProgs(runQueue)...)
 
 	for _, unwindProg := range progs {
 		if !unwindProg.enable {
@@ -665,9 +1001,10 @@ func loadProgram(ebpfProgs map[string]*cebpf.Program, tailcallMap *cebpf.Map,
 
 // insertKernelFrames fetches the kernel stack frames for a particular kstackID and populates
 // the trace with these kernel frames. It also allocates the memory for the frames of the trace.
+// If waitChannel is set, the wait channel of the trace is determined from the kernel frames.
 // It returns the number of kernel frames for kstackID or an error.
 func (t *Tracer) insertKernelFrames(trace *host.Trace, ustackLen uint32,
-	kstackID int32) (uint32, error) {
+	kstackID int32, waitChannel bool) (uint32, error) {
 	cKstackID := kstackID
 	kstackVal := make([]uint64, support.PerfMaxStackDepth)
 
@@ -740,9 +1077,45 @@ func (t *Tracer) insertKernelFrames(trace *host.Trace, ustackLen uint32,
 	t.fallbackSymbolMiss.Add(kernelSymbolCacheMiss)
 	t.fallbackSymbolHit.Add(kernelSymbolCacheHit)
 
+	if waitChannel {
+		trace.WaitChannel = t.waitChannel(kstackVal[:kstackLen])
+	}
+
 	return kstackLen, nil
 }
 
+// waitChannel returns the name of the kernel function that called into the scheduler
+// in kstack, which is the wait channel of a blocked task as reported by the kernel in
+// /proc/PID/wchan. Frames before the scheduler functions, e.g. of the hook that
+// collected kstack, are skipped. It returns an empty string if the wait channel can
+// not be determined.
+func (t *Tracer) waitChannel(kstack []uint64) string {
+	if t.schedTextEnd == 0 {
+		return ""
+	}
+	inScheduler := false
+	for _, pc := range kstack {
+		address := libpf.Address(pc)
+		if address >= t.schedTextStart && address < t.schedTextEnd {
+			inScheduler = true
+			continue
+		}
+		if !inScheduler {
+			continue
+		}
+		kmod, err := t.kernelSymbolizer.GetModuleByAddress(address)
+		if err != nil {
+			return ""
+		}
+		funcName, _, err := kmod.LookupSymbolByAddress(address)
+		if err != nil {
+			return ""
+		}
+		return funcName
+	}
+	return ""
+}
+
 // enableEvent removes the entry of given eventType from the inhibitEvents map
 // so that the eBPF code will send the event again.
 func (t *Tracer) enableEvent(eventType int) {
@@ -875,7 +1248,7 @@ func (t *Tracer) eBPFMetricsCollector(
 //
 // If the raw trace contains a kernel stack ID, the kernel stack is also
 // retrieved and inserted at the appropriate position.
-func (t *Tracer) loadBpfTrace(raw []byte, cpu int) *host.Trace {
+func (t *Tracer) loadBpfTrace(raw []byte) *host.Trace {
 	frameListOffs := int(unsafe.Offsetof(support.Trace{}.Frames))
 
 	if len(raw) < frameListOffs {
@@ -896,6 +1269,7 @@ func (t *Tracer) loadBpfTrace(raw []byte, cpu int) *host.Trace {
 		Comm:             goString(ptr.Comm[:]),
 		ExecutablePath:   procMeta.Executable,
 		ContainerID:      procMeta.ContainerID,
+		CgroupPath:       procMeta.CgroupPath,
 		ProcessName:      procMeta.Name,
 		APMTraceID:       *(*libpf.APMTraceID)(unsafe.Pointer(&ptr.Apm_trace_id)),
 		APMTransactionID: *(*libpf.APMTransactionID)(unsafe.Pointer(&ptr.Apm_transaction_id)),
@@ -903,32 +1277,58 @@ func (t *Tracer) loadBpfTrace(raw []byte, cpu int) *host.Trace {
 		TID:              libpf.PID(ptr.Tid),
 		Origin:           libpf.Origin(ptr.Origin),
 		OffTime:          int64(ptr.Offtime),
+		Addr:             ptr.Addr,
 		KTime:            times.KTime(ptr.Ktime),
-		CPU:              cpu,
+		CPU:              int(ptr.Cpu),
 		EnvVars:          procMeta.EnvVariables,
 	}
 
-	if trace.Origin != support.TraceOriginSampling && trace.Origin != support.TraceOriginOffCPU {
+	if _, isPerfEvent := perfEventSources[trace.Origin]; !isPerfEvent &&
+		trace.Origin != support.TraceOriginSampling && trace.Origin != support.TraceOriginOffCPU &&
+		trace.Origin != support.TraceOriginUprobe && trace.Origin != support.TraceOriginAlloc &&
+		trace.Origin != support.TraceOriginContention &&
+		trace.Origin != support.TraceOriginRunQueue && trace.Origin != support.TraceOriginWakeup {
 		log.Warnf("Skip handling trace from unexpected %d origin", trace.Origin)
 		return nil
 	}
 
+	if trace.Origin == support.TraceOriginSampling && t.sampling != nil {
+		// The sampling period varies with adaptive sampling, so it is stored with the
+		// trace to weight it correctly.
+		trace.OffTime = t.sampling.periodAt(trace.KTime)
+	}
+
+	taskState := types.TaskState(ptr.Task_state)
+	if trace.Origin == support.TraceOriginOffCPU {
+		trace.TaskState = taskState.String()
+		if ptr.Waker.Tid != 0 {
+			trace.WakerPID = libpf.PID(ptr.Waker.Pid)
+			trace.WakerTID = libpf.PID(ptr.Waker.Tid)
+			trace.WakerKTime = times.KTime(ptr.Waker.Ktime)
+		}
+	}
+
 	// Trace fields included in the hash:
 	//  - PID, kernel stack ID, length & frame array
 	// Intentionally excluded:
-	//  - ktime, COMM, APM trace, APM transaction ID, Origin and Off Time
+	//  - ktime, COMM, APM trace, APM transaction ID, Origin, Off Time, Addr, Task State,
+	//    Waker and CPU
 	ptr.Comm = [16]byte{}
 	ptr.Apm_trace_id = support.ApmTraceID{}
 	ptr.Apm_transaction_id = support.ApmSpanID{}
 	ptr.Ktime = 0
 	ptr.Origin = 0
 	ptr.Offtime = 0
+	ptr.Addr = 0
+	ptr.Task_state = 0
+	ptr.Waker = support.Waker{}
+	ptr.Cpu = 0
 	trace.Hash = host.TraceHash(xxh3.Hash128(raw).Lo)
 
 	userFrameOffs := 0
 	if ptr.Kernel_stack_id >= 0 {
-		kstackLen, err := t.insertKernelFrames(
-			trace, ptr.Stack_len, ptr.Kernel_stack_id)
+		kstackLen, err := t.insertKernelFrames(trace, ptr.Stack_len, ptr.Kernel_stack_id,
+			trace.Origin == support.TraceOriginOffCPU && taskState.Blocked())
 
 		if err != nil {
 			log.Errorf("Failed to get kernel stack frames for 0x%x: %v", trace.Hash, err)
@@ -998,9 +1398,14 @@ func (t *Tracer) StartMapMonitors(ctx context.Context, traceOutChan chan<- *host
 	previousMetricValue := make([]metrics.MetricValue, len(translateIDs))
 
 	periodiccaller.Start(ctx, t.intervals.MonitorInterval(), func() {
+		traceEventMetrics := traceEventMetricCollector()
+		ebpfMetrics := t.eBPFMetricsCollector(translateIDs, previousMetricValue)
 		metrics.AddSlice(eventMetricCollector())
-		metrics.AddSlice(traceEventMetricCollector())
-		metrics.AddSlice(t.eBPFMetricsCollector(translateIDs, previousMetricValue))
+		metrics.AddSlice(traceEventMetrics)
+		metrics.AddSlice(ebpfMetrics)
+		if t.sampling != nil {
+			t.adaptSampling(traceEventMetrics, ebpfMetrics)
+		}
 
 		metrics.AddSlice([]metrics.Metric{
 			{
@@ -1019,7 +1424,8 @@ func (t *Tracer) StartMapMonitors(ctx context.Context, traceOutChan chan<- *host
 
 // AttachTracer attaches the main tracer entry point to the perf interrupt events. The tracer
 // entry point is always the native tracer. The native tracer will determine when to invoke the
-// interpreter tracers based on address range information.
+// interpreter tracers based on address range information. The configured additional perf
+// events are attached to their own entry points.
 func (t *Tracer) AttachTracer() error {
 	tracerProg, ok := t.ebpfProgs["native_tracer_entry"]
 	if !ok {
@@ -1049,6 +1455,15 @@ func (t *Tracer) AttachTracer() error {
 		}
 		*events = append(*events, perfEvent)
 	}
+	t.numSamplingEvents = len(*events)
+
+	for _, event := range t.perfEvents {
+		perfEvents, err := t.attachPerfEvent(event, onlineCPUIDs)
+		if err != nil {
+			return err
+		}
+		*events = append(*events, perfEvents...)
+	}
 	return nil
 }
 
@@ -1064,6 +1479,7 @@ func (t *Tracer) EnableProfiling() error {
 			return fmt.Errorf("failed to enable perf event on CPU %d: %v", id, err)
 		}
 	}
+	t.profiling.Store(true)
 	return nil
 }
 
@@ -1083,12 +1499,40 @@ func (t *Tracer) probabilisticProfile(interval time.Duration, threshold uint) {
 	} else {
 		log.Debugf("Stop sampling for next interval (%v)", interval)
 	}
+	t.probabilisticDisabled.Store(!enableSampling)
+	t.updatePerfEvents()
+	metrics.Add(metrics.IDProbProfilingStatus,
+		metrics.MetricValue(probProfilingStatus))
+}
+
+// profilingEnabled returns whether the perf events should be enabled. Pausing profiling
+// takes precedence over everything else, followed by the holds of HoldProfiling, the
+// profiling mode and finally probabilistic profiling.
+func (t *Tracer) profilingEnabled() bool {
+	if t.paused.Load() {
+		return false
+	}
+	if t.profilingHolds.Load() > 0 {
+		return true
+	}
+	switch ProfilingMode(t.profilingMode.Load()) {
+	case ProfilingOn:
+		return true
+	case ProfilingOff:
+		return false
+	}
+	return !t.probabilisticDisabled.Load()
+}
 
+// updatePerfEvents enables or disables the perf events with the attached eBPF
+// programs according to profilingEnabled.
+func (t *Tracer) updatePerfEvents() {
 	events := t.perfEntrypoints.WLock()
 	defer t.perfEntrypoints.WUnlock(&events)
+	enable := t.profilingEnabled()
 	var enableErr, disableErr metrics.MetricValue
 	for _, event := range *events {
-		if enableSampling {
+		if enable {
 			if err := event.Enable(); err != nil {
 				enableErr++
 				log.Errorf("Failed to enable frequency based sampling: %v",
@@ -1107,27 +1551,90 @@ func (t *Tracer) probabilisticProfile(interval time.Duration, threshold uint) {
 	if disableErr != 0 {
 		metrics.Add(metrics.IDPerfEventDisableErr, disableErr)
 	}
-	metrics.Add(metrics.IDProbProfilingStatus,
-		metrics.MetricValue(probProfilingStatus))
+	t.profiling.Store(enable)
+}
+
+// PauseProfiling disables the perf events with the attached eBPF programs until it
+// is called again with pause set to false. Resuming leaves the perf events disabled
+// if the profiling mode or probabilistic profiling disabled them.
+func (t *Tracer) PauseProfiling(pause bool) {
+	if t.paused.Swap(pause) == pause {
+		return
+	}
+	t.updatePerfEvents()
+}
+
+// SetIncludedTracers switches the interpreter unwinders that were loaded on or off,
+// according to tracers. Switched off interpreter unwinders are replaced by
+// unwind_stop, so that traces end at the first frame of the interpreter, and the
+// process manager stops detecting their interpreters in new executables. Tracers
+// that were not included when the tracer was created can not be switched on.
+func (t *Tracer) SetIncludedTracers(tracers types.IncludedTracers) error {
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
+	loaded := tailCallTargets(t.includeTracers)
+	wanted := tailCallTargets(tracers)
+	for _, prefix := range []string{"perf_", "kprobe_"} {
+		tailcallMap := t.ebpfMaps[prefix+"progs"]
+		stopProg, ok := t.ebpfProgs[prefix+"unwind_stop"]
+		if !ok {
+			// The programs of this kind are not loaded.
+			continue
+		}
+		for i, prog := range loaded {
+			if !prog.enable {
+				continue
+			}
+			target := stopProg
+			if wanted[i].enable {
+				target = t.ebpfProgs[prefix+prog.name]
+			}
+			progID := prog.progID
+			fd := uint32(target.FD())
+			if err := tailcallMap.Update(unsafe.Pointer(&progID), unsafe.Pointer(&fd),
+				cebpf.UpdateAny); err != nil {
+				return fmt.Errorf("failed to update %s: %v", prefix+prog.name, err)
+			}
+		}
+	}
+	t.activeTracers = tracers & t.includeTracers
+	t.processManager.SetIncludedTracers(t.activeTracers)
+	return nil
 }
 
 // StartProbabilisticProfiling periodically runs probabilistic profiling.
 func (t *Tracer) StartProbabilisticProfiling(ctx context.Context) {
-	metrics.Add(metrics.IDProbProfilingInterval,
-		metrics.MetricValue(t.probabilisticInterval.Seconds()))
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+	t.startProbabilisticProfiling(ctx)
+}
+
+// startProbabilisticProfiling (re)starts probabilistic profiling with the current
+// interval and threshold. Caller must hold controlMu.
+func (t *Tracer) startProbabilisticProfiling(ctx context.Context) {
+	if t.stopProbabilistic != nil {
+		t.stopProbabilistic()
+	}
+	interval, threshold := t.probabilisticInterval, t.probabilisticThreshold
+	metrics.Add(metrics.IDProbProfilingInterval, metrics.MetricValue(interval.Seconds()))
 
 	// Run a single iteration of probabilistic profiling to avoid needing
 	// to wait for the first interval to pass with periodiccaller.Start()
 	// before getting called.
-	t.probabilisticProfile(t.probabilisticInterval, t.probabilisticThreshold)
+	t.probabilisticProfile(interval, threshold)
 
-	periodiccaller.Start(ctx, t.probabilisticInterval, func() {
-		t.probabilisticProfile(t.probabilisticInterval, t.probabilisticThreshold)
+	ctx, t.stopProbabilistic = context.WithCancel(ctx)
+	periodiccaller.Start(ctx, interval, func() {
+		t.probabilisticProfile(interval, threshold)
 	})
 }
 
 // StartOffCPUProfiling starts off-cpu profiling by attaching the programs to the hooks.
 func (t *Tracer) StartOffCPUProfiling() error {
+	t.controlMu.Lock()
+	defer t.controlMu.Unlock()
+
 	// Attach the second hook for off-cpu profiling first.
 	kprobeProg, ok := t.ebpfProgs["finish_task_switch"]
 	if !ok {
@@ -1139,39 +1646,96 @@ func (t *Tracer) StartOffCPUProfiling() error {
 		return err
 	}
 
-	hookSymbolPrefix := "finish_task_switch"
+	// The scheduler functions are used to determine the wait channel of blocked tasks.
+	schedTextStart, startErr := kmod.LookupSymbol("__sched_text_start")
+	schedTextEnd, endErr := kmod.LookupSymbol("__sched_text_end")
+	if startErr == nil && endErr == nil {
+		t.schedTextStart, t.schedTextEnd = schedTextStart, schedTextEnd
+	} else {
+		log.Warnf("Failed to find scheduler functions, wait channels are not reported")
+	}
+
+	if err = t.attachFinishTaskSwitch("kprobe", kprobeProg); err != nil {
+		return err
+	}
+	t.offCPUStarted = true
+
+	// Attach the first hook that enables off-cpu profiling.
+	tpProg, ok := t.ebpfProgs["tracepoint__sched_switch"]
+	if !ok {
+		return errors.New("tracepoint__sched_switch is not available")
+	}
+	tpLink, err := link.Tracepoint("sched", "sched_switch", tpProg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach to tracepoint sched_switch: %v", err)
+	}
+	t.hooks[schedSwitchHook] = tpLink
+
+	if t.offCPUWakeups {
+		return t.attachWakeups()
+	}
+	return nil
+}
+
+// attachWakeups attaches the programs that collect the traces of the threads that wake
+// up the tasks of off-cpu traces. Caller must hold controlMu.
+func (t *Tracer) attachWakeups() error {
+	kretprobeProg, ok := t.ebpfProgs["kretprobe__try_to_wake_up"]
+	if !ok {
+		return errors.New("off-cpu program kretprobe__try_to_wake_up is not available")
+	}
+	tpProg, ok := t.ebpfProgs["tracepoint__sched_waking"]
+	if !ok {
+		return errors.New("off-cpu program tracepoint__sched_waking is not available")
+	}
+
+	// Attach the return hook first, so that no recorded wakeup misses its trace.
+	kretprobeLink, err := link.Kretprobe("try_to_wake_up", kretprobeProg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach kretprobe to try_to_wake_up: %v", err)
+	}
+	t.hooks[wakeupHooks[1]] = kretprobeLink
+
+	tpLink, err := link.Tracepoint("sched", "sched_waking", tpProg, nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach to tracepoint sched_waking: %v", err)
+	}
+	t.hooks[wakeupHooks[0]] = tpLink
+	return nil
+}
+
+// hookSymbolPrefix is the prefix of the symbols of finish_task_switch, which the
+// compiler can rename, e.g. to finish_task_switch.isra.0.
+const hookSymbolPrefix = "finish_task_switch"
+
+// attachFinishTaskSwitch attaches prog to finish_task_switch, which is called right after
+// the scheduler switched a task onto the CPU. The hooks are tracked in group.
+func (t *Tracer) attachFinishTaskSwitch(group string, prog *cebpf.Program) error {
+	kmod, err := t.kernelSymbolizer.GetModuleByName(kallsyms.Kernel)
+	if err != nil {
+		return err
+	}
+
 	kprobeSymbs := kmod.LookupSymbolsByPrefix(hookSymbolPrefix)
 	if len(kprobeSymbs) == 0 {
-		return errors.New("no finish_task_switch symbols found")
+		return fmt.Errorf("no %s symbols found", hookSymbolPrefix)
 	}
 
 	attached := false
 	// Attach to all symbols with the prefix finish_task_switch.
 	for _, symb := range kprobeSymbs {
-		kprobeLink, linkErr := link.Kprobe(string(symb.Name), kprobeProg, nil)
+		kprobeLink, linkErr := link.Kprobe(string(symb.Name), prog, nil)
 		if linkErr != nil {
 			log.Warnf("Failed to attach to %s: %v", symb.Name, linkErr)
 			continue
 		}
 		attached = true
-		t.hooks[hookPoint{group: "kprobe", name: string(symb.Name)}] = kprobeLink
+		t.hooks[hookPoint{group: group, name: string(symb.Name)}] = kprobeLink
 	}
 	if !attached {
 		return fmt.Errorf("failed to attach to one of %d symbols with prefix '%s'",
 			len(kprobeSymbs), hookSymbolPrefix)
 	}
-
-	// Attach the first hook that enables off-cpu profiling.
-	tpProg, ok := t.ebpfProgs["tracepoint__sched_switch"]
-	if !ok {
-		return errors.New("tracepoint__sched_switch is not available")
-	}
-	tpLink, err := link.Tracepoint("sched", "sched_switch", tpProg, nil)
-	if err != nil {
-		return nil
-	}
-	t.hooks[hookPoint{group: "sched", name: "sched_switch"}] = tpLink
-
 	return nil
 }
 
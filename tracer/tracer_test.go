@@ -4,9 +4,87 @@
 // Package tracer contains functionality for populating tracers.
 package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
 
-import cebpf "github.com/cilium/ebpf"
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
 
 // Make accessible for testing
 func (t *Tracer) GetEbpfMaps() map[string]*cebpf.Map {
 	return t.ebpfMaps
 }
+
+func TestSchedTimesSize(t *testing.T) {
+	tests := map[string]struct {
+		possibleCPUs int
+		threshold    uint32
+		want         uint32
+	}{
+		"minimum":         {possibleCPUs: 1, threshold: 1, want: 16},
+		"maximum":         {possibleCPUs: 1, threshold: math.MaxUint32, want: 4096},
+		"half":            {possibleCPUs: 1, threshold: math.MaxUint32 / 2, want: 2047},
+		"scaled by CPUs":  {possibleCPUs: 8, threshold: math.MaxUint32, want: 8 * 4096},
+		"minimum per CPU": {possibleCPUs: 8, threshold: 1, want: 8 * 16},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, schedTimesSize(tc.possibleCPUs, tc.threshold))
+		})
+	}
+}
+
+func TestTraceRingbufSize(t *testing.T) {
+	pageSize := uint32(os.Getpagesize())
+	traceSize := uint32(support.Sizeof_Trace)
+
+	// Small configurations use a single page.
+	assert.Equal(t, pageSize, traceRingbufSize(1, 1, time.Millisecond))
+
+	// Sizes are rounded up to the next power of two.
+	for _, tc := range []struct {
+		possibleCPUs, samplesPerSecond int
+		pollInterval                   time.Duration
+	}{
+		{possibleCPUs: 1, samplesPerSecond: 20, pollInterval: 250 * time.Millisecond},
+		{possibleCPUs: 3, samplesPerSecond: 20, pollInterval: 250 * time.Millisecond},
+		{possibleCPUs: 64, samplesPerSecond: 19, pollInterval: 250 * time.Millisecond},
+		{possibleCPUs: 7, samplesPerSecond: 1000, pollInterval: time.Second},
+	} {
+		size := traceRingbufSize(tc.possibleCPUs, tc.samplesPerSecond, tc.pollInterval)
+		needed := uint64(tc.possibleCPUs) * uint64(tc.samplesPerSecond) *
+			uint64(traceSize) * 2 * uint64(tc.pollInterval) / uint64(time.Second)
+		assert.Zero(t, size&(size-1), "size %d is not a power of two", size)
+		assert.Zero(t, size%pageSize, "size %d is not a multiple of the page size", size)
+		assert.GreaterOrEqual(t, uint64(size), needed)
+		assert.Less(t, uint64(size)/2, max(needed, uint64(pageSize)))
+	}
+
+	// The size is bounded.
+	assert.Equal(t, uint32(maxTraceRingbufSize),
+		traceRingbufSize(4096, 20000, 10*time.Second))
+}
+
+func TestRequireMaps(t *testing.T) {
+	cfg := &Config{}
+	ebpfMaps := map[string]*cebpf.Map{}
+	for _, name := range requiredMaps(cfg, false) {
+		ebpfMaps[name] = nil
+	}
+	assert.NoError(t, requireMaps(ebpfMaps, requiredMaps(cfg, false)...))
+	assert.ErrorContains(t, requireMaps(ebpfMaps, requiredMaps(cfg, true)...),
+		"eBPF map trace_events_ringbuf not found")
+	assert.ErrorContains(t, requireMaps(ebpfMaps, requiredMaps(&Config{TargetPID: 1},
+		false)...), "eBPF map target_pids not found")
+	assert.ErrorContains(t, requireMaps(ebpfMaps, requiredMaps(&Config{
+		AllocSampleInterval: 1, AllocInUse: true}, false)...), "eBPF map alloc_in_use not found")
+
+	assert.ErrorContains(t, setVariable(&cebpf.CollectionSpec{}, "with_ringbuf",
+		uint32(1)), "eBPF variable with_ringbuf not found")
+}
@@ -0,0 +1,31 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types // import "go.opentelemetry.io/ebpf-profiler/tracer/types"
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ParseAllocLibraries parses a comma-delimited list of allocator libraries whose
+// allocation functions are hooked for allocation profiling, e.g.
+// /usr/lib/x86_64-linux-gnu/libc.so.6,/usr/lib/libjemalloc.so.2. Each library must
+// be given by its absolute path.
+func ParseAllocLibraries(libraries string) ([]string, error) {
+	var result []string
+
+	for _, library := range strings.Split(libraries, ",") {
+		library = strings.TrimSpace(library)
+		if library == "" {
+			continue
+		}
+		if !filepath.IsAbs(library) {
+			return nil, fmt.Errorf("invalid allocator library %s: not an absolute path",
+				library)
+		}
+		result = append(result, filepath.Clean(library))
+	}
+	return result, nil
+}
@@ -0,0 +1,37 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllocLibraries(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		"empty": {},
+		"multiple": {
+			in:   " /usr/lib/libc.so.6, /usr/lib/../lib/libjemalloc.so.2,",
+			want: []string{"/usr/lib/libc.so.6", "/usr/lib/libjemalloc.so.2"},
+		},
+		"relative library": {in: "libc.so.6", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			libraries, err := ParseAllocLibraries(tc.in)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, libraries)
+		})
+	}
+}
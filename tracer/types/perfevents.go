@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types // import "go.opentelemetry.io/ebpf-profiler/tracer/types"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// PerfEvent selects a perf event, in addition to the CPU clock, whose samples
+// trigger stack unwinding.
+type PerfEvent struct {
+	// Name is the name of the event as listed by perf list, e.g. page-faults.
+	Name string
+	// Origin is the origin of the traces collected for the event.
+	Origin libpf.Origin
+	// Period samples every Period-th event. It is ignored if Frequency is set.
+	Period uint64
+	// Frequency is the number of samples per second the kernel adjusts the
+	// sample period to.
+	Frequency uint64
+}
+
+// perfEventInfo describes a supported perf event.
+type perfEventInfo struct {
+	origin libpf.Origin
+	// defaultPeriod is the sample period used if neither period nor frequency are given.
+	defaultPeriod uint64
+}
+
+var perfEventNameToInfo = map[string]perfEventInfo{
+	"page-faults":      {origin: support.TraceOriginPageFaults, defaultPeriod: 1000},
+	"context-switches": {origin: support.TraceOriginContextSwitches, defaultPeriod: 100},
+	"cache-misses":     {origin: support.TraceOriginCacheMisses, defaultPeriod: 10000},
+	"branch-misses":    {origin: support.TraceOriginBranchMisses, defaultPeriod: 10000},
+}
+
+var perfEventOriginToName = make(map[libpf.Origin]string, len(perfEventNameToInfo))
+
+func init() {
+	for name, info := range perfEventNameToInfo {
+		perfEventOriginToName[info.origin] = name
+	}
+}
+
+// PerfEventName returns the name of the perf event that produces traces of origin.
+// It returns false if origin does not belong to a perf event selectable by ParsePerfEvents.
+func PerfEventName(origin libpf.Origin) (string, bool) {
+	name, ok := perfEventOriginToName[origin]
+	return name, ok
+}
+
+// ParsePerfEvents parses a comma-delimited list of perf events. Each element is the
+// name of an event, optionally followed by :period=N to sample every N-th event or
+// by :freq=N to sample N times per second, e.g. page-faults:period=100,cache-misses.
+func ParsePerfEvents(events string) ([]PerfEvent, error) {
+	var result []PerfEvent
+	seen := make(libpf.Set[libpf.Origin])
+
+	for _, elem := range strings.Split(events, ",") {
+		elem = strings.ToLower(strings.TrimSpace(elem))
+		if elem == "" {
+			continue
+		}
+
+		name, sample, hasSample := strings.Cut(elem, ":")
+		info, ok := perfEventNameToInfo[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown perf event: %s", name)
+		}
+		if _, ok := seen[info.origin]; ok {
+			return nil, fmt.Errorf("duplicate perf event: %s", name)
+		}
+		seen[info.origin] = libpf.Void{}
+
+		event := PerfEvent{
+			Name:   name,
+			Origin: info.origin,
+			Period: info.defaultPeriod,
+		}
+		if hasSample {
+			key, value, _ := strings.Cut(sample, "=")
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid sample %s of perf event %s", sample, name)
+			}
+			switch key {
+			case "period":
+				event.Period = n
+			case "freq":
+				event.Frequency = n
+			default:
+				return nil, fmt.Errorf("invalid sample %s of perf event %s", sample, name)
+			}
+		}
+		result = append(result, event)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,63 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+func TestParsePerfEvents(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    []PerfEvent
+		wantErr bool
+	}{
+		"empty": {},
+		"default period": {
+			in: "page-faults",
+			want: []PerfEvent{
+				{Name: "page-faults", Origin: support.TraceOriginPageFaults, Period: 1000},
+			},
+		},
+		"period and frequency": {
+			in: " Context-Switches:period=10, cache-misses:freq=99,",
+			want: []PerfEvent{
+				{Name: "context-switches", Origin: support.TraceOriginContextSwitches,
+					Period: 10},
+				{Name: "cache-misses", Origin: support.TraceOriginCacheMisses,
+					Period: 10000, Frequency: 99},
+			},
+		},
+		"unknown event":   {in: "cpu-cycles", wantErr: true},
+		"duplicate event": {in: "branch-misses,branch-misses:freq=1", wantErr: true},
+		"zero period":     {in: "page-faults:period=0", wantErr: true},
+		"invalid value":   {in: "page-faults:freq=x", wantErr: true},
+		"invalid key":     {in: "page-faults:count=1", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			events, err := ParsePerfEvents(tc.in)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, events)
+		})
+	}
+}
+
+func TestPerfEventName(t *testing.T) {
+	name, ok := PerfEventName(support.TraceOriginBranchMisses)
+	require.True(t, ok)
+	require.Equal(t, "branch-misses", name)
+
+	_, ok = PerfEventName(support.TraceOriginSampling)
+	require.False(t, ok)
+}
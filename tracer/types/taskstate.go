@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types // import "go.opentelemetry.io/ebpf-profiler/tracer/types"
+
+import "fmt"
+
+// TaskState is the state of a task when it was switched off the CPU, as reported in
+// the prev_state field of the sched_switch tracepoint since Linux 4.14.
+type TaskState uint32
+
+const (
+	// TaskStateRunning is reported for tasks that gave up the CPU while runnable,
+	// e.g. by calling sched_yield.
+	TaskStateRunning TaskState = 0
+	// TaskStateInterruptible is reported for tasks that sleep until an event occurs
+	// or a signal is delivered, e.g. while waiting for a lock or on a socket.
+	TaskStateInterruptible TaskState = 0x1
+	// TaskStateUninterruptible is reported for tasks that sleep until an event occurs,
+	// usually while waiting for disk I/O.
+	TaskStateUninterruptible TaskState = 0x2
+	// TaskStatePreempted is reported for tasks that were preempted while runnable.
+	TaskStatePreempted TaskState = 0x100
+)
+
+// taskStateNames maps the task states to their names. Besides the states above,
+// the kernel reports at most one of the remaining bits.
+var taskStateNames = map[TaskState]string{
+	TaskStateRunning:         "running",
+	TaskStateInterruptible:   "interruptible",
+	TaskStateUninterruptible: "uninterruptible",
+	0x4:                      "stopped",
+	0x8:                      "traced",
+	0x10:                     "dead",
+	0x20:                     "zombie",
+	0x40:                     "parked",
+	0x80:                     "idle",
+	TaskStatePreempted:       "preempted",
+}
+
+// String returns the name of the task state.
+func (s TaskState) String() string {
+	if name, ok := taskStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", uint32(s))
+}
+
+// Blocked returns true if the task waited for an event, and false if it was runnable
+// and only waited for a CPU.
+func (s TaskState) Blocked() bool {
+	return s != TaskStateRunning && s != TaskStatePreempted
+}
@@ -0,0 +1,32 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskState(t *testing.T) {
+	tests := map[string]struct {
+		state       TaskState
+		wantName    string
+		wantBlocked bool
+	}{
+		"running":         {state: TaskStateRunning, wantName: "running"},
+		"preempted":       {state: TaskStatePreempted, wantName: "preempted"},
+		"interruptible":   {state: 0x1, wantName: "interruptible", wantBlocked: true},
+		"uninterruptible": {state: 0x2, wantName: "uninterruptible", wantBlocked: true},
+		"idle":            {state: 0x80, wantName: "idle", wantBlocked: true},
+		"unknown":         {state: 0x3, wantName: "0x3", wantBlocked: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.wantName, tc.state.String())
+			assert.Equal(t, tc.wantBlocked, tc.state.Blocked())
+		})
+	}
+}
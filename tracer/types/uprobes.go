@@ -0,0 +1,75 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types // import "go.opentelemetry.io/ebpf-profiler/tracer/types"
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// defaultUprobeRate is the default maximum number of traces per second of an uprobe.
+const defaultUprobeRate = 100
+
+// Uprobe selects a function whose calls trigger stack unwinding.
+type Uprobe struct {
+	// Binary is the absolute path of the executable or shared library.
+	Binary string
+	// Symbol is the name of the function in the dynamic symbol table of Binary.
+	Symbol string
+	// MaxTracesPerSecond limits the number of traces collected for the uprobe.
+	// Calls exceeding the limit are accounted for in the next trace. Zero disables
+	// the limit.
+	MaxTracesPerSecond uint32
+}
+
+// String returns the uprobe in the format accepted by ParseUprobes.
+func (u Uprobe) String() string {
+	return fmt.Sprintf("%s:%s:%d", u.Binary, u.Symbol, u.MaxTracesPerSecond)
+}
+
+// ParseUprobes parses a comma-delimited list of uprobes. Each element has the format
+// binary:symbol, optionally followed by :N to collect at most N traces per second,
+// e.g. /usr/lib/libc.so.6:malloc:50. N defaults to 100, 0 disables the limit.
+func ParseUprobes(uprobes string) ([]Uprobe, error) {
+	var result []Uprobe
+
+	for _, elem := range strings.Split(uprobes, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		fields := strings.Split(elem, ":")
+		if len(fields) < 2 || len(fields) > 3 || fields[1] == "" {
+			return nil, fmt.Errorf("invalid uprobe %s: expected binary:symbol[:rate]", elem)
+		}
+		if !filepath.IsAbs(fields[0]) {
+			return nil, fmt.Errorf("invalid uprobe %s: binary is not an absolute path", elem)
+		}
+
+		uprobe := Uprobe{
+			Binary:             fields[0],
+			Symbol:             fields[1],
+			MaxTracesPerSecond: defaultUprobeRate,
+		}
+		if len(fields) == 3 {
+			rate, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate of uprobe %s: %v", elem, err)
+			}
+			uprobe.MaxTracesPerSecond = uint32(rate)
+		}
+		result = append(result, uprobe)
+	}
+
+	if len(result) > support.MaxUprobes {
+		return nil, fmt.Errorf("too many uprobes: %d (max: %d)", len(result),
+			support.MaxUprobes)
+	}
+	return result, nil
+}
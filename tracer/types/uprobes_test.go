@@ -0,0 +1,52 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUprobes(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    []Uprobe
+		wantErr bool
+	}{
+		"empty": {},
+		"default rate": {
+			in: "/usr/lib/libc.so.6:malloc",
+			want: []Uprobe{
+				{Binary: "/usr/lib/libc.so.6", Symbol: "malloc", MaxTracesPerSecond: 100},
+			},
+		},
+		"multiple": {
+			in: "/usr/lib/libc.so.6:malloc:5, /usr/bin/app:main:0,",
+			want: []Uprobe{
+				{Binary: "/usr/lib/libc.so.6", Symbol: "malloc", MaxTracesPerSecond: 5},
+				{Binary: "/usr/bin/app", Symbol: "main"},
+			},
+		},
+		"missing symbol":   {in: "/usr/bin/app", wantErr: true},
+		"empty symbol":     {in: "/usr/bin/app:", wantErr: true},
+		"relative binary":  {in: "app:main", wantErr: true},
+		"invalid rate":     {in: "/usr/bin/app:main:fast", wantErr: true},
+		"too many fields":  {in: "/usr/bin/app:main:1:2", wantErr: true},
+		"too many uprobes": {in: strings.Repeat("/usr/bin/app:main,", 65), wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			uprobes, err := ParseUprobes(tc.in)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, uprobes)
+		})
+	}
+}
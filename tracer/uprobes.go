@@ -0,0 +1,94 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracer // import "go.opentelemetry.io/ebpf-profiler/tracer"
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+
+	"go.opentelemetry.io/ebpf-profiler/libpf"
+	"go.opentelemetry.io/ebpf-profiler/libpf/pfelf"
+	"go.opentelemetry.io/ebpf-profiler/support"
+)
+
+// AttachUprobes attaches the uprobe entry point to the configured uprobes. The index
+// of an uprobe is passed as attach cookie to the eBPF program, which uses it to look
+// up the rate limiting state of the uprobe.
+func (t *Tracer) AttachUprobes() error {
+	if len(t.uprobes) == 0 {
+		return nil
+	}
+	prog, ok := t.ebpfProgs["uprobe__generic"]
+	if !ok {
+		return errors.New("uprobe program uprobe__generic is not available")
+	}
+
+	uprobeStates, ok := t.ebpfMaps["uprobe_states"]
+	if !ok {
+		return errors.New("uprobe map uprobe_states is not available")
+	}
+	for i, uprobe := range t.uprobes {
+		offset, err := binaryOffset(uprobe.Binary, uprobe.Symbol)
+		if err != nil {
+			return fmt.Errorf("failed to resolve uprobe %s: %v", uprobe, err)
+		}
+
+		state := support.UprobeState{Max_traces: uprobe.MaxTracesPerSecond}
+		if err = uprobeStates.Update(uint32(i), &state, cebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to set state of uprobe %s: %v", uprobe, err)
+		}
+
+		executable, err := link.OpenExecutable(uprobe.Binary)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", uprobe.Binary, err)
+		}
+		uprobeLink, err := executable.Uprobe(uprobe.Symbol, prog, &link.UprobeOptions{
+			Address: offset,
+			Cookie:  uint64(i),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to attach uprobe %s: %v", uprobe, err)
+		}
+		t.hooks[hookPoint{group: "uprobe", name: uprobe.Binary + ":" + uprobe.Symbol}] =
+			uprobeLink
+		log.Debugf("Attached uprobe %s at offset 0x%x", uprobe, offset)
+	}
+	return nil
+}
+
+// binaryOffset returns the file offset of symbol in binary.
+func binaryOffset(binary, symbol string) (uint64, error) {
+	ef, err := pfelf.Open(binary)
+	if err != nil {
+		return 0, err
+	}
+	defer ef.Close()
+
+	return symbolOffset(ef, symbol)
+}
+
+// symbolOffset returns the file offset of symbol in ef.
+func symbolOffset(ef *pfelf.File, symbol string) (uint64, error) {
+	sym, err := ef.LookupSymbol(libpf.SymbolName(symbol))
+	if err != nil {
+		return 0, err
+	}
+
+	addr := uint64(sym.Address)
+	for i := range ef.Progs {
+		prog := &ef.Progs[i]
+		if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_X == 0 {
+			continue
+		}
+		if addr >= prog.Vaddr && addr < prog.Vaddr+prog.Filesz {
+			return addr - prog.Vaddr + prog.Off, nil
+		}
+	}
+	return 0, fmt.Errorf("symbol %s at 0x%x is not in an executable segment", symbol, addr)
+}